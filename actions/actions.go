@@ -0,0 +1,389 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/filecopy"
+	"github.com/gromey/octopus/hold"
+	"github.com/gromey/octopus/trash"
+)
+
+// Kind represents the kind of an operation.
+type Kind string
+
+const (
+	Copy   Kind = "copy"   // Copy a file to the target, replacing it safely if it exists, see filecopy.File.
+	Move   Kind = "move"   // Move a file or directory to another location, possibly on another device.
+	Rename Kind = "rename" // Rename a file or directory within its filesystem, refusing to copy it across devices.
+	Link   Kind = "link"   // Replace a file with a link to the target, a file with the same content.
+	Delete Kind = "delete" // Delete a file or an empty directory; a path that no longer exists is not an error.
+)
+
+// Link methods.
+const (
+	Hardlink = "hardlink" // Hard link to the target, the default.
+	Reflink  = "reflink"  // Copy-on-write clone of the target, see filecopy.Clone.
+)
+
+// Op represents a single filesystem operation.
+type Op struct {
+	Kind      Kind   `json:"kind"`                // Kind of the operation.
+	Src       string `json:"src"`                 // Path the operation applies to.
+	Dst       string `json:"dst,omitempty"`       // Target path of the operation, if any.
+	Size      int64  `json:"size,omitempty"`      // Number of bytes affected, for reporting and rate limiting.
+	Reason    string `json:"reason,omitempty"`    // Why the operation is planned.
+	Method    string `json:"method,omitempty"`    // Method of a link operation, Hardlink if empty.
+	Recursive bool   `json:"recursive,omitempty"` // Whether a delete operation removes a directory with its content.
+}
+
+// Plan represents an ordered list of operations that can be reviewed, serialized and executed later.
+// The mutating subsystems return their work as plans, for review before it is executed: see dirsync.Plan,
+// dedupe.Plan.Ops, retention.DirsPlan and tiering.Report.Plan.
+type Plan struct {
+	Ops []Op `json:"ops"`
+}
+
+// Add appends an operation to the plan.
+func (p *Plan) Add(op Op) {
+	p.Ops = append(p.Ops, op)
+}
+
+// Bytes returns the total number of bytes affected by the plan.
+func (p *Plan) Bytes() int64 {
+	var n int64
+	for _, op := range p.Ops {
+		n += op.Size
+	}
+	return n
+}
+
+// Write writes the plan as JSON, so it can be reviewed and executed later with Read and Execute.
+func (p *Plan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Read reads a plan written by Write.
+func Read(r io.Reader) (*Plan, error) {
+	p := new(Plan)
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, fmt.Errorf("decode plan: %w", err)
+	}
+	return p, nil
+}
+
+// Options configures the execution of a plan.
+type Options struct {
+	Holds       *hold.Set     // Operations whose source or target is covered by these holds are refused (optional).
+	Audit       *audit.Log    // Log recording every performed operation (optional).
+	FilesPerSec float64       // Maximum number of operations per second, 0 for no limit.
+	BytesPerSec int64         // Maximum number of bytes per second, according to Op.Size, 0 for no limit.
+	BatchSize   int           // Number of operations after which the execution pauses for BatchPause, 0 for no batches.
+	BatchPause  time.Duration // Pause between batches.
+	Progress    string        // File recording the progress, so an interrupted execution resumes where it stopped (optional).
+	Trash       *trash.Trash  // Deleted and linked-over files are moved to this trash rather than unlinked (optional).
+}
+
+// Execute performs the operations in order. A failed operation does not stop the execution of the next ones;
+// the errors are joined and returned. The execution stops if an operation cannot be recorded in the audit log.
+//
+// Copied and deleted files are checked against the holds at their target and path, moved and renamed files at both,
+// and linked files at both, as the content of the target is shared. A link operation is refused unless both files
+// have the same content, as they may have changed since the plan was made.
+//
+// Mass deletions can overload network filers, so the operations can be paced with the rate limits
+// and batches of the options. With a progress file, the number of operations performed is recorded
+// after each of them, and an execution of the same plan skips them. The file is removed once the plan is complete.
+func (p *Plan) Execute(opts Options) error {
+	prog, err := openProgress(opts.Progress, p)
+	if err != nil {
+		return err
+	}
+
+	pace := newPacer(opts)
+	for i := prog.next(); i < len(p.Ops); i++ {
+		op := p.Ops[i]
+		pace.wait(op.Size)
+
+		var e error
+		if op.Kind != Copy {
+			e = opts.Holds.Check(op.Src)
+		}
+		if e == nil && op.Dst != "" {
+			e = opts.Holds.Check(op.Dst)
+		}
+		var records []record
+		if e == nil {
+			records, e = execute(op, opts.Trash)
+		}
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("%s %s: %w", op.Kind, op.Src, e))
+		}
+		for _, r := range records {
+			if e = opts.Audit.Record(r.op, r.path, r.target, op.Reason); e != nil {
+				return errors.Join(err, e)
+			}
+		}
+
+		if e = prog.save(i + 1); e != nil {
+			return errors.Join(err, e)
+		}
+	}
+
+	return errors.Join(err, prog.remove())
+}
+
+// record is an entry of the audit log for a performed operation.
+type record struct {
+	op           audit.Op
+	path, target string
+}
+
+// execute performs a single operation, moving the files it deletes or links over to the trash if not nil,
+// and returns the entries of the audit log of what it did, even if it fails halfway.
+func execute(op Op, t *trash.Trash) ([]record, error) {
+	switch op.Kind {
+	case Copy:
+		rec := record{op: audit.Create, path: op.Dst}
+		if _, err := os.Lstat(op.Dst); err == nil {
+			rec.op = audit.Modify
+		}
+		if _, err := filecopy.File(context.Background(), op.Src, op.Dst, filecopy.Options{}); err != nil {
+			return nil, err
+		}
+		return []record{rec}, nil
+
+	case Move, Rename:
+		var err error
+		if op.Kind == Move {
+			err = move(op.Src, op.Dst)
+		} else {
+			err = rename(op.Src, op.Dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []record{{audit.Move, op.Src, op.Dst}}, nil
+
+	case Link:
+		return link(op, t)
+
+	case Delete:
+		// Directories deleted without Recursive are empty: they are removed, holding nothing to restore.
+		if info, err := os.Lstat(op.Src); t != nil && (err != nil || !info.IsDir() || op.Recursive) {
+			trashed, err := t.Put(op.Src, op.Reason, false)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return []record{{audit.Move, op.Src, trashed}}, nil
+		}
+
+		remove := os.Remove
+		if op.Recursive {
+			remove = os.RemoveAll
+		}
+		if err := remove(op.Src); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return []record{{audit.Delete, op.Src, ""}}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Kind)
+	}
+}
+
+// rename renames src to dst, creating the parent directories of dst. It refuses to overwrite an existing dst.
+func rename(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// link atomically replaces the file of the operation with a link to its target created next to it,
+// after checking that both have the same content.
+func link(op Op, t *trash.Trash) ([]record, error) {
+	if err := SameContent(op.Src, op.Dst); err != nil {
+		return nil, err
+	}
+
+	tmp := filepath.Join(filepath.Dir(op.Src), fmt.Sprintf(".%s.octopus-%d", filepath.Base(op.Src), time.Now().UnixNano()))
+	var err error
+	switch op.Method {
+	case "", Hardlink:
+		err = os.Link(op.Dst, tmp)
+	case Reflink:
+		err = filecopy.Clone(op.Dst, tmp)
+	default:
+		err = fmt.Errorf("unknown link method %q", op.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	if t != nil {
+		trashed, err := t.Put(op.Src, op.Reason, true)
+		if err != nil {
+			_ = os.Remove(tmp)
+			return nil, err
+		}
+		records = append(records, record{audit.Move, op.Src, trashed})
+	}
+
+	if err = os.Rename(tmp, op.Src); err != nil {
+		_ = os.Remove(tmp)
+		return records, err
+	}
+	return append(records, record{audit.Link, op.Src, op.Dst}), nil
+}
+
+// SameContent checks that the files a and b are distinct regular files with the same content, comparing them byte
+// for byte, so that files are only linked together when they are identical, whatever hash found them.
+func SameContent(a, b string) error {
+	fa, err := os.Open(a)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fa.Close() }()
+	fb, err := os.Open(b)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fb.Close() }()
+
+	sa, err := fa.Stat()
+	if err != nil {
+		return err
+	}
+	sb, err := fb.Stat()
+	if err != nil {
+		return err
+	}
+	switch {
+	case !sa.Mode().IsRegular() || !sb.Mode().IsRegular():
+		return errors.New("only regular files can be linked")
+	case os.SameFile(sa, sb):
+		return fmt.Errorf("%s is already linked to %s", a, b)
+	case sa.Size() != sb.Size():
+		return fmt.Errorf("%s and %s differ", a, b)
+	}
+
+	bufA, bufB := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		n, errA := io.ReadFull(fa, bufA)
+		_, errB := io.ReadFull(fb, bufB[:n])
+		if errB != nil && n > 0 {
+			return errB
+		}
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			return fmt.Errorf("%s and %s differ", a, b)
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if errA != nil {
+			return errA
+		}
+	}
+}
+
+// move renames src to dst, creating the parent directories of dst.
+// When src and dst are on different devices, src is copied and then removed.
+// It refuses to overwrite an existing dst.
+func move(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err = copyTree(src, dst); err != nil {
+		_ = os.RemoveAll(dst)
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// copyTree copies a file or a directory recursively, preserving modes and modification times.
+func copyTree(src, dst string) error {
+	st, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case st.IsDir():
+		if err = os.Mkdir(dst, st.Mode().Perm()); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err = copyTree(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+				return err
+			}
+		}
+	case st.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	default:
+		if err = copyFile(src, dst, st.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return os.Chtimes(dst, st.ModTime(), st.ModTime())
+}
+
+// copyFile copies the content of a regular file.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
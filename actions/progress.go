@@ -0,0 +1,145 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// progress records how many operations of a plan were performed, see Options.Progress.
+type progress struct {
+	Plan string `json:"plan"` // Digest of the plan, so the progress of another plan is never applied.
+	Done int    `json:"done"` // Number of operations performed, in order.
+	path string
+}
+
+// openProgress reads the progress of the plan from the file at path, or starts a new one.
+// A nil progress is returned if path is empty; its methods do nothing.
+func openProgress(path string, p *Plan) (*progress, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	prog := &progress{Plan: hex.EncodeToString(sum[:]), path: path}
+
+	data, err = os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return prog, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read progress %s: %w", path, err)
+	}
+
+	var saved progress
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("read progress %s: %w", path, err)
+	}
+	if saved.Plan != prog.Plan {
+		return nil, fmt.Errorf("read progress %s: recorded for another plan", path)
+	}
+	if saved.Done < 0 || saved.Done > len(p.Ops) {
+		return nil, fmt.Errorf("read progress %s: invalid number of operations %d", path, saved.Done)
+	}
+	prog.Done = saved.Done
+
+	return prog, nil
+}
+
+// next returns the index of the first operation not performed yet.
+func (prog *progress) next() int {
+	if prog == nil {
+		return 0
+	}
+	return prog.Done
+}
+
+// save records that the first done operations were performed.
+// The file is replaced atomically, so an interruption never leaves a partial progress behind.
+func (prog *progress) save(done int) error {
+	if prog == nil {
+		return nil
+	}
+	prog.Done = done
+
+	data, err := json.Marshal(prog)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(prog.path), ".progress-*")
+	if err != nil {
+		return fmt.Errorf("save progress %s: %w", prog.path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("save progress %s: %w", prog.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("save progress %s: %w", prog.path, err)
+	}
+
+	if err = os.Rename(tmp.Name(), prog.path); err != nil {
+		return fmt.Errorf("save progress %s: %w", prog.path, err)
+	}
+
+	return nil
+}
+
+// remove removes the progress file once the plan is complete.
+func (prog *progress) remove() error {
+	if prog == nil {
+		return nil
+	}
+	if err := os.Remove(prog.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove progress %s: %w", prog.path, err)
+	}
+	return nil
+}
+
+// pacer delays operations to respect the rate limits and batches of the options.
+type pacer struct {
+	opts  Options
+	start time.Time // Start of the current batch, which the rates are measured from.
+	files int       // Number of operations started in the current batch.
+	bytes int64     // Number of bytes of the operations started in the current batch.
+}
+
+// newPacer returns a pacer for the options.
+func newPacer(opts Options) *pacer {
+	return &pacer{opts: opts, start: time.Now()}
+}
+
+// wait blocks until an operation affecting size bytes may start.
+func (p *pacer) wait(size int64) {
+	if p.opts.BatchSize > 0 && p.files == p.opts.BatchSize {
+		time.Sleep(p.opts.BatchPause)
+		p.start, p.files, p.bytes = time.Now(), 0, 0
+	}
+
+	// The operation may start once the previous ones took as long as the limits allow for them.
+	var d time.Duration
+	if p.opts.FilesPerSec > 0 {
+		d = time.Duration(float64(p.files) / p.opts.FilesPerSec * float64(time.Second))
+	}
+	if p.opts.BytesPerSec > 0 {
+		if b := time.Duration(float64(p.bytes) / float64(p.opts.BytesPerSec) * float64(time.Second)); b > d {
+			d = b
+		}
+	}
+	time.Sleep(time.Until(p.start.Add(d)))
+
+	p.files++
+	p.bytes += size
+}
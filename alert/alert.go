@@ -0,0 +1,209 @@
+// Package alert evaluates rules over the changes found between two scans, such as "more than 5% of the files
+// changed" or "any change under etc/", so that diffs run on a schedule, or the diff step of a pipeline,
+// make octopus a lightweight file-integrity monitor. The period a rule covers is the time between the
+// compared scans, e.g. an hour for a pipeline run hourly.
+//
+// Rules are defined in JSON:
+//
+//	[
+//	  {"name": "mass-change", "minPercent": 5},
+//	  {"name": "etc", "paths": ["etc"]},
+//	  {"name": "binaries", "paths": ["usr/bin/*", "usr/sbin/*"], "ops": ["added", "modified"]}
+//	]
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gromey/octopus/diff"
+)
+
+// maxPaths is the number of paths of the matching changes an Alert reports.
+const maxPaths = 20
+
+// Rule represents a condition on the changes between two scans. A rule without threshold is triggered by
+// any matching change.
+type Rule struct {
+	Name       string    `json:"name"`                 // Name of the rule, for the alerts.
+	Paths      []string  `json:"paths,omitempty"`      // Patterns of the slash-separated relative paths watched, see Match, all if empty.
+	Ops        []diff.Op `json:"ops,omitempty"`        // Kinds of changes counted, all if empty.
+	MinCount   int       `json:"minCount,omitempty"`   // Minimum number of matching changes.
+	MinPercent float64   `json:"minPercent,omitempty"` // Minimum number of matching changes, as a percentage of the files.
+}
+
+// Alert represents a triggered rule.
+type Alert struct {
+	Rule    string   `json:"rule"`    // Name of the rule.
+	Changes int      `json:"changes"` // Number of matching changes.
+	Files   int      `json:"files"`   // Number of files the percentage is relative to.
+	Percent float64  `json:"percent"` // Matching changes as a percentage of the files.
+	Paths   []string `json:"paths"`   // Slash-separated paths of the first matching changes.
+}
+
+// String returns a description of the alert, e.g. `mass-change: 12 changes (6.0% of 200 files), first "a.txt"`.
+func (a Alert) String() string {
+	s := fmt.Sprintf("%s: %d changes (%.1f%% of %d files)", a.Rule, a.Changes, a.Percent, a.Files)
+	if len(a.Paths) > 0 {
+		s += fmt.Sprintf(", first %q", a.Paths[0])
+	}
+	return s
+}
+
+// Load reads and validates the rules defined in the JSON file at path.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load alert rules %s: %w", path, err)
+	}
+
+	var rules []Rule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("load alert rules %s: %w", path, err)
+	}
+	if err = Validate(rules); err != nil {
+		return nil, fmt.Errorf("load alert rules %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// Validate checks that the rules are named, and that their patterns, kinds of changes and thresholds are valid.
+func Validate(rules []Rule) error {
+	for i, r := range rules {
+		var err error
+		switch {
+		case r.Name == "":
+			err = errors.New("name is required")
+		case r.MinCount < 0 || r.MinPercent < 0 || r.MinPercent > 100:
+			err = errors.New("thresholds must be positive, and percentages at most 100")
+		}
+		for _, p := range r.Paths {
+			if _, e := path.Match(p, ""); e != nil && err == nil {
+				err = fmt.Errorf("pattern %q: %w", p, e)
+			}
+		}
+		for _, op := range r.Ops {
+			if op != diff.Added && op != diff.Removed && op != diff.Modified && err == nil {
+				err = fmt.Errorf("unknown kind of change %q", op)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the alerts of the rules triggered by the changes, in the order of the rules.
+// files is the number of files the percentages are relative to, usually those of the older scan.
+func Evaluate(rules []Rule, changes []diff.Change, files int) []Alert {
+	var alerts []Alert
+	for _, r := range rules {
+		a := Alert{Rule: r.Name, Files: files}
+		for _, c := range changes {
+			p := filepath.ToSlash(c.Path)
+			if !r.counts(c.Op) || !r.watches(p) {
+				continue
+			}
+			a.Changes++
+			if len(a.Paths) < maxPaths {
+				a.Paths = append(a.Paths, p)
+			}
+		}
+		if files > 0 {
+			a.Percent = float64(a.Changes) * 100 / float64(files)
+		}
+
+		triggered := a.Changes > 0 && a.Changes >= r.MinCount
+		if r.MinPercent > 0 {
+			// Without files, any change is a change of all of them.
+			triggered = triggered && (files == 0 || a.Percent >= r.MinPercent)
+		}
+		if triggered {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// counts reports whether the rule counts the changes of the kind.
+func (r *Rule) counts(op diff.Op) bool {
+	if len(r.Ops) == 0 {
+		return true
+	}
+	for _, o := range r.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// watches reports whether the rule watches the slash-separated path.
+func (r *Rule) watches(p string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range r.Paths {
+		if Match(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash-separated relative path, or one of its parent directories, matches
+// the pattern, see path.Match, ignoring a leading slash of the pattern: "etc" matches "etc/passwd".
+func Match(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	for {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		i := strings.LastIndexByte(p, '/')
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// Post posts the alerts as a JSON object {"alerts": [...]} to the webhook at url.
+func Post(ctx context.Context, url string, alerts []Alert) error {
+	body, err := json.Marshal(struct {
+		Alerts []Alert `json:"alerts"`
+	}{alerts})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post alerts: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("post alerts: unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package archive reads the files stored in zip and tar archives, so that a scan can descend into archives
+// as if they were directories, see dirreader.WithArchives, and writes such archives from files, see Packer.
+//
+// The files of an archive are addressed by the path of the archive followed by Separator and their path
+// inside the archive, e.g. "bundle.zip!/inner/file.txt".
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gromey/octopus/codec"
+)
+
+// Separator follows the path of an archive in the paths of the files it stores.
+const Separator = "!"
+
+// Formats of the supported archives.
+const (
+	Zip    = "zip"     // Zip archive.
+	Tar    = "tar"     // Uncompressed tar archive.
+	TarGz  = "tar.gz"  // Gzip-compressed tar archive, also named .tgz.
+	TarZst = "tar.zst" // Zstandard-compressed tar archive, also named .tzst.
+)
+
+// ErrUnsupported is returned by Walk for files whose name is not that of a supported archive.
+var ErrUnsupported = errors.New("unsupported archive format")
+
+// Entry represents a regular file stored in an archive.
+type Entry struct {
+	Path string      // Slash-separated path of the file inside the archive, e.g. "inner/file.txt".
+	Info fs.FileInfo // Metadata of the file recorded in the archive.
+}
+
+// Format returns the format of the archive with the name, judging by its extension, or "" if unsupported.
+func Format(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return TarZst
+	default:
+		return ""
+	}
+}
+
+// Walk calls fn for each regular file of the archive at path, in the order they are stored, with a reader of its
+// content that is valid until fn returns. It stops at the first error returned by fn and returns it.
+// Directories, links and files whose path leaves the archive, e.g. "../x", are skipped.
+func Walk(path string, fn func(e Entry, content io.Reader) error) error {
+	switch Format(path) {
+	case Zip:
+		return walkZip(path, fn)
+	case Tar, TarGz, TarZst:
+		return walkTar(path, fn)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// walkZip walks the files of a zip archive.
+func walkZip(name string, fn func(e Entry, content io.Reader) error) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zr.Close() }()
+
+	for _, f := range zr.File {
+		p, ok := entryPath(f.Name)
+		if !ok || !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		err = fn(Entry{Path: p, Info: f.FileInfo()}, rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTar walks the files of a tar archive, decompressing it with the codec detected from its first bytes.
+func walkTar(name string, fn func(e Entry, content io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	src, err := codec.NewDetectingReader(f)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	tr := tar.NewReader(src)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, ok := entryPath(h.Name)
+		if !ok || !h.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err = fn(Entry{Path: p, Info: h.FileInfo()}, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath returns the cleaned path of a file stored under the name, and false if it leaves the archive.
+func entryPath(name string) (string, bool) {
+	p := strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/throttle"
+)
+
+// maxZipName is the length of the longest name of a zip entry, in bytes.
+const maxZipName = 1<<16 - 1
+
+// Notice reports an entry a Packer stored under another name than the one it was added under, or skipped.
+type Notice struct {
+	Name   string `json:"name"`             // Name the entry was added under.
+	Stored string `json:"stored,omitempty"` // Name the entry was stored under, empty if it was skipped.
+	Reason string `json:"reason"`           // Why the entry was renamed or skipped.
+}
+
+// Packer writes files into a new archive as they are added, streaming their content without buffering it.
+//
+// Tar archives use the PAX format, which stores names of any length, files of any size and modification times
+// to the nanosecond. Names that are not valid UTF-8 are stored as they are, marked as binary for the tools
+// honoring it. Zip archives switch to zip64 for files of 4 GiB and more. Their names are stored as UTF-8:
+// the bytes of a name that are not valid UTF-8 are decoded as Latin-1, and entries with names longer
+// than 65535 bytes, or renamed to the name of another entry, are skipped. See Notices.
+type Packer struct {
+	tw      *tar.Writer     // Writer of a tar archive, nil for zip.
+	zw      *zip.Writer     // Writer of a zip archive, nil for tar.
+	cw      io.WriteCloser  // Compressor of a tar archive.
+	n       int             // Number of files added.
+	names   map[string]bool // Names stored in a zip archive.
+	notices []Notice        // Entries renamed or skipped.
+}
+
+// NewPacker returns a packer writing an archive of the format, e.g. TarGz, to w.
+// Zip archives compress each file with Deflate, tar archives are compressed as a whole according to the format.
+func NewPacker(w io.Writer, format string) (*Packer, error) {
+	var c codec.Codec
+	switch format {
+	case Zip:
+		return &Packer{zw: zip.NewWriter(w), names: make(map[string]bool)}, nil
+	case Tar:
+		c = codec.None
+	case TarGz:
+		c = codec.Gzip
+	case TarZst:
+		c = codec.Zstd
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupported, format)
+	}
+
+	cw, err := c.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &Packer{tw: tar.NewWriter(cw), cw: cw}, nil
+}
+
+// Add adds the content read from src under the name, a slash-separated path, with the mode and the modification
+// time of info. src must provide exactly info.Size() bytes. It is not read if the entry is skipped, see Notices.
+func (p *Packer) Add(name string, info fs.FileInfo, src io.Reader) error {
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("add %s: not a regular file", name)
+	}
+
+	var w io.Writer
+	if p.zw != nil {
+		stored, reason := zipName(name)
+		if stored != "" && p.names[stored] {
+			stored, reason = "", fmt.Sprintf("renamed to %q, the name of another entry", stored)
+		}
+		if reason != "" {
+			p.notices = append(p.notices, Notice{Name: name, Stored: stored, Reason: reason})
+		}
+		if stored == "" {
+			return nil
+		}
+		p.names[stored] = true
+
+		h, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		h.Name, h.Method = stored, zip.Deflate
+		if w, err = p.zw.CreateHeader(h); err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+	} else {
+		h, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		h.Name = name
+		h.Format = tar.FormatPAX // Keeps the modification time to the nanosecond.
+		if !utf8.ValidString(name) {
+			h.PAXRecords = map[string]string{"hdrcharset": "BINARY"}
+		}
+		if err = p.tw.WriteHeader(h); err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		w = p.tw
+	}
+
+	if n, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("add %s: %w", name, err)
+	} else if n != info.Size() {
+		return fmt.Errorf("add %s: read %d bytes instead of %d, the file changed", name, n, info.Size())
+	}
+	p.n++
+
+	return nil
+}
+
+// AddFile adds the file at path under the name, a slash-separated path, with its current mode and modification time.
+func (p *Packer) AddFile(name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("add %s: %w", name, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("add %s: %w", name, err)
+	}
+	return p.Add(name, info, throttle.Global().Reader(context.Background(), io.LimitReader(f, info.Size())))
+}
+
+// AddBytes adds the data under the name, a slash-separated path, as a file readable by everyone
+// modified at modTime.
+func (p *Packer) AddBytes(name string, data []byte, modTime time.Time) error {
+	return p.Add(name, bytesInfo{name: path.Base(name), size: int64(len(data)), modTime: modTime}, bytes.NewReader(data))
+}
+
+// Len returns the number of files added, not counting the skipped ones.
+func (p *Packer) Len() int {
+	return p.n
+}
+
+// Notices returns the entries stored under another name than the one they were added under,
+// or skipped, in the order they were added.
+func (p *Packer) Notices() []Notice {
+	return p.notices
+}
+
+// zipName returns the name a zip entry added under name is stored under, empty if it cannot be stored,
+// and the reason it differs, if it does.
+func zipName(name string) (string, string) {
+	var reason string
+	if !utf8.ValidString(name) {
+		var sb strings.Builder
+		for i := 0; i < len(name); {
+			r, size := utf8.DecodeRuneInString(name[i:])
+			if r == utf8.RuneError && size == 1 {
+				r = rune(name[i]) // Latin-1 maps every byte to the code point of the same value.
+			}
+			sb.WriteRune(r)
+			i += size
+		}
+		name, reason = sb.String(), "not valid UTF-8, the invalid bytes were decoded as Latin-1"
+	}
+	if len(name) > maxZipName {
+		return "", "name longer than 65535 bytes"
+	}
+	return name, reason
+}
+
+// Close writes the end of the archive. It does not close the underlying writer.
+func (p *Packer) Close() error {
+	if p.zw != nil {
+		return p.zw.Close()
+	}
+	if err := p.tw.Close(); err != nil {
+		return err
+	}
+	return p.cw.Close()
+}
+
+// bytesInfo is the fs.FileInfo of the data added with AddBytes.
+type bytesInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i bytesInfo) Name() string       { return i.name }
+func (i bytesInfo) Size() int64        { return i.size }
+func (i bytesInfo) Mode() fs.FileMode  { return 0o644 }
+func (i bytesInfo) ModTime() time.Time { return i.modTime }
+func (i bytesInfo) IsDir() bool        { return false }
+func (i bytesInfo) Sys() interface{}   { return nil }
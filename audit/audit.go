@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrTampered is returned when the hash chain of an audit log is broken.
+var ErrTampered = errors.New("audit log tampered")
+
+// Op represents the kind of a mutating operation.
+type Op string
+
+const (
+	Create Op = "create" // A file was created.
+	Modify Op = "modify" // The content or the attributes of a file were changed.
+	Delete Op = "delete" // A file was deleted.
+	Move   Op = "move"   // A file or a directory was moved to the target.
+	Link   Op = "link"   // A file was replaced with a link to the target.
+)
+
+// Entry represents a mutating operation recorded in the audit log.
+// Each entry carries the hash of the previous one, so that altering, removing or reordering entries
+// breaks the chain and is detected by Verify.
+type Entry struct {
+	Seq      uint64    `json:"seq"`              // Sequence number of the entry, starting at 1.
+	Time     time.Time `json:"time"`             // Time the operation was performed.
+	Operator string    `json:"operator"`         // User that performed the operation.
+	Op       Op        `json:"op"`               // Kind of the operation.
+	Path     string    `json:"path"`             // Path of the file the operation applied to.
+	Target   string    `json:"target,omitempty"` // Target of a move or a link.
+	Reason   string    `json:"reason,omitempty"` // Why the operation was performed.
+	Prev     string    `json:"prev"`             // Hash of the previous entry, empty for the first one.
+	Hash     string    `json:"hash"`             // Hash of this entry, computed with Hash unset.
+}
+
+// sum returns the hash of the entry.
+func (e Entry) sum() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Log is an append-only, hash-chained audit log stored as newline-delimited JSON.
+// A nil *Log records nothing, so the subsystems accepting one treat auditing as optional.
+type Log struct {
+	Operator string // User recorded in the entries, defaults to the current user.
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// Open opens the audit log located at the provided path, creating it if needed.
+// A trailing incomplete record left by an interrupted write is discarded.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+
+	l := &Log{Operator: operator(), path: path, file: f}
+
+	var valid int64
+	err = scan(f, func(e Entry, end int64) error {
+		l.seq, l.last, valid = e.Seq, e.Hash, end
+		return nil
+	})
+	if err == nil {
+		// Drop whatever follows the last complete record and continue writing after it.
+		if err = f.Truncate(valid); err == nil {
+			_, err = f.Seek(valid, io.SeekStart)
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Record appends an operation to the log and syncs it to disk. The target may be empty.
+// Relative paths are recorded as absolute paths.
+func (l *Log) Record(op Op, path, target, reason string) error {
+	if l == nil {
+		return nil
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if abs, err := filepath.Abs(target); err == nil && target != "" {
+		target = abs
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Entry{
+		Seq:      l.seq + 1,
+		Time:     time.Now().UTC(),
+		Operator: l.Operator,
+		Op:       op,
+		Path:     path,
+		Target:   target,
+		Reason:   reason,
+		Prev:     l.last,
+	}
+
+	var err error
+	if e.Hash, err = e.sum(); err != nil {
+		return fmt.Errorf("append to audit log %s: %w", l.path, err)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("append to audit log %s: %w", l.path, err)
+	}
+	if _, err = l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("append to audit log %s: %w", l.path, err)
+	}
+	if err = l.file.Sync(); err != nil {
+		return fmt.Errorf("append to audit log %s: %w", l.path, err)
+	}
+
+	l.seq, l.last = e.Seq, e.Hash
+
+	return nil
+}
+
+// Verify checks the hash chain of the audit log at path and returns the number of entries.
+// The returned error wraps ErrTampered if an entry was altered, removed or reordered.
+func Verify(path string) (int, error) {
+	var n int
+	err := walk(path, func(Entry) error { n++; return nil })
+	if err != nil {
+		return n, fmt.Errorf("verify audit log %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Export verifies the audit log at path and writes its entries to w as newline-delimited JSON.
+// It stops at the first entry breaking the hash chain and returns an error wrapping ErrTampered.
+func Export(path string, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := walk(path, func(e Entry) error { return enc.Encode(e) }); err != nil {
+		return fmt.Errorf("export audit log %s: %w", path, err)
+	}
+	return nil
+}
+
+// walk calls fn with each entry of the audit log at path, checking the hash chain along the way.
+func walk(path string, fn func(e Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var seq uint64
+	var prev string
+	return scan(f, func(e Entry, _ int64) error {
+		sum, err := e.sum()
+		if err != nil {
+			return err
+		}
+		if e.Seq != seq+1 || e.Prev != prev || e.Hash != sum {
+			return fmt.Errorf("entry %d: %w", seq+1, ErrTampered)
+		}
+		seq, prev = e.Seq, e.Hash
+		return fn(e)
+	})
+}
+
+// scan decodes the complete records of the log from the beginning of f and calls fn with each entry
+// and the offset following it, until fn returns an error.
+func scan(f *os.File, fn func(e Entry, end int64) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil // An incomplete trailing record is not part of the log.
+			}
+			return err
+		}
+		offset += int64(len(line))
+
+		var e Entry
+		if err = json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset-int64(len(line)), err)
+		}
+
+		if err = fn(e, offset); err != nil {
+			return err
+		}
+	}
+}
+
+// operator returns the name of the current user.
+func operator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,126 @@
+// Package backends provides the trees octopus can scan, compare and synchronize besides local directories:
+// a Tree is a flat set of objects addressed by slash-separated names, implemented by Local for directories
+// and by S3 for a prefix of an S3-compatible bucket. Files lists a tree as scan results, to compare it
+// with diff, and Sync makes a tree a copy of another one.
+package backends
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Object represents a file of a tree.
+type Object struct {
+	Name      string      `json:"name"`                // Slash-separated path relative to the root of the tree.
+	Size      int64       `json:"size"`                // Size of the content.
+	ModTime   time.Time   `json:"modTime"`             // Modification time.
+	Mode      os.FileMode `json:"mode,omitempty"`      // Permissions, if the tree keeps them.
+	Hash      string      `json:"hash,omitempty"`      // Hex-encoded hash of the content, if the tree knows it.
+	Algorithm string      `json:"algorithm,omitempty"` // Name of the algorithm of Hash, see hashes.Lookup.
+}
+
+// Tree is a set of objects that can be listed, read and written.
+type Tree interface {
+	// List returns the objects of the tree, in no particular order.
+	List(ctx context.Context) ([]Object, error)
+	// Stat returns the object with the name, or an error wrapping fs.ErrNotExist if there is none.
+	Stat(ctx context.Context, name string) (Object, error)
+	// Open returns the content of the object with the name.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put stores the obj.Size bytes read from r as the object obj.Name, replacing it if it exists,
+	// with the modification time, hash, algorithm and permissions of obj, those the tree keeps.
+	Put(ctx context.Context, obj Object, r io.Reader) error
+	// Delete removes the object with the name.
+	Delete(ctx context.Context, name string) error
+}
+
+// ErrChanged is returned, wrapped, when an object read does not have the size it was listed with.
+var ErrChanged = errors.New("object changed while it was read")
+
+// Files returns the objects of the tree as scan results sorted by path. With a hashFunc, the objects are given
+// their hash for the algorithm, read to compute it when the tree does not know it. The absolute path of each
+// file is prefix followed by its name, e.g. "s3://bucket/prefix/" followed by "dir/file.txt".
+func Files(ctx context.Context, t Tree, hashFunc func() hash.Hash, algorithm, prefix string) ([]dirreader.FileInfo, error) {
+	objs, err := t.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]dirreader.FileInfo, len(objs))
+	for i, obj := range objs {
+		if hashFunc != nil {
+			if err = fillHash(ctx, t, &obj, hashFunc, algorithm); err != nil {
+				return nil, err
+			}
+		}
+		files[i] = fileInfo(obj, algorithm, prefix)
+	}
+	sortFiles(files)
+
+	return files, nil
+}
+
+// fileInfo returns the scan result of the object, with its hash if it is of the algorithm.
+func fileInfo(obj Object, algorithm, prefix string) dirreader.FileInfo {
+	fi := dirreader.FileInfo{
+		FileInfo: objectInfo{obj},
+		PathAbs:  prefix + obj.Name,
+		PathRel:  fromSlash(path.Dir(obj.Name)),
+	}
+	if obj.Algorithm == algorithm {
+		fi.Hash = obj.Hash
+	}
+	return fi
+}
+
+// hashObject computes the hash of the content of the object with hashFunc.
+func hashObject(ctx context.Context, t Tree, obj Object, hashFunc func() hash.Hash) (string, error) {
+	rc, err := t.Open(ctx, obj.Name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = rc.Close() }()
+
+	h := hashFunc()
+	if err = copyExactly(h, rc, obj); err != nil {
+		return "", err
+	}
+	return hexSum(h), nil
+}
+
+// copyExactly copies the content of the object from r to w, failing with ErrChanged if it has not the listed size.
+func copyExactly(w io.Writer, r io.Reader, obj Object) error {
+	n, err := io.Copy(w, io.LimitReader(r, obj.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != obj.Size {
+		return &fs.PathError{Op: "read", Path: obj.Name, Err: ErrChanged}
+	}
+	return nil
+}
+
+// objectInfo is the os.FileInfo of an object.
+type objectInfo struct {
+	obj Object
+}
+
+func (i objectInfo) Name() string { return path.Base(i.obj.Name) }
+func (i objectInfo) Size() int64  { return i.obj.Size }
+func (i objectInfo) Mode() os.FileMode {
+	if i.obj.Mode == 0 {
+		return 0o644
+	}
+	return i.obj.Mode.Perm()
+}
+func (i objectInfo) ModTime() time.Time { return i.obj.ModTime }
+func (i objectInfo) IsDir() bool        { return false }
+func (i objectInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,108 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local is a Tree of the regular files below a directory. It keeps the permissions of the files,
+// but does not know their hashes.
+type Local struct {
+	Dir string // Root directory of the tree.
+}
+
+// List implements Tree. Symbolic links and other special files are skipped.
+func (l *Local) List(ctx context.Context) ([]Object, error) {
+	var objs []Object
+	err := filepath.WalkDir(l.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.Dir, p)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, Object{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode().Perm()})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		// A missing root is an empty tree, created by the first Put.
+		return nil, nil
+	}
+	return objs, err
+}
+
+// Stat implements Tree.
+func (l *Local) Stat(_ context.Context, name string) (Object, error) {
+	info, err := os.Stat(l.path(name))
+	if err != nil {
+		return Object{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Object{}, fmt.Errorf("%s: not a regular file", name)
+	}
+	return Object{Name: name, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode().Perm()}, nil
+}
+
+// Open implements Tree.
+func (l *Local) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(l.path(name))
+}
+
+// Put implements Tree. The content is written to a temporary file renamed over the file once complete,
+// so a failed put never leaves a partial file behind.
+func (l *Local) Put(_ context.Context, obj Object, r io.Reader) error {
+	dst := l.path(obj.Name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), ".octopus-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() { _ = os.Remove(tmp) }()
+
+	err = copyExactly(f, r, obj)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp, objectInfo{obj}.Mode())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, obj.ModTime, obj.ModTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("put %s: %w", obj.Name, err)
+	}
+	return nil
+}
+
+// Delete implements Tree.
+func (l *Local) Delete(_ context.Context, name string) error {
+	return os.Remove(l.path(name))
+}
+
+// path returns the path of the file with the name.
+func (l *Local) path(name string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(name))
+}
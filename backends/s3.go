@@ -0,0 +1,249 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/sigv4"
+)
+
+// Metadata headers Put stores with the objects, read back by Stat and by List with S3.Metadata.
+const (
+	metaModTime = "X-Amz-Meta-Octopus-Mtime" // Modification time of the file, in RFC 3339 with nanoseconds.
+	metaHash    = "X-Amz-Meta-Octopus-Hash"  // Hash of the content, as "<algorithm>:<hex>".
+)
+
+// metadataWorkers is the number of HEAD requests List sends at once with S3.Metadata.
+const metadataWorkers = 16
+
+// S3 is a Tree of the objects below a prefix of a bucket in an S3-compatible object storage, addressed
+// path-style, i.e. <Endpoint>/<Bucket>/<Prefix><name>. Requests are signed with AWS Signature Version 4.
+//
+// The ETag of an object uploaded in a single part without KMS encryption is the MD5 of its content:
+// it is reported as the hash of the object for the "md5" algorithm. Put also stores the modification time
+// and the hash of the objects as user metadata, which List only reads with Metadata, one HEAD request per object,
+// since listings do not return it. Objects of more than 5 GiB cannot be put, as multipart uploads are not used.
+type S3 struct {
+	sigv4.Credentials
+	Endpoint string       // Base URL of the service, e.g. "https://s3.eu-west-1.amazonaws.com".
+	Bucket   string       // Name of the bucket.
+	Prefix   string       // Prefix of the keys of the objects, usually ending with a slash, e.g. "backups/" (optional).
+	Metadata bool         // Whether List reads the modification times and hashes stored by Put.
+	HTTP     *http.Client // HTTP client to use, defaults to http.DefaultClient.
+}
+
+// List implements Tree. Keys ending with a slash, used as folder markers, are skipped.
+func (s *S3) List(ctx context.Context) ([]Object, error) {
+	type listResult struct {
+		Contents []struct {
+			Key          string
+			LastModified time.Time
+			ETag         string
+			Size         int64
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+
+	var objs []Object
+	q := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s: %w", s.Bucket, s.Prefix, err)
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s: %w", s.Bucket, s.Prefix, err)
+		}
+
+		for _, c := range res.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue
+			}
+			obj := Object{Name: strings.TrimPrefix(c.Key, s.Prefix), Size: c.Size, ModTime: c.LastModified}
+			obj.Hash, obj.Algorithm = etagHash(c.ETag)
+			objs = append(objs, obj)
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+
+	if s.Metadata {
+		if err := s.readMetadata(ctx, objs); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, nil
+}
+
+// readMetadata replaces the listed objects by their Stat, which includes the metadata stored by Put.
+func (s *S3) readMetadata(ctx context.Context, objs []Object) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, metadataWorkers)
+	for i := range objs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(obj *Object) {
+			defer func() { <-sem; wg.Done() }()
+			st, err := s.Stat(ctx, obj.Name)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err == nil {
+				*obj = st
+			}
+		}(&objs[i])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Stat implements Tree.
+func (s *S3) Stat(ctx context.Context, name string) (Object, error) {
+	resp, err := s.do(ctx, http.MethodHead, name, nil, nil, nil)
+	if err != nil {
+		return Object{}, fmt.Errorf("stat %s: %w", name, err)
+	}
+	_ = resp.Body.Close()
+
+	obj := Object{Name: name, Size: resp.ContentLength}
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	if t, err := time.Parse(time.RFC3339Nano, resp.Header.Get(metaModTime)); err == nil {
+		obj.ModTime = t
+	}
+	obj.Hash, obj.Algorithm = etagHash(resp.Header.Get("ETag"))
+	if algorithm, sum, ok := strings.Cut(resp.Header.Get(metaHash), ":"); ok {
+		obj.Hash, obj.Algorithm = sum, algorithm
+	}
+
+	return obj, nil
+}
+
+// Open implements Tree.
+func (s *S3) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	return resp.Body, nil
+}
+
+// Put implements Tree. The content is streamed without being signed, which requires an HTTPS endpoint on AWS.
+func (s *S3) Put(ctx context.Context, obj Object, r io.Reader) error {
+	h := http.Header{}
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set(metaModTime, obj.ModTime.UTC().Format(time.RFC3339Nano))
+	if obj.Hash != "" && obj.Algorithm != "" {
+		h.Set(metaHash, obj.Algorithm+":"+obj.Hash)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, obj.Name, nil, h, &sizedReader{r: io.LimitReader(r, obj.Size), size: obj.Size})
+	if err != nil {
+		return fmt.Errorf("put %s: %w", obj.Name, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Delete implements Tree.
+func (s *S3) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// sizedReader is a request body of a known size.
+type sizedReader struct {
+	r    io.Reader
+	size int64
+}
+
+func (sr *sizedReader) Read(p []byte) (int, error) { return sr.r.Read(p) }
+
+// do sends a signed request for the object with the name, or for the bucket if name is empty,
+// and returns the response if its status is successful. A missing object is reported with fs.ErrNotExist.
+func (s *S3) do(ctx context.Context, method, name string, q url.Values, h http.Header, body *sizedReader) (*http.Response, error) {
+	key := s.Bucket
+	if name != "" {
+		key += "/" + s.Prefix + name
+	}
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath = "/" + sigv4.EscapePath(key)
+	u.RawQuery = q.Encode()
+
+	var rd io.Reader
+	if body != nil {
+		rd = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), rd)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	payload := sigv4.EmptyPayload()
+	if body != nil {
+		req.ContentLength, payload = body.size, sigv4.UnsignedPayload
+		if body.size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	s.Sign(req, payload, time.Now())
+
+	client := s.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && name != "" {
+		return nil, fs.ErrNotExist
+	}
+	return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// etagHash returns the MD5 of the content of an object from its ETag, if it is one: the ETags of multipart
+// uploads and of encrypted objects are not.
+func etagHash(etag string) (string, string) {
+	etag = strings.Trim(etag, `"`)
+	if _, err := hex.DecodeString(etag); err != nil || len(etag) != 32 {
+		return "", ""
+	}
+	return strings.ToLower(etag), "md5"
+}
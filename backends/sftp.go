@@ -0,0 +1,200 @@
+package backends
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP is a Tree of the regular files below a directory of a server reached over SSH. The requests are
+// spread over several connections, so that concurrent transfers are not limited by the window of a single
+// SSH channel. Put keeps the permissions and the modification time of the objects, the latter to the second
+// only, as in version 3 of the SFTP protocol. It does not know the hashes of the files.
+type SFTP struct {
+	dir     string         // Root directory of the tree on the server, slash-separated.
+	conns   []*ssh.Client  // SSH connections.
+	clients []*sftp.Client // SFTP sessions, one per connection.
+	next    uint32         // Counter selecting the client of the next request.
+}
+
+// DialSFTP opens n connections, at least one, to the SSH server at addr, "host:port", and returns the tree
+// of the directory dir on the server. The connections are closed by Close.
+func DialSFTP(addr string, config *ssh.ClientConfig, dir string, n int) (*SFTP, error) {
+	if n < 1 {
+		n = 1
+	}
+
+	s := &SFTP{dir: path.Clean(dir)}
+	for i := 0; i < n; i++ {
+		conn, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("dial %s: %w", addr, err)
+		}
+		s.conns = append(s.conns, conn)
+
+		c, err := sftp.NewClient(conn)
+		if err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("start sftp on %s: %w", addr, err)
+		}
+		s.clients = append(s.clients, c)
+	}
+
+	return s, nil
+}
+
+// Close closes the connections to the server.
+func (s *SFTP) Close() error {
+	var err error
+	for _, c := range s.clients {
+		err = errors.Join(err, c.Close())
+	}
+	for _, c := range s.conns {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// ModTimePrecision implements the optional interface of Sync: modification times are stored to the second.
+func (s *SFTP) ModTimePrecision() time.Duration {
+	return time.Second
+}
+
+// List implements Tree. Symbolic links and other special files are skipped.
+func (s *SFTP) List(ctx context.Context) ([]Object, error) {
+	var objs []Object
+	w := s.client().Walk(s.dir)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			if w.Path() == s.dir && errors.Is(err, fs.ErrNotExist) {
+				// A missing root is an empty tree, created by the first Put.
+				return nil, nil
+			}
+			return nil, fmt.Errorf("list %s: %w", w.Path(), err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if info := w.Stat(); info.Mode().IsRegular() {
+			objs = append(objs, s.object(s.rel(w.Path()), info))
+		}
+	}
+	return objs, nil
+}
+
+// Stat implements Tree.
+func (s *SFTP) Stat(_ context.Context, name string) (Object, error) {
+	info, err := s.client().Stat(s.path(name))
+	if err != nil {
+		return Object{}, fmt.Errorf("stat %s: %w", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return Object{}, fmt.Errorf("%s: not a regular file", name)
+	}
+	return s.object(name, info), nil
+}
+
+// Open implements Tree.
+func (s *SFTP) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	f, err := s.client().Open(s.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// Put implements Tree. The content is written to a temporary file renamed over the file once complete,
+// so a failed put never leaves a partial file behind.
+func (s *SFTP) Put(_ context.Context, obj Object, r io.Reader) error {
+	c := s.client()
+	dst := s.path(obj.Name)
+	var rnd [8]byte
+	_, err := rand.Read(rnd[:])
+	tmp := path.Join(path.Dir(dst), ".octopus-"+hex.EncodeToString(rnd[:]))
+
+	if err == nil {
+		err = c.MkdirAll(path.Dir(dst))
+	}
+	if err == nil {
+		err = s.write(c, tmp, obj, r)
+	}
+	if err == nil {
+		if err = c.PosixRename(tmp, dst); err != nil {
+			// Servers without the posix-rename extension refuse to rename over an existing file.
+			if e := c.Remove(dst); e == nil || errors.Is(e, fs.ErrNotExist) {
+				err = c.Rename(tmp, dst)
+			}
+		}
+	}
+	if err != nil {
+		_ = c.Remove(tmp)
+		return fmt.Errorf("put %s: %w", obj.Name, err)
+	}
+	return nil
+}
+
+// write writes the content of the object to a new file at p with its permissions and modification time.
+func (s *SFTP) write(c *sftp.Client, p string, obj Object, r io.Reader) error {
+	f, err := c.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	err = copyExactly(f, r, obj)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = c.Chmod(p, objectInfo{obj}.Mode())
+	}
+	if err == nil {
+		err = c.Chtimes(p, obj.ModTime, obj.ModTime)
+	}
+	return err
+}
+
+// Delete implements Tree.
+func (s *SFTP) Delete(_ context.Context, name string) error {
+	if err := s.client().Remove(s.path(name)); err != nil {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// client returns the client of the next request, in turn.
+func (s *SFTP) client() *sftp.Client {
+	return s.clients[int(atomic.AddUint32(&s.next, 1))%len(s.clients)]
+}
+
+// path returns the path on the server of the file with the name.
+func (s *SFTP) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// rel returns the name of the file at the path p on the server.
+func (s *SFTP) rel(p string) string {
+	switch s.dir {
+	case ".":
+		return p
+	case "/":
+		return p[1:]
+	}
+	return strings.TrimPrefix(p, s.dir+"/")
+}
+
+// object returns the object with the name and the file info.
+func (s *SFTP) object(name string, info os.FileInfo) Object {
+	return Object{Name: name, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode().Perm()}
+}
@@ -0,0 +1,225 @@
+package backends
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/dirsync"
+	"github.com/gromey/octopus/throttle"
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	HashFunc    func() hash.Hash // Compare objects by hash when set, otherwise by size and modification time.
+	Algorithm   string           // Name of the algorithm of HashFunc, see Object.Algorithm.
+	Delete      bool             // Delete objects from the destination that do not exist in the source.
+	DryRun      bool             // Only plan the actions without touching the destination.
+	Concurrency int              // Maximum number of objects hashed, copied or deleted at once, defaults to 1.
+
+	BandwidthLimit int64 // Maximum number of bytes copied per second by all the copies together, unlimited if 0.
+	TransferLimit  int64 // Maximum number of bytes copied per second by each copy, unlimited if 0.
+}
+
+// Sync makes the destination tree a copy of the source tree, one way: new and changed objects are copied
+// with their modification time and hash, and, if requested, objects missing from the source are deleted from
+// the destination. Objects are compared as in diff.Changed, with the modification times truncated to
+// the coarsest ModTimePrecision of the trees implementing it. With a HashFunc, the objects whose tree does not
+// know their hash for the algorithm are read to compute it: all of those of the source, and those of
+// the destination with the size of their source. When the context is done, the actions performed so far
+// are returned with the error of the context.
+func Sync(ctx context.Context, src, dst Tree, opts SyncOptions) (*dirsync.Result, error) {
+	srcObjs, err := src.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstObjs, err := dst.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.HashFunc != nil {
+		sizes := make(map[string]int64, len(srcObjs))
+		for _, obj := range srcObjs {
+			sizes[obj.Name] = obj.Size
+		}
+		errs := parallel(ctx, opts.Concurrency, len(srcObjs), func(i int) error {
+			return fillHash(ctx, src, &srcObjs[i], opts.HashFunc, opts.Algorithm)
+		})
+		if err = errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		errs = parallel(ctx, opts.Concurrency, len(dstObjs), func(i int) error {
+			if size, ok := sizes[dstObjs[i].Name]; ok && size == dstObjs[i].Size {
+				return fillHash(ctx, dst, &dstObjs[i], opts.HashFunc, opts.Algorithm)
+			}
+			return nil
+		})
+		if err = errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	precision := modTimePrecision(src)
+	if p := modTimePrecision(dst); p > precision {
+		precision = p
+	}
+	byPath := make(map[string]Object, len(srcObjs))
+	srcFiles := make([]dirreader.FileInfo, len(srcObjs))
+	for i, obj := range srcObjs {
+		byPath[fromSlash(obj.Name)] = obj
+		obj.ModTime = obj.ModTime.Truncate(precision)
+		srcFiles[i] = fileInfo(obj, opts.Algorithm, "")
+	}
+	dstFiles := make([]dirreader.FileInfo, len(dstObjs))
+	for i, obj := range dstObjs {
+		obj.ModTime = obj.ModTime.Truncate(precision)
+		dstFiles[i] = fileInfo(obj, opts.Algorithm, "")
+	}
+
+	var actions []dirsync.Action
+	for _, c := range diff.Compare(dstFiles, srcFiles) {
+		switch c.Op {
+		case diff.Added, diff.Modified:
+			actions = append(actions, dirsync.Action{Op: dirsync.Copy, Path: c.Path, Size: c.New.Size()})
+		case diff.Removed:
+			if opts.Delete {
+				actions = append(actions, dirsync.Action{Op: dirsync.Delete, Path: c.Path, Size: c.Old.Size()})
+			}
+		}
+	}
+
+	done := make([]bool, len(actions))
+	if opts.DryRun {
+		for i := range done {
+			done[i] = true
+		}
+	} else {
+		aggregate := throttle.New(opts.BandwidthLimit)
+		errs := parallel(ctx, opts.Concurrency, len(actions), func(i int) error {
+			a := actions[i]
+			var err error
+			if a.Op == dirsync.Copy {
+				err = copyObject(ctx, src, dst, byPath[a.Path], aggregate, throttle.New(opts.TransferLimit))
+			} else {
+				err = dst.Delete(ctx, filepath.ToSlash(a.Path))
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", a.Op, a.Path, err)
+			}
+			done[i] = true
+			return nil
+		})
+		err = errors.Join(errs...)
+	}
+
+	res := new(dirsync.Result)
+	for i, a := range actions {
+		if !done[i] {
+			continue
+		}
+		res.Actions = append(res.Actions, a)
+		switch a.Op {
+		case dirsync.Copy:
+			res.Copied++
+			res.Bytes += a.Size
+		case dirsync.Delete:
+			res.Deleted++
+		}
+	}
+	if ctx.Err() != nil {
+		err = errors.Join(err, ctx.Err())
+	}
+
+	return res, err
+}
+
+// modTimePrecision returns the precision of the modification times the tree keeps, as reported by
+// its ModTimePrecision method, or 0 if it keeps them as they are.
+func modTimePrecision(t Tree) time.Duration {
+	if p, ok := t.(interface{ ModTimePrecision() time.Duration }); ok {
+		return p.ModTimePrecision()
+	}
+	return 0
+}
+
+// parallel calls fn for the indexes from 0 to n-1, concurrency at once, at least one, and returns
+// the errors of the calls by index. The calls not yet started when the context is done are skipped.
+func parallel(ctx context.Context, concurrency, n int, fn func(i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// fillHash computes the hash of the object with hashFunc, unless its tree knows it for the algorithm.
+func fillHash(ctx context.Context, t Tree, obj *Object, hashFunc func() hash.Hash, algorithm string) error {
+	if obj.Hash != "" && obj.Algorithm == algorithm {
+		return nil
+	}
+	sum, err := hashObject(ctx, t, *obj, hashFunc)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", obj.Name, err)
+	}
+	obj.Hash, obj.Algorithm = sum, algorithm
+	return nil
+}
+
+// copyObject copies the object from the source to the destination tree, its content read at the rate the limiters
+// allow, those that are not nil.
+func copyObject(ctx context.Context, src, dst Tree, obj Object, limiters ...*throttle.Limiter) error {
+	rc, err := src.Open(ctx, obj.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	var r io.Reader = rc
+	for _, l := range limiters {
+		r = l.Reader(ctx, r)
+	}
+	return dst.Put(ctx, obj, r)
+}
+
+// sortFiles sorts the files by relative path.
+func sortFiles(files []dirreader.FileInfo) {
+	sort.Slice(files, func(i, j int) bool { return files[i].RelPath() < files[j].RelPath() })
+}
+
+// fromSlash returns the directory of a name, as the relative directory of a scan result.
+func fromSlash(dir string) string {
+	if dir == "." {
+		return ""
+	}
+	return filepath.FromSlash(dir)
+}
+
+// hexSum returns the hex-encoded sum of the hash.
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
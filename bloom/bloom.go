@@ -0,0 +1,179 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// magic identifies an encoded filter, followed by the format version.
+const (
+	magic   = "OCTBLOOM"
+	version = 1
+)
+
+// headerLen is the length of the fixed part of the header: the magic, the version, the number of bits,
+// the number of bit positions, the number of hashes and the length of the algorithm name.
+const headerLen = len(magic) + 1 + 8 + 4 + 8 + 2
+
+// ErrFormat is returned when decoding data that is not an encoded filter.
+var ErrFormat = errors.New("invalid bloom filter")
+
+// Filter is a Bloom filter over content hashes. It answers whether a hash was probably added,
+// with a bounded rate of false positives and no false negatives, in a fraction of the size of a manifest.
+type Filter struct {
+	Algorithm string // Name of the hash algorithm the content hashes were computed with, e.g. "sha256" (optional).
+	n         uint64 // Number of hashes added.
+	m         uint64 // Number of bits.
+	k         uint32 // Number of bit positions per hash.
+	bits      []byte
+}
+
+// New returns an empty filter sized for n hashes with a false positive rate of p, e.g. 0.01 for 1%.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{m: m, k: k, bits: make([]byte, (m+7)/8)}
+}
+
+// FromFiles returns a filter over the content hashes of the files with a false positive rate of p.
+// Files without a hash are an error, since a filter missing them would give false negatives.
+func FromFiles(files []dirreader.FileInfo, algorithm string, p float64) (*Filter, error) {
+	f := New(len(files), p)
+	f.Algorithm = algorithm
+
+	for _, fi := range files {
+		if fi.Hash == "" {
+			return nil, fmt.Errorf("file %s has no hash", fi.PathAbs)
+		}
+		f.Add(fi.Hash)
+	}
+
+	return f, nil
+}
+
+// Add adds the hex-encoded content hash to the filter. Hashes are matched case-insensitively.
+func (f *Filter) Add(hash string) {
+	h1, h2 := f.hashes(hash)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+	f.n++
+}
+
+// Test reports whether the hex-encoded content hash was probably added to the filter.
+// A false result means the hash was certainly not added.
+func (f *Filter) Test(hash string) bool {
+	h1, h2 := f.hashes(hash)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of hashes added to the filter.
+func (f *Filter) Len() int {
+	return int(f.n)
+}
+
+// FalsePositiveRate returns the estimated probability that Test reports a hash that was not added.
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.n)/float64(f.m)), float64(f.k))
+}
+
+// hashes returns the two hashes combined to derive the bit positions of the hash, see Kirsch and Mitzenmacher.
+func (f *Filter) hashes(hash string) (uint64, uint64) {
+	key := []byte(strings.ToLower(hash))
+
+	a := fnv.New64a()
+	_, _ = a.Write(key)
+	b := fnv.New64()
+	_, _ = b.Write(key)
+
+	// An odd step visits distinct positions.
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// WriteTo writes the filter in its binary format: a header with the magic, the version, the number of bits,
+// bit positions and hashes, and the algorithm name, followed by the bits.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	hdr := make([]byte, headerLen, headerLen+len(f.Algorithm))
+	copy(hdr, magic)
+	hdr[len(magic)] = version
+	p := hdr[len(magic)+1:]
+	binary.BigEndian.PutUint64(p, f.m)
+	binary.BigEndian.PutUint32(p[8:], f.k)
+	binary.BigEndian.PutUint64(p[12:], f.n)
+	binary.BigEndian.PutUint16(p[20:], uint16(len(f.Algorithm)))
+	hdr = append(hdr, f.Algorithm...)
+
+	n, err := w.Write(hdr)
+	if err != nil {
+		return int64(n), err
+	}
+	nb, err := w.Write(f.bits)
+
+	return int64(n + nb), err
+}
+
+// Read reads a filter written by WriteTo.
+func Read(r io.Reader) (*Filter, error) {
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	if v := hdr[len(magic)]; v != version {
+		return nil, fmt.Errorf("unsupported bloom filter version %d", v)
+	}
+
+	p := hdr[len(magic)+1:]
+	f := &Filter{
+		m: binary.BigEndian.Uint64(p),
+		k: binary.BigEndian.Uint32(p[8:]),
+		n: binary.BigEndian.Uint64(p[12:]),
+	}
+	if f.m == 0 || f.k == 0 || f.m > math.MaxInt32*8 {
+		return nil, ErrFormat
+	}
+
+	algorithm := make([]byte, binary.BigEndian.Uint16(p[20:]))
+	f.bits = make([]byte, (f.m+7)/8)
+	for _, b := range [][]byte{algorithm, f.bits} {
+		if _, err := io.ReadFull(r, b); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, ErrFormat
+			}
+			return nil, err
+		}
+	}
+	f.Algorithm = string(algorithm)
+
+	return f, nil
+}
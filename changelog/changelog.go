@@ -0,0 +1,263 @@
+package changelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Event represents a change persisted in the log.
+type Event struct {
+	Seq  uint64    `json:"seq"`            // Sequence number of the event, starting at 1 and strictly increasing.
+	Time time.Time `json:"time"`           // Time the change was recorded.
+	Root string    `json:"root,omitempty"` // Root directory the change was detected in.
+	diff.Change
+}
+
+// Log is an append-only change log stored as newline-delimited JSON.
+// Every appended event gets the next sequence number, so consumers can track their position with a Cursor.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+}
+
+// Open opens the change log located at the provided path, creating it if needed.
+// A trailing incomplete record left by an interrupted write is discarded.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open change log %s: %w", path, err)
+	}
+
+	l := &Log{path: path, file: f}
+
+	var valid int64
+	err = l.scan(func(e Event, end int64) bool {
+		l.seq = e.Seq
+		valid = end
+		return true
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// Drop whatever follows the last complete record and continue writing after it.
+	if err = f.Truncate(valid); err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("open change log %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Seq returns the sequence number of the last event in the log, or 0 if the log is empty.
+func (l *Log) Seq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// Append persists the provided changes detected in root and returns the resulting events.
+// The events are synced to disk before Append returns.
+func (l *Log) Append(root string, changes []diff.Change) ([]Event, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	seq := l.seq
+	events := make([]Event, len(changes))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, c := range changes {
+		seq++
+		events[i] = Event{Seq: seq, Time: now, Root: root, Change: c}
+		if err := enc.Encode(events[i]); err != nil {
+			return nil, fmt.Errorf("append to change log %s: %w", l.path, err)
+		}
+	}
+
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("append to change log %s: %w", l.path, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return nil, fmt.Errorf("append to change log %s: %w", l.path, err)
+	}
+
+	l.seq = seq
+
+	return events, nil
+}
+
+// Record compares two successive scans of root and appends the detected changes to the log.
+func (l *Log) Record(root string, old, new []dirreader.FileInfo) ([]Event, error) {
+	return l.Append(root, diff.Compare(old, new))
+}
+
+// Read returns up to limit events with a sequence number greater than after.
+// If limit is not positive, all such events are returned.
+func (l *Log) Read(after uint64, limit int) ([]Event, error) {
+	var events []Event
+	err := l.scan(func(e Event, _ int64) bool {
+		if e.Seq > after {
+			events = append(events, e)
+		}
+		return limit <= 0 || len(events) < limit
+	})
+	return events, err
+}
+
+// scan decodes the complete records of the log in order and calls fn with each event and the offset following it,
+// until fn returns false.
+func (l *Log) scan(fn func(e Event, end int64) bool) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("read change log %s: %w", l.path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil // An incomplete trailing record is not part of the log.
+			}
+			return fmt.Errorf("read change log %s: %w", l.path, err)
+		}
+		offset += int64(len(line))
+
+		var e Event
+		if err = json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("read change log %s at offset %d: %w", l.path, offset-int64(len(line)), err)
+		}
+
+		if !fn(e, offset) {
+			return nil
+		}
+	}
+}
+
+// Cursor tracks the position of a named consumer in the log.
+// The position is persisted next to the log, so a consumer that commits each event after processing it
+// receives every event exactly once, even across restarts.
+type Cursor struct {
+	log  *Log
+	path string
+	pos  uint64
+}
+
+// Cursor returns the cursor of the named consumer, starting at the beginning of the log for a new consumer.
+func (l *Log) Cursor(name string) (*Cursor, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid cursor name %q", name)
+	}
+
+	dir := l.path + ".cursors"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cursor %s: %w", name, err)
+	}
+
+	c := &Cursor{log: l, path: filepath.Join(dir, name)}
+
+	data, err := os.ReadFile(c.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read cursor %s: %w", name, err)
+	default:
+		if c.pos, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, fmt.Errorf("read cursor %s: %w", name, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Position returns the sequence number of the last committed event.
+func (c *Cursor) Position() uint64 {
+	return c.pos
+}
+
+// Next returns up to limit events following the last committed one.
+// Calling Next again without committing returns the same events.
+func (c *Cursor) Next(limit int) ([]Event, error) {
+	return c.log.Read(c.pos, limit)
+}
+
+// Commit marks all events up to and including seq as consumed and persists the position atomically.
+// The sequence number must be neither behind the position, nor past the last event of the log.
+func (c *Cursor) Commit(seq uint64) error {
+	if seq < c.pos {
+		return fmt.Errorf("commit cursor: sequence %d is behind position %d", seq, c.pos)
+	}
+	if last := c.log.Seq(); seq > last {
+		return fmt.Errorf("commit cursor: sequence %d is past the last event %d", seq, last)
+	}
+
+	// The position is flushed to disk before it replaces the previous one, and the rename after, so that a crash
+	// leaves either position, never an empty file.
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("commit cursor: %w", err)
+	}
+	_, err = f.WriteString(strconv.FormatUint(seq, 10) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("commit cursor: %w", err)
+	}
+	if err = os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("commit cursor: %w", err)
+	}
+	syncDir(filepath.Dir(c.path))
+
+	c.pos = seq
+
+	return nil
+}
+
+// syncDir flushes the directory to disk, so that the rename of a file into it survives a crash. Errors are
+// ignored: some platforms and filesystems cannot sync directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
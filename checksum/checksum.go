@@ -0,0 +1,248 @@
+package checksum
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/throttle"
+)
+
+// Style represents a checksum file format.
+type Style int
+
+const (
+	GNU Style = iota // GNU coreutils format: "<hash>  <path>", as written by sha256sum.
+	BSD              // BSD format: "<ALGORITHM> (<path>) = <hash>", as written by sha256sum --tag.
+)
+
+// Entry represents a line of a checksum file.
+type Entry struct {
+	Hash      string // Hex-encoded hash of the file.
+	Path      string // Slash-separated path of the file, relative to the checksum file's directory.
+	Algorithm string // Algorithm name, only present in the BSD format, e.g. "SHA256".
+	Binary    bool   // Whether the GNU entry is marked as read in binary mode ("*" before the path).
+}
+
+// Write writes a checksum line for each file in the provided style, sorted by relative path.
+// The algorithm name, e.g. "SHA256" or "MD5", is only used by the BSD style.
+// Files without a hash are skipped.
+func Write(w io.Writer, files []dirreader.FileInfo, style Style, algorithm string) error {
+	entries := make([]Entry, 0, len(files))
+	for _, fi := range files {
+		if fi.Hash == "" {
+			continue
+		}
+		entries = append(entries, Entry{Hash: fi.Hash, Path: filepath.ToSlash(fi.RelPath()), Algorithm: algorithm})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	return WriteEntries(w, entries, style)
+}
+
+// WriteEntries writes the entries in the provided style.
+// Paths containing a backslash or a newline are escaped the way coreutils does it.
+func WriteEntries(w io.Writer, entries []Entry, style Style) error {
+	bw := bufio.NewWriter(w)
+
+	for _, e := range entries {
+		prefix, path := "", e.Path
+		if strings.ContainsAny(path, "\\\n") {
+			prefix = "\\"
+			path = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(path)
+		}
+
+		switch style {
+		case GNU:
+			mode := " "
+			if e.Binary {
+				mode = "*"
+			}
+			_, _ = fmt.Fprintf(bw, "%s%s %s%s\n", prefix, e.Hash, mode, path)
+		case BSD:
+			_, _ = fmt.Fprintf(bw, "%s%s (%s) = %s\n", prefix, e.Algorithm, path, e.Hash)
+		default:
+			return fmt.Errorf("unknown checksum style %d", style)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Read parses a checksum file. Both styles are recognized, even mixed in the same file.
+// Empty lines and lines starting with "#" are ignored.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// bsdLine matches a line in the BSD style: ALGORITHM (path) = hash. The path may itself contain ") = ".
+var bsdLine = regexp.MustCompile(`^(\S+) \((.*)\) = ([0-9A-Fa-f]+)$`)
+
+// parseLine parses a single line in either style. The GNU style is tried first, since its paths may contain " (",
+// e.g. "Copy (2).txt".
+func parseLine(line string) (Entry, error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var e Entry
+	if i := strings.IndexByte(line, ' '); i > 0 && isHex(line[:i]) && len(line) >= i+3 && (line[i+1] == ' ' || line[i+1] == '*') {
+		// GNU style: hash, a space, a mode character and the path.
+		e.Hash, e.Binary, e.Path = line[:i], line[i+1] == '*', line[i+2:]
+	} else if m := bsdLine.FindStringSubmatch(line); m != nil {
+		e.Algorithm, e.Path, e.Hash = m[1], m[2], m[3]
+	} else {
+		return e, errors.New("improperly formatted checksum line")
+	}
+
+	if !isHex(e.Hash) {
+		return e, fmt.Errorf("invalid hash %q", e.Hash)
+	}
+
+	if escaped {
+		var sb strings.Builder
+		for k := 0; k < len(e.Path); k++ {
+			if e.Path[k] == '\\' && k+1 < len(e.Path) {
+				k++
+				switch e.Path[k] {
+				case 'n':
+					sb.WriteByte('\n')
+				case '\\':
+					sb.WriteByte('\\')
+				default:
+					return e, fmt.Errorf("invalid escape sequence in %q", e.Path)
+				}
+				continue
+			}
+			sb.WriteByte(e.Path[k])
+		}
+		e.Path = sb.String()
+	}
+
+	return e, nil
+}
+
+func isHex(s string) bool {
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Status represents the outcome of checking a single entry.
+type Status string
+
+const (
+	OK      Status = "OK"      // The file content matches the hash.
+	Failed  Status = "FAILED"  // The file content does not match the hash.
+	Missing Status = "MISSING" // The file does not exist.
+	Error   Status = "ERROR"   // The file exists but could not be read.
+)
+
+// Result represents the outcome of checking a single entry.
+type Result struct {
+	Entry
+	Status Status // Outcome of the check.
+	Err    error  // Problem encountered when the status is Missing or Error.
+}
+
+// Check verifies the entries against the files in dir, like "sha256sum -c" run from dir, with as many workers
+// as GOMAXPROCS, and returns a result for each entry in the same order.
+//   - entries: entries to verify, e.g. the result of Read.
+//   - dir: directory the paths of the entries are relative to.
+//   - hashFunc: function used to compute the hashes, matching the one used to produce the entries.
+func Check(entries []Entry, dir string, hashFunc func() hash.Hash) []Result {
+	results := make([]Result, len(entries))
+
+	var wg sync.WaitGroup
+	tasks := make(chan int)
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				results[i] = check(entries[i], dir, hashFunc)
+			}
+		}()
+	}
+	for i := range entries {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+
+	return results
+}
+
+// check verifies a single entry.
+func check(e Entry, dir string, hashFunc func() hash.Hash) Result {
+	res := Result{Entry: e}
+
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		res.Status, res.Err = Error, err
+		if errors.Is(err, os.ErrNotExist) {
+			res.Status = Missing
+		}
+		return res
+	}
+	defer func() { _ = f.Close() }()
+
+	h := hashFunc()
+	if _, err = io.Copy(h, throttle.Global().Reader(context.Background(), f)); err != nil {
+		res.Status, res.Err = Error, err
+		return res
+	}
+
+	res.Status = Failed
+	if strings.EqualFold(hex.EncodeToString(h.Sum(nil)), e.Hash) {
+		res.Status = OK
+	}
+
+	return res
+}
+
+// Summary counts the results by status.
+func Summary(results []Result) map[Status]int {
+	counts := make(map[Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	return counts
+}
@@ -0,0 +1,47 @@
+package checksum
+
+import "testing"
+
+func TestParseLine(t *testing.T) {
+	const hash = "d41d8cd98f00b204e9800998ecf8427e"
+	tests := []struct {
+		line string
+		want Entry
+	}{
+		{hash + "  file.txt", Entry{Hash: hash, Path: "file.txt"}},
+		{hash + "  Copy (2).txt", Entry{Hash: hash, Path: "Copy (2).txt"}},
+		{hash + " *dir/Copy (2) = x.bin", Entry{Hash: hash, Path: "dir/Copy (2) = x.bin", Binary: true}},
+		{"\\" + hash + "  a\\nb (1)", Entry{Hash: hash, Path: "a\nb (1)"}},
+		{"MD5 (file.txt) = " + hash, Entry{Algorithm: "MD5", Path: "file.txt", Hash: hash}},
+		{"MD5 (Copy (2).txt) = " + hash, Entry{Algorithm: "MD5", Path: "Copy (2).txt", Hash: hash}},
+		{"MD5 (a) = b) = " + hash, Entry{Algorithm: "MD5", Path: "a) = b", Hash: hash}},
+	}
+	for _, tt := range tests {
+		got, err := parseLine(tt.line)
+		if err != nil {
+			t.Errorf("parseLine(%q): %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"file.txt",
+		"d41d8cd98f00b204e9800998ecf8427e",
+		"d41d8cd98f00b204e9800998ecf8427e file.txt",
+		"nothex  Copy (2).txt",
+		"MD5 (file.txt) = nothex",
+		"MD5 (file.txt)",
+		"MD5 file.txt) = d41d8cd98f00b204e9800998ecf8427e",
+		"MD5 (file.txt) = abc",
+	} {
+		if e, err := parseLine(line); err == nil {
+			t.Errorf("parseLine(%q) = %+v, want an error", line, e)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package checksum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// maxFetchSize is the size of the largest checksum file Fetch downloads.
+const maxFetchSize = 256 << 20
+
+// Fetch downloads the checksum file, or any other file, at the HTTP or HTTPS URL. With a cache directory,
+// the file is kept there along with its ETag, and the next fetch asks the server to only send it again
+// if it changed, using If-None-Match. A cached file is never used without the server confirming it is current.
+func Fetch(ctx context.Context, client *http.Client, url, cacheDir string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var cached, etag []byte
+	var cachePath string
+	if cacheDir != "" {
+		sum := sha256.Sum256([]byte(url))
+		cachePath = filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+		if e, err := os.ReadFile(cachePath + ".etag"); err == nil {
+			if cached, err = os.ReadFile(cachePath); err == nil {
+				etag = e
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", string(etag))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && len(etag) > 0:
+		return cached, nil
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1))
+	if err == nil && len(data) > maxFetchSize {
+		err = fmt.Errorf("larger than %d bytes", maxFetchSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+
+	if cachePath != "" {
+		// The cache only saves downloads: failing to update it does not fail the fetch.
+		_ = os.Remove(cachePath + ".etag")
+		if e := resp.Header.Get("ETag"); e != "" && writeCache(cacheDir, cachePath, data) == nil {
+			_ = writeCache(cacheDir, cachePath+".etag", []byte(e))
+		}
+	}
+
+	return data, nil
+}
+
+// writeCache writes the data to the file at path in the cache directory, through a temporary file.
+func writeCache(dir, path string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".fetch-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// Files returns the entries as scan results holding only their path and hash,
+// e.g. to compare a checksum file with a scan using diff.Compare.
+func Files(entries []Entry) []dirreader.FileInfo {
+	files := make([]dirreader.FileInfo, len(entries))
+	for i, e := range entries {
+		dir, name := path.Split(e.Path)
+		files[i] = dirreader.FileInfo{
+			FileInfo: entryInfo{name: name},
+			PathAbs:  e.Path,
+			PathRel:  filepath.FromSlash(strings.TrimSuffix(dir, "/")),
+			Hash:     strings.ToLower(e.Hash),
+		}
+	}
+	return files
+}
+
+// entryInfo is the os.FileInfo of an entry, of which only the name is known.
+type entryInfo struct {
+	name string
+}
+
+func (i entryInfo) Name() string       { return i.name }
+func (i entryInfo) Size() int64        { return 0 }
+func (i entryInfo) Mode() os.FileMode  { return 0 }
+func (i entryInfo) ModTime() time.Time { return time.Time{} }
+func (i entryInfo) IsDir() bool        { return false }
+func (i entryInfo) Sys() interface{}   { return nil }
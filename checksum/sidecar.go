@@ -0,0 +1,83 @@
+package checksum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// SidecarExt returns the extension of the sidecar checksum files of the algorithm, e.g. ".sha256" for "SHA256".
+func SidecarExt(algorithm string) string {
+	return "." + strings.ToLower(algorithm)
+}
+
+// WriteSidecars writes next to each hashed file a sidecar checksum file named after it with the extension of the
+// algorithm, e.g. "a.txt.sha256", holding its entry in the style with its name as path, so that running
+// "sha256sum -c a.txt.sha256" in its directory checks it. Sidecars among the files are skipped.
+// It returns the number of sidecars written, with the errors joined if some could not be written.
+func WriteSidecars(files []dirreader.FileInfo, style Style, algorithm string) (int, error) {
+	ext := SidecarExt(algorithm)
+
+	var n int
+	var errs []error
+	for _, fi := range files {
+		if fi.Hash == "" || strings.HasSuffix(strings.ToLower(fi.Name()), ext) {
+			continue
+		}
+
+		var b bytes.Buffer
+		if err := WriteEntries(&b, []Entry{{Hash: fi.Hash, Path: fi.Name(), Algorithm: algorithm}}, style); err != nil {
+			return n, err
+		}
+		if err := os.WriteFile(fi.PathAbs+ext, b.Bytes(), 0o644); err != nil {
+			errs = append(errs, fmt.Errorf("write sidecar of %s: %w", fi.PathAbs, err))
+			continue
+		}
+		n++
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// CheckSidecars verifies the files under root against the sidecar checksum files of the algorithm found next to
+// them, see WriteSidecars, and returns a result for each entry of the sidecars, sorted by path. The paths of the
+// results are slash-separated and relative to root. Files without a sidecar are not checked.
+func CheckSidecars(root, algorithm string, hashFunc func() hash.Hash, opts ...dirreader.Option) ([]Result, error) {
+	sidecars, err := dirreader.Exec(root, nil, []string{SidecarExt(algorithm)}, true, append(opts[:len(opts):len(opts)], dirreader.WithMaskFold(true))...)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	var errs []error
+	for _, sc := range sidecars {
+		data, err := os.ReadFile(sc.PathAbs)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entries, err := Read(bytes.NewReader(data))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sc.PathAbs, err))
+			continue
+		}
+
+		rel := filepath.ToSlash(sc.PathRel)
+		for _, r := range Check(entries, filepath.Dir(sc.PathAbs), hashFunc) {
+			r.Path = path.Join(rel, r.Path)
+			results = append(results, r)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+
+	return results, errors.Join(errs...)
+}
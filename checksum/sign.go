@@ -0,0 +1,84 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// signaturePrefix starts the header line holding the signature of a checksum file.
+// The line is a comment, so that signed files are still read by Read and by the coreutils tools.
+const signaturePrefix = "# signature: ed25519 "
+
+// ErrUnsigned is returned when verifying the signature of a checksum file that is not signed.
+var ErrUnsigned = errors.New("checksum file is not signed")
+
+// ErrKeyMismatch is returned when verifying a checksum file signed with another key.
+var ErrKeyMismatch = errors.New("checksum file is signed with another key")
+
+// ErrBadSignature is returned when the signature of a checksum file does not match its content.
+var ErrBadSignature = errors.New("checksum file signature is invalid")
+
+// Fingerprint returns the fingerprint of the public key, "SHA256:" followed by the unpadded base64
+// of the SHA-256 of the key, like the fingerprints of OpenSSH.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Sign returns the checksum file signed with the private key: a header line holding the fingerprint
+// of the public key and the ed25519 signature of the content is prepended to it, replacing any previous one.
+func Sign(manifest []byte, key ed25519.PrivateKey) []byte {
+	content := unsigned(manifest)
+	sig := ed25519.Sign(key, content)
+
+	var b bytes.Buffer
+	b.WriteString(signaturePrefix)
+	b.WriteString(Fingerprint(key.Public().(ed25519.PublicKey)))
+	b.WriteByte(' ')
+	b.WriteString(base64.StdEncoding.EncodeToString(sig))
+	b.WriteByte('\n')
+	b.Write(content)
+
+	return b.Bytes()
+}
+
+// VerifySignature verifies the signature of a checksum file signed by Sign against the public key.
+// It returns ErrUnsigned if the file has no signature, ErrKeyMismatch if it was signed with another key,
+// and ErrBadSignature if the content was modified since it was signed.
+func VerifySignature(manifest []byte, pub ed25519.PublicKey) error {
+	line, content, ok := bytes.Cut(manifest, []byte{'\n'})
+	if !ok || !bytes.HasPrefix(line, []byte(signaturePrefix)) {
+		return ErrUnsigned
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line[len(signaturePrefix):]), "\r"))
+	if len(fields) != 2 {
+		return fmt.Errorf("%w: malformed signature line", ErrBadSignature)
+	}
+	if fields[0] != Fingerprint(pub) {
+		return fmt.Errorf("%w: signed by %s", ErrKeyMismatch, fields[0])
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || !ed25519.Verify(pub, content, sig) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// unsigned returns the checksum file without its signature line.
+func unsigned(manifest []byte) []byte {
+	if bytes.HasPrefix(manifest, []byte(signaturePrefix)) {
+		if _, content, ok := bytes.Cut(manifest, []byte{'\n'}); ok {
+			return content
+		}
+		return nil
+	}
+	return manifest
+}
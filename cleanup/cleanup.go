@@ -0,0 +1,352 @@
+// Package cleanup deletes the files of a tree matching rules such as "older than 90 days", "larger than 1 GiB"
+// or "named *.tmp", the hygiene of logs and temporary files.
+//
+// Deletions always follow a dry run: Evaluate reports the files each rule selects, with per-rule statistics,
+// and only the files of such a report, reviewed and possibly saved as JSON, are deleted by Report.Execute,
+// provided they did not change since. The report may also prune the empty directories of the scan, see
+// Report.Prune. Rules are defined in JSON:
+//
+//	[
+//	  {"name": "old-logs", "paths": ["var/log"], "names": ["*.log", "*.log.gz"], "olderThan": "90d"},
+//	  {"name": "tmp", "names": ["*.tmp"], "olderThan": "1d"},
+//	  {"name": "huge-dumps", "names": ["*.dmp"], "largerThan": "1GiB"}
+//	]
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/alert"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Rule selects the files matching all of its criteria. A rule requires at least one criterion, so that
+// a mistake does not select every file.
+type Rule struct {
+	Name       string   `json:"name"`                 // Name of the rule, for the statistics and the audit log.
+	Paths      []string `json:"paths,omitempty"`      // Patterns of the slash-separated relative paths, see alert.Match, any if empty.
+	Names      []string `json:"names,omitempty"`      // Patterns of the file names, e.g. "*.tmp", see path.Match, any if empty.
+	OlderThan  string   `json:"olderThan,omitempty"`  // Minimum time since the last modification, e.g. "90d", "2w" or "12h", see ParseAge.
+	LargerThan string   `json:"largerThan,omitempty"` // Minimum size, e.g. "1GiB" or "500MB", see ParseSize.
+
+	age  time.Duration
+	size int64
+}
+
+// Stats represents the files selected by a rule.
+type Stats struct {
+	Rule  string `json:"rule"`  // Name of the rule.
+	Files int    `json:"files"` // Number of files selected by the rule, and not by a previous one.
+	Bytes int64  `json:"bytes"` // Total size of the files.
+}
+
+// Candidate represents a file selected for deletion.
+type Candidate struct {
+	Path    string    `json:"path"`    // Relative path of the file.
+	PathAbs string    `json:"pathAbs"` // Absolute path of the file.
+	Rule    string    `json:"rule"`    // Name of the first rule selecting the file.
+	Size    int64     `json:"size"`    // Size of the file when it was selected.
+	ModTime time.Time `json:"modTime"` // Modification time of the file when it was selected.
+}
+
+// Skipped represents a candidate or an empty directory that is not deleted, and why.
+type Skipped struct {
+	Path   string `json:"path"`   // Absolute path of the file or directory.
+	Reason string `json:"reason"` // Reason the file is not deleted.
+}
+
+// Report represents the outcome of a dry run: the files the rules select for deletion, and the empty directories.
+type Report struct {
+	Root       string      `json:"root"`       // Root of the scanned tree.
+	Time       time.Time   `json:"time"`       // Reference time of the ages.
+	Rules      []Rule      `json:"rules"`      // Rules evaluated.
+	Stats      []Stats     `json:"stats"`      // Statistics of the rules, in their order.
+	Candidates []Candidate `json:"candidates"` // Files selected for deletion, sorted by path.
+	Files      int         `json:"files"`      // Number of files selected.
+	Bytes      int64       `json:"bytes"`      // Total size of the files selected.
+
+	EmptyDirs []dirreader.EmptyDir `json:"emptyDirs,omitempty"` // Empty directories of the scan, see Prune.
+}
+
+// Load reads and validates the rules defined in the JSON file at path.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load cleanup rules %s: %w", path, err)
+	}
+
+	var rules []Rule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("load cleanup rules %s: %w", path, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("load cleanup rules %s: no rules", path)
+	}
+	if err = Validate(rules); err != nil {
+		return nil, fmt.Errorf("load cleanup rules %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// Validate checks that the rules are named, have at least one criterion, and that their patterns, ages and sizes
+// are valid. It records the parsed ages and sizes in the rules.
+func Validate(rules []Rule) error {
+	for i := range rules {
+		r := &rules[i]
+		var err error
+		switch {
+		case r.Name == "":
+			err = errors.New("name is required")
+		case len(r.Paths) == 0 && len(r.Names) == 0 && r.OlderThan == "" && r.LargerThan == "":
+			err = errors.New("at least one of paths, names, olderThan and largerThan is required")
+		}
+		for _, p := range append(r.Paths[:len(r.Paths):len(r.Paths)], r.Names...) {
+			if _, e := path.Match(p, ""); e != nil && err == nil {
+				err = fmt.Errorf("pattern %q: %w", p, e)
+			}
+		}
+		if r.OlderThan != "" && err == nil {
+			r.age, err = ParseAge(r.OlderThan)
+		}
+		if r.LargerThan != "" && err == nil {
+			r.size, err = ParseSize(r.LargerThan)
+		}
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate validates the rules and returns the files of the scan of root they select, each with the first rule
+// selecting it, as of now. Directories are never selected.
+func Evaluate(root string, files []dirreader.FileInfo, rules []Rule, now time.Time) (*Report, error) {
+	rules = append([]Rule(nil), rules...)
+	if err := Validate(rules); err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{Root: root, Time: now, Rules: rules, Stats: make([]Stats, len(rules)), Candidates: []Candidate{}}
+	for i, r := range rules {
+		rep.Stats[i].Rule = r.Name
+	}
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+		p := filepath.ToSlash(fi.RelPath())
+		for i, r := range rules {
+			if !r.selects(p, fi.Size(), now.Sub(fi.ModTime())) {
+				continue
+			}
+			rep.Candidates = append(rep.Candidates, Candidate{Path: fi.RelPath(), PathAbs: fi.PathAbs, Rule: r.Name, Size: fi.Size(), ModTime: fi.ModTime()})
+			rep.Stats[i].Files++
+			rep.Stats[i].Bytes += fi.Size()
+			rep.Files++
+			rep.Bytes += fi.Size()
+			break
+		}
+	}
+	sort.Slice(rep.Candidates, func(i, j int) bool { return rep.Candidates[i].Path < rep.Candidates[j].Path })
+
+	return rep, nil
+}
+
+// selects reports whether the rule selects the file at the slash-separated relative path p.
+func (r *Rule) selects(p string, size int64, age time.Duration) bool {
+	if r.OlderThan != "" && age <= r.age {
+		return false
+	}
+	if r.LargerThan != "" && size <= r.size {
+		return false
+	}
+	if len(r.Paths) > 0 && !matchAny(r.Paths, p, alert.Match) {
+		return false
+	}
+	if len(r.Names) > 0 && !matchAny(r.Names, path.Base(p), func(pattern, name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}) {
+		return false
+	}
+	return true
+}
+
+// matchAny reports whether one of the patterns matches s.
+func matchAny(patterns []string, s string, match func(pattern, s string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Read reads a report written as JSON, e.g. by a dry run, and validates its rules.
+func Read(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cleanup report %s: %w", path, err)
+	}
+	rep := new(Report)
+	if err = json.Unmarshal(data, rep); err != nil {
+		return nil, fmt.Errorf("read cleanup report %s: %w", path, err)
+	}
+	if err = Validate(rep.Rules); err != nil {
+		return nil, fmt.Errorf("read cleanup report %s: %w", path, err)
+	}
+	return rep, nil
+}
+
+// Prune adds the empty directories of the scan of the report to it, see dirreader.Stats.EmptyDirs. Execute removes
+// those without any file, after the candidates, and leaves those holding files excluded from the scan.
+func (r *Report) Prune(dirs []dirreader.EmptyDir) {
+	r.EmptyDirs = append(r.EmptyDirs, dirs...)
+}
+
+// Plan returns the deletion of the candidates, then the removal of the empty directories from the deepest, as
+// a plan, after checking them like Execute, and the candidates and directories that are skipped.
+func (r *Report) Plan() (*actions.Plan, []Skipped) {
+	plan := new(actions.Plan)
+	var skipped []Skipped
+	for _, c := range r.Candidates {
+		if reason := r.check(c); reason != "" {
+			skipped = append(skipped, Skipped{Path: c.PathAbs, Reason: reason})
+			continue
+		}
+		plan.Add(actions.Op{Kind: actions.Delete, Src: c.PathAbs, Size: c.Size, Reason: "cleanup rule " + c.Rule})
+	}
+
+	prune := make(map[string]bool)
+	for _, d := range r.EmptyDirs {
+		if !d.Filtered {
+			prune[d.PathAbs] = true
+		}
+	}
+	dirs := append([]dirreader.EmptyDir(nil), r.EmptyDirs...)
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].PathAbs > dirs[j].PathAbs })
+	for _, d := range dirs {
+		if d.Filtered {
+			continue
+		}
+		if reason := checkDir(d.PathAbs, prune); reason != "" {
+			skipped = append(skipped, Skipped{Path: d.PathAbs, Reason: reason})
+			delete(prune, d.PathAbs)
+			continue
+		}
+		plan.Add(actions.Op{Kind: actions.Delete, Src: d.PathAbs, Reason: "cleanup empty directory"})
+	}
+	return plan, skipped
+}
+
+// checkDir returns why the empty directory at path must not be removed, or an empty string: it must hold nothing
+// but directories that are removed before it.
+func checkDir(path string, prune map[string]bool) string {
+	entries, err := os.ReadDir(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "no longer exists"
+	case err != nil:
+		return err.Error()
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !prune[filepath.Join(path, e.Name())] {
+			return "no longer empty"
+		}
+	}
+	return ""
+}
+
+// Execute deletes the candidates of the report and removes its empty directories, as the options of the execution
+// of plans allow, see actions.Plan.Execute. Candidates that no longer exist, or were modified since the report was
+// made, and directories that are no longer empty, are skipped and returned.
+func (r *Report) Execute(opts actions.Options) ([]Skipped, error) {
+	plan, skipped := r.Plan()
+	return skipped, plan.Execute(opts)
+}
+
+// check returns why the candidate must not be deleted, or an empty string.
+func (r *Report) check(c Candidate) string {
+	info, err := os.Lstat(c.PathAbs)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "no longer exists"
+	case err != nil:
+		return err.Error()
+	case info.IsDir():
+		return "is a directory"
+	case info.Size() != c.Size || !info.ModTime().Equal(c.ModTime):
+		return "modified since the dry run"
+	}
+	return ""
+}
+
+// ParseAge parses an age such as "90d", "2w" or "36h": a number of days or weeks, or a duration accepted by
+// time.ParseDuration.
+func ParseAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit == 0 {
+		d, err := time.ParseDuration(s)
+		if err == nil && d < 0 {
+			err = fmt.Errorf("negative age %q", s)
+		}
+		return d, err
+	}
+
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// ParseSize parses a size such as "1GiB", "500MB" or "4096": a number of bytes, with an optional unit among
+// KiB, MiB, GiB and TiB, their abbreviations K, M, G and T, and the decimal KB, MB, GB and TB.
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+	num, mult := s, 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.n
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/daemon"
+	"github.com/gromey/octopus/dirreader"
+	"google.golang.org/grpc/credentials"
+)
+
+func runAgent(args []string) int {
+	fs := newFlagSet("agent")
+
+	addr := fs.String("addr", "localhost:7420", "address of the octopusd server")
+	tokenFile := fs.String("token-file", "", "file holding the bearer token of the server")
+	tlsCA := fs.String("tls-ca", "", "PEM file of the certificate authority of the server, to encrypt the connection")
+	algorithm := fs.String("hash", "", "hash algorithm of the scan or the checksum file, the one of the server if empty")
+	base := fs.String("base", "", "diff: ID of an earlier scan to compare with, instead of the latest snapshot of the root")
+	skipHidden := fs.Bool("skip-hidden", false, "skip hidden files and directories")
+	format := fs.String("format", "table", "output format: table or json")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	nargs := map[string]int{"scan": 2, "diff": 2, "verify": 3, "drift": 2, "events": 1}
+	if fs.NArg() == 0 || nargs[fs.Arg(0)] != fs.NArg() {
+		fs.Usage()
+		return exitError
+	}
+	if *format != "table" && *format != "json" {
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	opts := daemon.ClientOptions{}
+	if *tokenFile != "" {
+		token, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			return fail(err)
+		}
+		opts.Token = strings.TrimSpace(string(token))
+	}
+	if *tlsCA != "" {
+		pem, err := os.ReadFile(*tlsCA)
+		if err != nil {
+			return fail(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fail(fmt.Errorf("%s: no certificate found", *tlsCA))
+		}
+		opts.TLS = credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	}
+	c, err := daemon.Dial(*addr, opts)
+	if err != nil {
+		return fail(err)
+	}
+	defer c.Close()
+
+	switch fs.Arg(0) {
+	case "scan", "diff":
+		job, err := c.StartScan(sigCtx, &daemon.ScanRequest{Root: fs.Arg(1), Hash: *algorithm, SkipHidden: *skipHidden})
+		if err != nil {
+			return fail(err)
+		}
+		if fs.Arg(0) == "diff" {
+			return agentDiff(c, job, *base, *format)
+		}
+		return agentScan(c, job, *format)
+	case "verify":
+		manifest, err := os.ReadFile(fs.Arg(1))
+		if err != nil {
+			return fail(err)
+		}
+		res, err := c.Verify(sigCtx, &daemon.VerifyRequest{Root: fs.Arg(2), Hash: *algorithm, Manifest: string(manifest)})
+		if err != nil {
+			return fail(err)
+		}
+		return agentVerify(res, *format)
+	case "drift":
+		rep, err := c.LatestDrift(sigCtx, &daemon.DriftRequest{Schedule: fs.Arg(1)})
+		if err != nil {
+			return fail(err)
+		}
+		return agentDrift(rep, *format)
+	default:
+		err = c.WatchEvents(sigCtx, func(e *daemon.Event) error {
+			if *format == "json" {
+				return json.NewEncoder(os.Stdout).Encode(e)
+			}
+			_, err := fmt.Printf("%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.RFC3339), e.Type, e.Job, e.Root, e.Detail)
+			return err
+		})
+		if err != nil && sigCtx.Err() == nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+}
+
+// agentScan prints the files of the scan once it finished.
+func agentScan(c *daemon.Client, job *daemon.Job, format string) int {
+	var files []dirreader.FileInfo
+	err := c.Results(sigCtx, job.ID, func(r *daemon.Results) error {
+		files = append(files, r.Files...)
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	if format == "json" {
+		if files == nil {
+			files = []dirreader.FileInfo{}
+		}
+		err = writeJSON(files)
+	} else {
+		tw := newTable()
+		fmt.Fprintln(tw, tr("PATH\tSIZE\tMODIFIED\tHASH"))
+		for _, fi := range files {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", fi.RelPath(), fi.Size(), fi.ModTime().Format(time.RFC3339), fi.Hash)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+// agentDiff prints the changes found by the scan since its base.
+func agentDiff(c *daemon.Client, job *daemon.Job, base, format string) int {
+	res, err := c.Diff(sigCtx, &daemon.DiffRequest{ID: job.ID, Base: base})
+	if err != nil {
+		return fail(err)
+	}
+
+	if format == "json" {
+		err = writeJSON(res)
+	} else {
+		tw := newTable()
+		for _, ch := range res.Changes {
+			fmt.Fprintf(tw, "%s\t%s\n", ch.Op, ch.Path)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if len(res.Changes) > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
+
+// agentDrift prints the last run of a schedule and the changes it found.
+func agentDrift(rep *daemon.DriftReport, format string) int {
+	var err error
+	if format == "json" {
+		err = writeJSON(rep)
+	} else {
+		if rep.Error != "" {
+			fmt.Fprintf(os.Stderr, "octopus: last run of %s failed: %s\n", rep.Schedule, rep.Error)
+		}
+		tw := newTable()
+		for _, ch := range rep.Changes {
+			fmt.Fprintf(tw, "%s\t%s\n", ch.Op, ch.Path)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if rep.Count > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
+
+// agentVerify prints the outcome of the verification.
+func agentVerify(res *daemon.VerifyResponse, format string) int {
+	var err error
+	if format == "json" {
+		err = writeJSON(res.Results)
+	} else {
+		for _, r := range res.Results {
+			if r.Error != "" {
+				fmt.Printf("%s: %s (%s)\n", r.Path, r.Status, r.Error)
+				continue
+			}
+			fmt.Printf("%s: %s\n", r.Path, r.Status)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if n := len(res.Results) - res.Summary[checksum.OK]; n > 0 {
+		fmt.Fprintf(os.Stderr, tr("octopus: WARNING: %d of %d files did not match\n"), n, len(res.Results))
+		return exitChanges
+	}
+	return exitOK
+}
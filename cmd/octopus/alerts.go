@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gromey/octopus/alert"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/notify"
+)
+
+// alertFlags holds the alert rules and notifiers flags shared by diff and verify.
+type alertFlags struct {
+	rules  string
+	url    string
+	notify string
+
+	notifier notify.Notifier // Notifiers of -notify, nil if not set.
+}
+
+func (f *alertFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.rules, "alerts", "", "JSON file of alert rules evaluated on the changes, exiting with status 3 if one is triggered")
+	fs.StringVar(&f.url, "alert-url", "", "webhook the triggered alerts are posted to")
+	fs.StringVar(&f.notify, "notify", "", "JSON file of the email, Slack, Teams and syslog notifiers sent the changes and the triggered alerts")
+}
+
+// load returns the rules of -alerts, if set, and loads the notifiers of -notify.
+func (f *alertFlags) load() ([]alert.Rule, error) {
+	var err error
+	if f.notifier, err = loadNotifier(f.notify); err != nil {
+		return nil, err
+	}
+	if f.rules == "" {
+		if f.url != "" {
+			return nil, fmt.Errorf("-alert-url requires -alerts")
+		}
+		return nil, nil
+	}
+	return alert.Load(f.rules)
+}
+
+// check evaluates the rules on the changes between scans of the number of files, prints the triggered alerts,
+// posts them to -alert-url and sends them to the notifiers. It returns exitAlert if an alert was triggered,
+// otherwise code.
+func (f *alertFlags) check(rules []alert.Rule, changes []diff.Change, files, code int) int {
+	alerts := alert.Evaluate(rules, changes, files)
+	if len(alerts) == 0 {
+		return code
+	}
+
+	lines := make([]string, len(alerts))
+	for i, a := range alerts {
+		fmt.Fprintf(os.Stderr, "octopus: ALERT %s\n", a)
+		lines[i] = a.String()
+	}
+	if f.url != "" {
+		if err := alert.Post(sigCtx, f.url, alerts); err != nil {
+			return fail(err)
+		}
+	}
+	err := f.send(&notify.Message{
+		Severity: notify.Critical,
+		Event:    "alert",
+		Subject:  fmt.Sprintf("%d alert rules triggered", len(alerts)),
+		Body:     notify.Lines(lines),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return exitAlert
+}
+
+// send sends the message to the notifiers of -notify, if set, at the current time.
+func (f *alertFlags) send(m *notify.Message) error {
+	if f.notifier == nil {
+		return nil
+	}
+	m.Time = time.Now()
+	return f.notifier.Notify(sigCtx, m)
+}
+
+// loadNotifier returns the notifiers of the JSON file at path, nil if path is empty.
+func loadNotifier(path string) (notify.Notifier, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return notify.Load(path)
+}
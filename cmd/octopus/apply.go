@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gromey/octopus/actions"
+)
+
+func runApply(args []string) int {
+	fs := newFlagSet("apply")
+
+	format := fs.String("format", "table", "output format of -dry-run: table or json")
+	dryRun := fs.Bool("dry-run", false, "only print the operations of the plan")
+	store := fs.String("store", "", "snapshot store whose holds are honored")
+	auditPath := fs.String("audit", "", "audit log recording the performed operations")
+	trashDir := fs.String("trash", "", "move the deleted and linked-over files to this trash directory, or to the trash of the desktop with \"system\"")
+	progress := fs.String("progress", "", "file recording the progress, so that an interrupted run resumes where it stopped")
+	filesPerSec := fs.Float64("files-per-sec", 0, "perform at most this many operations per second")
+	bytesPerSec := fs.Int64("bytes-per-sec", 0, "perform operations on at most this many bytes per second")
+	batchSize := fs.Int("batch-size", 0, "pause for -batch-pause after this many operations")
+	batchPause := fs.Duration("batch-pause", 0, "pause between batches")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	plan, err := readPlan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	if *dryRun {
+		switch *format {
+		case "table":
+			tw := newTable()
+			for _, op := range plan.Ops {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", op.Kind, op.Src, op.Dst, op.Size)
+			}
+			fmt.Fprintf(tw, tr("%d operations (%d bytes)\n"), len(plan.Ops), plan.Bytes())
+			err = tw.Flush()
+		case "json":
+			err = writeJSON(plan)
+		default:
+			return fail(fmt.Errorf("unknown output format %q", *format))
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	holds, err := loadHolds(*store)
+	if err != nil {
+		return fail(err)
+	}
+	auditLog, err := openAudit(*auditPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = auditLog.Close() }()
+	bin, err := openTrash(*trashDir, "")
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = bin.Close() }()
+
+	err = plan.Execute(actions.Options{
+		Holds:       holds,
+		Audit:       auditLog,
+		FilesPerSec: *filesPerSec,
+		BytesPerSec: *bytesPerSec,
+		BatchSize:   *batchSize,
+		BatchPause:  *batchPause,
+		Progress:    *progress,
+		Trash:       bin,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Printf(tr("applied %d operations (%d bytes)\n"), len(plan.Ops), plan.Bytes())
+
+	return exitOK
+}
+
+// readPlan reads the plan written to the file at path.
+func readPlan(path string) (*actions.Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	p, err := actions.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// writePlan writes the plan to the file at path, for review before it is applied, and prints its size.
+func writePlan(p *actions.Plan, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = p.Write(f); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+
+	fmt.Printf(tr("planned %d operations (%d bytes), apply with: octopus apply %s\n"), len(p.Ops), p.Bytes(), path)
+	return nil
+}
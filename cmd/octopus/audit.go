@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gromey/octopus/audit"
+)
+
+func runAudit(args []string) int {
+	fs := newFlagSet("audit")
+
+	verify := fs.Bool("verify", false, "only verify the hash chain and print the number of entries")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	if *verify {
+		n, err := audit.Verify(fs.Arg(0))
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf(tr("%s: %d entries, chain intact\n"), fs.Arg(0), n)
+		return exitOK
+	}
+
+	if err := audit.Export(fs.Arg(0), os.Stdout); err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// openAudit opens the audit log at path, or returns nil if no path is provided.
+func openAudit(path string) (*audit.Log, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return audit.Open(path)
+}
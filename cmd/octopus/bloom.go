@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/gromey/octopus/bloom"
+	"github.com/gromey/octopus/hashes"
+)
+
+func runBloom(args []string) int {
+	fs := newFlagSet("bloom")
+
+	var sf scanFlags
+	sf.register(fs, "sha256")
+	out := fs.String("o", "", "file to write the filter of the tree or saved scan to")
+	rate := fs.Float64("fp", 0.01, "false positive rate of the filter")
+	query := fs.String("query", "", "filter to query for the files or hashes given as arguments instead of building one")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if (*query == "") == (*out == "") || (*out != "" && fs.NArg() != 1) || (*query != "" && fs.NArg() == 0) {
+		fs.Usage()
+		return exitError
+	}
+
+	if *query != "" {
+		return queryBloom(*query, fs.Args())
+	}
+
+	if sf.hash == "none" {
+		return fail(errors.New("bloom requires a hash algorithm"))
+	}
+
+	files, err := sf.load(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	f, err := bloom.FromFiles(files, sf.hash, *rate)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err = writeBloom(*out, f); err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// writeBloom writes the filter to the file at path.
+func writeBloom(path string, f *bloom.Filter) error {
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteTo(w); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return w.Close()
+}
+
+// queryBloom reports for each argument whether the tree the filter was built from probably contains it.
+// Arguments naming existing files are hashed with the filter's algorithm, others are taken as hashes.
+func queryBloom(path string, args []string) int {
+	r, err := os.Open(path)
+	if err != nil {
+		return fail(err)
+	}
+	f, err := bloom.Read(r)
+	_ = r.Close()
+	if err != nil {
+		return fail(fmt.Errorf("%s: %w", path, err))
+	}
+
+	h, err := hashes.Lookup(f.Algorithm)
+	if err != nil {
+		return fail(err)
+	}
+
+	code := exitOK
+	for _, arg := range args {
+		sum := arg
+		if st, err := os.Stat(arg); err == nil && st.Mode().IsRegular() {
+			if h == nil {
+				return fail(fmt.Errorf("%s: filter has no hash algorithm to hash %s with", path, arg))
+			}
+			if sum, err = hashFile(arg, h); err != nil {
+				return fail(err)
+			}
+		}
+
+		if f.Test(sum) {
+			fmt.Printf(tr("%s: probably present\n"), arg)
+			continue
+		}
+		fmt.Printf(tr("%s: absent\n"), arg)
+		code = exitChanges
+	}
+
+	return code
+}
+
+// hashFile returns the hex-encoded hash of the content of the file at path.
+func hashFile(path string, hashFunc func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := hashFunc()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
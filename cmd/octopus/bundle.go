@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/snapshot"
+)
+
+func runExport(args []string) int {
+	fs := newFlagSet("export")
+
+	store := fs.String("store", "", "snapshot store to export from (required)")
+	out := fs.String("o", "", "file to write the bundle to (default: the standard output)")
+	compress := fs.String("compress", "gzip", "codec to compress the bundle with: "+strings.Join(codec.Names(), ", "))
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+	if *store == "" {
+		fs.Usage()
+		return exitError
+	}
+
+	c, err := codec.Lookup(*compress)
+	if err != nil {
+		return fail(err)
+	}
+
+	s, err := snapshot.Open(*store)
+	if err != nil {
+		return fail(err)
+	}
+
+	if *out == "" {
+		err = s.Export(os.Stdout, fs.Arg(0), c)
+	} else {
+		err = exportFile(s, fs.Arg(0), *out, c)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// exportFile writes the bundle of the snapshot to the file at path, removing the file if the export fails.
+func exportFile(s *snapshot.Store, id, path string, c codec.Codec) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Export(f, id, c); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+
+	return err
+}
+
+func runImport(args []string) int {
+	fs := newFlagSet("import")
+
+	store := fs.String("store", "", "snapshot store to import into (required)")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+	if *store == "" {
+		fs.Usage()
+		return exitError
+	}
+
+	s, err := snapshot.Open(*store)
+	if err != nil {
+		return fail(err)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	snap, err := s.Import(f)
+	if err != nil {
+		return fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	fmt.Println(snap.ID)
+
+	return exitOK
+}
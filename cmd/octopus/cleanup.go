@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/cleanup"
+)
+
+func runCleanup(args []string) int {
+	fs := newFlagSet("cleanup")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "table", "output format: table or json")
+	rulesPath := fs.String("rules", "", "JSON file of the cleanup rules evaluated in a dry run")
+	emptyDirs := fs.Bool("empty-dirs", false, "also remove the directories without any file below them, and report those holding only files excluded from the scan")
+	out := fs.String("o", "", "with -rules, write the report of the dry run to this file, to delete its files with -delete")
+	del := fs.String("delete", "", "delete the files of this dry run report that did not change since, and exit")
+	store := fs.String("store", "", "with -delete, snapshot store whose holds are honored")
+	auditPath := fs.String("audit", "", "with -delete, audit log recording the deleted files")
+	trashDir := fs.String("trash", "", "with -delete, move the files to this trash directory, or to the trash of the desktop with \"system\", rather than unlinking them")
+	filesPerSec := fs.Float64("files-per-sec", 0, "with -delete, delete at most this many files per second")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	if *del != "" {
+		if fs.NArg() != 0 || *rulesPath != "" {
+			fs.Usage()
+			return exitError
+		}
+		return deleteCleanup(*del, *format, *store, *auditPath, *trashDir, *filesPerSec)
+	}
+
+	if fs.NArg() != 1 || (*rulesPath == "" && !*emptyDirs) {
+		fs.Usage()
+		return exitError
+	}
+	var rules []cleanup.Rule
+	if *rulesPath != "" {
+		var err error
+		if rules, err = cleanup.Load(*rulesPath); err != nil {
+			return fail(err)
+		}
+	}
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	rep, err := cleanup.Evaluate(fs.Arg(0), files, rules, time.Now())
+	if err != nil {
+		return fail(err)
+	}
+	if *emptyDirs {
+		rep.Prune(sf.stats.EmptyDirs)
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, c := range rep.Candidates {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", c.Rule, c.Path, c.Size, c.ModTime.Format(time.RFC3339))
+		}
+		pruned := 0
+		for _, d := range rep.EmptyDirs {
+			if d.Filtered {
+				fmt.Fprintf(tw, "%s\t%s\t\t\n", tr("filtered"), d.Path)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\t\t\n", tr("empty"), d.Path)
+				pruned++
+			}
+		}
+		for _, s := range rep.Stats {
+			fmt.Fprintf(tw, tr("rule %s\t%d files\t%d bytes\t\n"), s.Rule, s.Files, s.Bytes)
+		}
+		fmt.Fprintf(tw, tr("dry run: %d files (%d bytes) and %d empty directories to delete\n"), rep.Files, rep.Bytes, pruned)
+		err = tw.Flush()
+	case "json":
+		err = writeJSON(rep)
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+	if err == nil && *out != "" {
+		err = writeReport(rep, *out)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if rep.Files > 0 || len(rep.EmptyDirs) > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
+
+// deleteCleanup deletes the files of the dry run report at path, and prints the skipped ones.
+func deleteCleanup(path, format, store, auditPath, trashDir string, filesPerSec float64) int {
+	rep, err := cleanup.Read(path)
+	if err != nil {
+		return fail(err)
+	}
+	holds, err := loadHolds(store)
+	if err != nil {
+		return fail(err)
+	}
+	auditLog, err := openAudit(auditPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = auditLog.Close() }()
+	bin, err := openTrash(trashDir, rep.Root)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = bin.Close() }()
+
+	plan, skipped := rep.Plan()
+	err = plan.Execute(actions.Options{Holds: holds, Audit: auditLog, Trash: bin, FilesPerSec: filesPerSec})
+
+	switch format {
+	case "table":
+		tw := newTable()
+		for _, s := range skipped {
+			fmt.Fprintf(tw, "%s\t%s\t(%s)\n", tr("skip"), s.Path, s.Reason)
+		}
+		if err == nil {
+			fmt.Fprintf(tw, tr("deleted %d files and directories, skipped %d\n"), len(plan.Ops), len(skipped))
+		}
+		if e := tw.Flush(); e != nil && err == nil {
+			err = e
+		}
+	case "json":
+		if skipped == nil {
+			skipped = []cleanup.Skipped{}
+		}
+		if e := writeJSON(skipped); e != nil && err == nil {
+			err = e
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+// writeReport writes the dry run report to the file at path.
+func writeReport(rep *cleanup.Report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(rep); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+
+	return err
+}
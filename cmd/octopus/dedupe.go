@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gromey/octopus/dedupe"
+	"github.com/gromey/octopus/hashes"
+)
+
+func runDedupe(args []string) int {
+	fs := newFlagSet("dedupe")
+
+	var sf scanFlags
+	sf.register(fs, "sha256")
+	format := fs.String("format", "table", "output format: table or json")
+	link := fs.String("link", "", "replace duplicates with links: hardlink or reflink")
+	dryRun := fs.Bool("dry-run", false, "with -link, only print the plan")
+	rollbackLog := fs.String("rollback-log", "octopus-rollback.ndjson", "with -link, file recording the replacements")
+	rollback := fs.Bool("rollback", false, "revert the replacements recorded in -rollback-log and exit")
+	store := fs.String("store", "", "with -link, snapshot store whose holds are honored")
+	auditPath := fs.String("audit", "", "audit log recording the replaced files")
+	planPath := fs.String("plan", "", "with -link, write the replacements to this plan file, for review before \"octopus apply\", rather than performing them")
+	trashDir := fs.String("trash", "", "with -link, move the duplicates to this trash directory, or to the trash of the desktop with \"system\", before replacing them; their space is freed once the trash is emptied")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	auditLog, err := openAudit(*auditPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	if *rollback {
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return exitError
+		}
+		if err = dedupe.Rollback(*rollbackLog, auditLog); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	h, err := hashes.Lookup(sf.hash)
+	if err != nil {
+		return fail(err)
+	}
+	if h == nil {
+		return fail(fmt.Errorf("dedupe requires a hash algorithm"))
+	}
+
+	// Scan without hashing, the duplicate finder only hashes files that share their size.
+	// Quick hashes are cheap enough to collect during the scan and spare reading the leading bytes again.
+	if sf.quickHash <= 0 {
+		sf.hash = "none"
+	}
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	res, err := dedupe.Find(files, h, false)
+	if err != nil {
+		return fail(err)
+	}
+
+	if *link == "" {
+		if err = printSets(res, *format); err != nil {
+			return fail(err)
+		}
+		if len(res.Sets) > 0 {
+			return exitChanges
+		}
+		return exitOK
+	}
+
+	holds, err := loadHolds(*store)
+	if err != nil {
+		return fail(err)
+	}
+
+	plan, err := dedupe.PlanLinks(res, dedupe.Method(*link), holds)
+	if err != nil {
+		return fail(err)
+	}
+
+	if *planPath != "" {
+		if err = writePlan(plan.Ops(), *planPath); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *dryRun {
+		if *format == "json" {
+			err = writeJSON(plan)
+		} else {
+			tw := newTable()
+			for _, a := range plan.Actions {
+				fmt.Fprintf(tw, "%s\t%s\t->\t%s\n", plan.Method, a.Replace, a.Keep)
+			}
+			for _, s := range plan.Skipped {
+				fmt.Fprintf(tw, "%s\t%s\t(%s)\t\n", tr("skip"), s.Path, s.Reason)
+			}
+			fmt.Fprintf(tw, tr("reclaimable\t%d bytes\t\t\n"), plan.Reclaimable)
+			err = tw.Flush()
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if plan.Trash, err = openTrash(*trashDir, fs.Arg(0)); err != nil {
+		return fail(err)
+	}
+	defer func() { _ = plan.Trash.Close() }()
+
+	if err = plan.Execute(*rollbackLog, auditLog); err != nil {
+		return fail(err)
+	}
+	fmt.Printf(tr("replaced %d duplicates, reclaimed %d bytes, rollback log: %s\n"), len(plan.Actions), plan.Reclaimable, *rollbackLog)
+
+	return exitOK
+}
+
+// printSets prints the duplicate sets in the provided format.
+func printSets(res *dedupe.Result, format string) error {
+	switch format {
+	case "table":
+		tw := newTable()
+		for _, s := range res.Sets {
+			fmt.Fprintf(tw, tr("%s\t%d bytes x %d\n"), s.Hash, s.Size, len(s.Files))
+			for _, fi := range s.Files {
+				fmt.Fprintf(tw, "\t%s\n", fi.PathAbs)
+			}
+		}
+		fmt.Fprintf(tw, tr("reclaimable\t%d bytes\n"), res.Reclaimable)
+		return tw.Flush()
+	case "json":
+		type set struct {
+			Hash  string   `json:"hash"`
+			Size  int64    `json:"size"`
+			Files []string `json:"files"`
+		}
+		out := struct {
+			Sets        []set `json:"sets"`
+			Reclaimable int64 `json:"reclaimable"`
+		}{Sets: make([]set, len(res.Sets)), Reclaimable: res.Reclaimable}
+		for i, s := range res.Sets {
+			out.Sets[i] = set{Hash: s.Hash, Size: s.Size}
+			for _, fi := range s.Files {
+				out.Sets[i].Files = append(out.Sets[i].Files, fi.PathAbs)
+			}
+		}
+		return writeJSON(out)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
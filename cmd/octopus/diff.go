@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/notify"
+)
+
+func runDiff(args []string) int {
+	fs := newFlagSet("diff")
+
+	var sf scanFlags
+	sf.register(fs, "sha256")
+	var af alertFlags
+	af.register(fs)
+	format := fs.String("format", "table", "output format: table or json")
+	tree := fs.Bool("tree", false, "print the changes of the table format as an indented tree with the number of changes of each directory")
+	fs.StringVar(&sf.pubkey, "pubkey", "", "require the manifests fetched from URLs to be checksum files signed with the ed25519 public key in this PEM file")
+
+	if !parse(fs, args, 2) {
+		return exitError
+	}
+
+	if *tree && *format != "table" {
+		return fail(fmt.Errorf("-tree cannot be used with -format %s", *format))
+	}
+	rules, err := af.load()
+	if err != nil {
+		return fail(err)
+	}
+
+	old, err := sf.load(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	cur, err := sf.load(fs.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+
+	changes := diff.Compare(old, cur)
+
+	switch *format {
+	case "table":
+		if *tree {
+			err = writeTree(os.Stdout, changes)
+			break
+		}
+		tw := newTable()
+		for _, c := range changes {
+			fmt.Fprintf(tw, "%s\t%s\n", c.Op, c.Path)
+		}
+		err = tw.Flush()
+	case "json":
+		if changes == nil {
+			changes = []diff.Change{}
+		}
+		err = writeJSON(changes)
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	code := exitOK
+	if len(changes) > 0 {
+		code = exitChanges
+		lines := make([]string, len(changes))
+		for i, c := range changes {
+			lines[i] = fmt.Sprintf("%s %s", c.Op, filepath.ToSlash(c.Path))
+		}
+		err = af.send(&notify.Message{
+			Severity: notify.Warning,
+			Event:    "drift",
+			Root:     fs.Arg(1),
+			Subject:  fmt.Sprintf("%d changes between %s and %s", len(changes), fs.Arg(0), fs.Arg(1)),
+			Body:     notify.Lines(lines),
+		})
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	return af.check(rules, changes, len(old), code)
+}
+
+// opMarks are the marks of the files of a tree of changes.
+var opMarks = map[diff.Op]string{diff.Added: "+", diff.Removed: "-", diff.Modified: "~"}
+
+// changeNode is a file or a directory of a tree of changes.
+type changeNode struct {
+	name     string
+	op       diff.Op                // Change of a file, empty for a directory.
+	counts   map[diff.Op]int        // Changes below a directory, by kind.
+	children map[string]*changeNode // Files and directories of a directory.
+}
+
+// writeTree writes the changes as an indented tree: each file is marked with + if added, - if removed
+// and ~ if modified, and each directory is followed by the number of changes below it, by kind. Directories
+// holding a single directory are merged with it, e.g. "a/b/", to keep deep trees readable.
+func writeTree(w io.Writer, changes []diff.Change) error {
+	root := &changeNode{counts: make(map[diff.Op]int), children: make(map[string]*changeNode)}
+	for _, c := range changes {
+		n := root
+		parts := strings.Split(filepath.ToSlash(c.Path), "/")
+		for i, part := range parts {
+			n.counts[c.Op]++
+			child := n.children[part]
+			if child == nil {
+				child = &changeNode{name: part}
+				if i < len(parts)-1 {
+					child.counts, child.children = make(map[diff.Op]int), make(map[string]*changeNode)
+				}
+				n.children[part] = child
+			}
+			n = child
+		}
+		n.op = c.Op
+	}
+
+	if err := root.write(w, 0); err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		_, err := fmt.Fprintf(w, tr("%d changes: %s\n"), len(changes), root.summary())
+		return err
+	}
+	return nil
+}
+
+// write writes the children of the directory, indented by depth levels.
+func (n *changeNode) write(w io.Writer, depth int) error {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indent := strings.Repeat("  ", depth)
+	for _, name := range names {
+		child := n.children[name]
+		if child.children == nil {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", indent, opMarks[child.op], child.name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		label := child.name + "/"
+		for len(child.children) == 1 {
+			var only *changeNode
+			for _, c := range child.children {
+				only = c
+			}
+			if only.children == nil {
+				break
+			}
+			label += only.name + "/"
+			child = only
+		}
+		if _, err := fmt.Fprintf(w, "%s%s (%s)\n", indent, label, child.summary()); err != nil {
+			return err
+		}
+		if err := child.write(w, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary returns the number of changes below the directory by kind, e.g. "+2 -1 ~3".
+func (n *changeNode) summary() string {
+	var parts []string
+	for _, op := range []diff.Op{diff.Added, diff.Removed, diff.Modified} {
+		if c := n.counts[op]; c > 0 {
+			parts = append(parts, fmt.Sprintf("%s%d", opMarks[op], c))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/health"
+	"github.com/gromey/octopus/hold"
+	"github.com/gromey/octopus/publish"
+)
+
+func runDoctor(args []string) int {
+	fs := newFlagSet("doctor")
+
+	hashName := fs.String("hash", "", "hash algorithm the jobs use")
+	compress := fs.String("compress", "", "codec the jobs compress with")
+	store := fs.String("store", "", "snapshot store the jobs use")
+	auditPath := fs.String("audit", "", "audit log the jobs record to")
+	hmacKey := fs.String("hmac-key", "", "HMAC key file the jobs use")
+	bucket := fs.String("bucket", "", "bucket the jobs publish to, with the credentials of the environment")
+	endpoint := fs.String("endpoint", "https://s3.amazonaws.com", "base URL of the S3-compatible object storage of -bucket")
+	region := fs.String("region", "us-east-1", "region of -bucket")
+	minFiles := fs.Uint64("min-open-files", 4096, "minimum limit of open files")
+	minWatches := fs.Int("min-watches", 8192, "minimum number of inotify watches per user")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each check")
+	format := fs.String("format", "table", "output format: table or json")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	c := health.New(*timeout)
+	c.AddReadiness("open file limit", health.FileLimit(*minFiles))
+	c.AddReadiness("inotify watches", health.InotifyWatches(*minWatches))
+	if fs.NArg() > 0 {
+		c.AddReadiness("roots", health.Accessible(fs.Args()...))
+	}
+	if *hashName != "" {
+		c.AddReadiness("hash algorithm", func(context.Context) error {
+			_, err := hashes.Lookup(*hashName)
+			return err
+		})
+	}
+	if *compress != "" {
+		c.AddReadiness("codec", func(context.Context) error {
+			_, err := codec.Lookup(*compress)
+			return err
+		})
+	}
+	if *store != "" {
+		c.AddReadiness("store", health.Writable(*store))
+		c.AddReadiness("holds", func(context.Context) error {
+			_, err := hold.Load(*store)
+			return err
+		})
+	}
+	if *auditPath != "" {
+		c.AddReadiness("audit log", func(ctx context.Context) error {
+			if _, err := os.Stat(*auditPath); errors.Is(err, os.ErrNotExist) {
+				return health.Writable(filepath.Dir(*auditPath))(ctx)
+			}
+			_, err := audit.Verify(*auditPath)
+			return err
+		})
+	}
+	if *hmacKey != "" {
+		c.AddReadiness("HMAC key", func(context.Context) error {
+			key, err := os.ReadFile(*hmacKey)
+			if err == nil && len(key) == 0 {
+				err = fmt.Errorf("%s is empty", *hmacKey)
+			}
+			return err
+		})
+	}
+	if *bucket != "" {
+		s3 := &publish.S3{
+			Endpoint:     *endpoint,
+			Bucket:       *bucket,
+			Region:       *region,
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		c.AddReadiness("bucket", func(ctx context.Context) error {
+			if s3.AccessKey == "" || s3.SecretKey == "" {
+				return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+			}
+			return s3.Check(ctx)
+		})
+	}
+
+	rep := c.Ready(sigCtx)
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, r := range rep.Checks {
+			status := tr("ok")
+			if !r.OK {
+				status = tr("FAIL")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", status, r.Name, r.Error)
+		}
+		if err := tw.Flush(); err != nil {
+			return fail(err)
+		}
+	case "json":
+		if err := writeJSON(rep); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if !rep.OK {
+		return exitChanges
+	}
+	return exitOK
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gromey/octopus/document"
+)
+
+func runDocuments(args []string) int {
+	fs := newFlagSet("documents")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "table", "output format: table or json")
+	all := fs.Bool("all", false, "list every document, not only the ones with macros, active content or embedded objects")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	type result struct {
+		Path string `json:"path"`
+		*document.Report
+	}
+	var results []result
+	var risky int
+	for _, fi := range files {
+		rep, e := document.Inspect(fi.PathAbs)
+		if e != nil {
+			if !errors.Is(e, document.ErrUnknownFormat) {
+				err = errors.Join(err, e)
+			}
+			continue
+		}
+		if rep.Risky() {
+			risky++
+		}
+		if *all || rep.Risky() || len(rep.Embedded) > 0 {
+			results = append(results, result{Path: fi.RelPath(), Report: rep})
+		}
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		fmt.Fprintln(tw, tr("PATH\tFORMAT\tMACROS\tACTIVE\tEMBEDDED"))
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", r.Path, r.Format, r.Macros, strings.Join(r.Active, ","), strings.Join(r.Embedded, ", "))
+		}
+		if e := tw.Flush(); e != nil {
+			err = errors.Join(err, e)
+		}
+	case "json":
+		if e := writeJSON(results); e != nil {
+			err = errors.Join(err, e)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	if risky > 0 {
+		return exitChanges
+	}
+
+	return exitOK
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/fim"
+	"github.com/gromey/octopus/notify"
+	"github.com/gromey/octopus/systemd"
+)
+
+func runFIM(args []string) int {
+	fs := newFlagSet("fim")
+
+	format := fs.String("format", "table", "output format of the alerts: table or json, one object per line with watch")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 2 || (fs.Arg(0) != "baseline" && fs.Arg(0) != "check" && fs.Arg(0) != "watch" && fs.Arg(0) != "rules") {
+		fs.Usage()
+		return exitError
+	}
+	if *format != "table" && *format != "json" {
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	p, err := fim.LoadProfile(fs.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+	if fs.Arg(0) == "rules" {
+		for _, r := range p.AuditRules() {
+			fmt.Println(r)
+		}
+		return exitOK
+	}
+	key, err := p.Key()
+	if err != nil {
+		return fail(err)
+	}
+	n, err := p.Notifier()
+	if err != nil {
+		return fail(err)
+	}
+
+	if fs.Arg(0) == "baseline" {
+		b, err := fim.Take(sigCtx, p, key)
+		if b == nil {
+			return fail(err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "octopus: WARNING: files left out of the baseline: %v\n", err)
+		}
+		if err = b.Save(p, key); err != nil {
+			return fail(err)
+		}
+		fmt.Printf(tr("%d files in the baseline of %s\n"), len(b.Files), p.Name)
+		return exitOK
+	}
+
+	b, err := fim.LoadBaseline(p, key)
+	if errors.Is(err, fim.ErrTampered) {
+		fmt.Fprintf(os.Stderr, "octopus: ALERT %v\n", err)
+		m := &notify.Message{Time: time.Now(), Severity: notify.Critical, Event: "fim", Subject: fmt.Sprintf("%s: %v", p.Name, err)}
+		if n != nil {
+			if err = n.Notify(sigCtx, m); err != nil {
+				return fail(err)
+			}
+		}
+		return exitAlert
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if fs.Arg(0) == "check" {
+		alerts, err := fim.Check(sigCtx, p, key, b)
+		if sigCtx.Err() != nil {
+			return fail(sigCtx.Err())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "octopus: WARNING: files not checked: %v\n", err)
+		}
+		if *format == "json" {
+			if alerts == nil {
+				alerts = []fim.Alert{}
+			}
+			err = writeJSON(alerts)
+		} else {
+			err = printAlerts(alerts)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if len(alerts) == 0 {
+			return exitOK
+		}
+		if n != nil {
+			if err = n.Notify(sigCtx, fim.Message(p.Name, alerts)); err != nil {
+				return fail(err)
+			}
+		}
+		return exitChanges
+	}
+
+	m := &fim.Monitor{Profile: p, Key: key, Baseline: b, Notifier: n, Logger: logger}
+	m.Alert = func(alerts []fim.Alert) {
+		if *format == "table" {
+			_ = printAlerts(alerts)
+			return
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for i := range alerts {
+			_ = enc.Encode(&alerts[i])
+		}
+	}
+	_ = systemd.Ready()
+	if err = m.Run(sigCtx); err != nil {
+		return fail(err)
+	}
+	_ = systemd.Stopping()
+	return exitOK
+}
+
+// printAlerts prints the alerts as a table: when the change was detected, what changed, and who changed it if
+// known.
+func printAlerts(alerts []fim.Alert) error {
+	tw := newTable()
+	for _, a := range alerts {
+		who := "-"
+		if a.Actor != nil {
+			who = a.Actor.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a.Time.Local().Format(time.RFC3339), a.Op, a.Path, strings.Join(a.Changed, ","), who)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gromey/octopus/hold"
+)
+
+func runHold(args []string) int {
+	fs := newFlagSet("hold")
+
+	store := fs.String("store", "", "snapshot store keeping the holds (required)")
+	reason := fs.String("reason", "", "why the path is held")
+	release := fs.Bool("release", false, "release the hold placed on the path instead of placing one")
+	listOnly := fs.Bool("list", false, "list the holds and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *store == "" || (*listOnly && fs.NArg() != 0) || (!*listOnly && fs.NArg() != 1) {
+		fs.Usage()
+		return exitError
+	}
+
+	holds, err := hold.Load(*store)
+	if err != nil {
+		return fail(err)
+	}
+
+	switch {
+	case *listOnly:
+		tw := newTable()
+		for _, h := range holds.List() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", h.Path, h.Created.Format(time.RFC3339), h.Reason)
+		}
+		err = tw.Flush()
+	case *release:
+		err = holds.Remove(fs.Arg(0))
+	default:
+		err = holds.Add(fs.Arg(0), *reason)
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// loadHolds loads the holds of the snapshot store, or returns nil if no store is provided.
+func loadHolds(store string) (*hold.Set, error) {
+	if store == "" {
+		return nil, nil
+	}
+	return hold.Load(store)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// loadPrivateKey reads an ed25519 private key from a PEM-encoded PKCS #8 file,
+// as written by "openssl genpkey -algorithm ed25519".
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s: %w", path, err)
+	}
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("parse private key %s: not an ed25519 key", path)
+}
+
+// loadPublicKey reads an ed25519 public key from a PEM-encoded PKIX file,
+// as written by "openssl pkey -pubout".
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s: %w", path, err)
+	}
+	if k, ok := key.(ed25519.PublicKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("parse public key %s: not an ed25519 key", path)
+}
+
+// readPEM returns the content of the first PEM block of the file with the type.
+func readPEM(path, typ string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return nil, fmt.Errorf("%s: no %s PEM block", path, typ)
+		}
+		if block.Type == typ {
+			return block.Bytes, nil
+		}
+	}
+}
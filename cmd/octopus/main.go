@@ -0,0 +1,586 @@
+// Command octopus scans, compares, verifies, deduplicates and synchronizes directory trees.
+//
+// Usage:
+//
+//	octopus [-lang <language>] [-io-limit <bytes-per-second>] [-log-level <level>] <command> [flags] [arguments]
+//
+// The -lang option, or the OCTOPUS_LANG environment variable, selects the language of tables and summaries:
+// en (the default), de, es or fr. Errors and machine-readable output are always in English.
+//
+// The -io-limit option, or the OCTOPUS_IO_LIMIT environment variable, caps the bytes read per second by the whole
+// command, across its scans, hashing, copies and verifications, on top of the -rate-limit of scans.
+//
+// The -log-level option, or the OCTOPUS_LOG_LEVEL environment variable, logs what the command does to the standard
+// error as it happens, with structured fields: debug (skipped paths and scan phases), info (scans and pipeline
+// steps), warn (failures on paths and retries) or error. Nothing is logged by default.
+//
+// The scan, diff and sync commands accept a prefix of an S3 bucket as s3://<bucket>/<prefix> in place of
+// a directory, with the credentials of AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN,
+// the region of AWS_REGION, and the endpoint of OCTOPUS_S3_ENDPOINT, https://s3.amazonaws.com by default.
+// The objects are compared by their ETag with -hash md5, and otherwise by the modification time and hash
+// stored when octopus uploaded them, the objects without one being read to hash them.
+//
+// They also accept a directory of a server reached over SSH as sftp://[<user>@]<host>[:<port>]/<dir>,
+// /~/<dir> for a directory relative to the home directory. The host key must be in ~/.ssh/known_hosts,
+// or OCTOPUS_SSH_KNOWN_HOSTS, and the user is authenticated by the SSH agent or the key of OCTOPUS_SSH_KEY,
+// ~/.ssh/id_ed25519, id_ecdsa or id_rsa by default. The filters and other scan flags do not apply to S3
+// and SFTP trees.
+//
+// The commands are:
+//
+//	scan       list the files of a tree with their hashes
+//	diff       compare two trees or saved scans
+//	verify     check files against a checksum file
+//	dedupe     find duplicate files and optionally replace them with links
+//	sync       make a directory a copy of another one
+//	hold       place or release holds protecting paths from sync, dedupe and planned actions
+//	audit      verify and export an audit log
+//	publish    write snapshots and audit logs to object storage with Object Lock retention
+//	media      detect truncated or malformed video and audio containers
+//	documents  list Office and PDF documents with macros, active content or embedded objects
+//	bloom      build a Bloom filter of the content hashes of a tree, or query one for files
+//	export     write a snapshot as a portable bundle
+//	import     add a snapshot bundle to a store
+//	doctor     check limits, stores, keys and credentials before running jobs
+//	plugins    list the plugins found in OCTOPUS_PLUGIN_PATH and PATH
+//	run        run the steps of pipelines defined in JSON files, each as a single job, concurrently, once or on an interval
+//	pack       write the files of a tree into a zip or tar archive
+//	trash      list the files sync and dedupe moved to a trash, or restore them
+//	apply      perform the operations of a plan written by sync or dedupe with -plan
+//	cleanup    delete the files matching rules such as "older than 90 days", and empty directories, after a dry run
+//	organize   move or rename files by templates over their dates and metadata, e.g. photos into year/month
+//	agent      query a remote octopusd server: scans, diffs, verifications, drift of schedules and events
+//	fim        monitor the integrity of files: baseline paths with HMAC, then check or watch them and alert on changes
+//
+// Run "octopus <command> -h" for the flags of a command.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gromey/octopus/backends"
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/script"
+	"github.com/gromey/octopus/shutdown"
+	"github.com/gromey/octopus/store"
+	"github.com/gromey/octopus/throttle"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0 // Success, no differences or failures.
+	exitChanges = 1 // Differences, duplicates or verification failures were found.
+	exitError   = 2 // Invalid usage or an error prevented the command from completing.
+	exitAlert   = 3 // An alert rule was triggered, see diff -alerts, or a baseline was tampered with, see fim.
+)
+
+// command represents a subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// commands lists the subcommands. It is populated in init, since the commands refer to it to print their usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"scan", "scan [flags] <root>", runScan},
+		{"diff", "diff [flags] <old> <new>", runDiff},
+		{"verify", "verify [flags] <checksum-file> | verify -sidecars [flags] <root>", runVerify},
+		{"dedupe", "dedupe [flags] <root>", runDedupe},
+		{"sync", "sync [flags] <src> <dst>", runSync},
+		{"hold", "hold -store <dir> [flags] <path> | hold -store <dir> -list", runHold},
+		{"audit", "audit [flags] <log>", runAudit},
+		{"publish", "publish -bucket <name> | -plugin <name> [flags]", runPublish},
+		{"media", "media [flags] <root>", runMedia},
+		{"documents", "documents [flags] <root>", runDocuments},
+		{"bloom", "bloom -o <filter> [flags] <root|scan> | bloom -query <filter> <file|hash>...", runBloom},
+		{"export", "export -store <dir> [-o <bundle>] <snapshot-id>", runExport},
+		{"import", "import -store <dir> <bundle>", runImport},
+		{"doctor", "doctor [flags] [root...]", runDoctor},
+		{"plugins", "plugins [-format table|json]", runPlugins},
+		{"run", "run [flags] <pipeline.json>...", runPipeline},
+		{"pack", "pack [flags] <root> <archive>", runPack},
+		{"trash", "trash [flags] <dir|system>", runTrash},
+		{"apply", "apply [flags] <plan.json>", runApply},
+		{"cleanup", "cleanup -rules <rules.json> | -empty-dirs [-o <report.json>] [flags] <root> | cleanup -delete <report.json> [flags]", runCleanup},
+		{"organize", "organize -rules <rules.json> [flags] <root>", runOrganize},
+		{"agent", "agent [flags] scan <root> | diff <root> | verify <checksum-file> <root> | drift <schedule> | events", runAgent},
+		{"fim", "fim [flags] baseline <profile.json> | check <profile.json> | watch <profile.json> | rules <profile.json>", runFIM},
+	}
+}
+
+// sigCtx is canceled on SIGINT or SIGTERM, so that long commands stop early and save their progress.
+var sigCtx = context.Background()
+
+// logger logs to the standard error at the level of -log-level, nil if it is not set.
+var logger *slog.Logger
+
+func main() {
+	var stop context.CancelFunc
+	sigCtx, stop = shutdown.Notify(context.Background())
+	code := run(os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+func run(args []string) int {
+	lang, ioLimit, logLevel, args := globalArgs(args)
+	if err := setLang(lang); err != nil {
+		return fail(err)
+	}
+	if logLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+			return fail(fmt.Errorf("invalid -log-level %q, expected debug, info, warn or error", logLevel))
+		}
+		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	if ioLimit != "" {
+		n, err := strconv.ParseInt(ioLimit, 10, 64)
+		if err != nil {
+			return fail(fmt.Errorf("invalid -io-limit %q, expected a number of bytes per second", ioLimit))
+		}
+		throttle.SetGlobal(n)
+	}
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(os.Stderr)
+		return exitError
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, tr("octopus: unknown command %q\n"), args[0])
+	usage(os.Stderr)
+
+	return exitError
+}
+
+// globalArgs returns the values of the leading -lang, -io-limit and -log-level options, defaulting to OCTOPUS_LANG,
+// OCTOPUS_IO_LIMIT and OCTOPUS_LOG_LEVEL, and the remaining arguments.
+func globalArgs(args []string) (lang, ioLimit, logLevel string, rest []string) {
+	lang, ioLimit, logLevel = os.Getenv("OCTOPUS_LANG"), os.Getenv("OCTOPUS_IO_LIMIT"), os.Getenv("OCTOPUS_LOG_LEVEL")
+	options := map[string]*string{"lang": &lang, "io-limit": &ioLimit, "log-level": &logLevel}
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		if k, v, ok := strings.Cut(name, "="); ok && options[k] != nil {
+			*options[k] = v
+			args = args[1:]
+		} else if options[name] != nil && len(args) > 1 {
+			*options[name] = args[1]
+			args = args[2:]
+		} else {
+			break
+		}
+	}
+
+	return lang, ioLimit, logLevel, args
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, tr("Usage: octopus [-lang <language>] [-io-limit <bytes-per-second>] [-log-level <level>] <command> [flags] [arguments]"))
+	fmt.Fprintln(w, tr("\nCommands:"))
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\n", c.usage)
+	}
+}
+
+// newFlagSet returns a flag set for the command printing its usage line on errors.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(fs.Output(), tr("Usage: octopus %s\n\nFlags:\n"), c.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags and checks the number of positional arguments.
+func parse(fs *flag.FlagSet, args []string, nargs int) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+// list is a flag accepting comma-separated values, possibly repeated.
+type list []string
+
+func (l *list) String() string { return strings.Join(*l, ",") }
+
+func (l *list) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// orderFlag is a flag selecting the order files are read in, see dirreader.WithOrder.
+type orderFlag dirreader.Order
+
+func (o *orderFlag) String() string { return dirreader.Order(*o).String() }
+
+func (o *orderFlag) Set(s string) error {
+	order, ok := dirreader.ParseOrder(s)
+	if !ok {
+		return fmt.Errorf("unknown order %q", s)
+	}
+	*o = orderFlag(order)
+	return nil
+}
+
+// scanFlags holds the flags shared by the commands that scan trees.
+type scanFlags struct {
+	hash       string
+	include    list
+	exclude    list
+	skipHidden bool
+	ignoreCase bool
+	matchPath  bool
+	oneFS      bool
+	inodesOnce bool
+	index      bool
+	quickHash  int64
+	hmacKey    string
+	allErrors  bool
+	checkpoint string
+	cpInterval time.Duration
+	rateLimit  int64
+	scriptPath string
+	script     *script.Script // Compiled script of scriptPath, see loadScript.
+	order      orderFlag
+	maxFiles   int
+	maxBytes   int64
+	maxErrors  int
+	skipDenied bool
+	cache      string
+	pubkey     string          // Public key the manifests fetched by load must be signed with, set by diff -pubkey.
+	stats      dirreader.Stats // Statistics of the last scan, see scan.
+}
+
+func (f *scanFlags) register(fs *flag.FlagSet, defaultHash string) {
+	fs.StringVar(&f.hash, "hash", defaultHash, "hash algorithm: none, "+strings.Join(hashes.Names(), ", ")+"; "+hashes.Default+" is the fastest")
+	fs.Var(&f.include, "include", "only include files with these suffixes, comma-separated or repeated")
+	fs.Var(&f.exclude, "exclude", "exclude files with these suffixes, comma-separated or repeated")
+	fs.BoolVar(&f.skipHidden, "skip-hidden", false, "skip hidden files and directories")
+	fs.BoolVar(&f.ignoreCase, "ignore-case", false, "match -include and -exclude case-insensitively")
+	fs.BoolVar(&f.matchPath, "match-path", false, "match -include and -exclude against the relative path, e.g. /docs/ or /README.md")
+	fs.BoolVar(&f.oneFS, "one-file-system", false, "do not descend into directories on other filesystems, including bind and network mounts")
+	fs.BoolVar(&f.inodesOnce, "hash-inodes-once", false, "hash hard-linked files once per inode")
+	fs.BoolVar(&f.index, "index", false, "list the files from the locate database or the NTFS master file table when available")
+	fs.Int64Var(&f.quickHash, "quick-hash", 0, "hash only the size and the first and last N bytes of each file")
+	fs.StringVar(&f.hmacKey, "hmac-key", "", "file holding a secret key to compute HMAC digests with the -hash algorithm")
+	fs.BoolVar(&f.allErrors, "all-errors", false, "print every scan error instead of a summary grouped by cause")
+	fs.StringVar(&f.checkpoint, "checkpoint", "", "save the progress of the scan to this file, to resume it if interrupted")
+	fs.DurationVar(&f.cpInterval, "checkpoint-interval", time.Minute, "interval between checkpoints")
+	fs.Int64Var(&f.rateLimit, "rate-limit", 0, "read the content of the files at most at this many bytes per second")
+	fs.Var(&f.order, "order", "order the files are read in: unordered, smallest-first, largest-first, breadth-first or depth-first")
+	fs.IntVar(&f.maxFiles, "max-files", 0, "stop the scan after this many files, e.g. to sample a huge tree")
+	fs.Int64Var(&f.maxBytes, "max-bytes", 0, "stop the scan after files totaling this many bytes")
+	fs.IntVar(&f.maxErrors, "max-errors", 0, "give up the scan after this many errors, e.g. on a broken mount")
+	fs.BoolVar(&f.skipDenied, "skip-denied", false, "skip the directories and files access is denied to instead of failing the scan")
+	fs.StringVar(&f.cache, "cache", "", "keep the scanned files in this store file and read only the files changed since the previous scan")
+	fs.StringVar(&f.scriptPath, "script", "", "Starlark script whose filter function selects the files and annotate function labels them")
+}
+
+// mask returns the mask and the include flag for dirreader.Exec.
+func (f *scanFlags) mask() ([]string, bool, error) {
+	if len(f.include) > 0 && len(f.exclude) > 0 {
+		return nil, false, errors.New("-include and -exclude cannot be used together")
+	}
+	if len(f.include) > 0 {
+		return f.include, true, nil
+	}
+	return f.exclude, false, nil
+}
+
+// options returns the dirreader options selected by the flags.
+func (f *scanFlags) options() []dirreader.Option {
+	return []dirreader.Option{
+		dirreader.WithSkipHidden(f.skipHidden),
+		dirreader.WithMaskFold(f.ignoreCase),
+		dirreader.WithMaskPath(f.matchPath),
+		dirreader.WithOneFileSystem(f.oneFS),
+		dirreader.WithHashInodesOnce(f.inodesOnce),
+		dirreader.WithIndex(f.index),
+		dirreader.WithQuickHash(f.quickHash),
+		dirreader.WithCheckpoint(f.checkpoint, f.cpInterval),
+		dirreader.WithRateLimit(f.rateLimit),
+		dirreader.WithOrder(dirreader.Order(f.order)),
+		dirreader.WithLimit(f.maxFiles, f.maxBytes),
+		dirreader.WithMaxErrors(f.maxErrors),
+		dirreader.WithSkipPermissionErrors(f.skipDenied),
+		dirreader.WithContext(sigCtx),
+		dirreader.WithLogger(logger),
+	}
+}
+
+// loadScript returns the script of -script, compiled on first use, or nil if none is set.
+func (f *scanFlags) loadScript() (*script.Script, error) {
+	if f.scriptPath == "" || f.script != nil {
+		return f.script, nil
+	}
+	var err error
+	f.script, err = script.Load(f.scriptPath)
+	return f.script, err
+}
+
+// scriptOptions returns the dirreader options applying the filter function of -script, if any.
+func (f *scanFlags) scriptOptions() ([]dirreader.Option, error) {
+	s, err := f.loadScript()
+	if err != nil || s == nil || !s.HasFilter() {
+		return nil, err
+	}
+	return []dirreader.Option{dirreader.WithFilter(s.Filter)}, nil
+}
+
+// scan scans the root with the selected hash algorithm and filters, collecting the statistics of the scan in f.stats.
+// A remote root, see remoteTree, is listed instead.
+func (f *scanFlags) scan(root string, opts ...dirreader.Option) ([]dirreader.FileInfo, error) {
+	h, err := hashes.Lookup(f.hash)
+	if err != nil {
+		return nil, err
+	}
+	if isRemote(root) {
+		t, err := remoteTree(root, f.hash, 1)
+		if err != nil {
+			return nil, err
+		}
+		defer closeTree(t)
+		return backends.Files(sigCtx, t, h, f.hash, strings.TrimSuffix(root, "/")+"/")
+	}
+
+	mask, include, err := f.mask()
+	if err != nil {
+		return nil, err
+	}
+
+	scriptOpts, err := f.scriptOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(append(append(f.options(), scriptOpts...), dirreader.WithStats(&f.stats)), opts...)
+	if f.hmacKey != "" {
+		if h == nil {
+			return nil, errors.New("-hmac-key requires a hash algorithm")
+		}
+		key, err := os.ReadFile(f.hmacKey)
+		if err != nil {
+			return nil, fmt.Errorf("read HMAC key: %w", err)
+		}
+		opts = append(opts, dirreader.WithHMAC(key, h))
+	}
+
+	var cache store.Store
+	var cacheRoot string
+	if f.cache != "" {
+		if cache, cacheRoot, err = f.openCache(root); err != nil {
+			return nil, err
+		}
+		defer func() { _ = cache.Close() }()
+		prev, err := cache.Files(sigCtx, cacheRoot)
+		if err != nil {
+			return nil, fmt.Errorf("read cache %s: %w", f.cache, err)
+		}
+		opts = append(opts, dirreader.WithPrevious(prev))
+	}
+
+	files, err := dirreader.Exec(root, h, mask, include, opts...)
+	if errors.Is(err, dirreader.ErrLimitReached) {
+		fmt.Fprintf(os.Stderr, "octopus: scan %s stopped after %d files, the limit was reached\n", root, len(files))
+		err = withoutLimit(err)
+	}
+	if n := len(f.stats.Skipped); n > 0 && err == nil {
+		fmt.Fprintf(os.Stderr, "octopus: skipped %d paths of %s, permission denied\n", n, root)
+		if f.allErrors {
+			for _, p := range f.stats.Skipped {
+				fmt.Fprintf(os.Stderr, "  %s\n", p)
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) && f.checkpoint != "" {
+			return nil, fmt.Errorf("scan %s interrupted, run it again to resume from %s", root, f.checkpoint)
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("scan %s interrupted", root)
+		}
+		if f.allErrors {
+			return nil, err
+		}
+		return nil, dirreader.Summarize(err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].RelPath() < files[j].RelPath() })
+
+	if cache != nil {
+		if _, err = cache.Save(sigCtx, cacheRoot, files, time.Time{}); err != nil {
+			return nil, fmt.Errorf("write cache %s: %w", f.cache, err)
+		}
+	}
+
+	return files, nil
+}
+
+// withoutLimit returns the errors of a scan but dirreader.ErrLimitReached, nil if there is none.
+func withoutLimit(err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		if !errors.Is(e, dirreader.ErrLimitReached) {
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openCache opens the store of -cache and returns the key the scans of root are kept under: its absolute path
+// with the hash settings, so that the content read with other settings is never reused.
+func (f *scanFlags) openCache(root string) (store.Store, string, error) {
+	if f.hmacKey != "" {
+		return nil, "", errors.New("-cache cannot be used with -hmac-key")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := store.OpenBolt(f.cache)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, fmt.Sprintf("%s?hash=%s&quick=%d", abs, f.hash, f.quickHash), nil
+}
+
+// load returns the files of the tree at path, scanning it if it is a directory,
+// or decoding it if it is a scan saved with "octopus scan -format json", possibly compressed with -compress.
+// An HTTP or HTTPS URL is fetched, see fetchManifest, and decoded as a saved scan, or as a checksum file
+// whose files only have a path and a hash.
+func (f *scanFlags) load(path string) ([]dirreader.FileInfo, error) {
+	if isURL(path) {
+		data, err := fetchManifest(path, f.pubkey)
+		if err != nil {
+			return nil, err
+		}
+		var files []dirreader.FileInfo
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' && f.pubkey == "" {
+			if err = json.Unmarshal(data, &files); err != nil {
+				return nil, fmt.Errorf("decode saved scan %s: %w", path, err)
+			}
+			return files, nil
+		}
+		entries, err := checksum.Read(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return checksum.Files(entries), nil
+	}
+	if isRemote(path) {
+		return f.scan(path)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return f.scan(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	r, err := codec.NewDetectingReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode saved scan %s: %w", path, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	var files []dirreader.FileInfo
+	if err = json.NewDecoder(r).Decode(&files); err != nil {
+		return nil, fmt.Errorf("decode saved scan %s: %w", path, err)
+	}
+
+	return files, nil
+}
+
+// isURL reports whether the path is an HTTP or HTTPS URL.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// fetchManifest downloads the checksum file or saved scan at the URL, checking that it is signed with
+// the ed25519 public key in the PEM file pubkey, if set. Manifests are cached with their ETag in the
+// octopus directory of the user cache directory, e.g. ~/.cache/octopus/manifests, and only downloaded
+// again if they changed.
+func fetchManifest(url, pubkey string) ([]byte, error) {
+	var cacheDir string
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheDir = filepath.Join(dir, "octopus", "manifests")
+	}
+	data, err := checksum.Fetch(sigCtx, nil, url, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSignature(data, url, pubkey); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fail prints the error and returns the error exit code.
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "octopus: %v\n", err)
+	return exitError
+}
+
+// writeJSON writes v as indented JSON to the standard output.
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// newTable returns a writer aligning tab-separated columns on the standard output.
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
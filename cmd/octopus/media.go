@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gromey/octopus/media"
+)
+
+func runMedia(args []string) int {
+	fs := newFlagSet("media")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "table", "output format: table or json")
+	all := fs.Bool("all", false, "list every media file, not only the ones with problems")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	type result struct {
+		Path string `json:"path"`
+		*media.Info
+	}
+	var results []result
+	var problems int
+	for _, fi := range files {
+		info, e := media.Probe(fi.PathAbs)
+		if e != nil {
+			if !errors.Is(e, media.ErrUnknownFormat) {
+				err = errors.Join(err, e)
+			}
+			continue
+		}
+		if !info.OK() {
+			problems++
+		}
+		if *all || !info.OK() {
+			results = append(results, result{Path: fi.RelPath(), Info: info})
+		}
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, r := range results {
+			status := tr("ok")
+			if !r.OK() {
+				status = strings.Join(r.Problems, "; ")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Path, r.Container, r.Duration, status)
+		}
+		if e := tw.Flush(); e != nil {
+			err = errors.Join(err, e)
+		}
+	case "json":
+		if e := writeJSON(results); e != nil {
+			err = errors.Join(err, e)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+	if problems > 0 {
+		return exitChanges
+	}
+
+	return exitOK
+}
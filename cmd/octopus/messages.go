@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// catalog maps the English messages printed in tables and reports to their translation.
+// Messages are format strings: translations keep the verbs, in the same order, and the tabs separating columns.
+// Errors, JSON and CSV output, checksum files and statuses read by other tools are not translated.
+type catalog map[string]string
+
+// catalogs lists the catalogs by language, selected with -lang.
+var catalogs = map[string]catalog{
+	"de": {
+		"skipped": "übersprungen",
+		"failed":  "fehlgeschlagen",
+		"Usage: octopus [-lang <language>] [-io-limit <bytes-per-second>] [-log-level <level>] <command> [flags] [arguments]": "Verwendung: octopus [-lang <Sprache>] [-io-limit <Bytes-pro-Sekunde>] [-log-level <Stufe>] <Befehl> [Optionen] [Argumente]",
+		"\nCommands:":                            "\nBefehle:",
+		"Usage: octopus %s\n\nFlags:\n":          "Verwendung: octopus %s\n\nOptionen:\n",
+		"octopus: unknown command %q\n":          "octopus: unbekannter Befehl %q\n",
+		"%s: %d entries, chain intact\n":         "%s: %d Einträge, Kette intakt\n",
+		"%d files in the baseline of %s\n":       "%d Dateien in der Baseline von %s\n",
+		"%s: probably present\n":                 "%s: wahrscheinlich vorhanden\n",
+		"%s: absent\n":                           "%s: nicht vorhanden\n",
+		"skip":                                   "übersprungen",
+		"reclaimable\t%d bytes\t\t\n":            "freigebbar\t%d Bytes\t\t\n",
+		"reclaimable\t%d bytes\n":                "freigebbar\t%d Bytes\n",
+		"%s\t%d bytes x %d\n":                    "%s\t%d Bytes x %d\n",
+		"ok":                                     "ok",
+		"FAIL":                                   "FEHLER",
+		"PATH\tFORMAT\tMACROS\tACTIVE\tEMBEDDED": "PFAD\tFORMAT\tMAKROS\tAKTIV\tEINGEBETTET",
+		"PATH\tSIZE\tMODIFIED\tHASH":             "PFAD\tGRÖSSE\tGEÄNDERT\tHASH",
+		"files\t%d\n":                            "Dateien\t%d\n",
+		"directories\t%d\n":                      "Verzeichnisse\t%d\n",
+		"bytes\t%d\n":                            "Bytes\t%d\n",
+		"hard links\t%d\n":                       "Hardlinks\t%d\n",
+		"lines\t%d\n":                            "Zeilen\t%d\n",
+		"deepest path\t%s (%d)\n":                "tiefster Pfad\t%s (%d)\n",
+		"elapsed\t%s\n":                          "Dauer\t%s\n",
+		"\nEXTENSION\tFILES\tBYTES\tLINES":       "\nENDUNG\tDATEIEN\tBYTES\tZEILEN",
+		"(none)":                                 "(keine)",
+		"\nLARGEST\tBYTES\t":                     "\nGRÖSSTE\tBYTES\t",
+		"FILE\tBYTES":                            "DATEI\tBYTES",
+		"\nDIRECTORY\tBYTES\tFILES":              "\nVERZEICHNIS\tBYTES\tDATEIEN",
+		"INODE\tSIZE\tPATH":                      "INODE\tGRÖSSE\tPFAD",
+		"replaced %d duplicates, reclaimed %d bytes, rollback log: %s\n": "%d Duplikate ersetzt, %d Bytes freigegeben, Rückgängig-Protokoll: %s\n",
+		"copied %d files (%d bytes), deleted %d files\n":                 "%d Dateien kopiert (%d Bytes), %d Dateien gelöscht\n",
+		"octopus: WARNING: %d of %d files did not match\n":               "octopus: WARNUNG: %d von %d Dateien stimmen nicht überein\n",
+	},
+	"es": {
+		"skipped": "omitido",
+		"failed":  "fallido",
+		"Usage: octopus [-lang <language>] [-io-limit <bytes-per-second>] [-log-level <level>] <command> [flags] [arguments]": "Uso: octopus [-lang <idioma>] [-io-limit <bytes-por-segundo>] [-log-level <nivel>] <comando> [opciones] [argumentos]",
+		"\nCommands:":                            "\nComandos:",
+		"Usage: octopus %s\n\nFlags:\n":          "Uso: octopus %s\n\nOpciones:\n",
+		"octopus: unknown command %q\n":          "octopus: comando desconocido %q\n",
+		"%s: %d entries, chain intact\n":         "%s: %d entradas, cadena intacta\n",
+		"%d files in the baseline of %s\n":       "%d archivos en la línea base de %s\n",
+		"%s: probably present\n":                 "%s: probablemente presente\n",
+		"%s: absent\n":                           "%s: ausente\n",
+		"skip":                                   "omitido",
+		"reclaimable\t%d bytes\t\t\n":            "recuperable\t%d bytes\t\t\n",
+		"reclaimable\t%d bytes\n":                "recuperable\t%d bytes\n",
+		"%s\t%d bytes x %d\n":                    "%s\t%d bytes x %d\n",
+		"ok":                                     "ok",
+		"FAIL":                                   "FALLO",
+		"PATH\tFORMAT\tMACROS\tACTIVE\tEMBEDDED": "RUTA\tFORMATO\tMACROS\tACTIVO\tINCRUSTADO",
+		"PATH\tSIZE\tMODIFIED\tHASH":             "RUTA\tTAMAÑO\tMODIFICADO\tHASH",
+		"files\t%d\n":                            "archivos\t%d\n",
+		"directories\t%d\n":                      "directorios\t%d\n",
+		"bytes\t%d\n":                            "bytes\t%d\n",
+		"hard links\t%d\n":                       "enlaces duros\t%d\n",
+		"lines\t%d\n":                            "líneas\t%d\n",
+		"deepest path\t%s (%d)\n":                "ruta más profunda\t%s (%d)\n",
+		"elapsed\t%s\n":                          "duración\t%s\n",
+		"\nEXTENSION\tFILES\tBYTES\tLINES":       "\nEXTENSIÓN\tARCHIVOS\tBYTES\tLÍNEAS",
+		"(none)":                                 "(ninguna)",
+		"\nLARGEST\tBYTES\t":                     "\nMÁS GRANDES\tBYTES\t",
+		"FILE\tBYTES":                            "ARCHIVO\tBYTES",
+		"\nDIRECTORY\tBYTES\tFILES":              "\nDIRECTORIO\tBYTES\tARCHIVOS",
+		"INODE\tSIZE\tPATH":                      "INODO\tTAMAÑO\tRUTA",
+		"replaced %d duplicates, reclaimed %d bytes, rollback log: %s\n": "%d duplicados reemplazados, %d bytes recuperados, registro de reversión: %s\n",
+		"copied %d files (%d bytes), deleted %d files\n":                 "%d archivos copiados (%d bytes), %d archivos eliminados\n",
+		"octopus: WARNING: %d of %d files did not match\n":               "octopus: AVISO: %d de %d archivos no coinciden\n",
+	},
+	"fr": {
+		"skipped": "ignoré",
+		"failed":  "échoué",
+		"Usage: octopus [-lang <language>] [-io-limit <bytes-per-second>] [-log-level <level>] <command> [flags] [arguments]": "Utilisation : octopus [-lang <langue>] [-io-limit <octets-par-seconde>] [-log-level <niveau>] <commande> [options] [arguments]",
+		"\nCommands:":                            "\nCommandes :",
+		"Usage: octopus %s\n\nFlags:\n":          "Utilisation : octopus %s\n\nOptions :\n",
+		"octopus: unknown command %q\n":          "octopus : commande inconnue %q\n",
+		"%s: %d entries, chain intact\n":         "%s : %d entrées, chaîne intacte\n",
+		"%d files in the baseline of %s\n":       "%d fichiers dans la référence de %s\n",
+		"%s: probably present\n":                 "%s : probablement présent\n",
+		"%s: absent\n":                           "%s : absent\n",
+		"skip":                                   "ignoré",
+		"reclaimable\t%d bytes\t\t\n":            "récupérable\t%d octets\t\t\n",
+		"reclaimable\t%d bytes\n":                "récupérable\t%d octets\n",
+		"%s\t%d bytes x %d\n":                    "%s\t%d octets x %d\n",
+		"ok":                                     "ok",
+		"FAIL":                                   "ÉCHEC",
+		"PATH\tFORMAT\tMACROS\tACTIVE\tEMBEDDED": "CHEMIN\tFORMAT\tMACROS\tACTIF\tINTÉGRÉ",
+		"PATH\tSIZE\tMODIFIED\tHASH":             "CHEMIN\tTAILLE\tMODIFIÉ\tHASH",
+		"files\t%d\n":                            "fichiers\t%d\n",
+		"directories\t%d\n":                      "répertoires\t%d\n",
+		"bytes\t%d\n":                            "octets\t%d\n",
+		"hard links\t%d\n":                       "liens physiques\t%d\n",
+		"lines\t%d\n":                            "lignes\t%d\n",
+		"deepest path\t%s (%d)\n":                "chemin le plus profond\t%s (%d)\n",
+		"elapsed\t%s\n":                          "durée\t%s\n",
+		"\nEXTENSION\tFILES\tBYTES\tLINES":       "\nEXTENSION\tFICHIERS\tOCTETS\tLIGNES",
+		"(none)":                                 "(aucune)",
+		"\nLARGEST\tBYTES\t":                     "\nLES PLUS GRANDS\tOCTETS\t",
+		"FILE\tBYTES":                            "FICHIER\tOCTETS",
+		"\nDIRECTORY\tBYTES\tFILES":              "\nRÉPERTOIRE\tOCTETS\tFICHIERS",
+		"INODE\tSIZE\tPATH":                      "INŒUD\tTAILLE\tCHEMIN",
+		"replaced %d duplicates, reclaimed %d bytes, rollback log: %s\n": "%d doublons remplacés, %d octets récupérés, journal d'annulation : %s\n",
+		"copied %d files (%d bytes), deleted %d files\n":                 "%d fichiers copiés (%d octets), %d fichiers supprimés\n",
+		"octopus: WARNING: %d of %d files did not match\n":               "octopus : AVERTISSEMENT : %d fichiers sur %d ne correspondent pas\n",
+	},
+}
+
+// messages is the catalog of the selected language, nil for English.
+var messages catalog
+
+// setLang selects the language of the messages, "en" or one of the catalogs.
+func setLang(lang string) error {
+	lang = strings.ToLower(lang)
+	if lang == "" || lang == "en" {
+		messages = nil
+		return nil
+	}
+	if c, ok := catalogs[lang]; ok {
+		messages = c
+		return nil
+	}
+
+	langs := []string{"en"}
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+
+	return fmt.Errorf("unknown language %q, supported: %s", lang, strings.Join(langs, ", "))
+}
+
+// tr returns the translation of the message in the selected language, or the message itself.
+func tr(msg string) string {
+	if t, ok := messages[msg]; ok {
+		return t
+	}
+	return msg
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/organize"
+)
+
+func runOrganize(args []string) int {
+	fs := newFlagSet("organize")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "table", "output format: table or json")
+	rulesPath := fs.String("rules", "", "JSON file of the rules giving the new paths of the files, see the organize package")
+	dest := fs.String("dest", "", "directory the new paths are relative to, moving the files out of the root; the root if empty")
+	conflict := fs.String("conflict", string(organize.Skip), "handling of the files whose new path is taken: skip, or suffix to number their names")
+	planPath := fs.String("plan", "", "write the moves to this plan file, for review before \"octopus apply\"")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+	if *rulesPath == "" {
+		fs.Usage()
+		return exitError
+	}
+
+	rules, err := organize.Load(*rulesPath)
+	if err != nil {
+		return fail(err)
+	}
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	plan, skipped, err := organize.Plan(fs.Arg(0), files, rules, organize.Options{Dest: *dest, Conflict: organize.Conflict(*conflict)})
+	if err != nil {
+		return fail(err)
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, op := range plan.Ops {
+			fmt.Fprintf(tw, "%s\t%s\t->\t%s\n", op.Kind, op.Src, op.Dst)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(tw, "%s\t%s\t\t(%s)\n", tr("skip"), s.Path, s.Reason)
+		}
+		fmt.Fprintf(tw, tr("dry run: %d files to move, %d skipped\n"), len(plan.Ops), len(skipped))
+		err = tw.Flush()
+	case "json":
+		if skipped == nil {
+			skipped = []organize.Skipped{}
+		}
+		err = writeJSON(struct {
+			Plan    *actions.Plan      `json:"plan"`
+			Skipped []organize.Skipped `json:"skipped"`
+		}{plan, skipped})
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+	if err == nil && *planPath != "" {
+		err = writePlan(plan, *planPath)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(plan.Ops) > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/archive"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Entries of the archives written with "octopus pack -manifest" or -since, so that the next incremental
+// archive of a chain can be based on the archive alone.
+const (
+	manifestEntry = ".octopus/manifest.json" // Scan of the whole tree at the time of the archive, as with "octopus scan -format json".
+	deletedEntry  = ".octopus/deleted.json"  // Slash-separated paths deleted since the previous archive, as a JSON array.
+)
+
+func runPack(args []string) int {
+	fs := newFlagSet("pack")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "", "archive format: zip, tar, tar.gz or tar.zst (default: from the extension of the archive)")
+	since := fs.String("since", "", "only pack the files new or changed since this saved scan, or archive written with -manifest, and list the deleted ones")
+	withManifest := fs.Bool("manifest", false, "store the scan of the tree in the archive, to base the next -since archive on it")
+
+	if !parse(fs, args, 2) {
+		return exitError
+	}
+
+	if *format == "" {
+		if *format = archive.Format(fs.Arg(1)); *format == "" {
+			return fail(fmt.Errorf("cannot tell the format of %s from its extension, use -format", fs.Arg(1)))
+		}
+	}
+
+	files, err := sf.scan(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	var inc *increment
+	if *since != "" || *withManifest {
+		var prev []dirreader.FileInfo
+		if *since != "" {
+			if prev, err = loadPrevious(&sf, *since); err != nil {
+				return fail(err)
+			}
+		}
+		var reserved []dirreader.FileInfo
+		files, reserved = splitReserved(files)
+		for _, fi := range reserved {
+			fmt.Fprintf(os.Stderr, "octopus: skipped %q: reserved for the manifest of the archive\n", fi.RelPath())
+		}
+		inc = newIncrement(prev, files, *since != "")
+	}
+
+	packed := files
+	if inc != nil && *since != "" {
+		packed = inc.changed
+	}
+	n, size, notices, err := packFiles(packed, fs.Arg(1), *format, inc)
+	if err != nil {
+		return fail(err)
+	}
+	for _, nt := range notices {
+		if nt.Stored == "" {
+			fmt.Fprintf(os.Stderr, "octopus: skipped %q: %s\n", nt.Name, nt.Reason)
+		} else {
+			fmt.Fprintf(os.Stderr, "octopus: stored %q as %q: %s\n", nt.Name, nt.Stored, nt.Reason)
+		}
+	}
+	fmt.Printf(tr("packed %d files (%d bytes) into %s\n"), n, size, fs.Arg(1))
+	if inc != nil && *since != "" {
+		fmt.Printf(tr("listed %d deleted files\n"), len(inc.deleted))
+	}
+
+	return exitOK
+}
+
+// increment holds what an archive of a chain stores besides the files of the tree.
+type increment struct {
+	files   []dirreader.FileInfo // Scan of the whole tree, stored as manifestEntry.
+	changed []dirreader.FileInfo // Files new or changed since the previous scan.
+	deleted []string             // Slash-separated paths of the files deleted since the previous scan, nil without one.
+}
+
+// newIncrement compares the scan of the tree with the previous one, if any.
+func newIncrement(prev, files []dirreader.FileInfo, hasPrev bool) *increment {
+	inc := &increment{files: files}
+	if !hasPrev {
+		return inc
+	}
+
+	inc.deleted = []string{}
+	for _, c := range diff.Compare(prev, files) {
+		switch c.Op {
+		case diff.Added, diff.Modified:
+			inc.changed = append(inc.changed, *c.New)
+		case diff.Removed:
+			inc.deleted = append(inc.deleted, filepath.ToSlash(c.Path))
+		}
+	}
+	return inc
+}
+
+// splitReserved separates the files at the paths of the entries of an increment from the others.
+func splitReserved(files []dirreader.FileInfo) ([]dirreader.FileInfo, []dirreader.FileInfo) {
+	var kept, reserved []dirreader.FileInfo
+	for _, fi := range files {
+		switch filepath.ToSlash(fi.RelPath()) {
+		case manifestEntry, deletedEntry:
+			reserved = append(reserved, fi)
+		default:
+			kept = append(kept, fi)
+		}
+	}
+	return kept, reserved
+}
+
+// loadPrevious returns the files of the scan an incremental archive is based on: the manifest stored in
+// an archive written with -manifest or -since, or a saved scan.
+func loadPrevious(sf *scanFlags, path string) ([]dirreader.FileInfo, error) {
+	if archive.Format(path) == "" {
+		return sf.load(path)
+	}
+
+	var files []dirreader.FileInfo
+	found := false
+	err := archive.Walk(path, func(e archive.Entry, content io.Reader) error {
+		if e.Path != manifestEntry {
+			return nil
+		}
+		found = true
+		return json.NewDecoder(content).Decode(&files)
+	})
+	if err == nil && !found {
+		err = errors.New("no manifest, the archive was not written with -manifest or -since")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest of %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// packFiles writes the files into a new archive of the format at path, under their relative paths,
+// followed by the entries of the increment, if any, and returns the number of files and bytes packed,
+// and the files renamed or skipped. The archive is removed if packing fails or is interrupted.
+func packFiles(files []dirreader.FileInfo, path, format string, inc *increment) (int, int64, []archive.Notice, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	var total int64
+	p, err := archive.NewPacker(f, format)
+	for i := 0; err == nil && i < len(files); i++ {
+		if err = sigCtx.Err(); err != nil {
+			err = errors.New("pack interrupted")
+			break
+		}
+		n := p.Len()
+		if err = p.AddFile(filepath.ToSlash(files[i].RelPath()), files[i].PathAbs); err == nil && p.Len() > n {
+			total += files[i].Size()
+		}
+	}
+	n := 0
+	if err == nil {
+		n = p.Len()
+	}
+	if err == nil && inc != nil {
+		err = inc.add(p)
+	}
+	if err == nil {
+		err = p.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, 0, nil, fmt.Errorf("pack %s: %w", path, err)
+	}
+
+	return n, total, p.Notices(), nil
+}
+
+// add stores the manifest and, for an incremental archive, the list of deleted files.
+func (inc *increment) add(p *archive.Packer) error {
+	now := time.Now()
+	if err := addJSON(p, manifestEntry, inc.files, now); err != nil {
+		return err
+	}
+	if inc.deleted == nil {
+		return nil
+	}
+	return addJSON(p, deletedEntry, inc.deleted, now)
+}
+
+// addJSON stores v as indented JSON under the name.
+func addJSON(p *archive.Packer, name string, v any, modTime time.Time) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return p.AddBytes(name, buf.Bytes(), modTime)
+}
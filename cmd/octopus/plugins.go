@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/enrich"
+	"github.com/gromey/octopus/plugins"
+)
+
+func runPlugins(args []string) int {
+	fs := newFlagSet("plugins")
+
+	format := fs.String("format", "table", "output format: table or json")
+
+	if !parse(fs, args, 0) {
+		return exitError
+	}
+
+	type result struct {
+		plugins.Plugin
+		Capabilities []string `json:"capabilities"`
+		Error        string   `json:"error,omitempty"`
+	}
+
+	var results []result
+	for _, p := range plugins.Discover(plugins.SearchPath()) {
+		r := result{Plugin: p}
+		c, err := plugins.Start(sigCtx, p)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Capabilities = c.Capabilities
+			if err = c.Close(); err != nil {
+				r.Error = err.Error()
+			}
+		}
+		results = append(results, r)
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, strings.Join(r.Capabilities, ","), r.Path, r.Error)
+		}
+		if err := tw.Flush(); err != nil {
+			return fail(err)
+		}
+	case "json":
+		if err := writeJSON(results); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	return exitOK
+}
+
+// startPlugin starts the named plugin, which must support the method.
+func startPlugin(ctx context.Context, name, method string) (*plugins.Client, error) {
+	p, err := plugins.Find(name, plugins.SearchPath())
+	if err != nil {
+		return nil, err
+	}
+	c, err := plugins.Start(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Supports(method) {
+		_ = c.Close()
+		return nil, fmt.Errorf("plugin %s does not support %s", name, method)
+	}
+	return c, nil
+}
+
+// enrichWithPlugins labels the files with the named plugins in turn, prefixing the labels with the plugin names.
+func enrichWithPlugins(ctx context.Context, files []dirreader.FileInfo, names []string) error {
+	for _, name := range names {
+		c, err := startPlugin(ctx, name, plugins.Enrich)
+		if err != nil {
+			return err
+		}
+		err = (&enrich.Plugin{Client: c, Prefix: name + "."}).Enrich(ctx, files)
+		if err = errors.Join(err, c.Close()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/plugins"
+	"github.com/gromey/octopus/publish"
+	"github.com/gromey/octopus/snapshot"
+)
+
+func runPublish(args []string) int {
+	fs := newFlagSet("publish")
+
+	endpoint := fs.String("endpoint", "https://s3.amazonaws.com", "base URL of the S3-compatible object storage")
+	bucket := fs.String("bucket", "", "bucket with Object Lock enabled (required unless -plugin is set)")
+	region := fs.String("region", "us-east-1", "region of the bucket")
+	prefix := fs.String("prefix", "", "prefix of the object keys")
+	mode := fs.String("mode", "COMPLIANCE", "retention mode: GOVERNANCE, COMPLIANCE or none")
+	retain := fs.Duration("retain", 0, "retention period, e.g. 61320h for seven years")
+	legalHold := fs.Bool("legal-hold", false, "place a legal hold on the objects")
+	store := fs.String("store", "", "snapshot store of -snapshot")
+	snapID := fs.String("snapshot", "", "ID of the snapshot to publish")
+	auditPath := fs.String("audit", "", "audit log to publish")
+	plugin := fs.String("plugin", "", "publish with this plugin instead of S3, see \"octopus plugins\"")
+	compress := fs.String("compress", "none", "codec to compress the objects with: "+strings.Join(codec.Names(), ", "))
+
+	if !parse(fs, args, 0) {
+		return exitError
+	}
+	if (*bucket == "" && *plugin == "") || (*snapID == "" && *auditPath == "") || (*snapID != "" && *store == "") {
+		fs.Usage()
+		return exitError
+	}
+
+	c, err := codec.Lookup(*compress)
+	if err != nil {
+		return fail(err)
+	}
+
+	p := &publish.Publisher{
+		Bucket: &publish.S3{
+			Endpoint:     *endpoint,
+			Bucket:       *bucket,
+			Region:       *region,
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		Prefix:    *prefix,
+		Retain:    *retain,
+		LegalHold: *legalHold,
+		Codec:     c,
+	}
+	switch m := publish.Mode(strings.ToUpper(*mode)); m {
+	case publish.Governance, publish.Compliance:
+		p.Mode = m
+	case "NONE":
+	default:
+		return fail(fmt.Errorf("unknown retention mode %q", *mode))
+	}
+
+	ctx := sigCtx
+
+	if *plugin != "" {
+		pc, err := startPlugin(ctx, *plugin, plugins.Put)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() { _ = pc.Close() }()
+		p.Bucket = &plugins.Bucket{Client: pc}
+	}
+
+	if *snapID != "" {
+		err = publishSnapshot(ctx, p, *store, *snapID)
+	}
+	if *auditPath != "" {
+		key, e := p.AuditLog(ctx, *auditPath)
+		if e == nil {
+			fmt.Println(key)
+		}
+		err = errors.Join(err, e)
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// publishSnapshot publishes the snapshot with the provided ID from the store and prints its key.
+func publishSnapshot(ctx context.Context, p *publish.Publisher, store, id string) error {
+	s, err := snapshot.Open(store)
+	if err != nil {
+		return err
+	}
+
+	snap, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+
+	key, err := p.Snapshot(ctx, snap)
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gromey/octopus/backends"
+	"github.com/gromey/octopus/sigv4"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// isRemote reports whether the root is that of a remote tree, see remoteTree.
+func isRemote(root string) bool {
+	return strings.HasPrefix(root, "s3://") || strings.HasPrefix(root, "sftp://")
+}
+
+// remoteTree returns the tree of a root of the form s3://<bucket>/<prefix> or sftp://[<user>@]<host>[:<port>]/<dir>,
+// configured from the environment. The metadata of S3 objects is read unless they are compared by ETag,
+// and SFTP trees open conns connections, to be closed with closeTree.
+func remoteTree(root, algorithm string, conns int) (backends.Tree, error) {
+	if rest := strings.TrimPrefix(root, "s3://"); rest != root {
+		return s3Tree(rest, algorithm), nil
+	}
+	return sftpTree(root, conns)
+}
+
+// closeTree closes the connections of the tree, if any.
+func closeTree(t backends.Tree) {
+	if c, ok := t.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// s3Tree returns the S3 tree of <bucket>/<prefix>.
+func s3Tree(root, algorithm string) *backends.S3 {
+	bucket, prefix, _ := strings.Cut(root, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	t := &backends.S3{
+		Credentials: sigv4.Credentials{
+			Region:       os.Getenv("AWS_REGION"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		Endpoint: os.Getenv("OCTOPUS_S3_ENDPOINT"),
+		Bucket:   bucket,
+		Prefix:   prefix,
+		Metadata: algorithm != "md5",
+	}
+	if t.Endpoint == "" {
+		t.Endpoint = "https://s3.amazonaws.com"
+	}
+	return t
+}
+
+// sftpTree connects to the server of an sftp:// root. The directory is absolute, unless it starts with /~/,
+// relative to the home directory of the user. The user defaults to the local one, and the host key must be
+// in OCTOPUS_SSH_KNOWN_HOSTS, ~/.ssh/known_hosts by default. The user is authenticated by the SSH agent
+// of SSH_AUTH_SOCK, or the private key without passphrase of OCTOPUS_SSH_KEY, ~/.ssh/id_ed25519,
+// ~/.ssh/id_ecdsa or ~/.ssh/id_rsa by default.
+func sftpTree(root string, conns int) (*backends.SFTP, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	dir := u.Path
+	if dir == "" {
+		dir = "/"
+	}
+	if rest := strings.TrimPrefix(dir, "/~"); rest != dir {
+		dir = "." + rest
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	config, err := sshConfig(u.User.Username())
+	if err != nil {
+		return nil, err
+	}
+	return backends.DialSFTP(addr, config, dir, conns)
+}
+
+// sshConfig returns the configuration of the SSH connections of the user, see sftpTree.
+func sshConfig(user string) (*ssh.ClientConfig, error) {
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	home, _ := os.UserHomeDir()
+
+	knownHosts := os.Getenv("OCTOPUS_SSH_KNOWN_HOSTS")
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKey, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	keys := []string{os.Getenv("OCTOPUS_SSH_KEY")}
+	if keys[0] == "" {
+		keys = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	var signers []ssh.Signer
+	for _, k := range keys {
+		pem, err := os.ReadFile(k)
+		if errors.Is(err, os.ErrNotExist) && len(keys) > 1 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read ssh key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && len(keys) > 1 {
+			continue // Left to the agent.
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh key %s: %w", k, err)
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no ssh agent or key to authenticate with, set SSH_AUTH_SOCK or OCTOPUS_SSH_KEY")
+	}
+
+	return &ssh.ClientConfig{User: user, Auth: auth, HostKeyCallback: hostKey}, nil
+}
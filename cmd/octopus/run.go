@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/metrics"
+	"github.com/gromey/octopus/notify"
+	"github.com/gromey/octopus/pipeline"
+	"github.com/gromey/octopus/systemd"
+)
+
+func runPipeline(args []string) int {
+	fs := newFlagSet("run")
+
+	var sf scanFlags
+	sf.register(fs, "")
+	format := fs.String("format", "table", "output format: table or json")
+	every := fs.Duration("every", 0, "run the pipelines again after this interval until interrupted, rather than once")
+	notifyPath := fs.String("notify", "", "JSON file of the email, Slack, Teams and syslog notifiers sent the failed runs, the triggered alerts and the changes found")
+	metricsAddr := fs.String("metrics", "", "with -every, serve Prometheus metrics of the runs on /metrics at this address, e.g. :9090, or on the socket-activated listener named metrics")
+
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+	if *format != "table" && *format != "json" {
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+	if *metricsAddr != "" && *every <= 0 {
+		return fail(errors.New("-metrics requires -every"))
+	}
+
+	pipelines := make([]*pipeline.Pipeline, fs.NArg())
+	for i, path := range fs.Args() {
+		p, err := pipeline.Load(path)
+		if err != nil {
+			return fail(err)
+		}
+		if sf.hash != "" {
+			p.Hash = sf.hash
+		}
+		p.Logger = logger
+		if err = p.Validate(); err != nil {
+			return fail(err)
+		}
+		for _, s := range p.Steps {
+			if sf.skipDenied && s.Delete {
+				return fail(errors.New("-skip-denied cannot be used with sync steps deleting files, the skipped files would be deleted from the destination"))
+			}
+		}
+		pipelines[i] = p
+	}
+
+	scriptOpts, err := sf.scriptOptions()
+	if err != nil {
+		return fail(err)
+	}
+
+	n, err := loadNotifier(*notifyPath)
+	if err != nil {
+		return fail(err)
+	}
+
+	opts := append(sf.options(), scriptOpts...)
+	if *every > 0 {
+		return runEvery(pipelines, opts, n, *every, *metricsAddr, *format)
+	}
+	reports, errs := pipeline.RunAll(sigCtx, pipelines, opts...)
+	notifyRuns(n, pipelines, reports, errs)
+	return printRuns(reports, errs, *format)
+}
+
+// runEvery runs the pipelines, waiting for the interval after each run, until interrupted, sends the outcome of
+// the runs to the notifier if not nil, and serves the metrics of the runs on addr if not empty.
+func runEvery(pipelines []*pipeline.Pipeline, opts []dirreader.Option, n notify.Notifier, every time.Duration, addr, format string) int {
+	var m *metrics.Pipelines
+	if addr != "" {
+		activated, err := systemd.Listeners()
+		if err != nil {
+			return fail(err)
+		}
+		l, err := systemd.Listen(activated, "metrics", "tcp", addr)
+		if err != nil {
+			return fail(err)
+		}
+		reg := metrics.NewRegistry()
+		m = metrics.NewPipelines(reg)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", reg.Handler())
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() { _ = srv.Serve(l) }()
+		defer func() { _ = srv.Close() }()
+	}
+
+	for {
+		reports, errs := pipeline.RunAll(sigCtx, pipelines, opts...)
+		if sigCtx.Err() != nil {
+			return exitOK
+		}
+		for _, rep := range reports {
+			if m != nil && rep != nil {
+				m.Observe(rep)
+			}
+		}
+		notifyRuns(n, pipelines, reports, errs)
+		printRuns(reports, errs, format)
+
+		t := time.NewTimer(every)
+		select {
+		case <-sigCtx.Done():
+			t.Stop()
+			return exitOK
+		case <-t.C:
+		}
+	}
+}
+
+// notifyRuns sends the failed runs of the pipelines, the alerts they triggered, and the changes they found, to the
+// notifier if not nil, printing the failures to send them.
+func notifyRuns(n notify.Notifier, pipelines []*pipeline.Pipeline, reports []*pipeline.Report, errs []error) {
+	if n == nil || sigCtx.Err() != nil {
+		return
+	}
+	for i, p := range pipelines {
+		m := &notify.Message{Time: time.Now(), Root: p.Root}
+		rep := reports[i]
+		switch {
+		case errs[i] != nil:
+			m.Severity, m.Event = notify.Critical, "pipeline-failed"
+			m.Subject, m.Body = fmt.Sprintf("pipeline %s failed", p.Name), errs[i].Error()
+		case rep != nil && len(rep.Alerts) > 0:
+			lines := make([]string, len(rep.Alerts))
+			for j, a := range rep.Alerts {
+				lines[j] = a.String()
+			}
+			m.Severity, m.Event = notify.Critical, "alert"
+			m.Subject, m.Body = fmt.Sprintf("pipeline %s: %d alert rules triggered", p.Name, len(rep.Alerts)), notify.Lines(lines)
+		case rep != nil && rep.Changes > 0:
+			var lines []string
+			for _, s := range rep.Steps {
+				lines = append(lines, fmt.Sprintf("%s: %s", s.Type, s.Detail))
+			}
+			m.Severity, m.Event = notify.Warning, "drift"
+			m.Subject, m.Body = fmt.Sprintf("pipeline %s: %d changes in %s", p.Name, rep.Changes, p.Root), notify.Lines(lines)
+		default:
+			continue
+		}
+		if err := n.Notify(sigCtx, m); err != nil {
+			fmt.Fprintf(os.Stderr, "octopus: %v\n", err)
+		}
+	}
+}
+
+// printRuns prints the reports of the runs in the provided format, and the errors, and returns the exit code.
+func printRuns(reports []*pipeline.Report, errs []error, format string) int {
+	if len(reports) == 1 && reports[0] == nil {
+		return fail(errs[0])
+	}
+
+	switch format {
+	case "table":
+		tw := newTable()
+		for _, rep := range reports {
+			if rep == nil {
+				continue
+			}
+			for _, s := range rep.Steps {
+				detail := s.Detail
+				if s.Error != "" {
+					detail = s.Error
+				}
+				if len(reports) > 1 {
+					fmt.Fprintf(tw, "%s\t", rep.Name)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Type, tr(string(s.Status)), detail)
+			}
+		}
+		if e := tw.Flush(); e != nil {
+			errs = append(errs, e)
+		}
+	case "json":
+		var v any = reports
+		if len(reports) == 1 {
+			v = reports[0]
+		}
+		if e := writeJSON(v); e != nil {
+			errs = append(errs, e)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", format))
+	}
+
+	code := exitOK
+	for _, e := range errs {
+		if e != nil {
+			code = fail(e)
+		}
+	}
+	if code != exitOK {
+		return code
+	}
+	for _, rep := range reports {
+		for _, a := range rep.Alerts {
+			fmt.Fprintf(os.Stderr, "octopus: ALERT %s\n", a)
+			code = exitAlert
+		}
+		if rep.Changes > 0 && code == exitOK {
+			code = exitChanges
+		}
+	}
+	return code
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/enrich"
+	"github.com/gromey/octopus/output"
+	"github.com/gromey/octopus/trace"
+)
+
+func runScan(args []string) int {
+	fs := newFlagSet("scan")
+
+	var sf scanFlags
+	sf.register(fs, "sha256")
+	format := fs.String("format", "table", "output format: table, json, ndjson, csv, gnu or bsd (checksum files)")
+	var columns list
+	fs.Var(&columns, "columns", "columns for json, ndjson and csv output, comma-separated")
+	summary := fs.Bool("summary", false, "print scan statistics instead of the files, as a table or json")
+	xattrs := fs.Bool("xattrs", false, "collect the extended attributes of the files")
+	contentType := fs.Bool("content-type", false, "detect the MIME type of the files from their content")
+	encrypted := fs.Bool("encrypted", false, "detect encrypted and password-protected files")
+	lines := fs.Bool("lines", false, "classify the files as text or binary and count the lines of text files")
+	sidecars := fs.Bool("sidecars", false, "write a checksum file named after each file with the extension of the -hash algorithm next to it, e.g. a.txt.sha256")
+	archives := fs.Bool("archives", false, "list the files stored in zip and tar archives too, as archive.zip!/path")
+	emptyDirs := fs.Bool("empty-dirs", false, "print the directories without any scanned file below them instead of the files, as a table or json")
+	hardlinks := fs.Bool("hardlinks", false, "print the groups of hard-linked files instead of the files, as a table or json")
+	compress := fs.String("compress", "none", "codec to compress the listed files with: "+strings.Join(codec.Names(), ", "))
+	top := fs.Int("top", 0, "print the n largest files and directories instead of the files, as a table or json")
+	sign := fs.String("sign", "", "sign gnu and bsd checksum files with the ed25519 private key in this PEM file")
+	var plugs list
+	fs.Var(&plugs, "plugin", "label the files with these plugins, comma-separated, see \"octopus plugins\"")
+	recordTrace := fs.String("record-trace", "", "record the directory listings, opens and reads of the scan to this trace file")
+	anonymize := fs.Bool("anonymize", false, "replace the names of the directories and files by digests in the trace of -record-trace")
+	replayTrace := fs.String("replay-trace", "", "scan the tree recorded in this trace file instead of the disk, the root being a path of the trace such as .")
+	replayDelay := fs.Bool("replay-delay", false, "make every operation of -replay-trace take the time recorded for it")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	c, err := codec.Lookup(*compress)
+	if err != nil {
+		return fail(err)
+	}
+
+	var key ed25519.PrivateKey
+	if *sign != "" {
+		if *format != "gnu" && *format != "bsd" {
+			return fail(errors.New("-sign requires -format gnu or bsd"))
+		}
+		if key, err = loadPrivateKey(*sign); err != nil {
+			return fail(err)
+		}
+	}
+
+	root := fs.Arg(0)
+	opts := []dirreader.Option{dirreader.WithXattrs(*xattrs), dirreader.WithContentType(*contentType), dirreader.WithLineCount(*lines), dirreader.WithEncryption(*encrypted), dirreader.WithArchives(*archives)}
+	if (*recordTrace != "" || *replayTrace != "") && *sidecars {
+		return fail(errors.New("-sidecars cannot be used with -record-trace or -replay-trace"))
+	}
+	var rec *trace.Recorder
+	switch {
+	case *recordTrace != "" && *replayTrace != "":
+		return fail(errors.New("-record-trace and -replay-trace cannot be used together"))
+	case *recordTrace != "":
+		f, err := os.Create(*recordTrace)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() { _ = f.Close() }()
+		rec = trace.NewRecorder(os.DirFS(root), f, *anonymize)
+		opts, root = append(opts, dirreader.WithFS(rec)), "."
+	case *replayTrace != "":
+		f, err := os.Open(*replayTrace)
+		if err != nil {
+			return fail(err)
+		}
+		rp, err := trace.Load(f, *replayDelay)
+		_ = f.Close()
+		if err != nil {
+			return fail(fmt.Errorf("read trace %s: %w", *replayTrace, err))
+		}
+		opts = append(opts, dirreader.WithFS(rp))
+	}
+
+	files, err := sf.scan(root, opts...)
+	if rec != nil && rec.Err() != nil {
+		err = errors.Join(err, fmt.Errorf("write trace %s: %w", *recordTrace, rec.Err()))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if *sidecars {
+		if sf.hash == "" || sf.hash == "none" {
+			return fail(errors.New("-sidecars requires a hash algorithm"))
+		}
+		if _, err = checksum.WriteSidecars(files, checksum.GNU, sf.hash); err != nil {
+			return fail(err)
+		}
+	}
+	if err = enrichWithPlugins(sigCtx, files, plugs); err != nil {
+		return fail(err)
+	}
+	if s, _ := sf.loadScript(); s != nil && s.HasAnnotate() {
+		if err = (&enrich.Script{Script: s}).Enrich(sigCtx, files); err != nil {
+			return fail(err)
+		}
+	}
+
+	if *summary {
+		if err = printStats(&sf.stats, *format); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *emptyDirs {
+		if err = printEmptyDirs(sf.stats.EmptyDirs, *format); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *hardlinks {
+		if err = printHardlinks(files, *format); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	if *top > 0 {
+		if err = printTop(files, *top, *format); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	out, err := c.NewWriter(os.Stdout)
+	if err != nil {
+		return fail(err)
+	}
+
+	switch *format {
+	case "table":
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, tr("PATH\tSIZE\tMODIFIED\tHASH"))
+		for _, fi := range files {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", fi.RelPath(), fi.Size(), fi.ModTime().Format(time.RFC3339), fi.Hash)
+		}
+		err = tw.Flush()
+	case "gnu", "bsd":
+		if sf.hash == "none" {
+			return fail(fmt.Errorf("-format %s requires a hash algorithm", *format))
+		}
+		style := checksum.GNU
+		if *format == "bsd" {
+			style = checksum.BSD
+		}
+		var b bytes.Buffer
+		if err = checksum.Write(&b, files, style, strings.ToUpper(sf.hash)); err == nil {
+			manifest := b.Bytes()
+			if key != nil {
+				manifest = checksum.Sign(manifest, key)
+			}
+			_, err = out.Write(manifest)
+		}
+	default:
+		cols := make([]output.Column, len(columns))
+		for i, c := range columns {
+			cols[i] = output.Column(c)
+		}
+		err = output.Write(out, output.Format(*format), cols, files)
+	}
+
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// printStats prints the scan statistics in the provided format.
+func printStats(st *dirreader.Stats, format string) error {
+	switch format {
+	case "table":
+		tw := newTable()
+		fmt.Fprintf(tw, tr("files\t%d\n"), st.Files)
+		fmt.Fprintf(tw, tr("directories\t%d\n"), st.Dirs)
+		fmt.Fprintf(tw, tr("empty directories\t%d\n"), len(st.EmptyDirs))
+		fmt.Fprintf(tw, tr("bytes\t%d\n"), st.Bytes)
+		fmt.Fprintf(tw, tr("hard links\t%d\n"), st.Hardlinks)
+		fmt.Fprintf(tw, tr("lines\t%d\n"), st.Lines)
+		fmt.Fprintf(tw, tr("deepest path\t%s (%d)\n"), st.DeepestPath, st.Depth)
+		fmt.Fprintf(tw, tr("elapsed\t%s\n"), st.Elapsed.Round(time.Millisecond))
+
+		exts := make([]string, 0, len(st.Extensions))
+		for ext := range st.Extensions {
+			exts = append(exts, ext)
+		}
+		sort.Slice(exts, func(i, j int) bool { return st.Extensions[exts[i]].Bytes > st.Extensions[exts[j]].Bytes })
+
+		fmt.Fprintln(tw, tr("\nEXTENSION\tFILES\tBYTES\tLINES"))
+		for _, ext := range exts {
+			name := ext
+			if name == "" {
+				name = tr("(none)")
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", name, st.Extensions[ext].Files, st.Extensions[ext].Bytes, st.Extensions[ext].Lines)
+		}
+
+		fmt.Fprintln(tw, tr("\nLARGEST\tBYTES\t"))
+		for _, fi := range st.Largest {
+			fmt.Fprintf(tw, "%s\t%d\t\n", fi.RelPath(), fi.Size())
+		}
+
+		fmt.Fprintln(tw, tr("\nMETADATA\tSUPPORT\t"))
+		c := st.Capabilities
+		for _, m := range []struct {
+			name    string
+			support dirreader.Support
+		}{
+			{"owner", c.Owner},
+			{"inode", c.Inode},
+			{"xattrs", c.Xattrs},
+			{"birth time", c.BirthTime},
+			{"ACLs", c.ACLs},
+			{"reflinks", c.Reflinks},
+		} {
+			fmt.Fprintf(tw, "%s\t%s\t\n", m.name, tr(string(m.support)))
+		}
+
+		return tw.Flush()
+	case "json":
+		return writeJSON(st)
+	default:
+		return fmt.Errorf("unknown summary format %q", format)
+	}
+}
+
+// printTop prints the n largest files and directories in the provided format.
+func printTop(files []dirreader.FileInfo, n int, format string) error {
+	largest, dirs := dirreader.LargestFiles(files, n), dirreader.LargestDirs(files, n)
+
+	switch format {
+	case "table":
+		tw := newTable()
+		fmt.Fprintln(tw, tr("FILE\tBYTES"))
+		for _, fi := range largest {
+			fmt.Fprintf(tw, "%s\t%d\n", fi.RelPath(), fi.Size())
+		}
+		fmt.Fprintln(tw, tr("\nDIRECTORY\tBYTES\tFILES"))
+		for _, d := range dirs {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", d.Path, d.Bytes, d.Files)
+		}
+		return tw.Flush()
+	case "json":
+		return writeJSON(struct {
+			Files []dirreader.FileInfo `json:"files"`
+			Dirs  []dirreader.DirSize  `json:"dirs"`
+		}{largest, dirs})
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// printEmptyDirs prints the empty directories of a scan in the provided format.
+func printEmptyDirs(dirs []dirreader.EmptyDir, format string) error {
+	switch format {
+	case "table":
+		tw := newTable()
+		fmt.Fprintln(tw, tr("DIRECTORY\tCONTENT"))
+		for _, d := range dirs {
+			content := tr("empty")
+			if d.Filtered {
+				content = tr("filtered files only")
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", d.Path, content)
+		}
+		return tw.Flush()
+	case "json":
+		if dirs == nil {
+			dirs = []dirreader.EmptyDir{}
+		}
+		return writeJSON(dirs)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// printHardlinks prints the groups of hard-linked files in the provided format.
+func printHardlinks(files []dirreader.FileInfo, format string) error {
+	groups := dirreader.Hardlinks(files)
+
+	switch format {
+	case "table":
+		tw := newTable()
+		fmt.Fprintln(tw, tr("INODE\tSIZE\tPATH"))
+		for _, g := range groups {
+			for _, fi := range g {
+				fmt.Fprintf(tw, "%d:%d\t%d\t%s\n", fi.Dev, fi.Ino, fi.Size(), fi.RelPath())
+			}
+		}
+		return tw.Flush()
+	case "json":
+		if groups == nil {
+			groups = [][]dirreader.FileInfo{}
+		}
+		return writeJSON(groups)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gromey/octopus/backends"
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/dirsync"
+	"github.com/gromey/octopus/hashes"
+)
+
+func runSync(args []string) int {
+	fs := newFlagSet("sync")
+
+	var sf scanFlags
+	sf.register(fs, "none")
+	format := fs.String("format", "table", "output format: table or json")
+	del := fs.Bool("delete", false, "delete files from the destination that do not exist in the source")
+	dryRun := fs.Bool("dry-run", false, "only print what would be done")
+	store := fs.String("store", "", "snapshot store whose holds are honored in the destination")
+	auditPath := fs.String("audit", "", "audit log recording the files created, modified or deleted in the destination")
+	verify := fs.Bool("verify", false, "hash the files while copying them and abandon those that changed since the source was scanned")
+	manifestPath := fs.String("manifest", "", "checksum file with the hashes the copied files must match, paths relative to the source")
+	delta := fs.Int64("delta", 0, "update the destination files of at least this many bytes with a block delta, writing only the changed blocks (0: copy whole files)")
+	transfers := fs.Int("transfers", 4, "number of files copied at once, hashed at once with S3 and SFTP trees, and of connections to SFTP servers")
+	bandwidth := fs.Int64("bandwidth-limit", 0, "copy at most this many bytes per second across all transfers, e.g. to leave room for other traffic")
+	transferLimit := fs.Int64("transfer-limit", 0, "copy at most this many bytes per second per transfer")
+	planPath := fs.String("plan", "", "write the copies and deletions to this plan file, for review before \"octopus apply\", rather than performing them")
+	trashDir := fs.String("trash", "", "with -delete, move the deleted files to this trash directory, or to the trash of the desktop with \"system\", rather than unlinking them")
+
+	if !parse(fs, args, 2) {
+		return exitError
+	}
+
+	h, err := hashes.Lookup(sf.hash)
+	if err != nil {
+		return fail(err)
+	}
+	remote := isRemote(fs.Arg(0)) || isRemote(fs.Arg(1))
+	if remote && (*store != "" || *auditPath != "" || *verify || *manifestPath != "" || *delta != 0 || *trashDir != "" || *planPath != "") {
+		return fail(errors.New("-store, -audit, -verify, -manifest, -delta, -trash and -plan cannot be used with S3 and SFTP trees"))
+	}
+	if *delta < 0 || *bandwidth < 0 || *transferLimit < 0 {
+		return fail(errors.New("-delta, -bandwidth-limit and -transfer-limit must not be negative"))
+	}
+	mask, include, err := sf.mask()
+	if err != nil {
+		return fail(err)
+	}
+	if sf.skipDenied && *del {
+		return fail(errors.New("-skip-denied cannot be used with -delete, the skipped files would be deleted from the destination"))
+	}
+	if *trashDir != "" && !*del {
+		return fail(errors.New("-trash requires -delete"))
+	}
+	if (*verify || *manifestPath != "") && h == nil {
+		return fail(errors.New("-verify and -manifest require a hash algorithm"))
+	}
+	manifest, err := loadManifest(*manifestPath)
+	if err != nil {
+		return fail(err)
+	}
+	scriptOpts, err := sf.scriptOptions()
+	if err != nil {
+		return fail(err)
+	}
+	if *planPath != "" {
+		plan, err := dirsync.Plan(fs.Arg(0), fs.Arg(1), dirsync.Options{
+			HashFunc: h,
+			Mask:     mask,
+			Include:  include,
+			Scan:     append(sf.options(), scriptOpts...),
+			Delete:   *del,
+			Context:  sigCtx,
+		})
+		if err == nil {
+			err = writePlan(plan, *planPath)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+	holds, err := loadHolds(*store)
+	if err != nil {
+		return fail(err)
+	}
+	auditLog, err := openAudit(*auditPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = auditLog.Close() }()
+	bin, err := openTrash(*trashDir, fs.Arg(1))
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = bin.Close() }()
+
+	var res *dirsync.Result
+	if remote {
+		res, err = syncTrees(fs.Arg(0), fs.Arg(1), backends.SyncOptions{
+			HashFunc:    h,
+			Algorithm:   sf.hash,
+			Delete:      *del,
+			DryRun:      *dryRun,
+			Concurrency: *transfers,
+
+			BandwidthLimit: *bandwidth,
+			TransferLimit:  *transferLimit,
+		})
+	} else {
+		res, err = dirsync.Sync(fs.Arg(0), fs.Arg(1), dirsync.Options{
+			HashFunc: h,
+			Mask:     mask,
+			Include:  include,
+			Scan:     append(sf.options(), scriptOpts...),
+			Delete:   *del,
+			DryRun:   *dryRun,
+			Holds:    holds,
+			Audit:    auditLog,
+			Context:  sigCtx,
+			Verify:   *verify,
+			Manifest: manifest,
+			Delta:    *delta,
+			Trash:    bin,
+
+			Concurrency:    *transfers,
+			BandwidthLimit: *bandwidth,
+			TransferLimit:  *transferLimit,
+		})
+	}
+	if res == nil {
+		return fail(err)
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, a := range res.Actions {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", a.Op, a.Path, a.Size)
+		}
+		fmt.Fprintf(tw, tr("copied %d files (%d bytes), deleted %d files\n"), res.Copied, res.Bytes, res.Deleted)
+		if res.Reused > 0 {
+			fmt.Fprintf(tw, tr("%d bytes left in place by block deltas\n"), res.Reused)
+		}
+		if e := tw.Flush(); e != nil && err == nil {
+			err = e
+		}
+	case "json":
+		if e := writeJSON(res); e != nil && err == nil {
+			err = e
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// loadManifest returns the hashes of the checksum file at path by path, or nil if path is empty.
+func loadManifest(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	entries, err := checksum.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		m[e.Path] = e.Hash
+	}
+	return m, nil
+}
+
+// syncTrees synchronizes two trees of which at least one is remote, see remoteTree.
+func syncTrees(src, dst string, opts backends.SyncOptions) (*dirsync.Result, error) {
+	trees := make([]backends.Tree, 2)
+	for i, root := range []string{src, dst} {
+		if !isRemote(root) {
+			trees[i] = &backends.Local{Dir: root}
+			continue
+		}
+		t, err := remoteTree(root, opts.Algorithm, opts.Concurrency)
+		if err != nil {
+			return nil, err
+		}
+		defer closeTree(t)
+		trees[i] = t
+	}
+	return backends.Sync(sigCtx, trees[0], trees[1], opts)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/trash"
+)
+
+func runTrash(args []string) int {
+	fs := newFlagSet("trash")
+
+	format := fs.String("format", "table", "output format: table or json")
+	undo := fs.Bool("undo", false, "restore the files trashed by the session of -session")
+	session := fs.String("session", "", "session to list or restore (default: all when listing, the last one with -undo)")
+	auditPath := fs.String("audit", "", "audit log recording the restored files")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	t, err := openTrash(fs.Arg(0), "")
+	if err != nil {
+		return fail(err)
+	}
+
+	var entries []trash.Entry
+	if *undo {
+		auditLog, err := openAudit(*auditPath)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() { _ = auditLog.Close() }()
+
+		entries, err = t.Undo(*session)
+		for _, e := range entries {
+			if e2 := auditLog.Record(audit.Move, e.Trashed, e.Path, "undo trash session "+e.Session); e2 != nil {
+				err = errors.Join(err, e2)
+				break
+			}
+		}
+		if len(entries) == 0 && err != nil {
+			return fail(err)
+		}
+	} else {
+		if entries, err = t.Entries(); err != nil {
+			return fail(err)
+		}
+		if *session != "" {
+			var kept []trash.Entry
+			for _, e := range entries {
+				if e.Session == *session {
+					kept = append(kept, e)
+				}
+			}
+			entries = kept
+		}
+	}
+
+	switch *format {
+	case "table":
+		tw := newTable()
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Session, e.Path, e.Trashed, e.Reason)
+		}
+		if *undo {
+			fmt.Fprintf(tw, tr("restored %d files\n"), len(entries))
+		} else {
+			fmt.Fprintf(tw, tr("%d files in %d sessions\n"), len(entries), len(trash.Sessions(entries)))
+		}
+		if e := tw.Flush(); e != nil && err == nil {
+			err = e
+		}
+	case "json":
+		if entries == nil {
+			entries = []trash.Entry{}
+		}
+		if e := writeJSON(entries); e != nil && err == nil {
+			err = e
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return exitOK
+}
+
+// openTrash returns a new session of the trash directory dir, or of the trash of the desktop if dir is "system",
+// or nil if dir is empty. The trash must not be inside root, if provided, whose files it receives.
+func openTrash(dir, root string) (*trash.Trash, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	var t *trash.Trash
+	var err error
+	if dir == "system" {
+		t, err = trash.System()
+	} else {
+		t, err = trash.Open(dir)
+	}
+	if err != nil || root == "" {
+		return t, err
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(abs, t.Dir()); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("trash %s is inside %s", t.Dir(), root)
+	}
+	return t, nil
+}
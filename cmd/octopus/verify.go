@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/notify"
+)
+
+func runVerify(args []string) int {
+	fs := newFlagSet("verify")
+
+	algorithm := fs.String("hash", "sha256", "hash algorithm the checksum file was produced with")
+	dir := fs.String("dir", "", "directory the paths are relative to (default: the checksum file's directory, or the current directory for a URL)")
+	format := fs.String("format", "table", "output format: table or json")
+	quiet := fs.Bool("quiet", false, "do not print OK lines")
+	pubkey := fs.String("pubkey", "", "require the checksum file to be signed with the ed25519 public key in this PEM file")
+	var af alertFlags
+	af.register(fs)
+	sidecars := fs.Bool("sidecars", false, "check the files of the directory given instead of a checksum file against their sidecar checksum files, e.g. a.txt.sha256")
+
+	if !parse(fs, args, 1) {
+		return exitError
+	}
+
+	h, err := hashes.Lookup(*algorithm)
+	if err != nil {
+		return fail(err)
+	}
+	if h == nil {
+		return fail(fmt.Errorf("verify requires a hash algorithm"))
+	}
+	rules, err := af.load()
+	if err != nil {
+		return fail(err)
+	}
+
+	var results []checksum.Result
+	if *sidecars {
+		if *pubkey != "" || *dir != "" {
+			return fail(errors.New("-pubkey and -dir cannot be used with -sidecars"))
+		}
+		if results, err = checksum.CheckSidecars(fs.Arg(0), *algorithm, h, dirreader.WithContext(sigCtx)); err != nil {
+			return fail(err)
+		}
+	} else if results, err = checkManifest(fs.Arg(0), *dir, *pubkey, h); err != nil {
+		return fail(err)
+	}
+
+	switch *format {
+	case "table":
+		for _, r := range results {
+			if *quiet && r.Status == checksum.OK {
+				continue
+			}
+			if r.Err != nil {
+				fmt.Printf("%s: %s (%v)\n", r.Path, r.Status, r.Err)
+				continue
+			}
+			fmt.Printf("%s: %s\n", r.Path, r.Status)
+		}
+	case "json":
+		type result struct {
+			Path   string          `json:"path"`
+			Status checksum.Status `json:"status"`
+			Error  string          `json:"error,omitempty"`
+		}
+		out := make([]result, len(results))
+		for i, r := range results {
+			out[i] = result{Path: r.Path, Status: r.Status}
+			if r.Err != nil {
+				out[i].Error = r.Err.Error()
+			}
+		}
+		if err = writeJSON(out); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("unknown output format %q", *format))
+	}
+
+	code := exitOK
+	summary := checksum.Summary(results)
+	if n := len(results) - summary[checksum.OK]; n > 0 {
+		fmt.Fprintf(os.Stderr, tr("octopus: WARNING: %d of %d files did not match\n"), n, len(results))
+		code = exitChanges
+		var lines []string
+		for _, r := range results {
+			if r.Status != checksum.OK {
+				lines = append(lines, fmt.Sprintf("%s: %s", r.Path, r.Status))
+			}
+		}
+		err = af.send(&notify.Message{
+			Severity: notify.Critical,
+			Event:    "corruption",
+			Root:     *dir,
+			Subject:  fmt.Sprintf("%d of %d files did not match %s", n, len(results), fs.Arg(0)),
+			Body:     notify.Lines(lines),
+		})
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	return af.check(rules, resultChanges(results), len(results), code)
+}
+
+// resultChanges returns the files that do not match as changes for the alert rules: modified if their hash
+// differs, removed if they are missing.
+func resultChanges(results []checksum.Result) []diff.Change {
+	var changes []diff.Change
+	for _, r := range results {
+		switch r.Status {
+		case checksum.Failed:
+			changes = append(changes, diff.Change{Op: diff.Modified, Path: filepath.FromSlash(r.Path)})
+		case checksum.Missing:
+			changes = append(changes, diff.Change{Op: diff.Removed, Path: filepath.FromSlash(r.Path)})
+		}
+	}
+	return changes
+}
+
+// checkManifest verifies the files listed in the checksum file at path against it, checking its signature first
+// if pubkey is set. The paths are relative to dir, by default the directory of the checksum file.
+// A checksum file at an HTTP or HTTPS URL is fetched, see fetchManifest, its paths relative to the current
+// directory by default.
+func checkManifest(path, dir, pubkey string, h func() hash.Hash) ([]checksum.Result, error) {
+	var manifest []byte
+	var err error
+	if isURL(path) {
+		manifest, err = fetchManifest(path, pubkey)
+	} else {
+		manifest, err = readManifest(path, pubkey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := checksum.Read(bytes.NewReader(manifest))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if dir == "" && isURL(path) {
+		dir = "."
+	} else if dir == "" {
+		dir = filepath.Dir(path)
+	}
+
+	return checksum.Check(entries, dir, h), nil
+}
+
+// readManifest reads the checksum file at path, checking its signature if pubkey is set, see checkSignature.
+func readManifest(path, pubkey string) ([]byte, error) {
+	manifest, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSignature(manifest, path, pubkey); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// checkSignature checks that the checksum file at path is signed with the ed25519 public key in the PEM file
+// pubkey, if set.
+func checkSignature(manifest []byte, path, pubkey string) error {
+	if pubkey == "" {
+		return nil
+	}
+	pub, err := loadPublicKey(pubkey)
+	if err != nil {
+		return err
+	}
+	if err = checksum.VerifySignature(manifest, pub); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+// Command octopusd serves scans, diffs and verifications of the directories of the machine it runs on over gRPC,
+// for other services and remote clients such as "octopus agent", and as JSON over HTTP with -http, for dashboards
+// and curl, see the daemon package.
+//
+// Usage:
+//
+//	octopusd -roots <dir>[,<dir>...] [flags]
+//
+// With -schedules, the daemon also scans directories on cron schedules, saving the scans to the snapshot store of
+// -store, and serves the changes found by their last runs. The webhooks of -webhooks are notified of the drift,
+// new files and corruption found by the scheduled runs and by the diffs and verifications of the clients, and the
+// notifiers of -notify are sent the drift and corruption, and the failed scheduled runs, by email, to Slack or Teams,
+// or to syslog.
+//
+// With -changelog, the changes found by the diffs and the scheduled runs are appended to a change log, see the
+// changelog package. When hosts running the daemon share storage, -jitter spreads their scheduled runs, and with
+// -token-server every run first acquires a concurrency token from the daemon serving them with -serve-tokens, so
+// that at most that many scans run against the storage at once.
+//
+// The scans fail once they reach the limits of -limits, see daemon.Limits.
+//
+// On SIGHUP, the daemon reloads the files of -schedules, -webhooks, -notify and -limits, without interrupting the scans
+// and runs in progress, which complete with the previous configuration; it keeps it if the files are not valid.
+//
+// Clients may only scan and verify the directories of -roots, and the directories below them. Calls are rejected
+// without the token of -token-file when it is set, and the connections are encrypted with -tls-cert and -tls-key.
+// Under systemd, the daemon uses the sockets passed with the file descriptor names "grpc" and "http", if any, and
+// reports its readiness, and pings its watchdog while the liveness checks pass; it logs to the journal when its
+// standard error is connected to it. With -http, /healthz and /readyz serve the liveness and readiness checks, see the
+// health package, without the token: the roots must be readable, and the snapshot store writable.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gromey/octopus/changelog"
+	"github.com/gromey/octopus/daemon"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/fleet"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/health"
+	"github.com/gromey/octopus/notify"
+	"github.com/gromey/octopus/shutdown"
+	"github.com/gromey/octopus/systemd"
+	"github.com/gromey/octopus/webhook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "octopusd:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("octopusd", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:7420", "address to serve the gRPC API on, none if empty")
+	httpAddr := fs.String("http", "", "address to serve the HTTP API on, e.g. localhost:7421, none if empty")
+	roots := fs.String("roots", "", "comma-separated directories clients may scan and verify (required)")
+	store := fs.String("store", "", "snapshot store scans are compared with when clients give no earlier scan, and schedules save their scans to")
+	schedulesPath := fs.String("schedules", "", "JSON file of the scans to run on cron schedules, see daemon.Schedule")
+	webhooksPath := fs.String("webhooks", "", "JSON file of the webhooks notified of drift, new files and corruption, see the webhook package")
+	limitsPath := fs.String("limits", "", "JSON file of the rate limit and the maximum number of files, bytes and errors of the scans, see daemon.Limits")
+	notifyPath := fs.String("notify", "", "JSON file of the email, Slack, Teams and syslog notifiers sent drift, corruption and failed scheduled scans, see the notify package")
+	changelogPath := fs.String("changelog", "", "change log the changes found by the diffs and the scheduled runs are appended to, see the changelog package")
+	jitter := fs.Duration("jitter", 0, "maximum random delay of the scheduled runs, to spread those of the hosts sharing storage")
+	tokenServer := fs.String("token-server", "", "URL of the daemon serving the concurrency tokens the scheduled runs acquire, e.g. http://host:7421/fleet")
+	serveTokens := fs.Int("serve-tokens", 0, "number of concurrency tokens served to the fleet under /fleet of -http, none if 0")
+	tokenTTL := fs.Duration("token-ttl", time.Minute, "time after which the tokens served expire unless renewed")
+	hash := fs.String("hash", "", "hash algorithm of the scans that do not set one, "+hashes.Default+" by default")
+	tokenFile := fs.String("token-file", "", "file holding the bearer token clients must send")
+	tlsCert := fs.String("tls-cert", "", "certificate of the server, to encrypt the connections")
+	tlsKey := fs.String("tls-key", "", "private key of the certificate")
+	logLevel := fs.String("log-level", "info", "log level: debug, info, warn or error")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *roots == "" {
+		return errors.New("-roots is required")
+	}
+	if *listen == "" && *httpAddr == "" {
+		return errors.New("-listen or -http is required")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return errors.New("-tls-cert and -tls-key must be used together")
+	}
+	if *serveTokens > 0 && *httpAddr == "" {
+		return errors.New("-serve-tokens requires -http")
+	}
+
+	logger, err := newLogger(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	load := func() (daemon.Config, error) {
+		cfg, err := loadConfig(*schedulesPath, *webhooksPath, *notifyPath, *limitsPath)
+		cfg.Options = []dirreader.Option{dirreader.WithLogger(logger)}
+		return cfg, err
+	}
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	cfg.Roots = strings.Split(*roots, ",")
+	cfg.Store, cfg.Hash = *store, *hash
+	cfg.Jitter, cfg.Logger = *jitter, logger
+	if *tokenServer != "" {
+		host, _ := os.Hostname()
+		cfg.Tokens = &fleet.Client{URL: strings.TrimSuffix(*tokenServer, "/"), Holder: host}
+	}
+	if *changelogPath != "" {
+		if cfg.Changelog, err = changelog.Open(*changelogPath); err != nil {
+			return err
+		}
+		defer func() { _ = cfg.Changelog.Close() }()
+	}
+	srv, err := daemon.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	var token string
+	if *tokenFile != "" {
+		b, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			return err
+		}
+		if token = strings.TrimSpace(string(b)); token == "" {
+			return fmt.Errorf("token file %s is empty", *tokenFile)
+		}
+	}
+	var cert tls.Certificate
+	if *tlsCert != "" {
+		if cert, err = tls.LoadX509KeyPair(*tlsCert, *tlsKey); err != nil {
+			return err
+		}
+	}
+
+	checker := health.New(5 * time.Second)
+	checker.AddReadiness("roots", health.Accessible(cfg.Roots...))
+	if *store != "" {
+		checker.AddReadiness("store", health.Writable(*store))
+	}
+
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return err
+	}
+	var gs *grpc.Server
+	var hs *http.Server
+	errc := make(chan error, 2)
+
+	if *listen != "" {
+		l, err := systemd.Listen(activated, "grpc", "tcp", *listen)
+		if err != nil {
+			return err
+		}
+		var opts []grpc.ServerOption
+		if token != "" {
+			opts = append(opts, daemon.TokenAuth(token)...)
+		}
+		if *tlsCert != "" {
+			opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+		}
+		gs = grpc.NewServer(opts...)
+		srv.Register(gs)
+		logger.Info("serving gRPC", "address", l.Addr().String(), "roots", *roots)
+		go func() { errc <- gs.Serve(l) }()
+	}
+
+	if *httpAddr != "" {
+		l, err := systemd.Listen(activated, "http", "tcp", *httpAddr)
+		if err != nil {
+			return err
+		}
+		h := srv.Handler()
+		if token != "" {
+			h = daemon.RequireToken(token, h)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/", h)
+		mux.Handle("/healthz", checker.Handler())
+		mux.Handle("/readyz", checker.Handler())
+		if *serveTokens > 0 {
+			mux.Handle("/fleet/", http.StripPrefix("/fleet", fleet.NewTokenServer(*serveTokens, *tokenTTL)))
+		}
+		hs = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		if *tlsCert != "" {
+			l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+		}
+		logger.Info("serving HTTP", "address", l.Addr().String(), "roots", *roots)
+		go func() {
+			if err := hs.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
+			}
+		}()
+	}
+
+	ctx, stop := shutdown.Notify(context.Background())
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	_ = systemd.Ready()
+	go func() {
+		alive := func() bool { return checker.Live(ctx).OK }
+		if err := systemd.RunWatchdog(ctx, alive); err != nil {
+			logger.Warn("watchdog stopped", "error", err)
+		}
+	}()
+
+wait:
+	for {
+		select {
+		case err = <-errc:
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-hup:
+			_ = systemd.Reloading()
+			reload(srv, load, logger)
+			_ = systemd.Ready()
+		}
+	}
+	_ = systemd.Stopping()
+	logger.Info("stopping")
+	srv.Close()
+	if gs != nil {
+		gs.GracefulStop()
+	}
+	if hs != nil {
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(sctx)
+	}
+	return err
+}
+
+// loadConfig returns the configuration of the schedules, the webhooks, the notifiers and the limits in the files, if
+// not empty.
+func loadConfig(schedulesPath, webhooksPath, notifyPath, limitsPath string) (daemon.Config, error) {
+	var cfg daemon.Config
+	var err error
+	if schedulesPath != "" {
+		if cfg.Schedules, err = daemon.LoadSchedules(schedulesPath); err != nil {
+			return cfg, err
+		}
+	}
+	if webhooksPath != "" {
+		if cfg.Webhooks, err = webhook.Load(webhooksPath); err != nil {
+			return cfg, err
+		}
+	}
+	if notifyPath != "" {
+		if cfg.Notifier, err = notify.Load(notifyPath); err != nil {
+			return cfg, err
+		}
+	}
+	if limitsPath != "" {
+		if cfg.Limits, err = daemon.LoadLimits(limitsPath); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// reload reloads the schedules, the webhooks, the notifiers and the limits of the server on SIGHUP, keeping the
+// previous ones if the files are not valid.
+func reload(srv *daemon.Server, load func() (daemon.Config, error), logger *slog.Logger) {
+	cfg, err := load()
+	if err == nil {
+		err = srv.Reload(cfg)
+	}
+	if err != nil {
+		logger.Error("reload failed, keeping the previous configuration", "error", err)
+		return
+	}
+	logger.Info("reloaded", "schedules", len(cfg.Schedules), "webhooks", len(cfg.Webhooks))
+}
+
+// newLogger returns a logger at the level, writing to the journal when the standard error is connected to it.
+func newLogger(level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	if systemd.JournalEnabled() {
+		if h, err := systemd.NewJournalHandler("OCTOPUS_", opts); err == nil {
+			return slog.New(h), nil
+		}
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+}
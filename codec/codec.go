@@ -0,0 +1,180 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec is a compression format used by the writers of manifests, NDJSON output, bundles and published objects.
+type Codec interface {
+	// Name returns the name the codec is selected by, e.g. "gzip".
+	Name() string
+	// Ext returns the file extension of compressed files, e.g. ".gz", or "" if the codec does not compress.
+	Ext() string
+	// Magic returns the bytes compressed streams start with, used by Detect, or nil if there are none.
+	Magic() []byte
+	// NewWriter returns a writer compressing to w. Close must be called to flush the compressed stream;
+	// it does not close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Built-in codecs.
+var (
+	None Codec = noneCodec{} // No compression.
+	Gzip Codec = gzipCodec{} // Gzip, readable by every tool.
+	Zstd Codec = zstdCodec{} // Zstandard, faster and smaller than gzip.
+	LZ4  Codec = lz4Codec{}  // LZ4 frames, the fastest with a lower ratio.
+)
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Codec{}
+)
+
+func init() {
+	for _, c := range []Codec{None, Gzip, Zstd, LZ4} {
+		Register(c)
+	}
+}
+
+// Register makes the codec selectable by its name, replacing any codec registered with the same name.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// Lookup returns the codec registered with the name, case-insensitively. An empty name selects None.
+func Lookup(name string) (Codec, error) {
+	if name == "" {
+		return None, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if c, ok := codecs[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("unknown codec %q, supported: %s", name, strings.Join(names(), ", "))
+}
+
+// Names returns the names of the registered codecs, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(codecs))
+	for n := range codecs {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Detect returns the codec of the stream from its first bytes, or None if no registered codec matches.
+// The bytes are peeked, so br still returns the whole stream.
+func Detect(br *bufio.Reader) Codec {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, c := range codecs {
+		magic := c.Magic()
+		if len(magic) == 0 {
+			continue
+		}
+		if head, _ := br.Peek(len(magic)); bytes.Equal(head, magic) {
+			return c
+		}
+	}
+
+	return None
+}
+
+// NewDetectingReader returns a reader decompressing r with the codec detected from its first bytes,
+// so that compressed and uncompressed input are both accepted.
+func NewDetectingReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	return Detect(br).NewReader(br)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string  { return "none" }
+func (noneCodec) Ext() string   { return "" }
+func (noneCodec) Magic() []byte { return nil }
+
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string  { return "gzip" }
+func (gzipCodec) Ext() string   { return ".gz" }
+func (gzipCodec) Magic() []byte { return []byte{0x1f, 0x8b} }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string  { return "zstd" }
+func (zstdCodec) Ext() string   { return ".zst" }
+func (zstdCodec) Magic() []byte { return []byte{0x28, 0xb5, 0x2f, 0xfd} }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string  { return "lz4" }
+func (lz4Codec) Ext() string   { return ".lz4" }
+func (lz4Codec) Magic() []byte { return []byte{0x04, 0x22, 0x4d, 0x18} }
+
+func (lz4Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return lz4.NewWriter(w), nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// nopWriteCloser is a writer whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,212 @@
+// Package cron parses cron expressions and computes the times they match, to schedule scans and verifications
+// without an external cron.
+//
+// An expression has five fields separated by spaces: minute (0-59), hour (0-23), day of the month (1-31),
+// month (1-12 or jan-dec) and day of the week (0-7 or sun-sat, 0 and 7 being Sunday). A field is "*",
+// a value, a range "a-b", a step "*/n" or "a-b/n", or a comma-separated list of them. As with the standard cron,
+// when both the day of the month and the day of the week are restricted, a day matching either one matches.
+// The macros @yearly (or @annually), @monthly, @weekly, @daily (or @midnight) and @hourly are also accepted.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule represents a parsed cron expression.
+type Schedule struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64 // Bit sets of the matching values.
+	anyDom, anyDow                bool   // Whether the day of the month and of the week are "*".
+}
+
+// field describes the range and names of a field.
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names of the values from min, if any.
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of the month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of the week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q: expected 5 fields, got %d", expr, len(parts))
+	}
+
+	var sets [5]uint64
+	for i, p := range parts {
+		set, err := parseField(p, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s: %w", expr, fields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	s := &Schedule{
+		expr:   expr,
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDom: parts[2] == "*" || parts[2] == "?",
+		anyDow: parts[4] == "*" || parts[4] == "?",
+	}
+	// Reject the expressions matching no date, e.g. only February 30, from a leap year on.
+	if _, err := s.next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+	}
+	return s, nil
+}
+
+// parseField returns the bit set of the values of a field.
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+			if f.name == "day of the week" {
+				hi = 6
+			}
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = value(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = value(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			var err error
+			if lo, err = value(rng, f); err != nil {
+				return 0, err
+			}
+			if hasStep {
+				hi = f.max
+			} else {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += n {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// value parses a value of a field, a number or a name.
+func value(s string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// errNever is returned for expressions matching no date, e.g. "0 0 30 2 *".
+var errNever = errors.New("the expression matches no date")
+
+// Next returns the first time matching the schedule strictly after t, in the location of t, or the zero time if
+// there is none in the next five years, which only happens for February 29 in the rare spans without leap years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	next, err := s.next(t)
+	if err != nil {
+		return time.Time{}
+	}
+	return next
+}
+
+// next returns the first time matching the schedule strictly after t.
+func (s *Schedule) next(t time.Time) (time.Time, error) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, errNever
+}
+
+// matchDay reports whether the day of t matches the day of the month and the day of the week of the schedule.
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dow
+	case s.anyDow:
+		return dom
+	}
+	return dom || dow
+}
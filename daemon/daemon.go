@@ -0,0 +1,849 @@
+// Package daemon implements octopusd, a server scanning the directories of the machine it runs on for other services
+// and remote clients, over a gRPC API, see Server.Register and Client:
+//
+//	StartScan    start a scan of a directory, returning its job
+//	GetResults   stream the files of a scan, once it finished
+//	Diff         compare a scan with an earlier one, or with the latest snapshot of its root
+//	Verify       check the files of a directory against a checksum file
+//	WatchEvents  stream the events of the server: scans started, finished and failed, drift and failed verifications
+//	LatestDrift  last run of a schedule, see Schedule, with the changes it found
+//
+// Clients may only scan and verify the directories the server is configured with, and the directories below them.
+// The messages are encoded in JSON, with the gRPC content subtype "json", rather than with protocol buffers, so that
+// they are the types of this package and of the packages it returns the results of, e.g. dirreader.FileInfo.
+//
+// The same scans, diffs and verifications are served as JSON over plain HTTP by Server.Handler, with paginated lists.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/changelog"
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/fleet"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/notify"
+	"github.com/gromey/octopus/snapshot"
+	"github.com/gromey/octopus/webhook"
+)
+
+// ErrNotFound is returned for scans the server does not know, or no longer keeps.
+var ErrNotFound = errors.New("no such scan")
+
+// ErrNotServed is returned for directories outside the roots of the server.
+var ErrNotServed = errors.New("directory is not served")
+
+// ErrOutsideRoot is the error of the entries of a checksum file naming files outside the directory verified.
+var ErrOutsideRoot = errors.New("file is outside the verified directory")
+
+// ErrFailed is returned for the results of scans that failed.
+var ErrFailed = errors.New("scan failed")
+
+// ErrRunning is returned by the HTTP API for the results of scans that did not finish yet.
+var ErrRunning = errors.New("scan is running")
+
+// ErrInvalid is returned for requests that are not valid, e.g. naming an unknown hash algorithm.
+var ErrInvalid = errors.New("invalid request")
+
+// defaultMaxJobs is the number of finished scans kept by default.
+const defaultMaxJobs = 100
+
+// resultsBatch is the number of files per message of GetResults.
+const resultsBatch = 500
+
+// Config configures a Server.
+type Config struct {
+	Roots   []string           // Directories clients may scan and verify, with the directories below them.
+	Store   string             // Snapshot store Diff compares scans with when no earlier scan is given (optional).
+	Hash    string             // Hash algorithm of the scans and verifications that do not set one, hashes.Default if empty.
+	Options []dirreader.Option // Options of every scan, e.g. dirreader.WithLogger.
+	MaxJobs int                // Number of finished scans, and of verifications, kept for the clients, 100 if not positive.
+	Limits  Limits             // Limits of every scan.
+
+	Schedules []Schedule      // Scans run by the server on its own, which require a snapshot store.
+	Jitter    time.Duration   // Maximum random delay of the scheduled runs, spreading those of the hosts sharing storage.
+	Tokens    *fleet.Client   // Token server the scheduled runs acquire a concurrency token from before scanning (optional).
+	Webhooks  []webhook.Hook  // Endpoints notified of the drift, new files and corruption found by Diff and Verify.
+	Notifier  notify.Notifier // Sends the drift and corruption, and the failed scheduled runs, to humans (optional).
+	Changelog *changelog.Log  // Log the changes found by Diff and the schedules are appended to (optional).
+	Logger    *slog.Logger    // Logger of the failed webhook deliveries, notifications and change log appends (optional).
+}
+
+// State represents the progress of a scan.
+type State string
+
+const (
+	Running State = "running" // The scan is in progress.
+	Done    State = "done"    // The scan completed, its files are available.
+	Failed  State = "failed"  // The scan failed, see Job.Error.
+)
+
+// Job represents a scan started by a client.
+type Job struct {
+	ID       string    `json:"id"`
+	Root     string    `json:"root"`            // Absolute path of the scanned directory.
+	Hash     string    `json:"hash"`            // Hash algorithm of the scan, "none" if the files are not hashed.
+	State    State     `json:"state"`           // Progress of the scan.
+	Started  time.Time `json:"started"`         // Time the scan started.
+	Finished time.Time `json:"finished"`        // Time the scan finished, zero while it is running.
+	Files    int       `json:"files"`           // Number of files found by the finished scan.
+	Error    string    `json:"error,omitempty"` // Failure of the scan.
+}
+
+// ScanRequest is the request of StartScan.
+type ScanRequest struct {
+	Root       string   `json:"root"`                 // Directory to scan, absolute or relative to a root of the server.
+	Hash       string   `json:"hash,omitempty"`       // Hash algorithm, see hashes.Lookup, the one of the server if empty.
+	Include    []string `json:"include,omitempty"`    // Only scan the files with these extensions.
+	Exclude    []string `json:"exclude,omitempty"`    // Do not scan the files with these extensions.
+	SkipHidden bool     `json:"skipHidden,omitempty"` // Skip hidden files and directories.
+}
+
+// ResultsRequest is the request of GetResults.
+type ResultsRequest struct {
+	ID string `json:"id"` // ID of the scan.
+}
+
+// Results is a message of the stream of GetResults, holding up to 500 files of the scan, sorted by path.
+type Results struct {
+	Files []dirreader.FileInfo `json:"files"`
+}
+
+// DiffRequest is the request of Diff.
+type DiffRequest struct {
+	ID   string `json:"id"`             // ID of the scan.
+	Base string `json:"base,omitempty"` // ID of an earlier scan to compare with, the latest snapshot of the root with the same filters if empty.
+}
+
+// DiffResponse is the response of Diff.
+type DiffResponse struct {
+	Base    string        `json:"base"`    // ID of the scan or snapshot compared with, empty if the store has none.
+	Changes []diff.Change `json:"changes"` // Changes since the base, sorted by path.
+}
+
+// VerifyRequest is the request of Verify.
+type VerifyRequest struct {
+	Root     string `json:"root"`           // Directory the paths of the checksum file are relative to.
+	Hash     string `json:"hash,omitempty"` // Hash algorithm of the checksum file, the one of the server if empty.
+	Manifest string `json:"manifest"`       // Content of the checksum file, in the GNU or BSD style, see checksum.Read.
+}
+
+// VerifyResult represents the outcome of checking a file.
+type VerifyResult struct {
+	Path   string          `json:"path"`            // Slash-separated path of the file.
+	Status checksum.Status `json:"status"`          // Outcome of the check.
+	Error  string          `json:"error,omitempty"` // Problem encountered when the status is MISSING or ERROR.
+}
+
+// VerifyResponse is the response of Verify.
+type VerifyResponse struct {
+	ID      string                  `json:"id"`                // ID of the verification.
+	Root    string                  `json:"root"`              // Absolute path of the verified directory.
+	Time    time.Time               `json:"time"`              // Time the verification finished.
+	Results []VerifyResult          `json:"results,omitempty"` // Outcome of every entry of the checksum file, in order.
+	Summary map[checksum.Status]int `json:"summary"`           // Number of entries by status.
+}
+
+// EventsRequest is the request of WatchEvents.
+type EventsRequest struct{}
+
+// EventType represents the kind of an event.
+type EventType string
+
+const (
+	ScanStarted  EventType = "scan-started"  // A client started a scan.
+	ScanFinished EventType = "scan-finished" // A scan completed.
+	ScanFailed   EventType = "scan-failed"   // A scan failed.
+	Drift        EventType = "drift"         // Diff found changes.
+	VerifyFailed EventType = "verify-failed" // Verify found files that are missing or do not match.
+)
+
+// Event represents something that happened on the server, streamed by WatchEvents.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   EventType `json:"type"`
+	Job    string    `json:"job,omitempty"`    // ID of the scan, if any.
+	Root   string    `json:"root"`             // Directory of the scan or verification.
+	Detail string    `json:"detail,omitempty"` // Summary, e.g. "12 changes".
+}
+
+// Server runs the scans of the clients. It is safe for concurrent use.
+type Server struct {
+	cfg    Config
+	roots  []string // Absolute paths of the roots, with symbolic links resolved.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	seq  int
+	jobs map[string]*job
+	done []string // IDs of the finished jobs, oldest first.
+	subs map[chan Event]bool
+
+	verifications map[string]*VerifyResponse
+	verified      []string                // IDs of the verifications, oldest first.
+	drift         map[string]*DriftReport // Last runs of the schedules by name.
+	stopSchedules context.CancelFunc      // Stops waiting for the next runs of the schedules.
+	opts          []dirreader.Option      // Options of every scan, with the limits.
+	hooks         *webhook.Dispatcher     // Nil without webhooks.
+	notifier      notify.Notifier         // Nil without notifier.
+}
+
+// job is the state of a scan.
+type job struct {
+	Job
+	files    []dirreader.FileInfo
+	filters  snapshot.Filters        // Files of the root the scan reads.
+	finished chan struct{}           // Closed when the scan finished.
+	diffs    map[diffKey]*cachedDiff // Comparisons with its bases, see compared.
+}
+
+// diffKey identifies the comparison of a scan with a base: the base scan of the request, and the tag of the snapshots
+// it may be compared with otherwise.
+type diffKey struct {
+	base, tag string
+}
+
+// cachedDiff is a comparison of a scan with a base, computed once.
+type cachedDiff struct {
+	ready chan struct{} // Closed once the comparison is computed.
+	res   *comparison
+	err   error
+}
+
+// New returns a server scanning the roots of the configuration, and starts running its schedules.
+func New(cfg Config) (*Server, error) {
+	if len(cfg.Roots) == 0 {
+		return nil, errors.New("no roots")
+	}
+	if _, err := hashes.Lookup(cfg.Hash); err != nil {
+		return nil, err
+	}
+	if cfg.MaxJobs <= 0 {
+		cfg.MaxJobs = defaultMaxJobs
+	}
+	if err := cfg.Limits.validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.Schedules = append([]Schedule(nil), cfg.Schedules...)
+	s := &Server{
+		cfg:           cfg,
+		jobs:          make(map[string]*job),
+		subs:          make(map[chan Event]bool),
+		verifications: make(map[string]*VerifyResponse),
+		notifier:      cfg.Notifier,
+		opts:          scanOptions(cfg.Options, cfg.Limits),
+	}
+	for _, root := range cfg.Roots {
+		abs, err := resolve(root)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %w", root, err)
+		}
+		s.roots = append(s.roots, abs)
+	}
+	var err error
+	if s.drift, err = s.initSchedules(s.cfg.Schedules); err != nil {
+		return nil, err
+	}
+	if s.hooks, err = dispatcher(cfg.Webhooks, cfg.Logger); err != nil {
+		return nil, err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.startSchedules(s.cfg.Schedules)
+	return s, nil
+}
+
+// Reload replaces the schedules, the webhooks, the notifier, the options and limits of the scans, and the number of
+// jobs kept of the server with those of the configuration, whose other fields are ignored. The scans started after
+// it, including those of the runs of the schedules, use the new options and limits; the scans, runs and
+// notifications in progress complete with the previous ones, but the runs of the schedules removed are not
+// recorded. The server is left unchanged if the configuration is not valid.
+func (s *Server) Reload(cfg Config) error {
+	if err := cfg.Limits.validate(); err != nil {
+		return err
+	}
+	if cfg.MaxJobs <= 0 {
+		cfg.MaxJobs = defaultMaxJobs
+	}
+	schedules := append([]Schedule(nil), cfg.Schedules...)
+	drift, err := s.initSchedules(schedules)
+	if err != nil {
+		return err
+	}
+	hooks, err := dispatcher(cfg.Webhooks, s.cfg.Logger)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopSchedules()
+	// The schedules kept keep their last run, which the snapshots do not fully record.
+	for name, rep := range drift {
+		if last := s.drift[name]; last != nil && last.Root == rep.Root {
+			kept := *last
+			kept.Cron = rep.Cron
+			drift[name] = &kept
+		}
+	}
+	s.cfg.Schedules, s.drift, s.hooks, s.notifier = schedules, drift, hooks, cfg.Notifier
+	s.cfg.Options, s.cfg.Limits, s.cfg.MaxJobs = cfg.Options, cfg.Limits, cfg.MaxJobs
+	s.opts = scanOptions(cfg.Options, cfg.Limits)
+	s.startSchedules(schedules)
+	return nil
+}
+
+// dispatcher returns the dispatcher of the webhooks, nil without webhooks.
+func dispatcher(webhooks []webhook.Hook, logger *slog.Logger) (*webhook.Dispatcher, error) {
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	hooks := append([]webhook.Hook(nil), webhooks...)
+	if err := webhook.Validate(hooks); err != nil {
+		return nil, err
+	}
+	return &webhook.Dispatcher{Hooks: hooks, Logger: logger}, nil
+}
+
+// Close stops the running scans and the schedules.
+func (s *Server) Close() {
+	s.cancel()
+}
+
+// StartScan starts a scan of the directory of the request, and returns its job.
+func (s *Server) StartScan(_ context.Context, req *ScanRequest) (*Job, error) {
+	root, err := s.served(req.Root)
+	if err != nil {
+		return nil, err
+	}
+	name := s.hashName(req.Hash)
+	h, err := hashes.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(req.Include) > 0 && len(req.Exclude) > 0 {
+		return nil, fmt.Errorf("%w: include and exclude cannot be used together", ErrInvalid)
+	}
+	mask, include := req.Exclude, false
+	if len(req.Include) > 0 {
+		mask, include = req.Include, true
+	}
+
+	s.mu.Lock()
+	opts := append(s.opts[:len(s.opts):len(s.opts)], dirreader.WithSkipHidden(req.SkipHidden), dirreader.WithContext(s.ctx))
+	s.seq++
+	j := &job{Job: Job{ID: strconv.Itoa(s.seq), Root: root, Hash: strings.ToLower(name), State: Running, Started: time.Now().UTC()}, finished: make(chan struct{})}
+	if h == nil {
+		j.Hash = "none"
+	}
+	j.filters = snapshot.Filters{Include: req.Include, Exclude: req.Exclude, SkipHidden: req.SkipHidden}
+	s.jobs[j.ID] = j
+	s.mu.Unlock()
+	s.publish(Event{Type: ScanStarted, Job: j.ID, Root: root})
+
+	go func() {
+		files, err := dirreader.Exec(root, h, mask, include, opts...)
+		sort.Slice(files, func(i, k int) bool { return files[i].RelPath() < files[k].RelPath() })
+
+		s.mu.Lock()
+		j.Finished = time.Now().UTC()
+		if err != nil {
+			j.State, j.Error = Failed, dirreader.Summarize(err).Error()
+		} else {
+			j.State, j.files, j.Files = Done, files, len(files)
+		}
+		s.done = append(s.done, j.ID)
+		for len(s.done) > s.cfg.MaxJobs {
+			delete(s.jobs, s.done[0])
+			s.done = s.done[1:]
+		}
+		e := Event{Type: ScanFinished, Job: j.ID, Root: root, Detail: fmt.Sprintf("%d files", j.Files)}
+		if err != nil {
+			e.Type, e.Detail = ScanFailed, j.Error
+		}
+		close(j.finished)
+		s.mu.Unlock()
+		s.publish(e)
+	}()
+
+	return s.Job(j.ID)
+}
+
+// Job returns the job of the scan with the ID.
+func (s *Server) Job(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	if j == nil {
+		return nil, fmt.Errorf("scan %s: %w", id, ErrNotFound)
+	}
+	job := j.Job
+	return &job, nil
+}
+
+// Results waits for the scan with the ID to finish, and calls fn with its files, by batches of up to 500.
+func (s *Server) Results(ctx context.Context, id string, fn func(*Results) error) error {
+	files, err := s.wait(ctx, id)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(files); i += resultsBatch {
+		end := i + resultsBatch
+		if end > len(files) {
+			end = len(files)
+		}
+		if err = fn(&Results{Files: files[i:end]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait waits for the scan with the ID to finish, and returns its files.
+func (s *Server) wait(ctx context.Context, id string) ([]dirreader.FileInfo, error) {
+	s.mu.Lock()
+	j := s.jobs[id]
+	s.mu.Unlock()
+	if j == nil {
+		return nil, fmt.Errorf("scan %s: %w", id, ErrNotFound)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-j.finished:
+	}
+	if j.State == Failed {
+		return nil, fmt.Errorf("scan %s: %w: %s", id, ErrFailed, j.Error)
+	}
+	return j.files, nil
+}
+
+// Diff waits for the scan of the request to finish, and compares it with its base. The comparison is computed, and
+// its drift published, once per scan and base: the following calls return the same changes.
+func (s *Server) Diff(ctx context.Context, req *DiffRequest) (*DiffResponse, error) {
+	return s.diff(ctx, req, "")
+}
+
+// diff is Diff, with the snapshots it may compare with restricted to those carrying the tag if not empty.
+func (s *Server) diff(ctx context.Context, req *DiffRequest, tag string) (*DiffResponse, error) {
+	res, fresh, err := s.compared(ctx, req, tag)
+	if err != nil {
+		return nil, err
+	}
+	if fresh && len(res.Changes) > 0 {
+		s.record(res.root, res.Changes)
+		s.publish(Event{Type: Drift, Job: req.ID, Root: res.root, Detail: fmt.Sprintf("%d changes since %s", len(res.Changes), res.Base)})
+		s.notify(webhook.FromDiff(res.root, req.ID, res.Base, res.Changes)...)
+	}
+	d := res.DiffResponse
+	return &d, nil
+}
+
+// compared returns the comparison of the scan of the request with its base, see compare, computing it once per scan,
+// base and tag. It reports whether this call computed it.
+func (s *Server) compared(ctx context.Context, req *DiffRequest, tag string) (*comparison, bool, error) {
+	// The scans are waited for first, so that the comparison does not depend on the context of the caller.
+	if _, err := s.wait(ctx, req.ID); err != nil {
+		return nil, false, err
+	}
+	if req.Base != "" {
+		if _, err := s.wait(ctx, req.Base); err != nil {
+			return nil, false, err
+		}
+	}
+
+	key := diffKey{base: req.Base, tag: tag}
+	s.mu.Lock()
+	j := s.jobs[req.ID]
+	if j == nil {
+		s.mu.Unlock()
+		return nil, false, fmt.Errorf("scan %s: %w", req.ID, ErrNotFound)
+	}
+	c := j.diffs[key]
+	fresh := c == nil
+	if fresh {
+		c = &cachedDiff{ready: make(chan struct{})}
+		if j.diffs == nil {
+			j.diffs = make(map[diffKey]*cachedDiff)
+		}
+		j.diffs[key] = c
+	}
+	s.mu.Unlock()
+
+	if !fresh {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-c.ready:
+		}
+		return c.res, false, c.err
+	}
+
+	c.res, c.err = s.compare(ctx, req, tag)
+	if c.err != nil {
+		// A failed comparison, e.g. of a snapshot store that cannot be read, is computed again by the next call.
+		s.mu.Lock()
+		delete(j.diffs, key)
+		s.mu.Unlock()
+	}
+	close(c.ready)
+	return c.res, c.err == nil, c.err
+}
+
+// comparison is the outcome of compare.
+type comparison struct {
+	DiffResponse
+	root string
+}
+
+// compare waits for the scan of the request to finish, and compares it with its base, without publishing the drift.
+// Without a base scan, the base is the latest snapshot of the root taken with the same filters as the scan, and
+// carrying the tag if not empty; the hashes are left out of the comparison when the scan and its base were hashed
+// with different algorithms.
+func (s *Server) compare(ctx context.Context, req *DiffRequest, tag string) (*comparison, error) {
+	files, err := s.wait(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	j := s.jobs[req.ID]
+	s.mu.Unlock()
+	if j == nil {
+		return nil, fmt.Errorf("scan %s: %w", req.ID, ErrNotFound)
+	}
+
+	res := &comparison{DiffResponse: DiffResponse{Base: req.Base}, root: j.Root}
+	var prev []dirreader.FileInfo
+	var hash string
+	switch {
+	case req.Base != "":
+		if prev, err = s.wait(ctx, req.Base); err != nil {
+			return nil, err
+		}
+		base, err := s.Job(req.Base)
+		if err != nil {
+			return nil, err
+		}
+		hash = base.Hash
+	case s.cfg.Store != "":
+		store, err := snapshot.Open(s.cfg.Store)
+		if err != nil {
+			return nil, err
+		}
+		last, err := latestSnapshot(store, j.Root, tag, &j.filters)
+		if err == nil {
+			prev, res.Base, hash = last.Files, last.ID, last.Hash
+		} else if !errors.Is(err, snapshot.ErrNotFound) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: no base scan, and the server has no snapshot store", ErrInvalid)
+	}
+
+	if prev != nil && !strings.EqualFold(hash, j.Hash) {
+		prev, files = withoutHashes(prev), withoutHashes(files)
+	}
+	res.Changes = diff.CompareContext(ctx, prev, files)
+	if res.Changes == nil {
+		res.Changes = []diff.Change{}
+	}
+	return res, nil
+}
+
+// latestSnapshot returns the latest snapshot of the root taken with the filters, see snapshot.Filters, and carrying
+// the tag if not empty.
+func latestSnapshot(store *snapshot.Store, root, tag string, filters *snapshot.Filters) (*snapshot.Snapshot, error) {
+	snaps, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if snaps[i].Root == root && snaps[i].Filters.Equal(filters) && (tag == "" || snaps[i].HasTag(tag)) {
+			return store.Load(snaps[i].ID)
+		}
+	}
+	return nil, fmt.Errorf("latest snapshot of %s: %w", root, snapshot.ErrNotFound)
+}
+
+// withoutHashes returns a copy of the files without their hashes, so that they are compared by size and
+// modification time.
+func withoutHashes(files []dirreader.FileInfo) []dirreader.FileInfo {
+	out := make([]dirreader.FileInfo, len(files))
+	for i, fi := range files {
+		fi.Hash, fi.QuickHash = "", ""
+		out[i] = fi
+	}
+	return out
+}
+
+// Verify checks the files of the directory of the request against its checksum file.
+func (s *Server) Verify(_ context.Context, req *VerifyRequest) (*VerifyResponse, error) {
+	root, err := s.served(req.Root)
+	if err != nil {
+		return nil, err
+	}
+	h, err := hashes.Lookup(s.hashName(req.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if h == nil {
+		return nil, fmt.Errorf("%w: verify requires a hash algorithm", ErrInvalid)
+	}
+	entries, err := checksum.Read(strings.NewReader(req.Manifest))
+	if err != nil {
+		return nil, fmt.Errorf("%w: checksum file: %v", ErrInvalid, err)
+	}
+
+	// The checksum file comes from the client: its entries may only name files below the root.
+	results := make([]checksum.Result, len(entries))
+	var allowed []checksum.Entry
+	var index []int
+	for i, e := range entries {
+		if err = entryServed(root, e.Path); err != nil {
+			results[i] = checksum.Result{Entry: e, Status: checksum.Error, Err: err}
+			continue
+		}
+		allowed = append(allowed, e)
+		index = append(index, i)
+	}
+	for i, r := range checksum.Check(allowed, root, h) {
+		results[index[i]] = r
+	}
+	res := &VerifyResponse{Root: root, Time: time.Now().UTC(), Results: make([]VerifyResult, len(results)), Summary: checksum.Summary(results)}
+	for i, r := range results {
+		res.Results[i] = VerifyResult{Path: r.Path, Status: r.Status}
+		if r.Err != nil {
+			res.Results[i].Error = r.Err.Error()
+		}
+	}
+
+	s.mu.Lock()
+	s.seq++
+	res.ID = strconv.Itoa(s.seq)
+	s.verifications[res.ID] = res
+	s.verified = append(s.verified, res.ID)
+	for len(s.verified) > s.cfg.MaxJobs {
+		delete(s.verifications, s.verified[0])
+		s.verified = s.verified[1:]
+	}
+	s.mu.Unlock()
+
+	if bad := len(results) - res.Summary[checksum.OK]; bad > 0 {
+		s.publish(Event{Type: VerifyFailed, Root: root, Detail: fmt.Sprintf("%d of %d files did not match", bad, len(results))})
+	}
+	if p := webhook.FromVerify(root, res.ID, results); p != nil {
+		s.notify(*p)
+	}
+	return res, nil
+}
+
+// notify posts the payloads to the webhooks, and sends their messages to the notifier, in the background, until the
+// server is closed.
+func (s *Server) notify(payloads ...webhook.Payload) {
+	s.mu.Lock()
+	hooks, n := s.hooks, s.notifier
+	s.mu.Unlock()
+	if (hooks == nil && n == nil) || len(payloads) == 0 {
+		return
+	}
+	go func() {
+		for i := range payloads {
+			if hooks != nil {
+				// The dispatcher logs the failed deliveries.
+				_ = hooks.Send(s.ctx, &payloads[i])
+			}
+			if m := message(&payloads[i]); m != nil {
+				s.tell(m)
+			}
+		}
+	}()
+}
+
+// record appends the changes found in the root to the change log, if any, logging the failure.
+func (s *Server) record(root string, changes []diff.Change) {
+	if s.cfg.Changelog == nil {
+		return
+	}
+	if _, err := s.cfg.Changelog.Append(root, changes); err != nil && s.cfg.Logger != nil {
+		s.cfg.Logger.Error("change log append failed", "root", root, "error", err)
+	}
+}
+
+// tell sends the message to the notifier, if any, logging the failure.
+func (s *Server) tell(m *notify.Message) {
+	s.mu.Lock()
+	n := s.notifier
+	s.mu.Unlock()
+	if n == nil {
+		return
+	}
+	if err := n.Notify(s.ctx, m); err != nil && s.cfg.Logger != nil {
+		s.cfg.Logger.Error("notification failed", "event", m.Event, "root", m.Root, "error", err)
+	}
+}
+
+// message returns the message of the payload for the notifier: a warning for drift, critical for corruption, and nil
+// for new files, which the drift lists.
+func message(p *webhook.Payload) *notify.Message {
+	m := &notify.Message{Time: p.Time, Event: string(p.Event), Root: p.Root}
+	switch p.Event {
+	case webhook.Drift:
+		m.Severity, m.Subject = notify.Warning, fmt.Sprintf("%d changes in %s since %s", len(p.Files), p.Root, p.Base)
+		if p.Base == "" {
+			m.Subject = fmt.Sprintf("%d changes in %s", len(p.Files), p.Root)
+		}
+	case webhook.Corruption:
+		m.Severity, m.Subject = notify.Critical, fmt.Sprintf("%d corrupted or missing files in %s", len(p.Files), p.Root)
+	default:
+		return nil
+	}
+
+	lines := make([]string, len(p.Files))
+	for i, f := range p.Files {
+		lines[i] = f.Change + " " + f.Path
+	}
+	m.Body = notify.Lines(lines)
+	return m
+}
+
+// Subscribe returns a channel receiving the events of the server until the context is done or the server is
+// closed. Events are dropped rather than delay the server when the subscriber does not keep up.
+func (s *Server) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, 64)
+	s.mu.Lock()
+	s.subs[ch] = true
+	s.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.ctx.Done():
+		}
+		s.mu.Lock()
+		delete(s.subs, ch)
+		close(ch)
+		s.mu.Unlock()
+	}()
+	return ch
+}
+
+// publish sends the event to the subscribers.
+func (s *Server) publish(e Event) {
+	e.Time = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// hashName returns the name of the hash algorithm of a request setting the given one: the algorithm of the
+// configuration if empty, hashes.Default if neither sets one.
+func (s *Server) hashName(name string) string {
+	if name == "" {
+		name = s.cfg.Hash
+	}
+	if name == "" {
+		name = hashes.Default
+	}
+	return name
+}
+
+// served returns the absolute path of the directory, with symbolic links resolved, if it is a root of the server
+// or below one. A relative path is resolved against the first root it exists under.
+func (s *Server) served(dir string) (string, error) {
+	candidates := []string{dir}
+	if !filepath.IsAbs(dir) {
+		candidates = candidates[:0]
+		for _, root := range s.roots {
+			candidates = append(candidates, filepath.Join(root, dir))
+		}
+	}
+
+	for _, c := range candidates {
+		abs, err := resolve(c)
+		if err != nil {
+			continue
+		}
+		for _, root := range s.roots {
+			if rel, err := filepath.Rel(root, abs); err == nil && within(rel) {
+				return abs, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s: %w", dir, ErrNotServed)
+}
+
+// entryServed returns ErrOutsideRoot if the path of an entry of a checksum file is absolute, climbs out of the
+// root, or resolves outside it through symbolic links, whether their targets exist or not.
+func entryServed(root, path string) error {
+	p := filepath.FromSlash(path)
+	clean := filepath.Clean(p)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" || !within(clean) {
+		return fmt.Errorf("%s: %w", path, ErrOutsideRoot)
+	}
+
+	// The longest existing part of the path must resolve below the root.
+	for cur := filepath.Join(root, clean); ; cur = filepath.Dir(cur) {
+		resolved, err := filepath.EvalSymlinks(cur)
+		if err == nil {
+			if rel, err := filepath.Rel(root, resolved); err != nil || !within(rel) {
+				return fmt.Errorf("%s: %w", path, ErrOutsideRoot)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// A path that exists without resolving is a dangling symbolic link, whose target is not checked either.
+		if _, err = os.Lstat(cur); err == nil {
+			return fmt.Errorf("%s: %w", path, ErrOutsideRoot)
+		}
+		if cur == root {
+			return nil
+		}
+	}
+}
+
+// within reports whether the cleaned relative path stays below the directory it is relative to.
+func within(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolve returns the absolute path of the existing directory, with symbolic links resolved.
+func resolve(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+	return abs, nil
+}
@@ -0,0 +1,293 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the name of the gRPC service of the server.
+const ServiceName = "octopus.v1.Octopus"
+
+// codecName is the content subtype of the messages, sent as application/grpc+json.
+const codecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes the messages in JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
+
+// service is the interface of the handlers, which grpc.ServiceDesc checks the server implements.
+type service interface {
+	StartScan(context.Context, *ScanRequest) (*Job, error)
+	Diff(context.Context, *DiffRequest) (*DiffResponse, error)
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	LatestDrift(context.Context, *DriftRequest) (*DriftReport, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "StartScan", Handler: unary("StartScan", func(s *Server, ctx context.Context, req *ScanRequest) (any, error) {
+			return s.StartScan(ctx, req)
+		})},
+		{MethodName: "Diff", Handler: unary("Diff", func(s *Server, ctx context.Context, req *DiffRequest) (any, error) {
+			return s.Diff(ctx, req)
+		})},
+		{MethodName: "Verify", Handler: unary("Verify", func(s *Server, ctx context.Context, req *VerifyRequest) (any, error) {
+			return s.Verify(ctx, req)
+		})},
+		{MethodName: "LatestDrift", Handler: unary("LatestDrift", func(s *Server, ctx context.Context, req *DriftRequest) (any, error) {
+			return s.LatestDrift(ctx, req)
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "GetResults", ServerStreams: true, Handler: getResults},
+		{StreamName: "WatchEvents", ServerStreams: true, Handler: watchEvents},
+	},
+}
+
+// unary returns the handler of the unary method calling fn with the decoded request.
+func unary[Req any](method string, fn func(*Server, context.Context, *Req) (any, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			res, err := fn(srv.(*Server), ctx, req.(*Req))
+			return res, toStatus(err)
+		}
+		if interceptor == nil {
+			return handler(ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+func getResults(srv any, stream grpc.ServerStream) error {
+	req := new(ResultsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return toStatus(srv.(*Server).Results(stream.Context(), req.ID, func(r *Results) error {
+		return stream.SendMsg(r)
+	}))
+}
+
+func watchEvents(srv any, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(new(EventsRequest)); err != nil {
+		return err
+	}
+	for e := range srv.(*Server).Subscribe(stream.Context()) {
+		e := e
+		if err := stream.SendMsg(&e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register registers the service of the server with a gRPC server, e.g.:
+//
+//	gs := grpc.NewServer(daemon.TokenAuth(token)...)
+//	srv.Register(gs)
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(&serviceDesc, s)
+}
+
+// toStatus returns the error with the gRPC status code matching it.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoSchedule), errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotServed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrFailed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// TokenAuth returns the options of a gRPC server rejecting the calls without the bearer token in their
+// "authorization" metadata, as sent by a Client dialed with the token.
+func TokenAuth(token string) []grpc.ServerOption {
+	check := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			got, ok := strings.CutPrefix(v, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := check(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// Client calls the gRPC service of a server.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	Token string                           // Bearer token of the server, if it requires one.
+	TLS   credentials.TransportCredentials // Credentials of the connection, which is not encrypted if nil.
+}
+
+// Dial returns a client of the server at the address, e.g. "localhost:7420". The connection is established on the
+// first call.
+func Dial(addr string, opts ClientOptions) (*Client, error) {
+	dialOpts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName))}
+	if opts.TLS != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.TLS))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if opts.Token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearer{opts.Token, opts.TLS != nil}))
+	}
+
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// StartScan starts a scan of a directory of the server.
+func (c *Client) StartScan(ctx context.Context, req *ScanRequest) (*Job, error) {
+	res := new(Job)
+	return res, c.conn.Invoke(ctx, "/"+ServiceName+"/StartScan", req, res)
+}
+
+// Diff compares a scan with an earlier one, or with the latest snapshot of its root.
+func (c *Client) Diff(ctx context.Context, req *DiffRequest) (*DiffResponse, error) {
+	res := new(DiffResponse)
+	return res, c.conn.Invoke(ctx, "/"+ServiceName+"/Diff", req, res)
+}
+
+// Verify checks the files of a directory of the server against a checksum file.
+func (c *Client) Verify(ctx context.Context, req *VerifyRequest) (*VerifyResponse, error) {
+	res := new(VerifyResponse)
+	return res, c.conn.Invoke(ctx, "/"+ServiceName+"/Verify", req, res)
+}
+
+// LatestDrift returns the last run of a schedule of the server, with the changes it found.
+func (c *Client) LatestDrift(ctx context.Context, req *DriftRequest) (*DriftReport, error) {
+	res := new(DriftReport)
+	return res, c.conn.Invoke(ctx, "/"+ServiceName+"/LatestDrift", req, res)
+}
+
+// Results waits for a scan to finish, and calls fn with its files as they are received.
+func (c *Client) Results(ctx context.Context, id string, fn func(*Results) error) error {
+	stream, err := c.stream(ctx, 0, "GetResults", &ResultsRequest{ID: id})
+	if err != nil {
+		return err
+	}
+	for {
+		res := new(Results)
+		if err = stream.RecvMsg(res); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = fn(res); err != nil {
+			return err
+		}
+	}
+}
+
+// WatchEvents calls fn with the events of the server until the context is done or fn returns an error.
+func (c *Client) WatchEvents(ctx context.Context, fn func(*Event) error) error {
+	stream, err := c.stream(ctx, 1, "WatchEvents", &EventsRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		e := new(Event)
+		if err = stream.RecvMsg(e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// stream opens a server stream and sends its request.
+func (c *Client) stream(ctx context.Context, i int, method string, req any) (grpc.ClientStream, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[i], "/"+ServiceName+"/"+method)
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	return stream, stream.CloseSend()
+}
+
+// bearer sends a token in the "authorization" metadata of the calls.
+type bearer struct {
+	token  string
+	secure bool
+}
+
+func (b bearer) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + b.token}, nil
+}
+
+func (b bearer) RequireTransportSecurity() bool {
+	return b.secure
+}
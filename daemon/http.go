@@ -0,0 +1,456 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// defaultLimit and maxLimit are the default and maximum number of items of a page of the HTTP API.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// errBadCursor is returned for cursors the server did not issue.
+var errBadCursor = errors.New("invalid cursor")
+
+// errBaseChanged is returned for the pages of a diff whose base is no longer the one of the first page.
+var errBaseChanged = errors.New("the base of the diff changed, start again from the first page")
+
+// Page is a page of a list of the HTTP API. Next is the cursor of the following page, empty on the last one.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Handler returns an http.Handler serving the scans, diffs and verifications of the server as JSON, for dashboards
+// and curl:
+//
+//	GET  /v1/scans                        list the scans, oldest first
+//	POST /v1/scans                        start a scan, with a ScanRequest as body, 202 with its job
+//	GET  /v1/scans/<id>                   job of a scan
+//	GET  /v1/scans/<id>/files             files of a finished scan, 409 while it is running
+//	GET  /v1/scans/<id>/diff?base=<id>    changes found by a finished scan since its base, see DiffRequest and Diff
+//	GET  /v1/verifications                list the verifications, oldest first, without their results
+//	POST /v1/verifications                verify a directory, with a VerifyRequest as body, 201 with the outcome
+//	GET  /v1/verifications/<id>           outcome of a verification, without its results
+//	GET  /v1/verifications/<id>/results   results of a verification
+//	GET  /v1/schedules                    last runs of the schedules, by name, without their changes
+//	GET  /v1/schedules/<name>             last run of a schedule, without its changes
+//	GET  /v1/schedules/<name>/drift       changes found by the last run of a schedule
+//
+// Lists are paginated: they return a Page of up to limit items, 100 by default and 1000 at most, and the cursor of
+// the following page, to pass as the cursor parameter. Errors are returned as {"error": "<message>"}.
+//
+// Unlike Diff, the diff endpoint does not publish the drift, nor notify the webhooks and the notifier: it only reads
+// the comparison Diff would return, computing it if needed, with the base pinned in the cursor.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/scans", s.scans)
+	mux.HandleFunc("/v1/scans/", s.scan)
+	mux.HandleFunc("/v1/verifications", s.verifyList)
+	mux.HandleFunc("/v1/verifications/", s.verification)
+	mux.HandleFunc("/v1/schedules", s.scheduleList)
+	mux.HandleFunc("/v1/schedules/", s.schedule)
+	return mux
+}
+
+// RequireToken returns a handler rejecting the requests without the bearer token in their Authorization header with
+// 401, and passing the others to h.
+func RequireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) scans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		jobs := make([]Job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			jobs = append(jobs, j.Job)
+		}
+		s.mu.Unlock()
+		writeKeyset(w, r, jobs, func(j Job) string { return j.ID })
+	case http.MethodPost:
+		var req ScanRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		job, err := s.StartScan(r.Context(), &req)
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		notAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/scans/"), "/")
+
+	switch sub {
+	case "":
+		job, err := s.Job(id)
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case "files":
+		files, err := s.files(id)
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		writeOffset(w, r, files)
+	case "diff":
+		if _, err := s.files(id); err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		base := r.URL.Query().Get("base")
+		if base != "" {
+			if _, err := s.files(base); err != nil {
+				writeError(w, httpStatus(err), err)
+				return
+			}
+		}
+
+		limit, err := pageLimit(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// The cursor holds the base of the first page, so that all the pages come from the same comparison.
+		cursor := r.URL.Query().Get("cursor")
+		offset, pinned := 0, ""
+		if cursor != "" {
+			if offset, pinned, err = decodeDiffCursor(cursor); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		res, _, err := s.compared(r.Context(), &DiffRequest{ID: id, Base: base}, "")
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		if cursor != "" && res.Base != pinned {
+			writeError(w, http.StatusConflict, errBaseChanged)
+			return
+		}
+		page, ok := pageAt(w, res.Changes, offset, limit)
+		if !ok {
+			return
+		}
+		if page.Next != "" {
+			page.Next = encodeDiffCursor(offset+limit, res.Base)
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Base string `json:"base"`
+			Page[diff.Change]
+		}{res.Base, page})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) verifyList(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		list := make([]VerifyResponse, 0, len(s.verifications))
+		for _, v := range s.verifications {
+			list = append(list, withoutResults(v))
+		}
+		s.mu.Unlock()
+		writeKeyset(w, r, list, func(v VerifyResponse) string { return v.ID })
+	case http.MethodPost:
+		var req VerifyRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		res, err := s.Verify(r.Context(), &req)
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, withoutResults(res))
+	default:
+		notAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) verification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/verifications/"), "/")
+
+	s.mu.Lock()
+	v := s.verifications[id]
+	s.mu.Unlock()
+	if v == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("verification %s: not found", id))
+		return
+	}
+
+	switch sub {
+	case "":
+		writeJSON(w, http.StatusOK, withoutResults(v))
+	case "results":
+		writeOffset(w, r, v.Results)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) scheduleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	s.mu.Lock()
+	list := make([]DriftReport, 0, len(s.drift))
+	for _, rep := range s.drift {
+		c := *rep
+		c.Changes = nil
+		list = append(list, c)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Schedule < list[j].Schedule })
+	writeOffset(w, r, list)
+}
+
+func (s *Server) schedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	name, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/schedules/"), "/")
+
+	rep, err := s.LatestDrift(r.Context(), &DriftRequest{Schedule: name})
+	if err != nil {
+		writeError(w, httpStatus(err), err)
+		return
+	}
+	switch sub {
+	case "":
+		rep.Changes = nil
+		writeJSON(w, http.StatusOK, rep)
+	case "drift":
+		writeOffset(w, r, rep.Changes)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// files returns the files of the finished scan with the ID, or ErrRunning.
+func (s *Server) files(id string) ([]dirreader.FileInfo, error) {
+	s.mu.Lock()
+	j := s.jobs[id]
+	s.mu.Unlock()
+	if j == nil {
+		return nil, fmt.Errorf("scan %s: %w", id, ErrNotFound)
+	}
+
+	select {
+	case <-j.finished:
+	default:
+		return nil, fmt.Errorf("scan %s: %w", id, ErrRunning)
+	}
+	return s.wait(context.Background(), id)
+}
+
+// withoutResults returns the verification without its results, which are listed by their own endpoint.
+func withoutResults(v *VerifyResponse) VerifyResponse {
+	c := *v
+	c.Results = nil
+	return c
+}
+
+// writeKeyset writes the page of the items with the numeric IDs following the cursor. The cursor is the last ID
+// of the previous page, so that the pages stay consistent while items are added and removed.
+func writeKeyset[T any](w http.ResponseWriter, r *http.Request, items []T, id func(T) string) {
+	num := func(item T) int {
+		n, _ := strconv.Atoi(id(item))
+		return n
+	}
+	sort.Slice(items, func(i, j int) bool { return num(items[i]) < num(items[j]) })
+
+	after, limit, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	i := sort.Search(len(items), func(i int) bool { return num(items[i]) > after })
+	page := Page[T]{Items: items[i:]}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.Next = encodeCursor(num(page.Items[limit-1]))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// writeOffset writes the page of the items following the cursor, the offset of the page in the list, which must not
+// change between the pages.
+func writeOffset[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	if page, ok := paginate(w, r, items); ok {
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// paginate returns the page of the items following the cursor, the offset of the page in the list, or writes the
+// error of the parameters.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T) (Page[T], bool) {
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return Page[T]{}, false
+	}
+	return pageAt(w, items, offset, limit)
+}
+
+// pageAt returns the page of up to limit items at the offset, or writes the error of an offset past the items.
+func pageAt[T any](w http.ResponseWriter, items []T, offset, limit int) (Page[T], bool) {
+	if offset > len(items) {
+		writeError(w, http.StatusBadRequest, errBadCursor)
+		return Page[T]{}, false
+	}
+
+	page := Page[T]{Items: items[offset:]}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.Next = encodeCursor(offset + limit)
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page, true
+}
+
+// pageParams returns the decoded cursor and the limit of the request.
+func pageParams(r *http.Request) (cursor, limit int, err error) {
+	if limit, err = pageLimit(r); err != nil {
+		return 0, 0, err
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return 0, 0, errBadCursor
+		}
+		if cursor, err = strconv.Atoi(string(b)); err != nil || cursor < 0 {
+			return 0, 0, errBadCursor
+		}
+	}
+	return cursor, limit, nil
+}
+
+// pageLimit returns the limit of the request.
+func pageLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, nil
+}
+
+// encodeCursor returns the opaque cursor of a position.
+func encodeCursor(n int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(n)))
+}
+
+// encodeDiffCursor returns the opaque cursor of a position in a diff with the base.
+func encodeDiffCursor(n int, base string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(n) + "/" + base))
+}
+
+// decodeDiffCursor returns the position and the base of a cursor of encodeDiffCursor.
+func decodeDiffCursor(v string) (int, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return 0, "", errBadCursor
+	}
+	pos, base, ok := strings.Cut(string(b), "/")
+	n, err := strconv.Atoi(pos)
+	if !ok || err != nil || n < 0 {
+		return 0, "", errBadCursor
+	}
+	return n, base, nil
+}
+
+// decode decodes the JSON body of the request into v, or writes the error.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// httpStatus returns the HTTP status code matching the error.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoSchedule), errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotServed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrFailed), errors.Is(err, ErrRunning):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalid):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func notAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Limits represents the limits of the scans of the server, which fail once they reach one.
+type Limits struct {
+	RateLimit int64 `json:"rateLimit,omitempty"` // Bytes read per second by all the scans together, unlimited if 0.
+	MaxFiles  int   `json:"maxFiles,omitempty"`  // Number of files a scan fails at, unlimited if 0.
+	MaxBytes  int64 `json:"maxBytes,omitempty"`  // Total size of the files a scan fails at, unlimited if 0.
+	MaxErrors int   `json:"maxErrors,omitempty"` // Number of errors a scan fails at, unlimited if 0.
+}
+
+// LoadLimits reads the limits from a JSON file.
+func LoadLimits(path string) (Limits, error) {
+	var l Limits
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, fmt.Errorf("load limits %s: %w", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&l); err != nil {
+		return l, fmt.Errorf("load limits %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// validate checks that none of the limits is negative.
+func (l Limits) validate() error {
+	if l.RateLimit < 0 || l.MaxFiles < 0 || l.MaxBytes < 0 || l.MaxErrors < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// scanOptions returns the options of every scan: those of the configuration followed by the limits, which share a
+// single rate limit.
+func scanOptions(opts []dirreader.Option, l Limits) []dirreader.Option {
+	return append(opts[:len(opts):len(opts)],
+		dirreader.WithRateLimit(l.RateLimit),
+		dirreader.WithLimit(l.MaxFiles, l.MaxBytes),
+		dirreader.WithMaxErrors(l.MaxErrors),
+	)
+}
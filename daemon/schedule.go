@@ -0,0 +1,340 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/cron"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/fleet"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/notify"
+	"github.com/gromey/octopus/snapshot"
+)
+
+// ErrNoSchedule is returned for schedules the server is not configured with.
+var ErrNoSchedule = errors.New("no such schedule")
+
+// scheduleTag is the prefix of the tag of the snapshots saved by a schedule, followed by its name.
+const scheduleTag = "schedule:"
+
+// Schedule represents the scans the server runs on its own, on a cron schedule, see the cron package. Every run
+// compares the scan with the latest snapshot the schedule saved, saves it as the new snapshot, and verifies the root
+// against a checksum file if the schedule has one.
+type Schedule struct {
+	Name       string   `json:"name"`                 // Unique name of the schedule.
+	Root       string   `json:"root"`                 // Directory to scan, a root of the server or below one.
+	Cron       string   `json:"cron"`                 // Cron expression of the runs, e.g. "0 3 * * *", in local time.
+	Hash       string   `json:"hash,omitempty"`       // Hash algorithm, the one of the server if empty.
+	Include    []string `json:"include,omitempty"`    // Only scan the files with these extensions.
+	Exclude    []string `json:"exclude,omitempty"`    // Do not scan the files with these extensions.
+	SkipHidden bool     `json:"skipHidden,omitempty"` // Skip hidden files and directories.
+	Manifest   string   `json:"manifest,omitempty"`   // Checksum file to verify the root against on every run (optional).
+
+	cron *cron.Schedule
+}
+
+// LoadSchedules reads a JSON array of schedules from a file.
+func LoadSchedules(path string) ([]Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load schedules %s: %w", path, err)
+	}
+
+	var schedules []Schedule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&schedules); err != nil {
+		return nil, fmt.Errorf("load schedules %s: %w", path, err)
+	}
+	return schedules, nil
+}
+
+// DriftRequest is the request of LatestDrift.
+type DriftRequest struct {
+	Schedule string `json:"schedule"` // Name of the schedule.
+}
+
+// DriftReport represents the last run of a schedule.
+type DriftReport struct {
+	Schedule     string        `json:"schedule"`               // Name of the schedule.
+	Root         string        `json:"root"`                   // Absolute path of the scanned directory.
+	Cron         string        `json:"cron"`                   // Cron expression of the schedule.
+	Next         time.Time     `json:"next"`                   // Time of the next run.
+	Time         time.Time     `json:"time"`                   // Time the last run finished, zero before the first one.
+	Job          string        `json:"job,omitempty"`          // ID of the scan of the last run, empty if it ran before a restart.
+	Snapshot     string        `json:"snapshot,omitempty"`     // ID of the snapshot saved by the last run.
+	Base         string        `json:"base,omitempty"`         // ID of the snapshot compared with, empty for the first snapshot.
+	Count        int           `json:"count"`                  // Number of changes since the base.
+	Changes      []diff.Change `json:"changes,omitempty"`      // Changes since the base, sorted by path.
+	Verification string        `json:"verification,omitempty"` // ID of the verification of the last run, if any.
+	Error        string        `json:"error,omitempty"`        // Failure of the last run, which keeps the drift of the one before if the scan failed.
+	Usage        *Usage        `json:"usage,omitempty"`        // Resources of the process during the last run, nil before the first one and where not measured.
+}
+
+// initSchedules validates the schedules, and returns their latest drift by name, recovered from the snapshots they
+// saved.
+func (s *Server) initSchedules(schedules []Schedule) (map[string]*DriftReport, error) {
+	drift := make(map[string]*DriftReport)
+	if len(schedules) == 0 {
+		return drift, nil
+	}
+	if s.cfg.Store == "" {
+		return nil, errors.New("schedules require a snapshot store")
+	}
+	store, err := snapshot.Open(s.cfg.Store)
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range schedules {
+		sc := &schedules[i]
+		if err = s.initSchedule(sc, store, snaps, drift); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", sc.Name, err)
+		}
+	}
+	return drift, nil
+}
+
+// initSchedule validates the schedule and records its latest drift in drift.
+func (s *Server) initSchedule(sc *Schedule, store *snapshot.Store, snaps []snapshot.Snapshot, drift map[string]*DriftReport) error {
+	var err error
+	switch {
+	case sc.Name == "":
+		return errors.New("name is required")
+	case drift[sc.Name] != nil:
+		return errors.New("duplicate name")
+	case len(sc.Include) > 0 && len(sc.Exclude) > 0:
+		return errors.New("include and exclude cannot be used together")
+	}
+	if sc.cron, err = cron.Parse(sc.Cron); err != nil {
+		return err
+	}
+	if _, err = hashes.Lookup(sc.Hash); err != nil {
+		return err
+	}
+	if sc.Root, err = s.served(sc.Root); err != nil {
+		return err
+	}
+	if sc.Manifest != "" {
+		if h, _ := hashes.Lookup(s.hashName(sc.Hash)); h == nil {
+			return errors.New("verifying a manifest requires a hash algorithm")
+		}
+	}
+
+	rep := &DriftReport{Schedule: sc.Name, Root: sc.Root, Cron: sc.Cron, Changes: []diff.Change{}}
+	drift[sc.Name] = rep
+
+	// The latest snapshot of the schedule, and the one it was compared with: the snapshot of the schedule before it
+	// taken with the same filters.
+	last, base := -1, -1
+	for i := len(snaps) - 1; i >= 0 && base < 0; i-- {
+		switch {
+		case snaps[i].Root != sc.Root || !snaps[i].HasTag(scheduleTag+sc.Name):
+		case last < 0:
+			last = i
+		case snaps[i].Filters.Equal(snaps[last].Filters):
+			base = i
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+
+	rep.Time, rep.Snapshot = snaps[last].Created, snaps[last].ID
+	cur, err := store.Load(snaps[last].ID)
+	if err != nil {
+		return err
+	}
+	var prev *snapshot.Snapshot
+	if base >= 0 {
+		if prev, err = store.Load(snaps[base].ID); err != nil {
+			return err
+		}
+		rep.Base = prev.ID
+	} else {
+		prev = &snapshot.Snapshot{}
+	}
+	if base >= 0 && !strings.EqualFold(prev.Hash, cur.Hash) {
+		prev.Files, cur.Files = withoutHashes(prev.Files), withoutHashes(cur.Files)
+	}
+	if changes := diff.Compare(prev.Files, cur.Files); changes != nil {
+		rep.Changes, rep.Count = changes, len(changes)
+	}
+	return nil
+}
+
+// startSchedules runs the schedules until the server is closed or Reload replaces them. It is called with the lock
+// held once the server is started.
+func (s *Server) startSchedules(schedules []Schedule) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopSchedules = cancel
+	for i := range schedules {
+		go s.runSchedule(ctx, &schedules[i])
+	}
+}
+
+// runSchedule runs the schedule until the context is done. The run in progress then completes.
+func (s *Server) runSchedule(ctx context.Context, sc *Schedule) {
+	for {
+		next := sc.cron.Next(time.Now())
+		s.mu.Lock()
+		if ctx.Err() == nil {
+			s.drift[sc.Name].Next = next
+		}
+		s.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		s.runScheduled(sc)
+	}
+}
+
+// runScheduled runs the scan, and the verification, of the schedule, and records its drift. The run starts after a
+// random delay of up to Config.Jitter, and once it holds a token of Config.Tokens, if set.
+func (s *Server) runScheduled(sc *Schedule) {
+	if fleet.Sleep(s.ctx, fleet.Jitter(s.cfg.Jitter)) != nil {
+		return
+	}
+	rep := DriftReport{Schedule: sc.Name, Root: sc.Root, Cron: sc.Cron, Changes: []diff.Change{}}
+	release, err := s.lease()
+	if err == nil {
+		start := readUsage()
+		err = s.scheduledScan(s.ctx, sc, &rep)
+		if err == nil && sc.Manifest != "" {
+			err = s.scheduledVerify(s.ctx, sc, &rep)
+		}
+		if end := readUsage(); start != nil && end != nil {
+			rep.Usage = end.since(start)
+		}
+		release()
+	}
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return
+		}
+		rep.Error = err.Error()
+		// The failures of the scan itself are published by StartScan.
+		if !errors.Is(err, ErrFailed) {
+			s.publish(Event{Type: ScanFailed, Job: rep.Job, Root: sc.Root, Detail: fmt.Sprintf("schedule %s: %v", sc.Name, err)})
+		}
+		go s.tell(&notify.Message{
+			Time:     time.Now().UTC(),
+			Severity: notify.Critical,
+			Event:    string(ScanFailed),
+			Root:     sc.Root,
+			Subject:  fmt.Sprintf("scheduled scan %s of %s failed", sc.Name, sc.Root),
+			Body:     err.Error(),
+		})
+	}
+	rep.Time = time.Now().UTC()
+
+	s.mu.Lock()
+	prev := s.drift[sc.Name]
+	if prev == nil {
+		// Reload removed the schedule.
+		s.mu.Unlock()
+		return
+	}
+	rep.Next = prev.Next
+	if rep.Snapshot == "" {
+		rep.Snapshot, rep.Base, rep.Count, rep.Changes = prev.Snapshot, prev.Base, prev.Count, prev.Changes
+	}
+	s.drift[sc.Name] = &rep
+	s.mu.Unlock()
+}
+
+// lease waits for a token of Config.Tokens, if set, and returns the function releasing it.
+func (s *Server) lease() (func(), error) {
+	if s.cfg.Tokens == nil {
+		return func() {}, nil
+	}
+	l, err := s.cfg.Tokens.Acquire(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire token: %w", err)
+	}
+	return func() {
+		// The token is released even when the server is closing, so that other hosts need not wait for it to expire.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := l.Release(ctx); err != nil && s.cfg.Logger != nil {
+			s.cfg.Logger.Warn("token release failed", "error", err)
+		}
+	}, nil
+}
+
+// scheduledScan scans the root of the schedule, compares it with the latest snapshot the schedule saved and saves it as
+// a new one.
+func (s *Server) scheduledScan(ctx context.Context, sc *Schedule, rep *DriftReport) error {
+	job, err := s.StartScan(ctx, &ScanRequest{Root: sc.Root, Hash: sc.Hash, Include: sc.Include, Exclude: sc.Exclude, SkipHidden: sc.SkipHidden})
+	if err != nil {
+		return err
+	}
+	rep.Job = job.ID
+
+	res, err := s.diff(ctx, &DiffRequest{ID: job.ID}, scheduleTag+sc.Name)
+	if err != nil {
+		return err
+	}
+	rep.Base, rep.Changes, rep.Count = res.Base, res.Changes, len(res.Changes)
+
+	files, err := s.wait(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	store, err := snapshot.Open(s.cfg.Store)
+	if err != nil {
+		return err
+	}
+	snap := &snapshot.Snapshot{Root: sc.Root, Tags: []string{scheduleTag + sc.Name}, Files: files, Hash: job.Hash}
+	snap.Filters = &snapshot.Filters{Include: sc.Include, Exclude: sc.Exclude, SkipHidden: sc.SkipHidden}
+	if err = store.Save(snap); err != nil {
+		return err
+	}
+	rep.Snapshot = snap.ID
+	return nil
+}
+
+// scheduledVerify verifies the root of the schedule against its checksum file.
+func (s *Server) scheduledVerify(ctx context.Context, sc *Schedule, rep *DriftReport) error {
+	manifest, err := os.ReadFile(sc.Manifest)
+	if err != nil {
+		return err
+	}
+	res, err := s.Verify(ctx, &VerifyRequest{Root: sc.Root, Hash: sc.Hash, Manifest: string(manifest)})
+	if err != nil {
+		return err
+	}
+	rep.Verification = res.ID
+	return nil
+}
+
+// LatestDrift returns the last run of the schedule of the request, with the changes it found.
+func (s *Server) LatestDrift(_ context.Context, req *DriftRequest) (*DriftReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rep := s.drift[req.Schedule]
+	if rep == nil {
+		return nil, fmt.Errorf("%s: %w", req.Schedule, ErrNoSchedule)
+	}
+	c := *rep
+	return &c, nil
+}
@@ -0,0 +1,30 @@
+package daemon
+
+import "time"
+
+// Usage represents the resources the server process used during the last run of a schedule. The scans run on the
+// goroutines of the whole process, which the counters of the system cannot tell apart, so these are process-wide: they
+// are the difference of the counters of the process between the start and the end of the run, and a run overlapping
+// client scans, or other runs, also counts what they used.
+type Usage struct {
+	UserTime       time.Duration `json:"userTime"`       // CPU time the process spent running during the run.
+	SystemTime     time.Duration `json:"systemTime"`     // CPU time the kernel spent on behalf of the process during the run.
+	ProcessPeakRSS int64         `json:"processPeakRSS"` // Peak resident set size of the process since it started, not of the run, in bytes.
+	ReadBytes      int64         `json:"readBytes"`      // Bytes the process fetched from storage during the run, excluding the page cache.
+	WriteBytes     int64         `json:"writeBytes"`     // Bytes the process sent to storage during the run.
+	ReadCalls      int64         `json:"readCalls"`      // Read system calls of the process during the run, e.g. read and pread.
+	WriteCalls     int64         `json:"writeCalls"`     // Write system calls of the process during the run, e.g. write and pwrite.
+}
+
+// since returns the usage between the start of a run and the end, u.
+func (u *Usage) since(start *Usage) *Usage {
+	return &Usage{
+		UserTime:       u.UserTime - start.UserTime,
+		SystemTime:     u.SystemTime - start.SystemTime,
+		ProcessPeakRSS: u.ProcessPeakRSS,
+		ReadBytes:      u.ReadBytes - start.ReadBytes,
+		WriteBytes:     u.WriteBytes - start.WriteBytes,
+		ReadCalls:      u.ReadCalls - start.ReadCalls,
+		WriteCalls:     u.WriteCalls - start.WriteCalls,
+	}
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readUsage returns the resources the process used since it started, from getrusage and /proc/self/io, nil if they
+// cannot be read.
+func readUsage() *Usage {
+	var ru unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &ru); err != nil {
+		return nil
+	}
+	u := &Usage{
+		UserTime:       time.Duration(ru.Utime.Nano()),
+		SystemTime:     time.Duration(ru.Stime.Nano()),
+		ProcessPeakRSS: ru.Maxrss * 1024, // In kilobytes on Linux.
+	}
+
+	f, err := os.Open("/proc/self/io")
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	// Format: one "name: value" counter per line.
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "read_bytes":
+			u.ReadBytes = n
+		case "write_bytes":
+			u.WriteBytes = n
+		case "syscr":
+			u.ReadCalls = n
+		case "syscw":
+			u.WriteCalls = n
+		}
+	}
+	if sc.Err() != nil {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package daemon
+
+// readUsage returns nil, as the resources used by the process are only read on Linux.
+func readUsage() *Usage {
+	return nil
+}
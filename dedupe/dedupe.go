@@ -0,0 +1,254 @@
+package dedupe
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// partialSize is the number of leading bytes hashed during the partial hash pass.
+const partialSize = 4096
+
+// Set represents a group of files with identical content.
+type Set struct {
+	Size  int64                // Size of each file in the set.
+	Hash  string               // Full hash of the content shared by all files in the set.
+	Files []dirreader.FileInfo // Files with identical content, sorted by absolute path.
+}
+
+// Reclaimable returns the number of bytes that would be freed by keeping only one file of the set.
+func (s Set) Reclaimable() int64 {
+	return s.Size * int64(len(s.Files)-1)
+}
+
+// Result represents the outcome of a duplicate search.
+type Result struct {
+	Sets        []Set // Duplicate sets, sorted by reclaimable bytes in descending order.
+	Reclaimable int64 // Total number of bytes that would be freed by removing all duplicates.
+}
+
+// Find searches the provided files for duplicates.
+// Files are grouped by size first, then by a hash of their leading bytes, and only the remaining
+// candidates are hashed in full, so most unique files are never read completely.
+//   - files: scanned files, e.g. the result of dirreader.Exec.
+//   - hashFunc: function used to compute partial and full hashes.
+//   - hashed: whether the hashes the files carry were computed with hashFunc, so that they are reused as their full
+//     hashes. Otherwise the files are hashed again, since hashes of different algorithms cannot be compared.
+//
+// If all the candidates carry a quick hash, see dirreader.WithQuickHash, it is used instead of the leading bytes.
+// Directories and empty files are ignored.
+func Find(files []dirreader.FileInfo, hashFunc func() hash.Hash, hashed bool) (*Result, error) {
+	if hashFunc == nil {
+		return nil, errors.New("hash function is required")
+	}
+
+	f := &finder{hashFunc: hashFunc, hashed: hashed}
+
+	// Group files by size, files with a unique size cannot have duplicates.
+	bySize := make(map[int64][]dirreader.FileInfo)
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() || fi.Size() == 0 {
+			continue
+		}
+		bySize[fi.Size()] = append(bySize[fi.Size()], fi)
+	}
+
+	var groups [][]dirreader.FileInfo
+	for _, group := range bySize {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	// Narrow the groups by hashing the leading bytes of each file, or by their quick hashes.
+	partial := f.partialHash
+	if quickHashed(groups) {
+		partial = func(fi dirreader.FileInfo) (string, error) { return fi.QuickHash, nil }
+	}
+	groups, err := f.split(groups, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	// Confirm the remaining candidates by hashing their full content.
+	if groups, err = f.split(groups, f.fullHash); err != nil {
+		return nil, err
+	}
+
+	res := &Result{Sets: make([]Set, 0, len(groups))}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].PathAbs < group[j].PathAbs })
+
+		h, _ := f.fullHash(group[0])
+		set := Set{
+			Size:  group[0].Size(),
+			Hash:  h,
+			Files: group,
+		}
+
+		res.Sets = append(res.Sets, set)
+		res.Reclaimable += set.Reclaimable()
+	}
+
+	sort.Slice(res.Sets, func(i, j int) bool {
+		if ri, rj := res.Sets[i].Reclaimable(), res.Sets[j].Reclaimable(); ri != rj {
+			return ri > rj
+		}
+		return res.Sets[i].Files[0].PathAbs < res.Sets[j].Files[0].PathAbs
+	})
+
+	return res, nil
+}
+
+// finder holds the state of a duplicate search.
+type finder struct {
+	mu       sync.Mutex
+	hashFunc func() hash.Hash
+	hashed   bool              // Whether the hashes of the files were computed with hashFunc.
+	full     map[string]string // Full hashes by absolute path, so each file is read completely at most once.
+}
+
+// split hashes every file of the provided groups using hashFn, with as many workers as GOMAXPROCS,
+// and splits each group into subgroups of files with equal hashes, dropping the subgroups of a single file.
+func (f *finder) split(groups [][]dirreader.FileInfo, hashFn func(dirreader.FileInfo) (string, error)) ([][]dirreader.FileInfo, error) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		err error
+	)
+
+	type task struct{ i, j int }
+	tasks := make(chan task)
+	hashes := make([][]string, len(groups))
+	for i, group := range groups {
+		hashes[i] = make([]string, len(group))
+	}
+
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				fi := groups[t.i][t.j]
+				h, e := hashFn(fi)
+				if e != nil {
+					mu.Lock()
+					err = errors.Join(err, fmt.Errorf("calculate hash sum %s: %w", fi.PathAbs, e))
+					mu.Unlock()
+					continue
+				}
+				hashes[t.i][t.j] = h
+			}
+		}()
+	}
+	for i, group := range groups {
+		for j := range group {
+			tasks <- task{i, j}
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]dirreader.FileInfo
+	for i, group := range groups {
+		byHash := make(map[string][]dirreader.FileInfo)
+		var order []string
+		for j, fi := range group {
+			if _, ok := byHash[hashes[i][j]]; !ok {
+				order = append(order, hashes[i][j])
+			}
+			byHash[hashes[i][j]] = append(byHash[hashes[i][j]], fi)
+		}
+
+		for _, h := range order {
+			if len(byHash[h]) > 1 {
+				result = append(result, byHash[h])
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// quickHashed reports whether all the files of the groups carry a quick hash.
+func quickHashed(groups [][]dirreader.FileInfo) bool {
+	for _, group := range groups {
+		for _, fi := range group {
+			if fi.QuickHash == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// partialHash computes the hash of the leading bytes of the file.
+// Files not larger than the partial size are hashed in full, and the result is cached as their full hash.
+func (f *finder) partialHash(fi dirreader.FileInfo) (string, error) {
+	if fi.Size() <= partialSize {
+		return f.fullHash(fi)
+	}
+	return f.computeHash(fi.PathAbs, partialSize)
+}
+
+// fullHash returns the hash of the whole file content, reusing the hash collected during the scan if it was
+// computed with the hash function of the finder.
+func (f *finder) fullHash(fi dirreader.FileInfo) (string, error) {
+	if f.hashed && fi.Hash != "" {
+		return fi.Hash, nil
+	}
+
+	f.mu.Lock()
+	h, ok := f.full[fi.PathAbs]
+	f.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	h, err := f.computeHash(fi.PathAbs, -1)
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	if f.full == nil {
+		f.full = make(map[string]string)
+	}
+	f.full[fi.PathAbs] = h
+	f.mu.Unlock()
+
+	return h, nil
+}
+
+// computeHash computes the hash of the first n bytes of the file, or of the whole file if n is negative.
+func (f *finder) computeHash(filename string, n int64) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	var r io.Reader = file
+	if n >= 0 {
+		r = io.LimitReader(file, n)
+	}
+
+	h := f.hashFunc()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,342 @@
+package dedupe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/filecopy"
+	"github.com/gromey/octopus/hold"
+	"github.com/gromey/octopus/trash"
+)
+
+// ErrReflinkUnsupported is returned when reflinks are not supported by the platform or the filesystem.
+var ErrReflinkUnsupported = filecopy.ErrCloneUnsupported
+
+// Method represents the way a duplicate is replaced.
+type Method string
+
+const (
+	Hardlink Method = "hardlink" // Replace the duplicate with a hard link to the kept file.
+	Reflink  Method = "reflink"  // Replace the duplicate with a copy-on-write clone of the kept file.
+)
+
+// Action represents the replacement of a single duplicate.
+type Action struct {
+	Keep    string `json:"keep"`    // Absolute path of the file that is kept.
+	Replace string `json:"replace"` // Absolute path of the duplicate that is replaced.
+	Size    int64  `json:"size"`    // Size of the file.
+}
+
+// Skipped represents a duplicate that is left untouched, and why.
+type Skipped struct {
+	Path   string `json:"path"`   // Absolute path of the duplicate.
+	Reason string `json:"reason"` // Reason the duplicate is skipped.
+}
+
+// Plan represents the replacement of duplicates with links. It can be inspected as a dry run before being executed.
+type Plan struct {
+	Method      Method    `json:"method"`            // Method used to replace duplicates.
+	Actions     []Action  `json:"actions"`           // Replacements to perform.
+	Skipped     []Skipped `json:"skipped,omitempty"` // Duplicates that cannot be replaced.
+	Reclaimable int64     `json:"reclaimable"`       // Number of bytes freed by executing the plan.
+
+	// Trash receives the replaced duplicates, which trash.Trash.Undo restores over their links (optional).
+	// The space of the duplicates is only freed once the trash is emptied.
+	Trash *trash.Trash `json:"-"`
+
+	files map[string]dirreader.FileInfo // Scanned files by absolute path, used to detect changes since the scan.
+}
+
+// PlanLinks plans the replacement of duplicates found by Find with links using the provided method.
+// The first file of each set is kept, and duplicates that reside on another device,
+// are already linked to the kept file, or where either file is covered by one of the holds, are skipped.
+// The holds may be nil.
+func PlanLinks(res *Result, method Method, holds *hold.Set) (*Plan, error) {
+	if method != Hardlink && method != Reflink {
+		return nil, fmt.Errorf("unknown link method %q", method)
+	}
+
+	p := &Plan{Method: method, files: make(map[string]dirreader.FileInfo)}
+
+	for _, set := range res.Sets {
+		keep := set.Files[0]
+		keepDev, keepDevOK := fileDevice(keep)
+
+		for _, fi := range set.Files[1:] {
+			if _, ok := holds.Held(keep.PathAbs); ok {
+				p.Skipped = append(p.Skipped, Skipped{Path: fi.PathAbs, Reason: "kept file held"})
+				continue
+			}
+			if _, ok := holds.Held(fi.PathAbs); ok {
+				p.Skipped = append(p.Skipped, Skipped{Path: fi.PathAbs, Reason: "held"})
+				continue
+			}
+
+			if sameFile(keep, fi) {
+				p.Skipped = append(p.Skipped, Skipped{Path: fi.PathAbs, Reason: "already linked"})
+				continue
+			}
+
+			dev, ok := fileDevice(fi)
+			if !ok || !keepDevOK {
+				p.Skipped = append(p.Skipped, Skipped{Path: fi.PathAbs, Reason: "device unknown"})
+				continue
+			}
+			if dev != keepDev {
+				p.Skipped = append(p.Skipped, Skipped{Path: fi.PathAbs, Reason: "cross-device"})
+				continue
+			}
+
+			p.Actions = append(p.Actions, Action{Keep: keep.PathAbs, Replace: fi.PathAbs, Size: set.Size})
+			p.Reclaimable += set.Size
+			p.files[keep.PathAbs] = keep
+			p.files[fi.PathAbs] = fi
+		}
+	}
+
+	return p, nil
+}
+
+// fileDevice returns the ID of the device of the file: the one recorded by the scan, or else the one of its
+// metadata, which the files loaded from a snapshot or a cache lack.
+func fileDevice(fi dirreader.FileInfo) (uint64, bool) {
+	if fi.Dev != 0 {
+		return fi.Dev, true
+	}
+	return device(fi.FileInfo)
+}
+
+// sameFile reports whether the files are links to the same file: whether they have the same device and inode recorded
+// by the scan, or else the same metadata, which the files loaded from a snapshot or a cache lack.
+func sameFile(a, b dirreader.FileInfo) bool {
+	if a.Ino != 0 && b.Ino != 0 {
+		return a.Dev == b.Dev && a.Ino == b.Ino
+	}
+	if a.FileInfo == nil || b.FileInfo == nil {
+		return false
+	}
+	return os.SameFile(a.FileInfo, b.FileInfo)
+}
+
+// Ops returns the planned replacements as a plan of link operations, to be reviewed and executed later with
+// actions.Plan.Execute, which checks that both files still have the same content. Unlike Execute, the execution
+// keeps no rollback log: with a trash, trash.Trash.Undo restores the duplicates.
+func (p *Plan) Ops() *actions.Plan {
+	ops := new(actions.Plan)
+	for _, a := range p.Actions {
+		ops.Add(actions.Op{Kind: actions.Link, Src: a.Replace, Dst: a.Keep, Size: a.Size, Reason: "dedupe " + string(p.Method), Method: string(p.Method)})
+	}
+	return ops
+}
+
+// rollbackEntry is a record of the rollback log.
+type rollbackEntry struct {
+	Action
+	Method  Method    `json:"method"`
+	Mode    uint32    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Execute performs the planned replacements, recording each of them in the rollback log at logPath,
+// so they can be reverted with Rollback, and in the audit log if one is provided.
+// Before a duplicate is replaced, both files are checked to be unchanged since the scan and compared byte for byte;
+// files that changed or differ are skipped and reported in the returned error.
+func (p *Plan) Execute(logPath string, auditLog *audit.Log) error {
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open rollback log %s: %w", logPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	enc := json.NewEncoder(f)
+	for _, a := range p.Actions {
+		orig, e := p.check(a)
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("replace %s: %w", a.Replace, e))
+			continue
+		}
+
+		// Record the action before performing it, so an interrupted run can still be rolled back.
+		entry := rollbackEntry{Action: a, Method: p.Method, Mode: uint32(orig.Mode()), ModTime: orig.ModTime()}
+		if e = enc.Encode(entry); e == nil {
+			e = f.Sync()
+		}
+		if e != nil {
+			return errors.Join(err, fmt.Errorf("write rollback log %s: %w", logPath, e))
+		}
+
+		trashed, e := replace(a.Keep, a.Replace, p.Method, p.Trash)
+		if e != nil {
+			err = errors.Join(err, fmt.Errorf("replace %s: %w", a.Replace, e))
+			continue
+		}
+
+		if trashed != "" {
+			if e = auditLog.Record(audit.Move, a.Replace, trashed, "dedupe "+string(p.Method)); e != nil {
+				return errors.Join(err, e)
+			}
+		}
+		if e = auditLog.Record(audit.Link, a.Replace, a.Keep, "dedupe "+string(p.Method)); e != nil {
+			return errors.Join(err, e)
+		}
+	}
+
+	return err
+}
+
+// check verifies that both files of the action are unchanged since the scan and still have the same content,
+// compared byte for byte since the hash that found them may not be collision resistant, and returns the current
+// state of the duplicate.
+func (p *Plan) check(a Action) (os.FileInfo, error) {
+	var orig os.FileInfo
+	for _, path := range []string{a.Keep, a.Replace} {
+		cur, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if scanned, ok := p.files[path]; ok {
+			if !cur.Mode().IsRegular() || cur.Size() != scanned.Size() || !cur.ModTime().Equal(scanned.ModTime()) {
+				return nil, fmt.Errorf("%s changed since the scan", path)
+			}
+		}
+		orig = cur
+	}
+	if err := actions.SameContent(a.Replace, a.Keep); err != nil {
+		return nil, err
+	}
+	return orig, nil
+}
+
+// replace atomically replaces dst with a link to src created next to it. If t is not nil, dst is moved to the trash
+// once the link is created, and its path in the trash returned.
+func replace(src, dst string, method Method, t *trash.Trash) (string, error) {
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.octopus-%d", filepath.Base(dst), time.Now().UnixNano()))
+
+	var err error
+	switch method {
+	case Hardlink:
+		err = os.Link(src, tmp)
+	case Reflink:
+		err = filecopy.Clone(src, tmp)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var trashed string
+	if t != nil {
+		if trashed, err = t.Put(dst, "dedupe "+string(method), true); err != nil {
+			_ = os.Remove(tmp)
+			return "", err
+		}
+	}
+
+	if err = os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return trashed, err
+	}
+
+	return trashed, nil
+}
+
+// Rollback reverts the replacements recorded in the rollback log at logPath.
+// Every hard-linked duplicate is turned back into an independent file with its original mode and modification time.
+// Reflinked duplicates are already independent files and only get their mode and modification time restored.
+// Every reverted duplicate is recorded in the audit log if one is provided.
+func Rollback(logPath string, auditLog *audit.Log) error {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return fmt.Errorf("open rollback log %s: %w", logPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []rollbackEntry
+	r := bufio.NewReader(f)
+	for {
+		line, e := r.ReadBytes('\n')
+		if len(line) > 0 && e == nil {
+			var entry rollbackEntry
+			if e = json.Unmarshal(line, &entry); e != nil {
+				return fmt.Errorf("read rollback log %s: %w", logPath, e)
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		if errors.Is(e, io.EOF) {
+			break
+		}
+		if e != nil {
+			return fmt.Errorf("read rollback log %s: %w", logPath, e)
+		}
+	}
+
+	// Revert in reverse order, so the most recent replacements are undone first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := unlink(entries[i]); e != nil {
+			err = errors.Join(err, fmt.Errorf("rollback %s: %w", entries[i].Replace, e))
+			continue
+		}
+
+		if e := auditLog.Record(audit.Modify, entries[i].Replace, "", "dedupe rollback"); e != nil {
+			return errors.Join(err, e)
+		}
+	}
+
+	return err
+}
+
+// unlink turns the replaced duplicate back into an independent file.
+func unlink(entry rollbackEntry) error {
+	dst := entry.Replace
+
+	keep, err := os.Stat(entry.Keep)
+	if err != nil {
+		return err
+	}
+	cur, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+
+	// Both files were just stated, so their metadata tell whether they are still linked.
+	if entry.Method == Hardlink && os.SameFile(keep, cur) {
+		in, err := os.Open(dst)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = in.Close() }()
+
+		out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".octopus-*")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(out.Name()) }()
+
+		if _, err = io.Copy(out, in); err != nil {
+			_ = out.Close()
+			return err
+		}
+		if err = out.Close(); err != nil {
+			return err
+		}
+		if err = os.Rename(out.Name(), dst); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Chmod(dst, os.FileMode(entry.Mode).Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, entry.ModTime, entry.ModTime)
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package dedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+// device returns the ID of the device the file resides on.
+func device(fi os.FileInfo) (uint64, bool) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), true
+	}
+	return 0, false
+}
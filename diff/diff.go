@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gromey/octopus/dirreader"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the octopus.diff spans of CompareContext with the global tracer provider, see otel.SetTracerProvider.
+var tracer = otel.Tracer("github.com/gromey/octopus/diff")
+
+// Op represents the kind of change detected for a file.
+type Op string
+
+const (
+	Added    Op = "added"    // The file exists only in the new result.
+	Removed  Op = "removed"  // The file exists only in the old result.
+	Modified Op = "modified" // The file exists in both results but its content or metadata differ.
+)
+
+// Change represents a single difference between two scan results.
+type Change struct {
+	Op   Op                  `json:"op"`            // Kind of the change.
+	Path string              `json:"path"`          // Relative path of the file, including its name.
+	Old  *dirreader.FileInfo `json:"old,omitempty"` // File from the old result, nil for added files.
+	New  *dirreader.FileInfo `json:"new,omitempty"` // File from the new result, nil for removed files.
+}
+
+// Compare compares two scan results by relative path and returns the changes sorted by path.
+// A file is considered modified if its hash differs when both results have hashes,
+// otherwise if its size or modification time differs.
+func Compare(old, new []dirreader.FileInfo) []Change {
+	oldByPath := make(map[string]*dirreader.FileInfo, len(old))
+	for i := range old {
+		oldByPath[old[i].RelPath()] = &old[i]
+	}
+
+	var changes []Change
+	seen := make(map[string]bool, len(new))
+	for i := range new {
+		path := new[i].RelPath()
+		seen[path] = true
+
+		o, ok := oldByPath[path]
+		if !ok {
+			changes = append(changes, Change{Op: Added, Path: path, New: &new[i]})
+			continue
+		}
+
+		if Changed(*o, new[i]) {
+			changes = append(changes, Change{Op: Modified, Path: path, Old: o, New: &new[i]})
+		}
+	}
+
+	for path, o := range oldByPath {
+		if !seen[path] {
+			changes = append(changes, Change{Op: Removed, Path: path, Old: o})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes
+}
+
+// CompareContext is Compare recorded as an octopus.diff span, child of the span of the context.
+func CompareContext(ctx context.Context, old, new []dirreader.FileInfo) []Change {
+	_, span := tracer.Start(ctx, "octopus.diff", trace.WithAttributes(attribute.Int("octopus.old_files", len(old)), attribute.Int("octopus.new_files", len(new))))
+	defer span.End()
+
+	changes := Compare(old, new)
+	span.SetAttributes(attribute.Int("octopus.changes", len(changes)))
+	return changes
+}
+
+// Changed reports whether two versions of the same file differ.
+// Hashes are compared when both files have them, otherwise sizes and modification times are compared.
+// Quick hashes, see dirreader.WithQuickHash, are compared first when both files have them: different
+// quick hashes prove a change, while equal ones are not enough to prove the content is the same.
+func Changed(old, new dirreader.FileInfo) bool {
+	if old.Hash != "" && new.Hash != "" {
+		return old.Hash != new.Hash
+	}
+	if old.QuickHash != "" && new.QuickHash != "" && old.QuickHash != new.QuickHash {
+		return true
+	}
+	return old.Size() != new.Size() || !old.ModTime().Equal(new.ModTime())
+}
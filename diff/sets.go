@@ -0,0 +1,80 @@
+package diff
+
+import (
+	"sort"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Key returns the key files are matched by in set operations, or "" if the file cannot be matched.
+type Key func(fi dirreader.FileInfo) string
+
+// ByPath matches files by their relative path, as Compare does.
+func ByPath(fi dirreader.FileInfo) string {
+	return fi.RelPath()
+}
+
+// ByHash matches files by their content hash, wherever they are. Files without a hash never match.
+func ByHash(fi dirreader.FileInfo) string {
+	return fi.Hash
+}
+
+// Union returns the files of a, followed by the files of b whose key is not in a, sorted by relative path.
+func Union(a, b []dirreader.FileInfo, key Key) []dirreader.FileInfo {
+	inA := keys(a, key)
+
+	res := append([]dirreader.FileInfo(nil), a...)
+	for _, fi := range b {
+		if k := key(fi); k == "" || !inA[k] {
+			res = append(res, fi)
+		}
+	}
+
+	return sorted(res)
+}
+
+// Intersect returns the files of a whose key is also in b, sorted by relative path.
+func Intersect(a, b []dirreader.FileInfo, key Key) []dirreader.FileInfo {
+	inB := keys(b, key)
+
+	var res []dirreader.FileInfo
+	for _, fi := range a {
+		if k := key(fi); k != "" && inB[k] {
+			res = append(res, fi)
+		}
+	}
+
+	return sorted(res)
+}
+
+// Except returns the files of a whose key is not in b, sorted by relative path:
+// with ByPath the files that exist in a but not in b, with ByHash the content of a missing from b.
+func Except(a, b []dirreader.FileInfo, key Key) []dirreader.FileInfo {
+	inB := keys(b, key)
+
+	var res []dirreader.FileInfo
+	for _, fi := range a {
+		if k := key(fi); k == "" || !inB[k] {
+			res = append(res, fi)
+		}
+	}
+
+	return sorted(res)
+}
+
+// keys returns the set of the keys of the files.
+func keys(files []dirreader.FileInfo, key Key) map[string]bool {
+	set := make(map[string]bool, len(files))
+	for _, fi := range files {
+		if k := key(fi); k != "" {
+			set[k] = true
+		}
+	}
+	return set
+}
+
+// sorted sorts the files by relative path and returns them.
+func sorted(files []dirreader.FileInfo) []dirreader.FileInfo {
+	sort.SliceStable(files, func(i, j int) bool { return files[i].RelPath() < files[j].RelPath() })
+	return files
+}
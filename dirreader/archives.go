@@ -0,0 +1,71 @@
+package dirreader
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gromey/octopus/archive"
+)
+
+// errStopped stops walking an archive when the scan must stop.
+var errStopped = errors.New("scan stopped")
+
+// isArchive reports whether the file with the name is an archive to read the files of, see WithArchives.
+func (r *dirReader) isArchive(name string) bool {
+	return r.archives && archive.Format(name) != ""
+}
+
+// readArchive reads the files stored in the file, if it is an archive to read, as the files of a directory
+// named after the archive followed by archive.Separator.
+func (r *dirReader) readArchive(abs, rel string, file os.FileInfo) {
+	if !r.isArchive(file.Name()) {
+		return
+	}
+
+	dirAbs := abs + archive.Separator
+	dirRel := filepath.Join(rel, file.Name()) + archive.Separator
+
+	err := archive.Walk(abs, func(e archive.Entry, content io.Reader) error {
+		if r.stopped() {
+			return errStopped
+		}
+
+		dir, name := path.Split(e.Path)
+		fi := FileInfo{
+			FileInfo: e.Info,
+			PathAbs:  filepath.Join(dirAbs, filepath.FromSlash(e.Path)),
+			PathRel:  filepath.Join(dirRel, filepath.FromSlash(dir)),
+		}
+
+		if r.skipHidden && hidden(e.Info) {
+			return nil
+		}
+		if r.include != r.includedInMask(fi.PathRel, name) {
+			return nil
+		}
+		if r.filter != nil {
+			keep, err := r.filter(fi)
+			if err != nil {
+				r.errorChan <- &ScanError{Op: OpFilter, Path: fi.PathAbs, Err: err}
+			}
+			if !keep {
+				return nil
+			}
+		}
+
+		if r.hashContent() || r.sniff || r.lines {
+			if err := r.readFrom(&fi, content); err != nil {
+				r.errorChan <- &ScanError{Op: OpHash, Path: fi.PathAbs, Err: err}
+			}
+		}
+
+		r.fileChan <- fi
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopped) {
+		r.errorChan <- &ScanError{Op: OpArchive, Path: abs, Err: err}
+	}
+}
@@ -0,0 +1,102 @@
+package dirreader
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Support represents whether a kind of metadata is available on the platform and filesystem of a root,
+// and whether a scan collected it.
+type Support string
+
+const (
+	Authoritative Support = "authoritative" // Collected by the scan: an empty value means the file has none.
+	Available     Support = "available"     // Supported, but not collected by the scan.
+	Unavailable   Support = "unavailable"   // Not supported: an empty value says nothing about the file.
+)
+
+// rank orders the supports from the least to the most informative, see Capabilities.merge.
+func (s Support) rank() int {
+	switch s {
+	case Unavailable:
+		return 1
+	case Available:
+		return 2
+	case Authoritative:
+		return 3
+	}
+	return 0
+}
+
+// Capabilities represents the metadata a root supports, and that a scan of the root collected, so that
+// zero values of unsupported fields are not mistaken for files without the metadata.
+type Capabilities struct {
+	Owner     Support `json:"owner"`     // FileInfo.Owner.
+	Inode     Support `json:"inode"`     // FileInfo.Dev and FileInfo.Ino, and the nlink attribute.
+	Xattrs    Support `json:"xattrs"`    // FileInfo.Xattrs, see WithXattrs.
+	BirthTime Support `json:"birthTime"` // Creation time of the files, not collected by scans.
+	ACLs      Support `json:"acls"`      // Access control lists beyond the permission bits, not collected by scans.
+	Reflinks  Support `json:"reflinks"`  // Copies sharing the extents of their source, used by sync, not a metadata of files.
+}
+
+// Probe detects the metadata supported by the platform and the filesystem of root, without writing to it.
+// Owners and inode numbers are reported as Authoritative where supported, as scans always collect them, the other
+// kinds of metadata as Available. A kind of metadata that cannot be probed is reported Unavailable.
+func Probe(root string) (Capabilities, error) {
+	c := Capabilities{
+		Owner:     Unavailable,
+		Inode:     Unavailable,
+		Xattrs:    Unavailable,
+		BirthTime: Unavailable,
+		ACLs:      Unavailable,
+		Reflinks:  Unavailable,
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return c, err
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		return c, err
+	}
+	if owner, _ := sysInfo(info); owner != nil {
+		c.Owner = Authoritative
+	}
+	if _, _, _, ok := inode(info); ok {
+		c.Inode = Authoritative
+	}
+	probeFS(root, &c)
+
+	return c, nil
+}
+
+// capabilities returns the capabilities of the root of the scan, with the extended attributes Authoritative if
+// the scan collects them. Trees read from an fs.FS support none.
+func (r *dirReader) capabilities() Capabilities {
+	if r.fsys != nil {
+		return Capabilities{Unavailable, Unavailable, Unavailable, Unavailable, Unavailable, Unavailable}
+	}
+	c, _ := Probe(r.root)
+	if r.xattrs && c.Xattrs == Available {
+		c.Xattrs = Authoritative
+	}
+	return c
+}
+
+// merge combines the capabilities of another root into c, keeping the least informative support of each kind,
+// as the files of both roots are scanned together.
+func (c *Capabilities) merge(o Capabilities) {
+	for _, p := range []struct{ dst, src *Support }{
+		{&c.Owner, &o.Owner},
+		{&c.Inode, &o.Inode},
+		{&c.Xattrs, &o.Xattrs},
+		{&c.BirthTime, &o.BirthTime},
+		{&c.ACLs, &o.ACLs},
+		{&c.Reflinks, &o.Reflinks},
+	} {
+		if *p.src != "" && (*p.dst == "" || p.src.rank() < p.dst.rank()) {
+			*p.dst = *p.src
+		}
+	}
+}
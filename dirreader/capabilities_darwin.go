@@ -0,0 +1,22 @@
+package dirreader
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+// probeFS detects the extended attributes of the filesystem of root, and reflinks, the clones of APFS.
+// Birth times and ACLs are supported by all the filesystems of macOS.
+func probeFS(root string, c *Capabilities) {
+	if _, err := unix.Llistxattr(root, nil); !unsupported(err) {
+		c.Xattrs = Available
+	}
+	c.BirthTime = Available
+	c.ACLs = Available
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err == nil && string(bytes.TrimRight(st.Fstypename[:], "\x00")) == "apfs" {
+		c.Reflinks = Available
+	}
+}
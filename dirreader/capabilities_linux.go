@@ -0,0 +1,32 @@
+package dirreader
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// probeFS detects the extended attributes, birth times, POSIX ACLs and reflinks of the filesystem of root.
+// Reflinks are reported for Btrfs, XFS and bcachefs, although XFS filesystems may be formatted without them.
+func probeFS(root string, c *Capabilities) {
+	if _, err := unix.Llistxattr(root, nil); !unsupported(err) {
+		c.Xattrs = Available
+	}
+
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, root, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stx); err == nil && stx.Mask&unix.STATX_BTIME != 0 {
+		c.BirthTime = Available
+	}
+
+	if _, err := unix.Lgetxattr(root, "system.posix_acl_access", nil); err == nil || errors.Is(err, unix.ENODATA) {
+		c.ACLs = Available
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err == nil {
+		switch uint32(st.Type) {
+		case unix.BTRFS_SUPER_MAGIC, unix.XFS_SUPER_MAGIC, unix.BCACHEFS_SUPER_MAGIC:
+			c.Reflinks = Available
+		}
+	}
+}
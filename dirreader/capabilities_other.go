@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !windows
+
+package dirreader
+
+// probeFS leaves the extended attributes, birth times, ACLs and reflinks unavailable on other platforms,
+// where they are not probed.
+func probeFS(string, *Capabilities) {}
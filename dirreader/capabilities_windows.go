@@ -0,0 +1,31 @@
+package dirreader
+
+import "golang.org/x/sys/windows"
+
+// fileSupportsBlockRefcounting is the flag of the volumes supporting block cloning, such as ReFS.
+const fileSupportsBlockRefcounting = 0x08000000
+
+// probeFS detects the ACLs and the block cloning of the volume of root from its flags.
+// Birth times, the creation times of the files, are supported by all the filesystems of Windows.
+func probeFS(root string, c *Capabilities) {
+	c.BirthTime = Available
+
+	path, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return
+	}
+	vol := make([]uint16, windows.MAX_PATH+1)
+	if err = windows.GetVolumePathName(path, &vol[0], uint32(len(vol))); err != nil {
+		return
+	}
+	var flags uint32
+	if err = windows.GetVolumeInformation(&vol[0], nil, 0, nil, nil, &flags, nil, 0); err != nil {
+		return
+	}
+	if flags&windows.FILE_PERSISTENT_ACLS != 0 {
+		c.ACLs = Available
+	}
+	if flags&fileSupportsBlockRefcounting != 0 {
+		c.Reflinks = Available
+	}
+}
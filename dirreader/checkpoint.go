@@ -0,0 +1,173 @@
+package dirreader
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultCheckpointInterval is the interval between checkpoints when none is provided, see WithCheckpoint.
+const defaultCheckpointInterval = time.Minute
+
+// checkpoint holds the files read by a previous, interrupted scan and saves the progress of the current one,
+// see WithCheckpoint.
+type checkpoint struct {
+	Settings string     `json:"settings"` // Digest of the settings affecting the content read, so other scans never reuse it.
+	Files    []FileInfo `json:"files"`    // Files read so far.
+	path     string
+	interval time.Duration
+	resume   map[string]FileInfo // Files of the previous scan, by absolute path.
+}
+
+// openCheckpoint reads the checkpoint at the path of the reader, if any.
+// A checkpoint saved with other settings is ignored. A nil checkpoint is returned if checkpoints are disabled;
+// its methods do nothing.
+func (r *dirReader) openCheckpoint() (*checkpoint, error) {
+	if r.cpPath == "" {
+		return nil, nil
+	}
+
+	cp := &checkpoint{Settings: r.contentSettings(), path: r.cpPath, interval: r.cpInterval}
+	if cp.interval <= 0 {
+		cp.interval = defaultCheckpointInterval
+	}
+
+	data, err := os.ReadFile(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", cp.path, err)
+	}
+
+	var saved checkpoint
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", cp.path, err)
+	}
+	if saved.Settings == cp.Settings {
+		cp.resume = make(map[string]FileInfo, len(saved.Files))
+		for _, fi := range saved.Files {
+			if r.hashed(fi) {
+				cp.resume[fi.PathAbs] = fi
+			}
+		}
+	}
+
+	return cp, nil
+}
+
+// contentSettings returns a digest of the settings affecting the content read from the files.
+// The hash function is identified by the hash of no data, which also tells HMAC keys apart.
+func (r *dirReader) contentSettings() string {
+	var sum string
+	if r.hashFunc != nil {
+		sum = hex.EncodeToString(r.hashFunc().Sum(nil))
+	}
+	return fmt.Sprintf("hash=%s quick=%d sniff=%t lines=%t", sum, r.quickHash, r.sniff, r.lines)
+}
+
+// hashed reports whether the file of an earlier scan carries the hash the scan computes, if any: the files whose
+// content could not be read have none, and must be read again.
+func (r *dirReader) hashed(fi FileInfo) bool {
+	switch {
+	case r.hashContent():
+		return fi.Hash != ""
+	case r.hashFunc != nil:
+		return fi.QuickHash != ""
+	}
+	return true
+}
+
+// ticker returns a channel receiving a value at every checkpoint interval, and a function stopping it.
+// The channel is nil, and never receives, if checkpoints are disabled.
+func (cp *checkpoint) ticker() (<-chan time.Time, func()) {
+	if cp == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(cp.interval)
+	return t.C, t.Stop
+}
+
+// restore copies the content read by the previous scan to the file if it is unchanged since,
+// and reports whether it did.
+func (cp *checkpoint) restore(fi *FileInfo) bool {
+	if cp == nil {
+		return false
+	}
+	prev, ok := cp.resume[fi.PathAbs]
+	return ok && reuseContent(fi, prev)
+}
+
+// reuseContent copies the content read from prev, the same file in an earlier scan, to the file
+// if it is unchanged since, by size and modification time, and reports whether it did.
+func reuseContent(fi *FileInfo, prev FileInfo) bool {
+	if prev.FileInfo == nil || prev.Size() != fi.Size() || !prev.ModTime().Equal(fi.ModTime()) {
+		return false
+	}
+
+	fi.Hash, fi.QuickHash, fi.ContentType, fi.IsBinary, fi.LineCount = prev.Hash, prev.QuickHash, prev.ContentType, prev.IsBinary, prev.LineCount
+
+	return true
+}
+
+// save records the files read so far, along with the files of the previous scan not read again yet.
+// The files whose content could not be read are left out, so that resuming the scan reads them again.
+// The file is replaced atomically, so an interruption never leaves a partial checkpoint behind.
+func (cp *checkpoint) save(files []FileInfo) error {
+	if cp == nil {
+		return nil
+	}
+
+	read := make(map[string]bool, len(files))
+	cp.Files = make([]FileInfo, 0, len(files)+len(cp.resume))
+	for _, fi := range files {
+		read[fi.PathAbs] = true
+		if !fi.unread {
+			cp.Files = append(cp.Files, fi)
+		}
+	}
+	for p, fi := range cp.resume {
+		if !read[p] {
+			cp.Files = append(cp.Files, fi)
+		}
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("save checkpoint %s: %w", cp.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.path, err)
+	}
+	if err = os.Rename(tmp.Name(), cp.path); err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.path, err)
+	}
+
+	return nil
+}
+
+// remove deletes the checkpoint once the scan is complete.
+func (cp *checkpoint) remove() error {
+	if cp == nil {
+		return nil
+	}
+	if err := os.Remove(cp.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint %s: %w", cp.path, err)
+	}
+	return nil
+}
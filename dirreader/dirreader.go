@@ -1,23 +1,53 @@
 package dirreader
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"hash"
 	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gromey/octopus/encryption"
+	"github.com/gromey/octopus/throttle"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // FileInfo represents file information including its absolute and relative paths, and the file's hash.
 type FileInfo struct {
-	os.FileInfo        // Embedding the standard FileInfo struct from the os package.
-	PathAbs     string // Absolute path of the file.
-	PathRel     string // Relative path of the file with respect to the root.
-	Hash        string // Hash of the file's content (optional).
+	os.FileInfo `json:"-"`        // Embedding the standard FileInfo struct from the os package.
+	PathAbs     string            `json:"pathAbs"`               // Absolute path of the file.
+	PathRel     string            `json:"pathRel"`               // Relative path of the file with respect to the root.
+	Root        string            `json:"root,omitempty"`        // Root the file was found under, set by ExecMulti (optional).
+	Hash        string            `json:"hash,omitempty"`        // Hash of the file's content (optional).
+	QuickHash   string            `json:"quickHash,omitempty"`   // Hash of the file's size and ends, collected with WithQuickHash (optional).
+	Meta        map[string]string `json:"meta,omitempty"`        // Labels attached to the file by enrichment stages (optional).
+	Owner       *Owner            `json:"owner,omitempty"`       // Owner of the file, nil where the platform does not expose it.
+	Attrs       map[string]string `json:"attrs,omitempty"`       // Platform-specific attributes, e.g. inode and link count on Unix.
+	Dev         uint64            `json:"dev,omitempty"`         // ID of the device the file resides on, 0 where the platform does not expose it.
+	Ino         uint64            `json:"ino,omitempty"`         // Inode number of the file, 0 where the platform does not expose it.
+	Xattrs      map[string][]byte `json:"xattrs,omitempty"`      // Extended attributes, collected with WithXattrs (optional).
+	ContentType string            `json:"contentType,omitempty"` // MIME type sniffed from the content, collected with WithContentType (optional).
+	IsBinary    bool              `json:"isBinary,omitempty"`    // Whether the file is binary, collected with WithLineCount (optional).
+	LineCount   int64             `json:"lineCount,omitempty"`   // Number of lines of a text file, collected with WithLineCount (optional).
+	Encrypted   bool              `json:"encrypted,omitempty"`   // Whether the file is encrypted or password-protected, collected with WithEncryption (optional).
+
+	unread bool // Whether reading the content of the file failed, so that checkpoints leave it out.
+}
+
+// RelPath returns the path of the file relative to the root, including the file name.
+func (fi FileInfo) RelPath() string {
+	return filepath.Join(fi.PathRel, fi.Name())
 }
 
 // Exec initializes a dirReader and starts reading files from the provided root directory.
@@ -26,7 +56,14 @@ type FileInfo struct {
 //   - hashFunc: function to compute a hash for file contents (can be nil if not needed).
 //   - mask: list of file extensions to include or exclude based on the 'include' flag.
 //   - include: if true, only include files matching the mask; if false, exclude them.
-func Exec(root string, hashFunc func() hash.Hash, mask []string, include bool) ([]FileInfo, error) {
+//   - opts: optional settings, see the With functions.
+func Exec(root string, hashFunc func() hash.Hash, mask []string, include bool, opts ...Option) ([]FileInfo, error) {
+	r := newDirReader(root, hashFunc, mask, include, opts)
+	return r.readDirectoryConcurrent(r.readRoot)
+}
+
+// newDirReader returns a dirReader for the root with the provided settings, see Exec.
+func newDirReader(root string, hashFunc func() hash.Hash, mask []string, include bool, opts []Option) *dirReader {
 	r := &dirReader{
 		fileChan:  make(chan FileInfo),
 		errorChan: make(chan error),
@@ -41,49 +78,170 @@ func Exec(root string, hashFunc func() hash.Hash, mask []string, include bool) (
 		r.include = false
 	}
 
-	return r.readDirectoryConcurrent()
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	// The features reading the operating system directly do not apply to an fs.FS.
+	if r.fsys != nil {
+		r.xattrs, r.encryption, r.oneFS, r.index, r.archives = false, false, false, false, false
+	}
+
+	// Lower the mask once for case-insensitive matching, without modifying the caller's slice.
+	if r.maskFold {
+		r.mask = make([]string, len(mask))
+		for i, m := range mask {
+			r.mask[i] = strings.ToLower(m)
+		}
+	}
+
+	return r
 }
 
 // dirReader holds the state for reading directories and files.
 type dirReader struct {
-	swg       sync.WaitGroup
-	wg        sync.WaitGroup
-	fileChan  chan FileInfo
-	errorChan chan error
-	hashFunc  func() hash.Hash
-	mask      []string
-	root      string
-	include   bool
-}
-
-// readDirectoryConcurrent reads the root directory concurrently and returns a list of FileInfo.
-// It spawns goroutines to read files and collect results/errors.
-func (r *dirReader) readDirectoryConcurrent() ([]FileInfo, error) {
+	swg        sync.WaitGroup
+	wg         sync.WaitGroup
+	fileChan   chan FileInfo
+	errorChan  chan error
+	hashFunc   func() hash.Hash
+	mask       []string
+	root       string
+	include    bool
+	stats      *Stats              // Statistics to fill during the scan (optional).
+	xattrs     bool                // Whether to read the extended attributes of the files.
+	sniff      bool                // Whether to detect the content type of the files.
+	lines      bool                // Whether to classify the files as text or binary and count the lines of text files.
+	skipHidden bool                // Whether to skip hidden files and directories.
+	maskFold   bool                // Whether the mask is matched case-insensitively.
+	maskPath   bool                // Whether the mask is matched against the relative path instead of the name.
+	encryption bool                // Whether to detect encrypted files.
+	oneFS      bool                // Whether to stay on the filesystem of the root.
+	boundary   *fsBoundary         // Filesystem of the root, set when oneFS is enabled.
+	inodeOnce  bool                // Whether to read the content of hard-linked files once per inode.
+	index      bool                // Whether to list the files from a file index of the operating system when available.
+	quickHash  int64               // Number of bytes hashed at each end of the files instead of their whole content, if positive.
+	cp         *checkpoint         // Progress of the scan, when checkpoints are enabled.
+	cpPath     string              // Path of the checkpoint file, empty if checkpoints are disabled.
+	cpInterval time.Duration       // Interval between checkpoints.
+	limit      *throttle.Limiter   // Throttles the reads of the content of the files (optional).
+	filter     Filter              // Selects the files to read and return (optional).
+	order      Order               // Order the files are read in.
+	queue      []queuedFile        // Files listed and waiting to be read, when an order is set.
+	queueMu    sync.Mutex          // Protects queue.
+	inodes     sync.Map            // Content read once per inode, by inodeKey, when inodeOnce is enabled.
+	dirs       int64               // Number of directories read, updated atomically.
+	dirMu      sync.Mutex          // Protects dirContent.
+	dirContent map[string]bool     // Whether the directories read hold entries besides the subdirectories read, see recordDir.
+	err        error               // Error of an option, returned before reading.
+	ctx        context.Context     // Stops the scan when done (optional).
+	maxFiles   int                 // Number of files after which the scan stops, unlimited if not positive.
+	maxBytes   int64               // Number of bytes after which the scan stops, unlimited if not positive.
+	maxErrors  int                 // Number of errors after which the scan stops, unlimited if not positive.
+	limited    int32               // Whether a limit was reached, updated atomically.
+	skipDenied bool                // Whether to skip the paths access is denied to instead of failing.
+	skipped    []string            // Paths skipped because access was denied, when skipDenied is enabled.
+	archives   bool                // Whether to read the files stored in archives, see WithArchives.
+	fsys       fs.FS               // Filesystem the tree is read from instead of the operating system, see WithFS (optional).
+	prev       map[string]FileInfo // Files of a previous scan whose content is reused, by absolute path, see WithPrevious.
+	log        *slog.Logger        // Logs the failures, skips and phases of the scan, see WithLogger (optional).
+}
+
+// readDirectoryConcurrent starts read, which reads the directories and files concurrently, and returns a list of FileInfo.
+// It spawns goroutines to read files and collect results/errors. read must call r.wg.Done when it returns.
+func (r *dirReader) readDirectoryConcurrent(read func()) ([]FileInfo, error) {
 	var fileInfos []FileInfo
 	var err error
 
-	// Goroutine to collect FileInfo results.
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.cp, err = r.openCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	if r.oneFS {
+		if r.boundary, err = newFSBoundary(r.root); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	ctx, span := r.startSpan(nil, "octopus.scan", attribute.String("octopus.root", r.root))
+	if r.stats != nil {
+		r.stats.reset()
+		r.stats.Capabilities = r.capabilities()
+	}
+
+	// Goroutine to collect FileInfo results, saving them at every checkpoint.
+	var cpErr error
+	var total int64 // Number of bytes of the collected files.
 	r.swg.Add(1)
 	go func() {
-		for fi := range r.fileChan {
-			fileInfos = append(fileInfos, fi)
+		defer r.swg.Done()
+
+		tick, stop := r.cp.ticker()
+		defer stop()
+
+		for {
+			select {
+			case fi, ok := <-r.fileChan:
+				if !ok {
+					return
+				}
+				// Drop the files still in progress when a limit was reached.
+				if r.limitReached() {
+					continue
+				}
+				fileInfos = append(fileInfos, fi)
+				if r.stats != nil {
+					r.stats.add(fi)
+				}
+				if fi.FileInfo != nil {
+					total += fi.Size()
+				}
+				if (r.maxFiles > 0 && len(fileInfos) >= r.maxFiles) || (r.maxBytes > 0 && total >= r.maxBytes) {
+					atomic.StoreInt32(&r.limited, 1)
+				}
+			case <-tick:
+				cpErr = r.cp.save(fileInfos)
+			}
 		}
-		r.swg.Done()
 	}()
 
 	// Goroutine to collect and aggregate errors.
+	var n int // Number of failures.
 	r.swg.Add(1)
 	go func() {
 		for e := range r.errorChan {
+			if r.denied(e) {
+				r.skipped = append(r.skipped, failurePath(e))
+				r.logSkip(failurePath(e), "access denied")
+				continue
+			}
+			r.logFailure(e)
 			err = errors.Join(err, e)
+			if n++; r.maxErrors > 0 && n >= r.maxErrors {
+				atomic.StoreInt32(&r.limited, 1)
+			}
 		}
 		r.swg.Done()
 	}()
 
-	// Start reading the root directory.
+	_, walk := r.startSpan(ctx, "octopus.traversal")
 	r.wg.Add(1)
-	go r.readDirectory(r.root, "")
+	go read()
 	r.wg.Wait() // Wait for all directory and file processing to complete.
+	walk.End()
+	r.logPhase("walk", start)
+	if r.order != Unordered {
+		queued := time.Now()
+		_, hashing := r.startSpan(ctx, "octopus.hash", attribute.Int("octopus.files", len(r.queue)))
+		r.readQueued()
+		hashing.End()
+		r.logPhase("read queued files", queued)
+	}
 
 	// Close the channels after processing is done.
 	close(r.fileChan)
@@ -91,49 +249,114 @@ func (r *dirReader) readDirectoryConcurrent() ([]FileInfo, error) {
 
 	r.swg.Wait() // Wait for result/error collection to finish.
 
+	if r.canceled() {
+		err = errors.Join(err, r.ctx.Err())
+	}
+	limited := r.limitReached()
+	if limited {
+		if err == nil {
+			err = ErrLimitReached
+		} else {
+			err = errors.Join(err, ErrLimitReached)
+		}
+	}
+
+	// Keep the checkpoint of a scan with errors, so that running it again only reads the files that failed.
 	if err != nil {
+		cpErr = r.cp.save(fileInfos)
+	} else if cpErr == nil {
+		cpErr = r.cp.remove()
+	}
+	if cpErr != nil {
+		err = errors.Join(err, cpErr)
+	}
+
+	if r.stats != nil {
+		r.stats.Dirs = int(atomic.LoadInt64(&r.dirs))
+		r.stats.Elapsed = time.Since(start)
+		r.stats.Skipped = r.skipped
+		if !limited {
+			r.stats.EmptyDirs = r.emptyDirs(fileInfos)
+		}
+		r.stats.finish()
+	}
+
+	span.SetAttributes(attribute.Int("octopus.files", len(fileInfos)), attribute.Int64("octopus.bytes", total),
+		attribute.Int64("octopus.dirs", atomic.LoadInt64(&r.dirs)), attribute.Int("octopus.failures", n))
+	endSpan(span, err)
+	if r.log != nil {
+		r.log.Info("scan finished", "root", r.root, "files", len(fileInfos), "dirs", atomic.LoadInt64(&r.dirs),
+			"failures", n, "skipped", len(r.skipped), "limited", limited, "elapsed", time.Since(start))
+	}
+
+	// The files collected until a limit was reached are returned along with the error.
+	if err != nil && !limited {
 		return nil, err
 	}
 
-	return fileInfos, nil
+	return fileInfos, err
+}
+
+// readRoot reads the root directory, or the files listed by an index, see WithIndex.
+func (r *dirReader) readRoot() {
+	if root, entries, ok := r.indexed(); ok {
+		r.readIndexed(root, entries)
+		return
+	}
+	r.readDirectory(r.root, "")
 }
 
 // readDirectory reads the contents of a directory and processes its files and subdirectories.
 func (r *dirReader) readDirectory(root, rel string) {
 	defer r.wg.Done() // Ensure the WaitGroup is decremented when done.
 
-	dir, err := os.Open(root)
-	if err != nil {
-		r.errorChan <- fmt.Errorf("open %s: %w", root, err)
+	if r.stopped() {
 		return
 	}
-	defer func() { _ = dir.Close() }()
 
 	// Read all directory entries.
-	var files []os.FileInfo
-	if files, err = dir.Readdir(-1); err != nil {
-		r.errorChan <- fmt.Errorf("read dir %s: %w", root, err)
+	files, op, err := r.listDir(root)
+	if err != nil {
+		r.recordDir(rel, true)
+		r.errorChan <- &ScanError{Op: op, Path: root, Err: err}
 		return
 	}
 
 	// Iterate over all files and directories in the current directory.
+	content := false
+	defer func() { r.recordDir(rel, content) }()
 	for _, file := range files {
-		abs := filepath.Join(root, file.Name())
+		abs := r.join(root, file.Name())
+
+		if r.skipHidden && hidden(file) {
+			r.logSkip(abs, "hidden")
+			content = true
+			continue
+		}
 
 		if file.IsDir() {
+			// Do not descend into other filesystems mounted below the root.
+			if r.boundary != nil && r.boundary.crosses(filepath.Join(rel, file.Name()), file) {
+				r.logSkip(abs, "other filesystem")
+				content = true
+				continue
+			}
+
 			// If the entry is a directory, recursively read its contents.
 			r.wg.Add(1)
 			go r.readDirectory(abs, filepath.Join(rel, file.Name()))
 			continue
 		}
 
-		// Filter files based on the mask (include or exclude them).
-		if r.include != r.includedInMask(file.Name()) {
+		content = true
+
+		// Filter files based on the mask (include or exclude them), archives are read for their files in any case.
+		if r.include != r.includedInMask(rel, file.Name()) && !r.isArchive(file.Name()) {
 			continue
 		}
 
 		r.wg.Add(1)
-		go r.getFileInfo(abs, rel, file)
+		r.schedule(abs, rel, file)
 	}
 }
 
@@ -141,45 +364,255 @@ func (r *dirReader) readDirectory(root, rel string) {
 func (r *dirReader) getFileInfo(abs string, rel string, file os.FileInfo) {
 	defer r.wg.Done() // Ensure the WaitGroup is decremented when done.
 
+	if r.stopped() {
+		return
+	}
+
+	// Archives excluded by the mask are only read for the files they store.
+	if r.include != r.includedInMask(rel, file.Name()) {
+		r.readArchive(abs, rel, file)
+		return
+	}
+
 	fi := FileInfo{
 		FileInfo: file,
 		PathAbs:  abs,
 		PathRel:  rel,
 	}
+	fi.Owner, fi.Attrs = sysInfo(file)
+	dev, ino, nlink, hasInode := inode(file)
+	fi.Dev, fi.Ino = dev, ino
+
+	// Skip the files rejected by the filter before reading anything from them.
+	if r.filter != nil {
+		keep, err := r.filter(fi)
+		if err != nil {
+			r.errorChan <- &ScanError{Op: OpFilter, Path: fi.PathAbs, Err: err}
+		}
+		if !keep {
+			return
+		}
+	}
 
-	// If a hash function is provided, compute the file's hash.
-	if r.hashFunc != nil {
+	if r.xattrs {
 		var err error
-		if fi.Hash, err = r.computeHash(fi.PathAbs); err != nil {
-			r.errorChan <- fmt.Errorf("calculate hash sum %s: %w", fi.PathAbs, err)
+		if fi.Xattrs, err = readXattrs(fi.PathAbs); err != nil {
+			r.errorChan <- &ScanError{Op: OpXattrs, Path: fi.PathAbs, Err: err}
+			if r.denied(err) {
+				return
+			}
+		}
+	}
+
+	if r.encryption {
+		format, err := encryption.Detect(fi.PathAbs)
+		if err != nil {
+			r.errorChan <- &ScanError{Op: OpEncryption, Path: fi.PathAbs, Err: err}
+			if r.denied(err) {
+				return
+			}
+		}
+		fi.Encrypted = format != ""
+	}
+
+	// Reuse the content read by an interrupted or a previous scan if the file is unchanged since.
+	restored := r.cp.restore(&fi)
+	if prev, ok := r.prev[fi.PathAbs]; ok && !restored && r.hashed(prev) {
+		restored = reuseContent(&fi, prev)
+	}
+
+	if !restored && r.hashFunc != nil && r.quickHash > 0 {
+		if err := r.readQuickHash(&fi); err != nil {
+			fi.unread = true
+			r.errorChan <- &ScanError{Op: OpQuickHash, Path: fi.PathAbs, Err: err}
+			if r.denied(err) {
+				return
+			}
+		}
+	}
+
+	// If the content is hashed or the content type is requested, read the file's content.
+	if !restored && (r.hashContent() || r.sniff || r.lines) {
+		var err error
+		if r.inodeOnce && hasInode && nlink > 1 {
+			err = r.readContentOnce(&fi)
+		} else {
+			err = r.readContent(&fi)
+		}
+		if err != nil {
+			fi.unread = true
+			r.errorChan <- &ScanError{Op: OpHash, Path: fi.PathAbs, Err: err}
+			if r.denied(err) {
+				return
+			}
 		}
 	}
 
 	r.fileChan <- fi
+	r.readArchive(abs, rel, file)
+}
+
+// stopped reports whether the scan must stop, because its context is done or a limit was reached.
+func (r *dirReader) stopped() bool {
+	return r.canceled() || r.limitReached()
+}
+
+// limitReached reports whether a limit of the scan was reached, see WithLimit and WithMaxErrors.
+func (r *dirReader) limitReached() bool {
+	return atomic.LoadInt32(&r.limited) != 0
+}
+
+// canceled reports whether the context of the scan is done, see WithContext.
+func (r *dirReader) canceled() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+// throttled returns src throttled by the limit of the scan and the global limit, see WithRateLimit.
+func (r *dirReader) throttled(src io.Reader) io.Reader {
+	return throttle.Global().Reader(r.ctx, r.limit.Reader(r.ctx, src))
+}
+
+// logFailure logs a failure of the scan as a warning, with the operation and path of a ScanError as fields.
+func (r *dirReader) logFailure(err error) {
+	if r.log == nil {
+		return
+	}
+	var se *ScanError
+	if errors.As(err, &se) {
+		r.log.Warn("scan failure", "op", string(se.Op), "path", se.Path, "error", se.Err)
+		return
+	}
+	r.log.Warn("scan failure", "error", err)
+}
+
+// logSkip logs a path the scan skips, and why, at debug level.
+func (r *dirReader) logSkip(path, reason string) {
+	if r.log != nil {
+		r.log.Debug("skipped", "path", path, "reason", reason)
+	}
+}
+
+// logPhase logs the duration of a phase of the scan started at start, at debug level.
+func (r *dirReader) logPhase(phase string, start time.Time) {
+	if r.log != nil {
+		r.log.Debug("scan phase", "root", r.root, "phase", phase, "elapsed", time.Since(start))
+	}
+}
+
+// denied reports whether the file failing with err is skipped, see WithSkipPermissionErrors.
+func (r *dirReader) denied(err error) bool {
+	return r.skipDenied && errors.Is(err, fs.ErrPermission)
 }
 
 // includedInMask checks if the file name matches any of the provided extensions in the mask.
-func (r *dirReader) includedInMask(name string) bool {
-	for _, ext := range r.mask {
-		if strings.HasSuffix(name, ext) {
+// In path mode the mask is matched against the relative path of the file instead, see WithMaskPath.
+func (r *dirReader) includedInMask(rel, name string) bool {
+	subject := name
+	if r.maskPath {
+		subject = "/" + filepath.ToSlash(filepath.Join(rel, name))
+	}
+	if r.maskFold {
+		subject = strings.ToLower(subject)
+	}
+
+	for _, m := range r.mask {
+		if r.maskPath && strings.HasSuffix(m, "/") {
+			if strings.Contains(subject, m) {
+				return true
+			}
+			continue
+		}
+		if strings.HasSuffix(subject, m) {
 			return true
 		}
 	}
 	return false
 }
 
-// computeHash computes the hash of the file content using the provided hash function.
-func (r *dirReader) computeHash(filename string) (string, error) {
-	f, err := os.Open(filename)
+// sniffLen is the number of bytes used to detect the content type, see http.DetectContentType.
+const sniffLen = 512
+
+// executables are the signatures of the executable formats http.DetectContentType does not recognize.
+var executables = []struct {
+	magic       string
+	contentType string
+}{
+	{"\x7fELF", "application/x-elf"},
+	{"\xfe\xed\xfa\xce", "application/x-mach-binary"}, // 32-bit, big-endian.
+	{"\xfe\xed\xfa\xcf", "application/x-mach-binary"}, // 64-bit, big-endian.
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"}, // 32-bit, little-endian.
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"}, // 64-bit, little-endian.
+}
+
+// detectContentType returns the content type of the file starting with head, see http.DetectContentType,
+// recognizing executables as well.
+func detectContentType(head []byte) string {
+	for _, e := range executables {
+		if bytes.HasPrefix(head, []byte(e.magic)) {
+			return e.contentType
+		}
+	}
+	// A portable executable starts with a DOS header whose last field is the offset of the PE signature.
+	if bytes.HasPrefix(head, []byte("MZ")) && len(head) >= 0x40 {
+		if off := binary.LittleEndian.Uint32(head[0x3c:]); int64(off)+4 <= int64(len(head)) && string(head[off:off+4]) == "PE\x00\x00" {
+			return "application/vnd.microsoft.portable-executable"
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// readContent reads the file content once to compute its hash using the provided hash function,
+// to detect its content type and to count its lines, as requested.
+func (r *dirReader) readContent(fi *FileInfo) error {
+	f, err := r.open(fi.PathAbs)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer func() { _ = f.Close() }()
+	return r.readFrom(fi, f)
+}
+
+// readFrom reads the content of the file from src, computing its hash, content type and lines as requested.
+func (r *dirReader) readFrom(fi *FileInfo, src io.Reader) error {
+	src = r.throttled(src)
 
-	h := r.hashFunc()
-	if _, err = io.Copy(h, f); err != nil {
-		return "", err
+	var h hash.Hash
+	var lc *lineCounter
+	var writers []io.Writer
+	if r.hashContent() {
+		h = r.hashFunc()
+		writers = append(writers, h)
+	}
+	if r.lines {
+		lc = new(lineCounter)
+		writers = append(writers, lc)
+	}
+	w := io.MultiWriter(writers...)
+
+	if r.sniff {
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(src, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		fi.ContentType = detectContentType(head[:n])
+		_, _ = w.Write(head[:n])
+	}
+
+	if len(writers) == 0 {
+		return nil
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	if h != nil {
+		fi.Hash = hex.EncodeToString(h.Sum(nil))
+	}
+	if lc != nil {
+		fi.IsBinary, fi.LineCount = lc.result()
 	}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return nil
 }
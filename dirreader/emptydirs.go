@@ -0,0 +1,64 @@
+package dirreader
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EmptyDir represents a directory without any file returned by the scan, at any depth below it.
+type EmptyDir struct {
+	Path     string `json:"path"`     // Relative path of the directory.
+	PathAbs  string `json:"pathAbs"`  // Absolute path of the directory.
+	Filtered bool   `json:"filtered"` // Whether files are below the directory, all excluded by the mask, the filter or as hidden.
+}
+
+// recordDir records whether the directory at the relative path rel holds entries other than the subdirectories
+// the scan reads, see emptyDirs. It does nothing unless statistics are collected.
+func (r *dirReader) recordDir(rel string, content bool) {
+	if r.stats == nil {
+		return
+	}
+	r.dirMu.Lock()
+	defer r.dirMu.Unlock()
+	if r.dirContent == nil {
+		r.dirContent = make(map[string]bool)
+	}
+	r.dirContent[rel] = content
+}
+
+// emptyDirs returns the directories read below the root that hold no file of the scan, sorted by path, so that
+// a parent comes before its subdirectories. A directory holding files, or entries the scan did not read such as
+// hidden or unreadable directories, at any depth, is reported as Filtered.
+func (r *dirReader) emptyDirs(files []FileInfo) []EmptyDir {
+	used := make(map[string]bool)
+	for _, fi := range files {
+		for dir := fi.PathRel; dir != "" && !used[dir]; dir = parentDir(dir) {
+			used[dir] = true
+		}
+	}
+	content := make(map[string]bool)
+	for dir, c := range r.dirContent {
+		for ; c && dir != "" && !content[dir]; dir = parentDir(dir) {
+			content[dir] = true
+		}
+	}
+
+	var empty []EmptyDir
+	for dir := range r.dirContent {
+		if dir != "" && !used[dir] {
+			empty = append(empty, EmptyDir{Path: dir, PathAbs: r.join(r.root, dir), Filtered: content[dir]})
+		}
+	}
+	sort.Slice(empty, func(i, j int) bool { return empty[i].Path < empty[j].Path })
+	return empty
+}
+
+// parentDir returns the parent of the relative path of a directory, "" for the root.
+func parentDir(rel string) string {
+	i := strings.LastIndexAny(rel, "/"+string(filepath.Separator))
+	if i < 0 {
+		return ""
+	}
+	return rel[:i]
+}
@@ -0,0 +1,204 @@
+package dirreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Op represents the operation of a scan that failed, see ScanError.
+type Op string
+
+// Operations of a scan.
+const (
+	OpOpen       Op = "open"                     // Opening a directory.
+	OpReadDir    Op = "read dir"                 // Listing a directory.
+	OpStat       Op = "stat"                     // Reading the metadata of a file found in an index.
+	OpFilter     Op = "filter"                   // Running the filter of WithFilter.
+	OpXattrs     Op = "read extended attributes" // Reading the extended attributes of a file.
+	OpQuickHash  Op = "read quick hash"          // Hashing the head and tail of a file.
+	OpHash       Op = "read content"             // Reading the content of a file to hash, sniff or count it.
+	OpArchive    Op = "read archive"             // Reading the files stored in an archive, see WithArchives.
+	OpEncryption Op = "detect encryption"        // Reading the structure of a file to detect its encryption, see WithEncryption.
+)
+
+// ScanError represents the failure of an operation on a path during a scan.
+// The errors returned by Exec and ExecMulti join a ScanError per failure, see Errors.
+type ScanError struct {
+	Op   Op     // Operation that failed.
+	Path string // Absolute path of the file or directory.
+	Err  error  // Cause of the failure.
+}
+
+// Error returns the failure as e.g. "read dir /srv/secure: permission denied".
+func (e *ScanError) Error() string {
+	return string(e.Op) + " " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// Errors returns the failures on paths joined in an error returned by Exec, ExecMulti or Summarize,
+// in the order they were reported. Other errors, such as ErrLimitReached or a canceled context, are left out.
+func Errors(err error) []ScanError {
+	var list []ScanError
+	for _, e := range failures(err) {
+		var se *ScanError
+		if errors.As(e, &se) {
+			list = append(list, *se)
+		}
+	}
+	return list
+}
+
+// FailureGroup represents the failures of a scan sharing the same cause.
+type FailureGroup struct {
+	Cause  string  `json:"cause"`         // Cause of the failures, e.g. "permission denied".
+	Dir    string  `json:"dir,omitempty"` // Deepest directory containing all the failed paths, empty if unknown.
+	Errors []error `json:"-"`             // Failures of the group, in the order they were reported.
+}
+
+// String returns the group as a line of a summary, e.g. "permission denied: 1204 under /srv/secure".
+func (g FailureGroup) String() string {
+	s := fmt.Sprintf("%s: %d", g.Cause, len(g.Errors))
+	if g.Dir != "" {
+		s += " under " + g.Dir
+	}
+	return s
+}
+
+// Failures represents the failures of a scan grouped by cause, see Summarize.
+type Failures struct {
+	Groups []FailureGroup // Groups of failures, the largest first.
+	err    error
+}
+
+// Summarize groups the failures joined in an error returned by Exec or ExecMulti by cause.
+// The error of the result is a summary with a line per group instead of a line per failure,
+// while errors.Is and errors.As still see the original error. It returns nil if err is nil.
+func Summarize(err error) *Failures {
+	if err == nil {
+		return nil
+	}
+
+	f := &Failures{err: err}
+	byCause := make(map[string]int)
+	var paths [][]string
+	for _, e := range failures(err) {
+		cause := failureCause(e)
+		i, ok := byCause[cause]
+		if !ok {
+			i = len(f.Groups)
+			byCause[cause] = i
+			f.Groups = append(f.Groups, FailureGroup{Cause: cause})
+			paths = append(paths, nil)
+		}
+		f.Groups[i].Errors = append(f.Groups[i].Errors, e)
+
+		if p := failurePath(e); p != "" {
+			paths[i] = append(paths[i], p)
+		}
+	}
+
+	for i := range f.Groups {
+		if len(paths[i]) == len(f.Groups[i].Errors) {
+			f.Groups[i].Dir = commonDir(paths[i])
+		}
+	}
+	sort.SliceStable(f.Groups, func(i, j int) bool { return len(f.Groups[i].Errors) > len(f.Groups[j].Errors) })
+
+	return f
+}
+
+// Error returns the summary: the number of failures followed by a line per group.
+func (f *Failures) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d failures", f.Len())
+	for _, g := range f.Groups {
+		b.WriteString("\n  ")
+		b.WriteString(g.String())
+	}
+	return b.String()
+}
+
+// Unwrap returns the original error.
+func (f *Failures) Unwrap() error {
+	return f.err
+}
+
+// Len returns the number of failures.
+func (f *Failures) Len() int {
+	var n int
+	for _, g := range f.Groups {
+		n += len(g.Errors)
+	}
+	return n
+}
+
+// failures returns the individual failures joined in err, looking through errors wrapping joined errors.
+func failures(err error) []error {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if joined, ok := e.(interface{ Unwrap() []error }); ok {
+			var list []error
+			for _, e := range joined.Unwrap() {
+				list = append(list, failures(e)...)
+			}
+			return list
+		}
+	}
+	return []error{err}
+}
+
+// failurePath returns the path a failure occurred on, empty if unknown.
+func failurePath(err error) string {
+	var se *ScanError
+	var pe *fs.PathError
+	if errors.As(err, &se) {
+		return se.Path
+	} else if errors.As(err, &pe) {
+		return pe.Path
+	}
+	return ""
+}
+
+// failureCause returns the cause of a failure: a common class for the usual causes,
+// otherwise the message of the innermost error.
+func failureCause(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not found"
+	case errors.Is(err, syscall.EIO):
+		return "I/O error"
+	}
+
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err.Error()
+		}
+		err = inner
+	}
+}
+
+// commonDir returns the deepest directory containing all the paths.
+func commonDir(paths []string) string {
+	dir := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for dir != p && !strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
@@ -0,0 +1,73 @@
+package dirreader
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// errNoReaderAt is returned by readQuickHash for files of an fs.FS that cannot be read at an offset.
+var errNoReaderAt = errors.New("file does not support reading at an offset")
+
+// listDir returns the entries of the directory, read from the fs.FS if set, see WithFS,
+// or the failed operation and its error.
+func (r *dirReader) listDir(dir string) ([]os.FileInfo, Op, error) {
+	if r.fsys != nil {
+		entries, err := fs.ReadDir(r.fsys, dir)
+		if err != nil {
+			return nil, OpReadDir, err
+		}
+		atomic.AddInt64(&r.dirs, 1)
+
+		files := make([]os.FileInfo, 0, len(entries))
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				return nil, OpStat, err
+			}
+			files = append(files, info)
+		}
+		return files, "", nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, OpOpen, err
+	}
+	defer func() { _ = d.Close() }()
+	atomic.AddInt64(&r.dirs, 1)
+
+	files, err := d.Readdir(-1)
+	if err != nil {
+		return nil, OpReadDir, err
+	}
+	return files, "", nil
+}
+
+// join joins the absolute path of a directory and a name, with forward slashes in an fs.FS.
+func (r *dirReader) join(dir, name string) string {
+	if r.fsys != nil {
+		return path.Join(dir, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// open opens the file at the absolute path for reading, from the fs.FS if set.
+func (r *dirReader) open(name string) (fs.File, error) {
+	if r.fsys != nil {
+		return r.fsys.Open(name)
+	}
+	return os.Open(name)
+}
+
+// readerAt returns the file as an io.ReaderAt, which files of an fs.FS may not implement.
+func readerAt(f fs.File) (io.ReaderAt, error) {
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra, nil
+	}
+	return nil, errNoReaderAt
+}
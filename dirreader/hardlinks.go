@@ -0,0 +1,60 @@
+package dirreader
+
+import (
+	"sort"
+	"sync"
+)
+
+// inodeKey identifies a file by its device and inode numbers.
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// inodeContent holds the content read once for all the links to an inode.
+type inodeContent struct {
+	once sync.Once
+	fi   FileInfo
+	err  error
+}
+
+// readContentOnce reads the content of a hard-linked file only for the first of its links,
+// and copies the results to the others.
+func (r *dirReader) readContentOnce(fi *FileInfo) error {
+	v, _ := r.inodes.LoadOrStore(inodeKey{fi.Dev, fi.Ino}, new(inodeContent))
+	c := v.(*inodeContent)
+
+	c.once.Do(func() {
+		c.fi = *fi
+		c.err = r.readContent(&c.fi)
+	})
+
+	fi.Hash, fi.ContentType, fi.IsBinary, fi.LineCount = c.fi.Hash, c.fi.ContentType, c.fi.IsBinary, c.fi.LineCount
+
+	return c.err
+}
+
+// Hardlinks groups the files of a scan that are hard links to the same inode.
+// Only groups of two or more files are returned, each sorted by relative path, and the groups by their first path.
+// Files without device and inode numbers, see FileInfo.Ino, are never grouped.
+func Hardlinks(files []FileInfo) [][]FileInfo {
+	byInode := make(map[inodeKey][]FileInfo)
+	for _, fi := range files {
+		if fi.Ino == 0 {
+			continue
+		}
+		k := inodeKey{fi.Dev, fi.Ino}
+		byInode[k] = append(byInode[k], fi)
+	}
+
+	var groups [][]FileInfo
+	for _, g := range byInode {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return g[i].RelPath() < g[j].RelPath() })
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].RelPath() < groups[j][0].RelPath() })
+
+	return groups
+}
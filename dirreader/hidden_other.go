@@ -0,0 +1,13 @@
+//go:build !windows
+
+package dirreader
+
+import (
+	"os"
+	"strings"
+)
+
+// hidden reports whether the file is a dotfile.
+func hidden(file os.FileInfo) bool {
+	return strings.HasPrefix(file.Name(), ".")
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package dirreader
+
+import (
+	"os"
+	"syscall"
+)
+
+// hidden reports whether the file has the Hidden or System attribute.
+func hidden(file os.FileInfo) bool {
+	if d, ok := file.Sys().(*syscall.Win32FileAttributeData); ok {
+		return d.FileAttributes&(syscall.FILE_ATTRIBUTE_HIDDEN|syscall.FILE_ATTRIBUTE_SYSTEM) != 0
+	}
+	return false
+}
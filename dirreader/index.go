@@ -0,0 +1,119 @@
+package dirreader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// errNoIndex is returned when no file index covers the root, in which case the tree is walked.
+var errNoIndex = errors.New("no file index")
+
+// indexEntry represents a path listed by a file index of the operating system, see WithIndex.
+type indexEntry struct {
+	path   string // Absolute path, below the resolved root.
+	dir    bool   // Whether the path is known to be a directory.
+	hidden bool   // Whether the path or one of its parent directories below the root is hidden.
+}
+
+// indexed returns the resolved root and the paths listed below it by a file index, if WithIndex is enabled
+// and an index covers the root.
+func (r *dirReader) indexed() (string, []indexEntry, bool) {
+	if !r.index {
+		return "", nil, false
+	}
+
+	root, err := filepath.Abs(r.root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", nil, false
+	}
+
+	entries, err := indexedFiles(root)
+	if err != nil {
+		return "", nil, false
+	}
+
+	return root, entries, true
+}
+
+// readIndexed processes the files listed by a file index instead of reading the directories.
+// The filters are applied to the listed paths, so that only the selected files are read from the filesystem.
+// Paths that no longer exist since the index was updated are skipped.
+func (r *dirReader) readIndexed(root string, entries []indexEntry) {
+	defer r.wg.Done()
+
+	dirs := map[string]bool{"": true}
+	crossing := make(map[string]bool)
+	for _, e := range entries {
+		if r.stopped() {
+			break
+		}
+		if e.dir || (r.skipHidden && e.hidden) {
+			continue
+		}
+
+		relPath, err := filepath.Rel(root, e.path)
+		if err != nil {
+			continue
+		}
+		rel, name := filepath.Dir(relPath), filepath.Base(relPath)
+		if rel == "." {
+			rel = ""
+		}
+
+		if r.boundary != nil && r.crossesIndexed(rel, crossing) {
+			continue
+		}
+		if r.include != r.includedInMask(rel, name) && !r.isArchive(name) {
+			continue
+		}
+
+		abs := filepath.Join(r.root, relPath)
+		file, err := os.Lstat(abs)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				r.errorChan <- &ScanError{Op: OpStat, Path: abs, Err: err}
+			}
+			continue
+		}
+		if file.IsDir() {
+			continue
+		}
+
+		dirs[rel] = true
+		r.wg.Add(1)
+		r.schedule(abs, rel, file)
+	}
+
+	atomic.AddInt64(&r.dirs, int64(len(dirs)))
+}
+
+// crossesIndexed reports whether the directory at the relative path, or one of its parents,
+// is on another filesystem than the root, see WithOneFileSystem. The results are memoized in crossing.
+func (r *dirReader) crossesIndexed(rel string, crossing map[string]bool) bool {
+	if rel == "" {
+		return false
+	}
+	if c, ok := crossing[rel]; ok {
+		return c
+	}
+
+	parent := filepath.Dir(rel)
+	if parent == "." {
+		parent = ""
+	}
+
+	c := r.crossesIndexed(parent, crossing)
+	if !c {
+		if st, err := os.Lstat(filepath.Join(r.root, rel)); err == nil {
+			c = r.boundary.crosses(rel, st)
+		}
+	}
+	crossing[rel] = c
+
+	return c
+}
@@ -0,0 +1,226 @@
+package dirreader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// locateDBs lists the databases of the locate implementations, in order of preference.
+var locateDBs = []struct {
+	path string
+	read func(db, root string) ([]indexEntry, error)
+}{
+	{"/var/lib/plocate/plocate.db", readPlocate},
+	{"/var/lib/mlocate/mlocate.db", readMlocate},
+}
+
+// indexedFiles returns the paths below the root listed by the first locate database covering the root.
+func indexedFiles(root string) ([]indexEntry, error) {
+	for _, db := range locateDBs {
+		if entries, err := db.read(db.path, root); err == nil {
+			return entries, nil
+		}
+	}
+	return nil, errNoIndex
+}
+
+// below returns the entry for the path if it is below the root, with its hidden flag set from dot-prefixed names.
+func below(root, path string) (indexEntry, bool) {
+	prefix := root
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(path, prefix) || len(path) == len(prefix) {
+		return indexEntry{}, false
+	}
+
+	e := indexEntry{path: path}
+	for _, name := range strings.Split(path[len(prefix):], "/") {
+		if strings.HasPrefix(name, ".") {
+			e.hidden = true
+			break
+		}
+	}
+
+	return e, true
+}
+
+// plocateMagic starts a plocate database.
+const plocateMagic = "\x00plocate"
+
+// readPlocate returns the paths below the root listed in a plocate database. The file names are stored
+// in zstd-compressed blocks, optionally with a dictionary, located by the filename index. The database covers
+// the root if it lists the root itself.
+func readPlocate(db, root string) ([]indexEntry, error) {
+	f, err := os.Open(db)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Header: magic, version, hash table size, extra slots, number of blocks, hash table offset,
+	// filename index offset, max version, dictionary length and dictionary offset, little-endian.
+	hdr := make([]byte, 56)
+	if _, err = f.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	if string(hdr[:8]) != plocateMagic {
+		return nil, fmt.Errorf("%s: not a plocate database", db)
+	}
+	le := binary.LittleEndian
+	version, blocks, indexOffset := le.Uint32(hdr[8:]), le.Uint32(hdr[20:]), le.Uint64(hdr[32:])
+
+	var opts []zstd.DOption
+	if version >= 1 {
+		if n, off := le.Uint32(hdr[44:]), le.Uint64(hdr[48:]); n > 0 {
+			dict := make([]byte, n)
+			if _, err = f.ReadAt(dict, int64(off)); err != nil {
+				return nil, err
+			}
+			opts = append(opts, zstd.WithDecoderDicts(dict))
+		}
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	index := make([]byte, (uint64(blocks)+1)*8)
+	if _, err = f.ReadAt(index, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+
+	var entries []indexEntry
+	covered := root == "/"
+	var buf []byte
+	for i := uint32(0); i < blocks; i++ {
+		start, end := le.Uint64(index[i*8:]), le.Uint64(index[(i+1)*8:])
+		if end < start {
+			return nil, fmt.Errorf("%s: invalid filename index", db)
+		}
+
+		block := make([]byte, end-start)
+		if _, err = f.ReadAt(block, int64(start)); err != nil {
+			return nil, err
+		}
+		if buf, err = dec.DecodeAll(block, buf[:0]); err != nil {
+			return nil, err
+		}
+
+		for _, name := range bytes.Split(bytes.TrimSuffix(buf, []byte{0}), []byte{0}) {
+			path := string(name)
+			if path == root {
+				covered = true
+			} else if e, ok := below(root, path); ok {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if !covered {
+		return nil, errNoIndex
+	}
+
+	return entries, nil
+}
+
+// mlocateMagic starts an mlocate database.
+const mlocateMagic = "\x00mlocate"
+
+// mlocate entry types.
+const (
+	mlocateFile = 0
+	mlocateDir  = 1
+	mlocateEnd  = 2
+)
+
+// readMlocate returns the paths below the root listed in an mlocate database, see mlocate.db(5):
+// a header followed by every directory with its entries. The database covers the root if it lists its directory.
+func readMlocate(db, root string) ([]indexEntry, error) {
+	f, err := os.Open(db)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	br := bufio.NewReaderSize(f, 1<<16)
+
+	// Header: magic, configuration block size, version, visibility flag and padding, big-endian,
+	// followed by the root of the database and the configuration block.
+	hdr := make([]byte, 16)
+	if _, err = io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr[:8]) != mlocateMagic {
+		return nil, fmt.Errorf("%s: not an mlocate database", db)
+	}
+	if _, err = br.ReadString(0); err != nil {
+		return nil, err
+	}
+	if _, err = br.Discard(int(binary.BigEndian.Uint32(hdr[8:]))); err != nil {
+		return nil, err
+	}
+
+	var entries []indexEntry
+	var covered bool
+	dirHdr := make([]byte, 16)
+	for {
+		// Directory: modification time and padding, path, then typed entries up to the end marker.
+		if _, err = io.ReadFull(br, dirHdr); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		dir, err := readCString(br)
+		if err != nil {
+			return nil, err
+		}
+		if dir == root {
+			covered = true
+		}
+
+		for {
+			typ, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if typ == mlocateEnd {
+				break
+			}
+
+			name, err := readCString(br)
+			if err != nil {
+				return nil, err
+			}
+			if e, ok := below(root, filepath.Join(dir, name)); ok {
+				e.dir = typ == mlocateDir
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if !covered {
+		return nil, errNoIndex
+	}
+
+	return entries, nil
+}
+
+// readCString reads a NUL-terminated string.
+func readCString(br *bufio.Reader) (string, error) {
+	s, err := br.ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	return s[:len(s)-1], nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package dirreader
+
+// indexedFiles returns errNoIndex, as no file index is supported on this platform.
+func indexedFiles(string) ([]indexEntry, error) {
+	return nil, errNoIndex
+}
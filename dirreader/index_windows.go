@@ -0,0 +1,191 @@
+package dirreader
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// fsctlEnumUSNData enumerates the file records of the master file table of an NTFS volume.
+const fsctlEnumUSNData = 0x000900b3
+
+// rootFileIndex is the index of the root directory of an NTFS volume in its master file table.
+const rootFileIndex = 5
+
+// mftEnumData is the input of fsctlEnumUSNData, MFT_ENUM_DATA_V0.
+type mftEnumData struct {
+	StartFileReferenceNumber uint64
+	LowUsn                   int64
+	HighUsn                  int64
+}
+
+// mftRecord represents a file record of the master file table.
+type mftRecord struct {
+	parent uint64
+	name   string
+	attrs  uint32
+}
+
+// indexedFiles returns the paths below the root listed in the master file table of its NTFS volume.
+// Reading the volume requires administrator rights; without them, or on other filesystems, errNoIndex is returned.
+func indexedFiles(root string) ([]indexEntry, error) {
+	vol := filepath.VolumeName(root)
+	if len(vol) != 2 || vol[1] != ':' {
+		return nil, errNoIndex
+	}
+
+	records, err := readMFT(vol)
+	if err != nil {
+		return nil, errNoIndex
+	}
+
+	paths := make(map[uint64]string, len(records))
+	var pathOf func(frn uint64) string
+	pathOf = func(frn uint64) string {
+		if frn&0xffffffffffff == rootFileIndex {
+			return vol + `\`
+		}
+		if p, ok := paths[frn]; ok {
+			return p
+		}
+		paths[frn] = "" // Guards against cycles in a corrupted table.
+
+		var p string
+		if rec, ok := records[frn]; ok {
+			if parent := pathOf(rec.parent); parent != "" {
+				p = filepath.Join(parent, rec.name)
+			}
+		}
+		paths[frn] = p
+
+		return p
+	}
+
+	// The root is covered if it is the volume root or a directory of the table.
+	rootFRN, covered := uint64(rootFileIndex), len(root) == len(vol)+1
+	for frn, rec := range records {
+		if !covered && rec.attrs&windows.FILE_ATTRIBUTE_DIRECTORY != 0 && strings.EqualFold(pathOf(frn), root) {
+			rootFRN, covered = frn, true
+		}
+	}
+	if !covered {
+		return nil, errNoIndex
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, `\`) {
+		prefix += `\`
+	}
+
+	var entries []indexEntry
+	for frn, rec := range records {
+		p := pathOf(frn)
+		if len(p) <= len(prefix) || !strings.EqualFold(p[:len(prefix)], prefix) {
+			continue
+		}
+
+		e := indexEntry{path: prefix + p[len(prefix):], dir: rec.attrs&windows.FILE_ATTRIBUTE_DIRECTORY != 0}
+		for cur, ok := frn, true; ok && cur != rootFRN; cur = records[cur].parent {
+			var r mftRecord
+			if r, ok = records[cur]; ok && r.attrs&(windows.FILE_ATTRIBUTE_HIDDEN|windows.FILE_ATTRIBUTE_SYSTEM) != 0 {
+				e.hidden = true
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// readMFT returns the file records of the master file table of the volume, e.g. "C:", by file reference number.
+func readMFT(vol string) (map[uint64]mftRecord, error) {
+	h, err := openVolume(vol)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	le := binary.LittleEndian
+	records := make(map[uint64]mftRecord)
+	med := mftEnumData{HighUsn: math.MaxInt64}
+	buf := make([]byte, 1<<20)
+	for {
+		var n uint32
+		err = windows.DeviceIoControl(h, fsctlEnumUSNData, (*byte)(unsafe.Pointer(&med)), uint32(unsafe.Sizeof(med)), &buf[0], uint32(len(buf)), &n, nil)
+		if errors.Is(err, windows.ERROR_HANDLE_EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n <= 8 {
+			return records, nil
+		}
+
+		// The output starts with the reference number to continue from, followed by USN_RECORD_V2 records.
+		med.StartFileReferenceNumber = le.Uint64(buf)
+		parseUSNRecords(buf[8:n], func(rec usnRecord) {
+			records[rec.frn] = mftRecord{parent: rec.parent, name: rec.name, attrs: rec.attrs}
+		})
+	}
+}
+
+// openVolume opens the volume, e.g. "C:", to query its master file table and change journal.
+func openVolume(vol string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(`\\.\` + vol)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+}
+
+// usnRecord represents the fields of a USN_RECORD_V2 used by the index and the change journal.
+type usnRecord struct {
+	frn    uint64 // File reference number.
+	parent uint64 // File reference number of the parent directory.
+	attrs  uint32 // File attributes.
+	name   string // File name.
+}
+
+// parseUSNRecords calls fn for each USN_RECORD_V2 of the buffer, skipping records of other versions.
+func parseUSNRecords(buf []byte, fn func(rec usnRecord)) {
+	le := binary.LittleEndian
+	for len(buf) >= 60 {
+		size := le.Uint32(buf)
+		if size < 60 || size > uint32(len(buf)) {
+			return
+		}
+		rec := buf[:size]
+		buf = buf[size:]
+
+		if le.Uint16(rec[4:]) != 2 {
+			continue
+		}
+		nameLen, nameOff := uint32(le.Uint16(rec[56:])), uint32(le.Uint16(rec[58:]))
+		if nameOff+nameLen > size {
+			continue
+		}
+		fn(usnRecord{
+			frn:    le.Uint64(rec[8:]),
+			parent: le.Uint64(rec[16:]),
+			attrs:  le.Uint32(rec[52:]),
+			name:   decodeUTF16(rec[nameOff : nameOff+nameLen]),
+		})
+	}
+}
+
+// decodeUTF16 decodes a little-endian UTF-16 string.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
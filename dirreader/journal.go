@@ -0,0 +1,155 @@
+package dirreader
+
+import (
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errNoJournal is returned when the volume of the root has no change journal.
+var errNoJournal = errors.New("no change journal")
+
+// Journal represents a position in the change journal of a volume, returned by ExecChanged
+// and persisted with the scan result to rescan only what changed since.
+type Journal struct {
+	Volume string `json:"volume,omitempty"` // Volume of the journal, e.g. "C:".
+	ID     uint64 `json:"id,omitempty"`     // ID of the journal, which changes when the journal is recreated.
+	Next   int64  `json:"next,omitempty"`   // Sequence number of the first change not read yet.
+}
+
+// ExecChanged returns the files of the root like Exec, reading from the filesystem only the files that changed
+// since a previous scan, prev, according to the change journal of the volume at the position since,
+// which is returned by the previous call. The other files are taken from prev, which must have been scanned
+// with the same settings. Created and renamed directories are read entirely, removed paths are dropped.
+// The returned position is the one to pass to the next call.
+//
+// The change journal is the USN journal of NTFS volumes on Windows. If the volume has no journal,
+// or the position is unknown or no longer valid, e.g. for the first scan or after the journal wrapped,
+// the root is scanned entirely, so the result is always complete. Only the journal is used to find changes:
+// a root on a volume without one, or read from an fs.FS, see WithFS, is scanned entirely every time.
+func ExecChanged(root string, prev []FileInfo, since Journal, hashFunc func() hash.Hash, mask []string, include bool, opts ...Option) ([]FileInfo, Journal, error) {
+	// A tree read from an fs.FS has no change journal.
+	if newDirReader(root, hashFunc, mask, include, opts).fsys != nil {
+		files, err := Exec(root, hashFunc, mask, include, opts...)
+		return files, Journal{}, err
+	}
+
+	resolved, err := filepath.Abs(root)
+	if err == nil {
+		resolved, err = filepath.EvalSymlinks(resolved)
+	}
+	if err != nil {
+		return nil, Journal{}, err
+	}
+
+	cur, changed, err := journalChanges(resolved, since)
+	if err != nil {
+		files, err := Exec(root, hashFunc, mask, include, opts...)
+		return files, cur, err
+	}
+
+	start := time.Now()
+	r := newDirReader(root, hashFunc, mask, include, opts)
+	st := r.stats
+	r.stats = nil // Computed over the merged result.
+
+	// Drop the changed paths, with everything below them, and decide how to read them again.
+	byPath := make(map[string]FileInfo, len(prev))
+	for _, fi := range prev {
+		byPath[fi.RelPath()] = fi
+	}
+	sort.Strings(changed)
+	var entries []indexEntry
+	var dirs []string
+	for _, rel := range changed {
+		delete(byPath, rel)
+		for p := range byPath {
+			if under(p, []string{rel}) {
+				delete(byPath, p)
+			}
+		}
+
+		if under(rel, dirs) {
+			continue // Read with its created or renamed parent directory.
+		}
+
+		file, err := os.Lstat(filepath.Join(root, rel))
+		if err != nil {
+			continue // Removed since.
+		}
+		hidden := r.skipHidden && r.hiddenPath(rel)
+		if file.IsDir() {
+			if !hidden {
+				dirs = append(dirs, rel)
+			}
+			continue
+		}
+		entries = append(entries, indexEntry{path: filepath.Join(resolved, rel), hidden: hidden})
+	}
+
+	files, err := r.readDirectoryConcurrent(func() {
+		defer r.wg.Done()
+
+		r.wg.Add(1)
+		go r.readIndexed(resolved, entries)
+
+		crossing := make(map[string]bool)
+		for _, dir := range dirs {
+			if r.boundary != nil && r.crossesIndexed(dir, crossing) {
+				continue
+			}
+			r.wg.Add(1)
+			go r.readDirectory(filepath.Join(root, dir), dir)
+		}
+	})
+	if err != nil {
+		return nil, cur, err
+	}
+
+	for _, fi := range files {
+		byPath[fi.RelPath()] = fi
+	}
+	files = files[:0]
+	for _, fi := range byPath {
+		files = append(files, fi)
+	}
+
+	if st != nil {
+		st.reset()
+		st.Capabilities = r.capabilities()
+		dirs := make(map[string]bool)
+		for _, fi := range files {
+			st.add(fi)
+			dirs[fi.PathRel] = true
+		}
+		st.Dirs = len(dirs)
+		st.Elapsed = time.Since(start)
+		st.finish()
+	}
+
+	return files, cur, nil
+}
+
+// under reports whether the relative path is below one of the directories.
+func under(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(rel, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenPath reports whether the relative path or one of its parent directories below the root is hidden.
+func (r *dirReader) hiddenPath(rel string) bool {
+	for p := rel; p != "." && p != ""; p = filepath.Dir(p) {
+		if file, err := os.Lstat(filepath.Join(r.root, p)); err == nil && hidden(file) {
+			return true
+		}
+	}
+	return false
+}
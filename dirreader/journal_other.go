@@ -0,0 +1,9 @@
+//go:build !windows
+
+package dirreader
+
+// journalChanges returns errNoJournal: the change journal is only read on Windows.
+// Notification APIs of other platforms, such as inotify, keep no history between runs.
+func journalChanges(string, Journal) (Journal, []string, error) {
+	return Journal{}, nil, errNoJournal
+}
@@ -0,0 +1,148 @@
+package dirreader
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Control codes of the USN change journal.
+const (
+	fsctlQueryUSNJournal = 0x000900f4
+	fsctlReadUSNJournal  = 0x000900bb
+)
+
+// procOpenFileByID opens a file by its file reference number, used to resolve the parents of changed files.
+var procOpenFileByID = windows.NewLazySystemDLL("kernel32.dll").NewProc("OpenFileById")
+
+// usnJournalData is the output of fsctlQueryUSNJournal, USN_JOURNAL_DATA_V0.
+type usnJournalData struct {
+	UsnJournalID    uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUSNJournalData is the input of fsctlReadUSNJournal, READ_USN_JOURNAL_DATA_V0.
+type readUSNJournalData struct {
+	StartUsn          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	UsnJournalID      uint64
+}
+
+// fileIDDescriptor is the input of OpenFileById, FILE_ID_DESCRIPTOR with a file reference number.
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID uint64
+	_      [8]byte
+}
+
+// journalChanges returns the current position of the USN journal of the NTFS volume of the root
+// and the paths below the root, relative to it, changed since the position.
+// Reading the journal requires administrator rights; without them, on other filesystems, or if the position
+// is not valid for the journal, errNoJournal is returned with the current position if known.
+func journalChanges(root string, since Journal) (Journal, []string, error) {
+	vol := filepath.VolumeName(root)
+	if len(vol) != 2 || vol[1] != ':' {
+		return Journal{}, nil, errNoJournal
+	}
+
+	h, err := openVolume(vol)
+	if err != nil {
+		return Journal{}, nil, errNoJournal
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	var data usnJournalData
+	var n uint32
+	if err = windows.DeviceIoControl(h, fsctlQueryUSNJournal, nil, 0, (*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &n, nil); err != nil {
+		return Journal{}, nil, errNoJournal
+	}
+
+	cur := Journal{Volume: vol, ID: data.UsnJournalID, Next: data.NextUsn}
+	if !strings.EqualFold(since.Volume, vol) || since.ID != data.UsnJournalID ||
+		since.Next < data.FirstUsn || since.Next > data.NextUsn {
+		return cur, nil, errNoJournal
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, `\`) {
+		prefix += `\`
+	}
+
+	parents := make(map[uint64]string)
+	changed := make(map[string]bool)
+	read := readUSNJournalData{StartUsn: since.Next, ReasonMask: 0xffffffff, UsnJournalID: data.UsnJournalID}
+	buf := make([]byte, 1<<20)
+	for read.StartUsn < data.NextUsn {
+		err = windows.DeviceIoControl(h, fsctlReadUSNJournal, (*byte)(unsafe.Pointer(&read)), uint32(unsafe.Sizeof(read)), &buf[0], uint32(len(buf)), &n, nil)
+		if err != nil {
+			return cur, nil, errNoJournal
+		}
+		if n < 8 {
+			break
+		}
+
+		// The output starts with the sequence number to continue from, followed by USN_RECORD_V2 records.
+		next := int64(binary.LittleEndian.Uint64(buf))
+		parseUSNRecords(buf[8:n], func(rec usnRecord) {
+			parent, ok := parents[rec.parent]
+			if !ok {
+				parent = pathByID(h, rec.parent)
+				parents[rec.parent] = parent
+			}
+			if parent == "" {
+				return // The parent was removed since, which is recorded as well.
+			}
+
+			p := filepath.Join(parent, rec.name)
+			if len(p) > len(prefix) && strings.EqualFold(p[:len(prefix)], prefix) {
+				changed[p[len(prefix):]] = true
+			}
+		})
+		if next <= read.StartUsn {
+			break
+		}
+		read.StartUsn = next
+	}
+	cur.Next = read.StartUsn
+
+	paths := make([]string, 0, len(changed))
+	for p := range changed {
+		paths = append(paths, p)
+	}
+
+	return cur, paths, nil
+}
+
+// pathByID returns the current path of the file with the reference number on the volume,
+// or an empty string if it no longer exists.
+func pathByID(vol windows.Handle, frn uint64) string {
+	id := fileIDDescriptor{Type: 0, FileID: frn}
+	id.Size = uint32(unsafe.Sizeof(id))
+	r, _, _ := procOpenFileByID.Call(uintptr(vol), uintptr(unsafe.Pointer(&id)), 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, 0, windows.FILE_FLAG_BACKUP_SEMANTICS)
+	h := windows.Handle(r)
+	if h == windows.InvalidHandle {
+		return ""
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetFinalPathNameByHandle(h, &buf[0], uint32(len(buf)), 0) // VOLUME_NAME_DOS
+	if err != nil || int(n) > len(buf) {
+		return ""
+	}
+
+	return strings.TrimPrefix(windows.UTF16ToString(buf[:n]), `\\?\`)
+}
@@ -0,0 +1,78 @@
+package dirreader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileInfo is FileInfo without its methods, used to avoid recursion when encoding to and decoding from JSON.
+type fileInfo FileInfo
+
+// fileJSON is the JSON representation of the embedded os.FileInfo.
+type fileJSON struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	Perm    string    `json:"perm"` // Numeric permission bits in octal, for readability; derived from the mode when decoding.
+	ModTime time.Time `json:"modTime"`
+}
+
+// MarshalJSON encodes the FileInfo together with the name, size, mode and modification time
+// of the embedded os.FileInfo.
+func (fi FileInfo) MarshalJSON() ([]byte, error) {
+	v := struct {
+		fileJSON
+		fileInfo
+	}{fileInfo: fileInfo(fi)}
+
+	if fi.FileInfo != nil {
+		v.fileJSON = fileJSON{
+			Name:    fi.Name(),
+			Size:    fi.Size(),
+			Mode:    uint32(fi.Mode()),
+			Perm:    fmt.Sprintf("%04o", fi.Perm()),
+			ModTime: fi.ModTime(),
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a FileInfo encoded by MarshalJSON.
+// The embedded os.FileInfo is replaced by a static implementation holding the decoded values.
+func (fi *FileInfo) UnmarshalJSON(data []byte) error {
+	v := struct {
+		*fileJSON
+		*fileInfo
+	}{&fileJSON{}, (*fileInfo)(fi)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	fi.FileInfo = fileStat{
+		name:    v.Name,
+		size:    v.Size,
+		mode:    os.FileMode(v.Mode),
+		modTime: v.ModTime,
+	}
+
+	return nil
+}
+
+// fileStat is a static os.FileInfo implementation used for decoded files.
+type fileStat struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fs fileStat) Name() string       { return fs.name }
+func (fs fileStat) Size() int64        { return fs.size }
+func (fs fileStat) Mode() os.FileMode  { return fs.mode }
+func (fs fileStat) ModTime() time.Time { return fs.modTime }
+func (fs fileStat) IsDir() bool        { return fs.mode.IsDir() }
+func (fs fileStat) Sys() any           { return nil }
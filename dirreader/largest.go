@@ -0,0 +1,95 @@
+package dirreader
+
+import (
+	"container/heap"
+	"path/filepath"
+	"sort"
+)
+
+// DirSize represents the aggregated size of a directory and everything below it.
+type DirSize struct {
+	Path  string `json:"path"`  // Relative path of the directory, "." for the root.
+	Files int    `json:"files"` // Number of files in the directory and its subdirectories.
+	Bytes int64  `json:"bytes"` // Total size of the files in the directory and its subdirectories.
+}
+
+// LargestFiles returns the n largest files of a scan, sorted by size in descending order.
+func LargestFiles(files []FileInfo, n int) []FileInfo {
+	if n <= 0 {
+		return nil
+	}
+
+	h := make(largestHeap, 0, n)
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+		if len(h) < n {
+			heap.Push(&h, fi)
+		} else if fi.Size() > h[0].Size() {
+			h[0] = fi
+			heap.Fix(&h, 0)
+		}
+	}
+
+	largest := []FileInfo(h)
+	sort.Slice(largest, func(i, j int) bool {
+		if largest[i].Size() != largest[j].Size() {
+			return largest[i].Size() > largest[j].Size()
+		}
+		return largest[i].RelPath() < largest[j].RelPath()
+	})
+
+	return largest
+}
+
+// LargestDirs returns the n largest directories of a scan, sorted by size in descending order, like du does:
+// the size of a directory is the total size of the files below it, at any depth.
+// Only the directories containing scanned files are taken into account.
+func LargestDirs(files []FileInfo, n int) []DirSize {
+	if n <= 0 {
+		return nil
+	}
+
+	dirs := make(map[string]*DirSize)
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+
+		for dir := filepath.Clean(fi.PathRel); ; dir = filepath.Dir(dir) {
+			if dir == string(filepath.Separator) {
+				dir = "."
+			}
+
+			d, ok := dirs[dir]
+			if !ok {
+				d = &DirSize{Path: dir}
+				dirs[dir] = d
+			}
+			d.Files++
+			d.Bytes += fi.Size()
+
+			if dir == "." {
+				break
+			}
+		}
+	}
+
+	sizes := make([]DirSize, 0, len(dirs))
+	for _, d := range dirs {
+		sizes = append(sizes, *d)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Path < sizes[j].Path
+	})
+
+	if len(sizes) > n {
+		sizes = sizes[:n]
+	}
+
+	return sizes
+}
@@ -0,0 +1,49 @@
+package dirreader
+
+import "bytes"
+
+// binaryProbeLen is the number of leading bytes searched for a NUL byte to tell binary files from text files,
+// the same heuristic as git's.
+const binaryProbeLen = 8000
+
+// lineCounter is an io.Writer classifying the content written to it as text or binary and counting its lines.
+type lineCounter struct {
+	n      int64 // Number of bytes written.
+	lines  int64 // Number of newlines.
+	binary bool  // Whether a NUL byte was found in the leading bytes.
+	last   byte  // Last byte written.
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if !lc.binary && lc.n < binaryProbeLen {
+		probe := p
+		if rest := binaryProbeLen - lc.n; int64(len(probe)) > rest {
+			probe = probe[:rest]
+		}
+		lc.binary = bytes.IndexByte(probe, 0) >= 0
+	}
+
+	if !lc.binary {
+		lc.lines += int64(bytes.Count(p, []byte{'\n'}))
+	}
+	lc.n += int64(len(p))
+	lc.last = p[len(p)-1]
+
+	return len(p), nil
+}
+
+// result returns whether the content is binary and, if it is not, its number of lines,
+// counting a last line without a trailing newline.
+func (lc *lineCounter) result() (bool, int64) {
+	if lc.binary {
+		return true, 0
+	}
+	if lc.n > 0 && lc.last != '\n' {
+		return false, lc.lines + 1
+	}
+	return false, lc.lines
+}
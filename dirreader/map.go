@@ -0,0 +1,32 @@
+package dirreader
+
+import (
+	"hash"
+	"path"
+	"path/filepath"
+)
+
+// NormPath returns the normalized form of a relative path used as the key of ToMap:
+// cleaned and slash-separated on every platform, e.g. "docs/a.txt".
+func NormPath(rel string) string {
+	return path.Clean(filepath.ToSlash(rel))
+}
+
+// ToMap returns the files keyed by their normalized relative path, see NormPath.
+// If several files have the same path, e.g. when combining the results of several roots, the last one is kept.
+func ToMap(files []FileInfo) map[string]FileInfo {
+	m := make(map[string]FileInfo, len(files))
+	for _, fi := range files {
+		m[NormPath(fi.RelPath())] = fi
+	}
+	return m
+}
+
+// ExecMap works like Exec but returns the files keyed by their normalized relative path, see ToMap.
+func ExecMap(root string, hashFunc func() hash.Hash, mask []string, include bool, opts ...Option) (map[string]FileInfo, error) {
+	files, err := Exec(root, hashFunc, mask, include, opts...)
+	if files == nil && err != nil {
+		return nil, err
+	}
+	return ToMap(files), err
+}
@@ -0,0 +1,54 @@
+package dirreader
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountPoints returns the mount points of the current mount namespace, including bind mounts,
+// which do not necessarily change the device ID.
+func mountPoints() (map[string]bool, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	mounts := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Format: mount ID, parent ID, major:minor, root, mount point, options, ...
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts[unescapeMount(fields[4])] = true
+	}
+
+	return mounts, sc.Err()
+}
+
+// unescapeMount decodes the octal escapes used for spaces, tabs, newlines and backslashes in mount points.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
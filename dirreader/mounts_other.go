@@ -0,0 +1,8 @@
+//go:build !linux
+
+package dirreader
+
+// mountPoints returns nil, as mount points are only listed on Linux. Other mounts are detected by their device ID.
+func mountPoints() (map[string]bool, error) {
+	return nil, nil
+}
@@ -0,0 +1,64 @@
+package dirreader
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+)
+
+// ExecMulti scans several roots concurrently with the same settings as Exec and returns the files of all of them,
+// each tagged with its root in FileInfo.Root. The error of each root is wrapped with the root and the errors
+// are joined; the files of the roots scanned without error, or stopped by a limit, are returned along with it.
+// With WithStats, the statistics of all the roots are combined, hard links are only detected within a root.
+// Overlapping roots return the files they share once per root, see Collapse.
+func ExecMulti(roots []string, hashFunc func() hash.Hash, mask []string, include bool, opts ...Option) ([]FileInfo, error) {
+	// Give every root its own statistics, to combine them once all the scans are complete.
+	probe := new(dirReader)
+	for _, opt := range opts {
+		opt(probe)
+	}
+	stats := make([]Stats, len(roots))
+
+	start := time.Now()
+	results := make([][]FileInfo, len(roots))
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+
+			files, err := Exec(root, hashFunc, mask, include, append(opts[:len(opts):len(opts)], WithStats(&stats[i]))...)
+			if err != nil {
+				errs[i] = fmt.Errorf("root %s: %w", root, err)
+			}
+
+			for j := range files {
+				files[j].Root = root
+			}
+			results[i] = files
+		}(i, root)
+	}
+	wg.Wait()
+
+	var files []FileInfo
+	for _, res := range results {
+		files = append(files, res...)
+	}
+
+	if st := probe.stats; st != nil {
+		st.reset()
+		for i := range stats {
+			if errs[i] == nil || errors.Is(errs[i], ErrLimitReached) {
+				st.merge(&stats[i])
+			}
+		}
+		st.Elapsed = time.Since(start)
+		st.finish()
+	}
+
+	return files, errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package dirreader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fsBoundary holds the state used to stay on the filesystem of the root, see WithOneFileSystem.
+type fsBoundary struct {
+	dev    uint64          // Device ID of the root.
+	hasDev bool            // Whether the platform exposes device IDs.
+	root   string          // Absolute root with symbolic links resolved, as listed in the mount table.
+	mounts map[string]bool // Mount points, nil where the platform does not list them.
+}
+
+// newFSBoundary returns the boundary of the filesystem the root resides on.
+func newFSBoundary(root string) (*fsBoundary, error) {
+	st, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", root, err)
+	}
+
+	b := new(fsBoundary)
+	b.dev, b.hasDev = device(st)
+
+	if b.root, err = filepath.Abs(root); err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", root, err)
+	}
+	if b.root, err = filepath.EvalSymlinks(b.root); err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", root, err)
+	}
+
+	if b.mounts, err = mountPoints(); err != nil {
+		return nil, fmt.Errorf("list mount points: %w", err)
+	}
+
+	return b, nil
+}
+
+// crosses reports whether the directory at the relative path is on another filesystem than the root:
+// it resides on another device, or it is a mount point, which also catches bind mounts of the same device.
+func (b *fsBoundary) crosses(rel string, dir os.FileInfo) bool {
+	if dev, ok := device(dir); ok && b.hasDev && dev != b.dev {
+		return true
+	}
+	return b.mounts[filepath.Join(b.root, rel)]
+}
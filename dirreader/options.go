@@ -0,0 +1,274 @@
+package dirreader
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"hash"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/throttle"
+)
+
+// Option configures optional behavior of Exec.
+type Option func(r *dirReader)
+
+// WithStats fills the provided Stats with statistics collected during the scan,
+// which avoids a second pass over the results for common reports.
+func WithStats(st *Stats) Option {
+	return func(r *dirReader) {
+		r.stats = st
+	}
+}
+
+// WithXattrs reads the extended attributes of every file into FileInfo.Xattrs when enabled.
+// On Linux the user.* and security.* namespaces are collected, on macOS all attributes, e.g. com.apple.*.
+// Files on filesystems without extended attributes, and platforms without them, get no attributes.
+func WithXattrs(enabled bool) Option {
+	return func(r *dirReader) {
+		r.xattrs = enabled
+	}
+}
+
+// WithContentType detects the MIME type of every file from its first 512 bytes into FileInfo.ContentType
+// when enabled, see http.DetectContentType, which is extended to executables: application/x-elf,
+// application/vnd.microsoft.portable-executable and application/x-mach-binary.
+// When hashing is enabled the same read is used for both.
+func WithContentType(enabled bool) Option {
+	return func(r *dirReader) {
+		r.sniff = enabled
+	}
+}
+
+// WithLineCount classifies every file as text or binary into FileInfo.IsBinary and counts the lines of text files
+// into FileInfo.LineCount when enabled. When hashing is enabled the same read is used for both.
+func WithLineCount(enabled bool) Option {
+	return func(r *dirReader) {
+		r.lines = enabled
+	}
+}
+
+// WithSkipHidden skips hidden files and directories, with everything below them, when enabled:
+// dotfiles and dot-directories on Unix, and files with the Hidden or System attribute on Windows.
+// The root directory is read even if it is hidden.
+func WithSkipHidden(enabled bool) Option {
+	return func(r *dirReader) {
+		r.skipHidden = enabled
+	}
+}
+
+// WithMaskFold matches the mask case-insensitively when enabled, so that ".jpg" also matches "IMG.JPG".
+func WithMaskFold(enabled bool) Option {
+	return func(r *dirReader) {
+		r.maskFold = enabled
+	}
+}
+
+// WithMaskPath matches the mask against the relative path of each file, with forward slashes and a leading slash,
+// instead of its name when enabled. A mask ending with a slash matches the files below every directory
+// with that path, e.g. "/docs/" matches "docs/a.txt" and "src/docs/b.txt", while other masks match the end
+// of the path, e.g. "/README.md" or "docs/index.html".
+func WithMaskPath(enabled bool) Option {
+	return func(r *dirReader) {
+		r.maskPath = enabled
+	}
+}
+
+// WithEncryption detects encrypted and password-protected files into FileInfo.Encrypted when enabled,
+// see encryption.Detect for the supported formats.
+func WithEncryption(enabled bool) Option {
+	return func(r *dirReader) {
+		r.encryption = enabled
+	}
+}
+
+// WithOneFileSystem does not descend into directories on other filesystems than the root when enabled,
+// like du -x and rsync -x. Mount points are detected by their device ID and, on Linux, from the mount table,
+// so that bind mounts and network mounts are skipped as well. The mount points themselves are not returned.
+func WithOneFileSystem(enabled bool) Option {
+	return func(r *dirReader) {
+		r.oneFS = enabled
+	}
+}
+
+// WithHashInodesOnce reads the content of hard-linked files once per inode when enabled,
+// so that all the links share the hash, content type and line count of the first one read.
+// Files are identified by their device and inode numbers where the platform exposes them, see FileInfo.Ino.
+func WithHashInodesOnce(enabled bool) Option {
+	return func(r *dirReader) {
+		r.inodeOnce = enabled
+	}
+}
+
+// WithIndex lists the files from a file index of the operating system instead of walking the directories
+// when enabled and an index covering the root is available, which is much faster on large trees:
+// the plocate or mlocate database on Linux, and the NTFS master file table on Windows, which requires
+// administrator rights. The filters are applied to the listed paths, so that only the selected files are read.
+// An index reflects the tree at its last update: files created since are missed, files removed since are skipped.
+// Stats.Dirs counts the directories containing selected files. Without a usable index the tree is walked.
+func WithIndex(enabled bool) Option {
+	return func(r *dirReader) {
+		r.index = enabled
+	}
+}
+
+// WithQuickHash hashes only the size and the first and last n bytes of every file into FileInfo.QuickHash
+// instead of its whole content into FileInfo.Hash when n is positive, using the hash function passed to Exec.
+// The quick hash is a cheap fingerprint: files with different quick hashes differ, while files with equal ones
+// are only likely to be identical, which makes it suited to narrow down the files to hash in full,
+// see dedupe.Find and diff.Changed. Files not larger than 2n bytes are hashed in full.
+func WithQuickHash(n int64) Option {
+	return func(r *dirReader) {
+		r.quickHash = n
+	}
+}
+
+// WithHashName hashes the content of the files with the named algorithm, see hashes.Lookup,
+// replacing the hash function passed to Exec. An unknown name makes Exec return an error.
+func WithHashName(name string) Option {
+	return func(r *dirReader) {
+		r.hashFunc, r.err = hashes.Lookup(name)
+	}
+}
+
+// WithHMAC hashes the content of the files with HMAC using the key and the hash function h,
+// replacing the hash function passed to Exec. Keyed digests cannot be recomputed without the key,
+// so that an attacker able to modify the files cannot forge the hashes of a manifest to match.
+func WithHMAC(key []byte, h func() hash.Hash) Option {
+	key = append([]byte(nil), key...)
+	return func(r *dirReader) {
+		r.hashFunc = func() hash.Hash { return hmac.New(h, key) }
+	}
+}
+
+// WithCheckpoint saves the files read so far to the file at path every interval, or every minute if it is
+// not positive, so that a scan interrupted by a crash or a signal can be resumed by running it again:
+// the hashes, content types and line counts of the files unchanged since, by size and modification time,
+// are taken from the checkpoint instead of reading the files again. The checkpoint of a scan with other
+// content settings, such as the hash function, is ignored. The file is removed when the scan completes
+// without errors. Roots scanned with ExecMulti must use different paths.
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(r *dirReader) {
+		r.cpPath, r.cpInterval = path, interval
+	}
+}
+
+// WithRateLimit limits the reads of the content of the files to bytesPerSecond bytes per second in total,
+// so that background scans do not saturate production disks or network mounts. Zero or less disables the limit.
+// The limit is shared by the roots of ExecMulti and by the scans given the same option; the reads are also subject
+// to the limit of the whole process, see throttle.SetGlobal.
+func WithRateLimit(bytesPerSecond int64) Option {
+	l := throttle.New(bytesPerSecond)
+	return func(r *dirReader) {
+		r.limit = l
+	}
+}
+
+// Filter reports whether to keep a file, see WithFilter.
+type Filter func(fi FileInfo) (bool, error)
+
+// WithFilter reads and returns only the files fn keeps, in addition to the mask. fn is called concurrently
+// with the path, file system metadata and owner of each file, before its content is read.
+// Files for which fn fails are skipped and the errors are returned by Exec.
+func WithFilter(fn Filter) Option {
+	return func(r *dirReader) {
+		r.filter = fn
+	}
+}
+
+// WithOrder reads the files in the order instead of all at once as they are listed: the tree is listed first,
+// then the files are read by as many workers as CPUs in that order, which Exec returns them roughly in.
+// It controls which files are read first, e.g. to get early results for many small files, or to hash the large
+// files first, and which files an interrupted scan has read, see WithCheckpoint.
+func WithOrder(o Order) Option {
+	return func(r *dirReader) {
+		r.order = o
+	}
+}
+
+// ErrLimitReached is returned by Exec, along with the files collected so far, when a limit set with WithLimit
+// or WithMaxErrors is reached.
+var ErrLimitReached = errors.New("scan limit reached")
+
+// WithLimit stops the scan once maxFiles files, or files totaling maxBytes bytes, were collected, e.g. to sample
+// a huge tree. Zero or less disables a limit. Exec then returns the collected files with ErrLimitReached;
+// which files are collected first depends on the order, see WithOrder. The limits apply to each root of ExecMulti.
+func WithLimit(maxFiles int, maxBytes int64) Option {
+	return func(r *dirReader) {
+		r.maxFiles, r.maxBytes = maxFiles, maxBytes
+	}
+}
+
+// WithMaxErrors stops the scan once n errors occurred, e.g. to bail out of a broken mount instead of failing
+// on every file. Zero or less disables the limit. Exec then returns the files collected so far with the errors
+// joined with ErrLimitReached.
+func WithMaxErrors(n int) Option {
+	return func(r *dirReader) {
+		r.maxErrors = n
+	}
+}
+
+// WithArchives reads the files stored in zip, tar and compressed tar archives when enabled, as if the archives
+// were directories: they are returned after the archives with paths such as "bundle.zip!/inner/file.txt",
+// see package archive, and their content is hashed, sniffed and counted like that of other files.
+// The mask and the filter apply to the stored files too; archives excluded by the mask are only read for their files.
+// The files stored in archives have no owner, inode or quick hash, and archives nested in archives are not read.
+func WithArchives(enabled bool) Option {
+	return func(r *dirReader) {
+		r.archives = enabled
+	}
+}
+
+// WithSkipPermissionErrors skips the directories and files access is denied to instead of failing the scan,
+// e.g. to scan system directories as an unprivileged user. The skipped paths are recorded in Stats.Skipped,
+// see WithStats, and do not count towards WithMaxErrors.
+func WithSkipPermissionErrors(skip bool) Option {
+	return func(r *dirReader) {
+		r.skipDenied = skip
+	}
+}
+
+// WithContext stops the scan when the context is done, e.g. on a signal, see shutdown.Notify:
+// no more directories and files are read, and Exec returns the error of the context joined with the others,
+// after saving the checkpoint if enabled, see WithCheckpoint.
+func WithContext(ctx context.Context) Option {
+	return func(r *dirReader) {
+		r.ctx = ctx
+	}
+}
+
+// WithFS reads the tree from fsys instead of the operating system, e.g. an fstest.MapFS to test a complete
+// workflow in memory, or an embed.FS. The root is then a path of fsys, such as ".", and FileInfo.PathAbs
+// holds paths of fsys. The options reading the operating system directly are ignored: WithXattrs,
+// WithEncryption, WithOneFileSystem, WithIndex and WithArchives. WithQuickHash requires files implementing
+// io.ReaderAt, as those of fstest.MapFS and embed.FS do.
+func WithFS(fsys fs.FS) Option {
+	return func(r *dirReader) {
+		r.fsys = fsys
+	}
+}
+
+// WithPrevious takes the hashes, content types and line counts of the files unchanged since a previous scan,
+// by size and modification time, from its result instead of reading the files again, like WithCheckpoint
+// for a completed scan, e.g. the files kept by store.Store.Files. The previous scan must have been run
+// with the same content settings, such as the hash function, and files are matched by absolute path.
+// The files without the hash the scan computes, e.g. those whose content could not be read, are read again.
+func WithPrevious(files []FileInfo) Option {
+	return func(r *dirReader) {
+		r.prev = make(map[string]FileInfo, len(files))
+		for _, fi := range files {
+			r.prev[fi.PathAbs] = fi
+		}
+	}
+}
+
+// WithLogger logs the failures of the scan as warnings as they happen, rather than only in the returned error,
+// the skipped paths and the durations of its phases at debug level, and a summary at info level.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *dirReader) {
+		r.log = l
+	}
+}
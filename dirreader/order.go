@@ -0,0 +1,136 @@
+package dirreader
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Order represents the order the files are read in, see WithOrder.
+type Order int
+
+const (
+	Unordered     Order = iota // Files are read as soon as they are listed, all at once, in no particular order.
+	SmallestFirst              // Smallest files first, for early results on trees of many small files.
+	LargestFirst               // Largest files first, e.g. to hash the big files overnight.
+	BreadthFirst               // Files closest to the root first, directory by directory.
+	DepthFirst                 // Files by path, so that each subtree is complete before the next one is started.
+)
+
+// String returns the name of the order, e.g. "smallest-first".
+func (o Order) String() string {
+	switch o {
+	case SmallestFirst:
+		return "smallest-first"
+	case LargestFirst:
+		return "largest-first"
+	case BreadthFirst:
+		return "breadth-first"
+	case DepthFirst:
+		return "depth-first"
+	default:
+		return "unordered"
+	}
+}
+
+// ParseOrder returns the order with the name returned by Order.String.
+func ParseOrder(name string) (Order, bool) {
+	for o := Unordered; o <= DepthFirst; o++ {
+		if o.String() == name {
+			return o, true
+		}
+	}
+	return Unordered, false
+}
+
+// queuedFile is a listed file waiting to be read, see dirReader.schedule.
+type queuedFile struct {
+	abs  string
+	rel  string
+	file os.FileInfo
+}
+
+// schedule reads the listed file right away, or queues it to be read by readQueued if an order is set.
+// The caller must have called r.wg.Add for the file in both cases.
+func (r *dirReader) schedule(abs, rel string, file os.FileInfo) {
+	if r.order == Unordered {
+		go r.getFileInfo(abs, rel, file)
+		return
+	}
+
+	r.queueMu.Lock()
+	r.queue = append(r.queue, queuedFile{abs: abs, rel: rel, file: file})
+	r.queueMu.Unlock()
+	r.wg.Done()
+}
+
+// readQueued reads the queued files in the order of the reader, by as many workers as CPUs,
+// and waits for them. It does nothing if no order is set.
+func (r *dirReader) readQueued() {
+	if r.order == Unordered {
+		return
+	}
+
+	queue := r.queue
+	r.queue = nil
+	sortQueue(queue, r.order)
+
+	next := make(chan queuedFile)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for q := range next {
+				r.getFileInfo(q.abs, q.rel, q.file)
+			}
+		}()
+	}
+
+	r.wg.Add(len(queue))
+	for _, q := range queue {
+		next <- q
+	}
+	close(next)
+	r.wg.Wait()
+}
+
+// sortQueue sorts the queued files in the order, breaking ties by path.
+func sortQueue(queue []queuedFile, order Order) {
+	path := func(i int) string { return filepath.Join(queue[i].rel, queue[i].file.Name()) }
+	depth := func(i int) int {
+		if queue[i].rel == "" {
+			return 0
+		}
+		return strings.Count(filepath.ToSlash(queue[i].rel), "/") + 1
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		switch order {
+		case SmallestFirst:
+			if si, sj := queue[i].file.Size(), queue[j].file.Size(); si != sj {
+				return si < sj
+			}
+		case LargestFirst:
+			if si, sj := queue[i].file.Size(), queue[j].file.Size(); si != sj {
+				return si > sj
+			}
+		case BreadthFirst:
+			if di, dj := depth(i), depth(j); di != dj {
+				return di < dj
+			}
+		}
+		return pathBefore(path(i), path(j))
+	})
+}
+
+// pathBefore reports whether the relative path a sorts before b component by component,
+// so that the files under a directory are contiguous.
+func pathBefore(a, b string) bool {
+	ea, eb := strings.Split(filepath.ToSlash(a), "/"), strings.Split(filepath.ToSlash(b), "/")
+	for k := 0; k < len(ea) && k < len(eb); k++ {
+		if ea[k] != eb[k] {
+			return ea[k] < eb[k]
+		}
+	}
+	return len(ea) < len(eb)
+}
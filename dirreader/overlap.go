@@ -0,0 +1,92 @@
+package dirreader
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Overlap represents a physical file found under several paths, e.g. by ExecMulti with nested roots,
+// roots reached through bind mounts or symbolic links, or hard links.
+type Overlap struct {
+	Canonical string   `json:"canonical"` // Absolute path the file is kept under.
+	Aliases   []string `json:"aliases"`   // Other absolute paths of the file, sorted, empty if the roots only share the path.
+}
+
+// Collapse returns the files with every physical file kept once, in their original order, and the overlaps found.
+// Files are identified by their device and inode numbers where the platform exposes them, see FileInfo.Ino,
+// so that hard links are collapsed as well, and by the path with symbolic links resolved otherwise.
+// The canonical path of a file is the one without symbolic links if it was found under it,
+// otherwise the shortest one; the overlaps are sorted by canonical path.
+func Collapse(files []FileInfo) ([]FileInfo, []Overlap) {
+	type physical struct {
+		dev, ino uint64
+		path     string
+	}
+
+	resolved := make([]string, len(files))
+	groups := make(map[physical][]int)
+	var order []physical
+	for i, fi := range files {
+		resolved[i] = fi.PathAbs
+		if p, err := filepath.EvalSymlinks(fi.PathAbs); err == nil {
+			resolved[i] = p
+		}
+
+		k := physical{dev: fi.Dev, ino: fi.Ino}
+		if fi.Ino == 0 {
+			k.path = resolved[i]
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+
+	keep := make([]bool, len(files))
+	var overlaps []Overlap
+	for _, k := range order {
+		group := groups[k]
+		canonical := group[0]
+		for _, i := range group[1:] {
+			if canonicalBefore(files[i].PathAbs, resolved[i], files[canonical].PathAbs, resolved[canonical]) {
+				canonical = i
+			}
+		}
+		keep[canonical] = true
+
+		if len(group) == 1 {
+			continue
+		}
+		o := Overlap{Canonical: files[canonical].PathAbs}
+		seen := map[string]bool{o.Canonical: true}
+		for _, i := range group {
+			if p := files[i].PathAbs; !seen[p] {
+				seen[p] = true
+				o.Aliases = append(o.Aliases, p)
+			}
+		}
+		sort.Strings(o.Aliases)
+		overlaps = append(overlaps, o)
+	}
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].Canonical < overlaps[j].Canonical })
+
+	result := make([]FileInfo, 0, len(order))
+	for i, fi := range files {
+		if keep[i] {
+			result = append(result, fi)
+		}
+	}
+
+	return result, overlaps
+}
+
+// canonicalBefore reports whether the path a, resolving to realA, is a better canonical path than b, resolving to realB.
+func canonicalBefore(a, realA, b, realB string) bool {
+	if resolvedA, resolvedB := a == realA, b == realB; resolvedA != resolvedB {
+		return resolvedA
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
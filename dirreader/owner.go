@@ -0,0 +1,61 @@
+package dirreader
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// Owner represents the user and the group owning a file.
+type Owner struct {
+	UID   uint32 `json:"uid"`             // Numeric user ID.
+	GID   uint32 `json:"gid"`             // Numeric group ID.
+	User  string `json:"user,omitempty"`  // User name, empty if it cannot be resolved.
+	Group string `json:"group,omitempty"` // Group name, empty if it cannot be resolved.
+}
+
+// Perm returns the permission bits of the file in their numeric Unix form, e.g. 0o644 or 0o4755
+// including the setuid, setgid and sticky bits.
+func (fi FileInfo) Perm() uint32 {
+	mode := fi.Mode()
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return perm
+}
+
+// userNames and groupNames cache the resolved names by ID, since resolving them may read the user database.
+var userNames, groupNames sync.Map
+
+// newOwner returns the owner with the user and group names resolved where possible.
+func newOwner(uid, gid uint32) *Owner {
+	o := &Owner{UID: uid, GID: gid}
+
+	if name, ok := userNames.Load(uid); ok {
+		o.User = name.(string)
+	} else {
+		if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+			o.User = u.Username
+		}
+		userNames.Store(uid, o.User)
+	}
+
+	if name, ok := groupNames.Load(gid); ok {
+		o.Group = name.(string)
+	} else {
+		if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+			o.Group = g.Name
+		}
+		groupNames.Store(gid, o.Group)
+	}
+
+	return o
+}
@@ -0,0 +1,57 @@
+package dirreader
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+// hashContent reports whether the whole content of the files is hashed into FileInfo.Hash.
+func (r *dirReader) hashContent() bool {
+	return r.hashFunc != nil && r.quickHash <= 0
+}
+
+// readQuickHash computes the quick fingerprint of the file, see WithQuickHash.
+func (r *dirReader) readQuickHash(fi *FileInfo) error {
+	f, err := r.open(fi.PathAbs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// The size of the opened file, which differs from the listed one for symbolic links.
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := st.Size()
+	ra, err := readerAt(f)
+	if err != nil {
+		return err
+	}
+	h := r.hashFunc()
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(size))
+	_, _ = h.Write(b[:])
+
+	src := r.throttled(f)
+
+	// Files not larger than both ends are hashed in full.
+	if size <= 2*r.quickHash {
+		if _, err = io.Copy(h, src); err != nil {
+			return err
+		}
+	} else {
+		if _, err = io.CopyN(h, src, r.quickHash); err != nil {
+			return err
+		}
+		if _, err = io.Copy(h, r.throttled(io.NewSectionReader(ra, size-r.quickHash, r.quickHash))); err != nil {
+			return err
+		}
+	}
+
+	fi.QuickHash = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package dirreader
+
+import (
+	"container/heap"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsLargest is the number of largest files kept in Stats.
+const statsLargest = 10
+
+// Stats represents statistics collected during a scan, see WithStats.
+type Stats struct {
+	Files        int                 `json:"files"`           // Number of files returned by the scan.
+	Dirs         int                 `json:"dirs"`            // Number of directories read, including the root.
+	Bytes        int64               `json:"bytes"`           // Total size of the files, counting hard-linked files once.
+	Hardlinks    int                 `json:"hardlinks"`       // Number of files that are further links to an inode already counted.
+	Lines        int64               `json:"lines,omitempty"` // Total number of lines of the text files, see WithLineCount.
+	Extensions   map[string]ExtStats `json:"extensions"`      // Counts and sizes by lower-case extension, "" for none.
+	Largest      []FileInfo          `json:"largest"`         // Largest files, sorted by size in descending order.
+	DeepestPath  string              `json:"deepestPath"`     // Relative path of the most deeply nested file.
+	Depth        int                 `json:"depth"`           // Number of path elements of the deepest path.
+	Elapsed      time.Duration       `json:"elapsed"`         // Duration of the scan.
+	Skipped      []string            `json:"skipped"`         // Absolute paths skipped because access was denied, see WithSkipPermissionErrors.
+	Capabilities Capabilities        `json:"capabilities"`    // Metadata supported by the filesystem of the root and collected by the scan.
+	EmptyDirs    []EmptyDir          `json:"emptyDirs"`       // Directories without any file of the scan, not collected by indexed and limited scans.
+	largest      largestHeap         // Heap of the largest files collected so far.
+	inodes       map[inodeKey]bool   // Hard-linked inodes counted so far.
+}
+
+// ExtStats represents the statistics of the files sharing an extension.
+type ExtStats struct {
+	Files int   `json:"files"`           // Number of files.
+	Bytes int64 `json:"bytes"`           // Total size of the files, counting hard-linked files once.
+	Lines int64 `json:"lines,omitempty"` // Total number of lines of the text files, see WithLineCount.
+}
+
+// reset clears the statistics before a scan.
+func (st *Stats) reset() {
+	*st = Stats{Extensions: make(map[string]ExtStats), inodes: make(map[inodeKey]bool)}
+}
+
+// add accounts for a file returned by the scan.
+func (st *Stats) add(fi FileInfo) {
+	// Count the size of hard-linked files once, like du does.
+	size := fi.Size()
+	if k := (inodeKey{fi.Dev, fi.Ino}); fi.Ino != 0 && fi.Attrs["nlink"] != "1" {
+		if st.inodes[k] {
+			st.Hardlinks++
+			size = 0
+		}
+		st.inodes[k] = true
+	}
+
+	st.Files++
+	st.Bytes += size
+	st.Lines += fi.LineCount
+
+	ext := strings.ToLower(filepath.Ext(fi.Name()))
+	es := st.Extensions[ext]
+	es.Files++
+	es.Bytes += size
+	es.Lines += fi.LineCount
+	st.Extensions[ext] = es
+
+	rel := fi.RelPath()
+	if depth := len(strings.Split(filepath.ToSlash(rel), "/")); depth > st.Depth || (depth == st.Depth && rel < st.DeepestPath) {
+		st.Depth, st.DeepestPath = depth, rel
+	}
+
+	st.addLargest(fi)
+}
+
+// addLargest keeps the file if it is one of the largest files collected so far.
+func (st *Stats) addLargest(fi FileInfo) {
+	if len(st.largest) < statsLargest {
+		heap.Push(&st.largest, fi)
+	} else if fi.Size() > st.largest[0].Size() {
+		st.largest[0] = fi
+		heap.Fix(&st.largest, 0)
+	}
+}
+
+// merge accounts for the statistics of another scan, which must be finished.
+func (st *Stats) merge(o *Stats) {
+	st.Files += o.Files
+	st.Dirs += o.Dirs
+	st.Bytes += o.Bytes
+	st.Hardlinks += o.Hardlinks
+	st.Lines += o.Lines
+
+	for ext, oes := range o.Extensions {
+		es := st.Extensions[ext]
+		es.Files += oes.Files
+		es.Bytes += oes.Bytes
+		es.Lines += oes.Lines
+		st.Extensions[ext] = es
+	}
+
+	if o.Depth > st.Depth || (o.Depth == st.Depth && o.DeepestPath < st.DeepestPath) {
+		st.Depth, st.DeepestPath = o.Depth, o.DeepestPath
+	}
+
+	for _, fi := range o.Largest {
+		st.addLargest(fi)
+	}
+
+	st.Skipped = append(st.Skipped, o.Skipped...)
+	st.EmptyDirs = append(st.EmptyDirs, o.EmptyDirs...)
+	st.Capabilities.merge(o.Capabilities)
+}
+
+// finish sorts the largest files once the scan is complete.
+func (st *Stats) finish() {
+	st.Largest = append([]FileInfo(nil), st.largest...)
+	st.largest = nil
+	st.inodes = nil
+	sort.Strings(st.Skipped)
+	sort.Slice(st.Largest, func(i, j int) bool {
+		if st.Largest[i].Size() != st.Largest[j].Size() {
+			return st.Largest[i].Size() > st.Largest[j].Size()
+		}
+		return st.Largest[i].RelPath() < st.Largest[j].RelPath()
+	})
+}
+
+// largestHeap is a min-heap of files by size, so the smallest of the largest files is evicted first.
+type largestHeap []FileInfo
+
+func (h largestHeap) Len() int           { return len(h) }
+func (h largestHeap) Less(i, j int) bool { return h[i].Size() < h[j].Size() }
+func (h largestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *largestHeap) Push(x any)        { *h = append(*h, x.(FileInfo)) }
+
+func (h *largestHeap) Pop() any {
+	old := *h
+	fi := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return fi
+}
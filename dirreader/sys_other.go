@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package dirreader
+
+import "os"
+
+// sysInfo returns the owner and the platform-specific attributes of the file, which are not available.
+func sysInfo(os.FileInfo) (*Owner, map[string]string) {
+	return nil, nil
+}
+
+// device returns the ID of the device the file resides on, which is not available.
+func device(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// inode returns the device and inode numbers identifying the file, and its number of hard links, which are not available.
+func inode(os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
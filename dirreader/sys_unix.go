@@ -0,0 +1,40 @@
+//go:build unix
+
+package dirreader
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// sysInfo returns the owner and the platform-specific attributes of the file.
+func sysInfo(file os.FileInfo) (*Owner, map[string]string) {
+	st, ok := file.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, nil
+	}
+
+	return newOwner(uint32(st.Uid), uint32(st.Gid)), map[string]string{
+		"dev":    strconv.FormatUint(uint64(st.Dev), 10),
+		"ino":    strconv.FormatUint(uint64(st.Ino), 10),
+		"nlink":  strconv.FormatUint(uint64(st.Nlink), 10),
+		"blocks": strconv.FormatInt(int64(st.Blocks), 10),
+	}
+}
+
+// device returns the ID of the device the file resides on.
+func device(file os.FileInfo) (uint64, bool) {
+	if st, ok := file.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), true
+	}
+	return 0, false
+}
+
+// inode returns the device and inode numbers identifying the file, and its number of hard links.
+func inode(file os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	if st, ok := file.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino), uint64(st.Nlink), true
+	}
+	return 0, 0, 0, false
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package dirreader
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// sysInfo returns the owner and the platform-specific attributes of the file.
+// Ownership is not available from the file information on Windows.
+func sysInfo(file os.FileInfo) (*Owner, map[string]string) {
+	d, ok := file.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return nil, nil
+	}
+
+	return nil, map[string]string{
+		"attributes": "0x" + strconv.FormatUint(uint64(d.FileAttributes), 16),
+	}
+}
+
+// device returns the ID of the device the file resides on, which is not available from the file information.
+// Mounted volumes and junctions are reparse points that are not descended into anyway.
+func device(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// inode returns the device and inode numbers identifying the file, and its number of hard links,
+// which are not available from the file information on Windows without opening the file.
+func inode(os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,36 @@
+package dirreader
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the scans with the global tracer provider, see otel.SetTracerProvider: a scan is an
+// octopus.scan span, child of the span of the context of WithContext, with an octopus.traversal span for the listing
+// of the directories, which includes reading the files of unordered scans, and an octopus.hash span for reading the
+// files queued by WithOrder. Nothing is recorded unless the program embedding the package sets a provider.
+var tracer = otel.Tracer("github.com/gromey/octopus/dirreader")
+
+// startSpan starts a span named after the phase of a scan, as a child of the span of the scan context.
+func (r *dirReader) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = r.ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error of a phase, if any, and ends its span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,9 @@
+package dirreader
+
+import "golang.org/x/sys/unix"
+
+// xattrNamespaces lists the prefixes of the collected extended attributes, nil for all of them.
+var xattrNamespaces []string
+
+// errNoAttr is returned when reading an attribute that does not exist.
+var errNoAttr = unix.ENOATTR
@@ -0,0 +1,10 @@
+package dirreader
+
+import "golang.org/x/sys/unix"
+
+// xattrNamespaces lists the prefixes of the collected extended attributes.
+// The trusted.* and system.* namespaces are left out, as they are restricted or describe ACLs.
+var xattrNamespaces = []string{"user.", "security."}
+
+// errNoAttr is returned when reading an attribute that does not exist.
+var errNoAttr = unix.ENODATA
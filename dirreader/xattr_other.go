@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package dirreader
+
+// readXattrs returns no extended attributes on platforms that do not support them.
+func readXattrs(string) (map[string][]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+//go:build linux || darwin
+
+package dirreader
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of the file in the collected namespaces, without following symlinks.
+// A filesystem that does not support extended attributes yields no attributes and no error.
+func readXattrs(path string) (map[string][]byte, error) {
+	list, err := xattrCall(func(dest []byte) (int, error) { return unix.Llistxattr(path, dest) })
+	if err != nil || len(list) == 0 {
+		if unsupported(err) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	var attrs map[string][]byte
+	for _, name := range bytes.Split(bytes.TrimRight(list, "\x00"), []byte{0}) {
+		attr := string(name)
+		if !collected(attr) {
+			continue
+		}
+
+		value, err := xattrCall(func(dest []byte) (int, error) { return unix.Lgetxattr(path, attr, dest) })
+		if err != nil {
+			if errors.Is(err, errNoAttr) {
+				continue // The attribute was removed since the list was read.
+			}
+			return nil, err
+		}
+
+		if attrs == nil {
+			attrs = make(map[string][]byte)
+		}
+		attrs[attr] = value
+	}
+
+	return attrs, nil
+}
+
+// xattrCall calls fn first to size the buffer and then to fill it, retrying if the value grew in between.
+func xattrCall(fn func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		n, err := fn(nil)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n)
+		if n, err = fn(buf); err != nil {
+			if errors.Is(err, unix.ERANGE) {
+				continue
+			}
+			return nil, err
+		}
+
+		return buf[:n], nil
+	}
+}
+
+// collected reports whether the attribute belongs to one of the collected namespaces.
+func collected(attr string) bool {
+	if xattrNamespaces == nil {
+		return true
+	}
+	for _, ns := range xattrNamespaces {
+		if strings.HasPrefix(attr, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupported reports whether the error means that the filesystem does not support extended attributes.
+func unsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
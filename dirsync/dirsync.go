@@ -0,0 +1,326 @@
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/filecopy"
+	"github.com/gromey/octopus/hold"
+	"github.com/gromey/octopus/throttle"
+	"github.com/gromey/octopus/trash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of Sync with the global tracer provider, see otel.SetTracerProvider: an octopus.sync span,
+// child of the span of Options.Context, with the octopus.scan spans of both directories and an octopus.transfer span
+// for the copies and deletions.
+var tracer = otel.Tracer("github.com/gromey/octopus/dirsync")
+
+// Op represents the kind of operation performed on the destination.
+type Op string
+
+const (
+	Copy   Op = "copy"   // Copy the file from the source to the destination.
+	Delete Op = "delete" // Delete the file from the destination.
+)
+
+// Action represents a single operation performed, or planned in a dry run, on the destination.
+type Action struct {
+	Op   Op     `json:"op"`   // Kind of the operation.
+	Path string `json:"path"` // Relative path of the file.
+	Size int64  `json:"size"` // Size of the file.
+}
+
+// Options configures a synchronization.
+type Options struct {
+	HashFunc func() hash.Hash   // Compare files by hash when set, otherwise by size and modification time.
+	Mask     []string           // File extensions to include or exclude, see dirreader.Exec.
+	Include  bool               // Whether the mask includes or excludes files.
+	Scan     []dirreader.Option // Additional options of both scans, e.g. dirreader.WithSkipHidden.
+	Delete   bool               // Delete files from the destination that do not exist in the source.
+	DryRun   bool               // Only plan the actions without touching the destination.
+	Holds    *hold.Set          // Destination files covered by these holds are neither overwritten nor deleted (optional).
+	Audit    *audit.Log         // Log recording every file created, modified or deleted in the destination (optional).
+	Context  context.Context    // Stops the synchronization when done, after the action in progress (optional).
+	Verify   bool               // Hash the copied files while reading them, check them against their recorded hash and read them back.
+	Manifest map[string]string  // Recorded hashes by slash-separated relative path, e.g. from a checksum file (optional).
+	Delta    int64              // Minimum size of the files updated with a block delta rather than copied whole, see Result.Reused, 0 to never.
+	Trash    *trash.Trash       // Deleted files are moved to this trash rather than unlinked (optional).
+
+	Concurrency    int   // Maximum number of files copied or deleted at once, defaults to 1.
+	BandwidthLimit int64 // Maximum number of bytes read per second by all the copies together, unlimited if 0.
+	TransferLimit  int64 // Maximum number of bytes read per second by each copy, unlimited if 0.
+}
+
+// ErrMismatch is returned, wrapped, for the files whose content read while copying does not match their recorded hash,
+// or whose copy does not read back as the content read.
+var ErrMismatch = filecopy.ErrMismatch
+
+// Result represents the outcome of a synchronization.
+type Result struct {
+	Actions []Action `json:"actions"` // Performed or planned actions, sorted by path.
+	Copied  int      `json:"copied"`  // Number of copied files.
+	Deleted int      `json:"deleted"` // Number of deleted files.
+	Bytes   int64    `json:"bytes"`   // Number of copied bytes.
+	Reused  int64    `json:"reused"`  // Number of copied bytes left in place in the destination by block deltas.
+}
+
+// Sync makes the destination directory a copy of the source directory, one way:
+// new and changed files are copied with their mode and modification time, keeping sparse files sparse, and, if requested,
+// files missing from the source are deleted from the destination.
+// Actions on held destination files are refused and reported in the returned error, even in a dry run.
+// The destination is created if it does not exist. When the context of the options is done, the actions
+// performed so far are returned with the error of the context.
+//
+// Up to Concurrency files are copied or deleted at once, their reads throttled to the TransferLimit each and to
+// the BandwidthLimit together, on top of the limit of the process, see throttle.SetGlobal.
+//
+// Files are copied with filecopy.File, through a temporary file flushed to disk and renamed over the destination.
+// With Verify or a Manifest, and a HashFunc, the copied files are hashed while they are read and compared with
+// their hash in the manifest, or else with the hash of the source scan: the copy of a file whose content changed
+// since it was recorded is abandoned, leaving the destination untouched, and reported with ErrMismatch.
+// With Verify, the copies are also read back and compared with the content read, before they replace the destination.
+//
+// With a Delta size, the files of at least that size replacing a destination file are updated with the rsync
+// algorithm: the destination file is searched for the blocks of the source, and only the blocks that changed are
+// written, in a copy of the destination file cloned by the filesystem where possible. Sparse files are copied whole.
+//
+// With a Trash, the files deleted from the destination are moved to the trash, from where trash.Trash.Undo
+// restores them, and audited as moves to the trash rather than deletions.
+func Sync(src, dst string, opts Options) (*Result, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer.Start(ctx, "octopus.sync", trace.WithAttributes(attribute.String("octopus.src", src), attribute.String("octopus.dst", dst)))
+	defer span.End()
+	opts.Context = ctx
+
+	plan, err := planSteps(src, dst, opts)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+
+	_, transfer := tracer.Start(ctx, "octopus.transfer", trace.WithAttributes(attribute.Int("octopus.actions", len(plan))))
+
+	aggregate := throttle.New(opts.BandwidthLimit)
+	var stop int32
+	started := each(opts.Concurrency, len(plan), func() bool {
+		return atomic.LoadInt32(&stop) != 0 || opts.Context.Err() != nil
+	}, func(i int) {
+		s := &plan[i]
+		a := s.Action
+		if s.err = opts.Holds.Check(filepath.Join(dst, a.Path)); s.err != nil {
+			s.err = fmt.Errorf("%s %s: %w", a.Op, a.Path, s.err)
+			return
+		}
+		if opts.DryRun {
+			s.done = true
+			return
+		}
+
+		co := filecopy.Options{HashFunc: opts.HashFunc, Delta: opts.Delta, Limits: []*throttle.Limiter{aggregate, throttle.New(opts.TransferLimit)}}
+		if a.Op == Copy && opts.HashFunc != nil && (opts.Verify || opts.Manifest != nil) {
+			if co.Expected = opts.Manifest[filepath.ToSlash(a.Path)]; co.Expected == "" {
+				co.Expected = s.change.New.Hash
+			}
+			co.Verify = opts.Verify
+		}
+		var trashed string
+		if a.Op == Delete && opts.Trash != nil {
+			trashed, s.err = discard(opts.Trash, dst, a, "sync from "+src)
+		} else {
+			s.reused, s.err = apply(opts.Context, src, dst, a, co)
+		}
+		if s.err != nil {
+			return
+		}
+		s.done = true
+
+		op := audit.Modify
+		switch {
+		case s.change.Op == diff.Added:
+			op = audit.Create
+		case trashed != "":
+			op = audit.Move
+		case a.Op == Delete:
+			op = audit.Delete
+		}
+		if s.err = opts.Audit.Record(op, filepath.Join(dst, a.Path), trashed, "sync from "+src); s.err != nil {
+			// Stop rather than keep modifying the destination without an audit trail.
+			atomic.StoreInt32(&stop, 1)
+		}
+	})
+
+	res := new(Result)
+	for _, s := range plan {
+		err = errors.Join(err, s.err)
+		if !s.done {
+			continue
+		}
+		res.Actions = append(res.Actions, s.Action)
+		switch s.Op {
+		case Copy:
+			res.Copied++
+			res.Bytes += s.Size
+			res.Reused += s.reused
+		case Delete:
+			res.Deleted++
+		}
+	}
+	if started < len(plan) && opts.Context.Err() != nil {
+		err = errors.Join(err, opts.Context.Err())
+	}
+	transfer.SetAttributes(attribute.Int("octopus.copied", res.Copied), attribute.Int64("octopus.bytes", res.Bytes), attribute.Int("octopus.deleted", res.Deleted))
+	transfer.End()
+	recordError(span, err)
+
+	return res, err
+}
+
+// recordError records the error, if any, on the span and sets its status.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Plan scans both directories like Sync and returns the actions Sync would perform as a plan of operations, to be
+// reviewed and executed later with actions.Plan.Execute: copies of the new and changed files and, with Delete,
+// deletions of the files missing from the source, by absolute path. The holds, the trash and the options of
+// the copies are left to the execution.
+func Plan(src, dst string, opts Options) (*actions.Plan, error) {
+	plan, err := planSteps(src, dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if src, err = filepath.Abs(src); err != nil {
+		return nil, err
+	}
+	if dst, err = filepath.Abs(dst); err != nil {
+		return nil, err
+	}
+
+	p := new(actions.Plan)
+	for _, s := range plan {
+		switch s.Op {
+		case Copy:
+			p.Add(actions.Op{Kind: actions.Copy, Src: filepath.Join(src, s.Path), Dst: filepath.Join(dst, s.Path), Size: s.Size, Reason: "sync from " + src})
+		case Delete:
+			p.Add(actions.Op{Kind: actions.Delete, Src: filepath.Join(dst, s.Path), Size: s.Size, Reason: "sync from " + src})
+		}
+	}
+	return p, nil
+}
+
+// planSteps scans both directories and plans the actions of a synchronization, sorted by path.
+func planSteps(src, dst string, opts Options) ([]step, error) {
+	if opts.Context != nil {
+		opts.Scan = append(opts.Scan[:len(opts.Scan):len(opts.Scan)], dirreader.WithContext(opts.Context))
+	}
+
+	srcFiles, err := dirreader.Exec(src, opts.HashFunc, opts.Mask, opts.Include, opts.Scan...)
+	if err != nil {
+		return nil, err
+	}
+
+	var dstFiles []dirreader.FileInfo
+	if _, err = os.Stat(dst); err == nil {
+		if dstFiles, err = dirreader.Exec(dst, opts.HashFunc, opts.Mask, opts.Include, opts.Scan...); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var plan []step
+	for _, c := range diff.Compare(dstFiles, srcFiles) {
+		switch c.Op {
+		case diff.Added, diff.Modified:
+			plan = append(plan, step{Action: Action{Op: Copy, Path: c.Path, Size: c.New.Size()}, change: c})
+		case diff.Removed:
+			if opts.Delete {
+				plan = append(plan, step{Action: Action{Op: Delete, Path: c.Path, Size: c.Old.Size()}, change: c})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// step is an action planned by Sync and its outcome.
+type step struct {
+	Action
+	change diff.Change // Change the action applies.
+	done   bool        // Whether the action was performed, or planned in a dry run.
+	reused int64       // Number of bytes a block delta left in place.
+	err    error
+}
+
+// each calls fn for the indexes from 0 to n-1 in order, concurrency at once, at least one, until stop returns true,
+// and returns the number of calls started.
+func each(concurrency, n int, stop func() bool, fn func(i int)) int {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	i := 0
+	for ; i < n; i++ {
+		sem <- struct{}{}
+		if stop() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return i
+}
+
+// apply performs the action on the destination and returns the number of bytes a block delta left in place,
+// see filecopy.File.
+func apply(ctx context.Context, src, dst string, a Action, opts filecopy.Options) (int64, error) {
+	switch a.Op {
+	case Copy:
+		reused, err := filecopy.File(ctx, filepath.Join(src, a.Path), filepath.Join(dst, a.Path), opts)
+		if err != nil {
+			return 0, fmt.Errorf("copy %s: %w", a.Path, err)
+		}
+		return reused, nil
+	case Delete:
+		if err := os.Remove(filepath.Join(dst, a.Path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("delete %s: %w", a.Path, err)
+		}
+	}
+	return 0, nil
+}
+
+// discard moves the file of the delete action to the trash and returns its path in the trash, or an empty path
+// if the file no longer exists.
+func discard(t *trash.Trash, dst string, a Action, reason string) (string, error) {
+	trashed, err := t.Put(filepath.Join(dst, a.Path), reason, false)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("delete %s: %w", a.Path, err)
+	}
+	return trashed, nil
+}
@@ -0,0 +1,280 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownFormat is returned when the file is not an Office or PDF document.
+var ErrUnknownFormat = errors.New("unknown document format")
+
+// Report represents the embedded content found in a document.
+type Report struct {
+	Format   string   `json:"format"`             // Container format: "ooxml", "ole" or "pdf".
+	Macros   bool     `json:"macros"`             // Whether the document contains macros.
+	Embedded []string `json:"embedded,omitempty"` // Names of the embedded files and objects.
+	Active   []string `json:"active,omitempty"`   // Kinds of active content, e.g. "activex", "javascript" or "launch".
+}
+
+// Risky reports whether the document contains macros or active content.
+func (r *Report) Risky() bool {
+	return r.Macros || len(r.Active) > 0
+}
+
+// Inspect enumerates the embedded files, macros and active content of a document.
+// Supported formats are Office Open XML (docx, xlsx, pptx and their macro-enabled variants),
+// legacy Office compound files (doc, xls, ppt), and PDF. Files in other formats return ErrUnknownFormat.
+//
+// The inspection is structural and does not execute or decode the content: PDF objects stored in compressed
+// object streams are not seen, and macros in compound files are detected from the names of their storages.
+func Inspect(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %w", path, err)
+	}
+
+	var head [8]byte
+	n, _ := io.ReadFull(f, head[:])
+
+	var rep *Report
+	switch h := head[:n]; {
+	case bytes.HasPrefix(h, []byte("PK\x03\x04")):
+		rep, err = inspectOOXML(f, st.Size())
+	case bytes.HasPrefix(h, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		rep, err = inspectOLE(f)
+	case bytes.HasPrefix(h, []byte("%PDF-")):
+		rep, err = inspectPDF(f)
+	default:
+		err = ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %w", path, err)
+	}
+
+	sort.Strings(rep.Embedded)
+	sort.Strings(rep.Active)
+
+	return rep, nil
+}
+
+// inspectOOXML lists the parts of an Office Open XML package holding macros, embedded objects and ActiveX controls.
+// Zip archives that are not Office packages return ErrUnknownFormat.
+func inspectOOXML(r io.ReaderAt, size int64) (*Report, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{Format: "ooxml"}
+	var office, activeX bool
+	for _, f := range zr.File {
+		name := f.Name
+		dir := path.Base(path.Dir(name))
+
+		switch {
+		case name == "[Content_Types].xml":
+			office = true
+		case path.Base(name) == "vbaProject.bin":
+			rep.Macros = true
+		case dir == "embeddings":
+			rep.Embedded = append(rep.Embedded, name)
+		case dir == "activeX":
+			activeX = true
+		}
+	}
+	if !office {
+		return nil, ErrUnknownFormat
+	}
+	if activeX {
+		rep.Active = append(rep.Active, "activex")
+	}
+
+	return rep, nil
+}
+
+// oleMarkers maps the UTF-16 names of compound file storages to what they reveal about the document.
+var oleMarkers = []struct {
+	name   string
+	macros bool
+	object bool
+}{
+	{name: "_VBA_PROJECT", macros: true},
+	{name: "Macros", macros: true},
+	{name: "ObjectPool", object: true},
+	{name: "\x01Ole10Native", object: true},
+}
+
+// inspectOLE searches the directory entry names of a compound file for macro and embedded object storages.
+func inspectOLE(r io.ReadSeeker) (*Report, error) {
+	rep := &Report{Format: "ole"}
+
+	patterns := make([][]byte, len(oleMarkers))
+	for i, m := range oleMarkers {
+		patterns[i] = utf16le(m.name)
+	}
+
+	var objects int
+	err := scanFor(r, patterns, func(i int) {
+		switch m := oleMarkers[i]; {
+		case m.macros:
+			rep.Macros = true
+		case m.object:
+			objects++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < objects; i++ {
+		rep.Embedded = append(rep.Embedded, fmt.Sprintf("object %d", i+1))
+	}
+
+	return rep, nil
+}
+
+// pdfMarkers maps PDF names to the kind of content they introduce.
+var pdfMarkers = []struct {
+	name   string
+	active string
+}{
+	{name: "/EmbeddedFile"},
+	{name: "/JavaScript", active: "javascript"},
+	{name: "/JS", active: "javascript"},
+	{name: "/Launch", active: "launch"},
+	{name: "/OpenAction", active: "openaction"},
+	{name: "/AA", active: "openaction"},
+	{name: "/RichMedia", active: "richmedia"},
+	{name: "/XFA", active: "xfa"},
+}
+
+// inspectPDF searches the uncompressed objects of a PDF for embedded files and active content.
+func inspectPDF(r io.ReadSeeker) (*Report, error) {
+	rep := &Report{Format: "pdf"}
+
+	patterns := make([][]byte, len(pdfMarkers))
+	for i, m := range pdfMarkers {
+		patterns[i] = []byte(m.name)
+	}
+
+	var embedded int
+	active := make(map[string]bool)
+	err := scanFor(r, patterns, func(i int) {
+		if m := pdfMarkers[i]; m.active != "" {
+			active[m.active] = true
+		} else {
+			embedded++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < embedded; i++ {
+		rep.Embedded = append(rep.Embedded, fmt.Sprintf("file %d", i+1))
+	}
+	for kind := range active {
+		rep.Active = append(rep.Active, kind)
+	}
+
+	return rep, nil
+}
+
+// scanFor reads r from the beginning and calls found with the index of each occurrence of the patterns.
+// A pattern starting with "/" is a PDF name and must not be followed by a regular character,
+// so that e.g. "/JS" does not match "/JSON".
+func scanFor(r io.ReadSeeker, patterns [][]byte, found func(i int)) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var longest int
+	for _, p := range patterns {
+		if len(p) > longest {
+			longest = len(p)
+		}
+	}
+
+	// The tail of each chunk is kept at the beginning of the next one, so patterns spanning two chunks are found.
+	// Matches are identified by their absolute offset, so those found twice are reported once.
+	counted := make([]int64, len(patterns))
+	for i := range counted {
+		counted[i] = -1
+	}
+
+	buf := make([]byte, 64<<10)
+	var base int64 // Offset of buf[0] in the file.
+	var carry int
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		end := carry + n
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return err
+		}
+
+		for i, p := range patterns {
+			for off := 0; ; {
+				j := bytes.Index(buf[off:end], p)
+				if j < 0 {
+					break
+				}
+				start, next := off+j, off+j+len(p)
+				off = start + 1
+
+				if base+int64(start) <= counted[i] {
+					continue
+				}
+				if p[0] == '/' {
+					if next == end && !last {
+						continue // The next byte is unknown yet, the match is checked again in the next chunk.
+					}
+					if next < end && regular(buf[next]) {
+						continue
+					}
+				}
+
+				counted[i] = base + int64(start)
+				found(i)
+			}
+		}
+
+		if last {
+			return nil
+		}
+
+		if end > longest {
+			carry = copy(buf, buf[end-longest:end])
+			base += int64(end - longest)
+		} else {
+			carry = end
+		}
+	}
+}
+
+// regular reports whether c is a regular PDF character, i.e. neither whitespace nor a delimiter.
+func regular(c byte) bool {
+	return !strings.ContainsRune(" \t\r\n\f\x00()<>[]{}/%", rune(c))
+}
+
+// utf16le encodes an ASCII string as UTF-16LE.
+func utf16le(s string) []byte {
+	b := make([]byte, 0, 2*len(s))
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i], 0)
+	}
+	return b
+}
@@ -0,0 +1,238 @@
+package encryption
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Formats of the detected encrypted files.
+const (
+	Zip    = "zip"    // Zip archive with encrypted entries, legacy ZipCrypto or AES.
+	SevenZ = "7z"     // 7-Zip archive encrypted with AES.
+	PDF    = "pdf"    // PDF with an encryption dictionary, i.e. a user or an owner password.
+	Office = "office" // Password-protected Office Open XML document, wrapped in an encrypted compound file.
+	LUKS   = "luks"   // LUKS encrypted volume.
+	PGP    = "pgp"    // OpenPGP encrypted message, binary or ASCII-armored.
+	Age    = "age"    // age encrypted file.
+)
+
+// Magic numbers and markers of the supported formats.
+var (
+	magicZip       = []byte("PK\x03\x04")
+	magic7z        = []byte("7z\xbc\xaf\x27\x1c")
+	magicPDF       = []byte("%PDF-")
+	magicOLE       = []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	magicLUKS      = []byte("LUKS\xba\xbe")
+	magicAge       = []byte("age-encryption.org/")
+	armorPGP       = []byte("-----BEGIN PGP MESSAGE-----")
+	coderAES7z     = []byte{0x06, 0xf1, 0x07, 0x01}
+	markerPDF      = []byte("/Encrypt")
+	markerOffice   = utf16le("EncryptedPackage")
+	pdfTrailerSize = int64(1 << 20)
+)
+
+// Detect reports the format of the file if it is encrypted or password-protected, or "" otherwise.
+// Detection relies on the structure of the supported formats, see the format constants; the content is not decrypted
+// and files in other formats are reported as not encrypted.
+func Detect(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("detect encryption %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	st, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("detect encryption %s: %w", path, err)
+	}
+
+	head := make([]byte, 64)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("detect encryption %s: %w", path, err)
+	}
+	head, err = head[:n], nil
+
+	var format string
+	var ok bool
+	switch {
+	case bytes.HasPrefix(head, magicLUKS):
+		format, ok = LUKS, true
+	case bytes.HasPrefix(head, magicAge):
+		format, ok = Age, true
+	case bytes.HasPrefix(head, armorPGP):
+		format, ok = PGP, true
+	case bytes.HasPrefix(head, magicZip):
+		format = Zip
+		ok = zipEncrypted(f, st.Size())
+	case bytes.HasPrefix(head, magic7z):
+		format = SevenZ
+		ok, err = sevenZEncrypted(f, head)
+	case bytes.HasPrefix(head, magicPDF):
+		format = PDF
+		ok, err = pdfEncrypted(f, st.Size())
+	case bytes.HasPrefix(head, magicOLE):
+		format = Office
+		ok, err = contains(f, 0, st.Size(), markerOffice)
+	default:
+		format, ok = PGP, pgpPacket(head)
+	}
+	if err != nil {
+		return "", fmt.Errorf("detect encryption %s: %w", path, err)
+	}
+	if !ok {
+		return "", nil
+	}
+
+	return format, nil
+}
+
+// zipEncrypted reports whether any entry of the zip archive is encrypted. Malformed archives are not encrypted.
+func zipEncrypted(r io.ReaderAt, size int64) bool {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Flags&0x1 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sevenZEncrypted reports whether the header of the 7-Zip archive refers to the AES coder,
+// which is the case when the content or the header itself is encrypted.
+func sevenZEncrypted(r io.ReaderAt, head []byte) (bool, error) {
+	if len(head) < 32 {
+		return false, nil
+	}
+
+	offset := binary.LittleEndian.Uint64(head[12:20])
+	size := binary.LittleEndian.Uint64(head[20:28])
+	if size == 0 || size > 16<<20 || offset > 1<<62 {
+		return false, nil
+	}
+
+	hdr := make([]byte, size)
+	if _, err := r.ReadAt(hdr, 32+int64(offset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil // Truncated archive.
+		}
+		return false, err
+	}
+
+	return bytes.Contains(hdr, coderAES7z), nil
+}
+
+// pdfEncrypted reports whether the PDF has an encryption dictionary. The trailer, or the cross-reference stream
+// holding it, is searched at the end of the file, and at its beginning for linearized files.
+func pdfEncrypted(r io.ReaderAt, size int64) (bool, error) {
+	start := size - pdfTrailerSize
+	if start < 0 {
+		start = 0
+	}
+	if ok, err := contains(r, start, size, markerPDF); ok || err != nil || start == 0 {
+		return ok, err
+	}
+
+	end := pdfTrailerSize
+	if end > start {
+		end = start
+	}
+	return contains(r, 0, end, markerPDF)
+}
+
+// pgpPacket reports whether the data starts with an OpenPGP packet carrying an encrypted session key,
+// which begins every encrypted message.
+func pgpPacket(head []byte) bool {
+	if len(head) < 3 || head[0]&0x80 == 0 {
+		return false
+	}
+
+	var tag byte
+	var body []byte
+	if head[0]&0x40 != 0 { // New packet format.
+		tag = head[0] & 0x3f
+		switch l := head[1]; {
+		case l < 192:
+			body = head[2:]
+		case l < 224:
+			body = head[3:]
+		case l == 255:
+			if len(head) < 6 {
+				return false
+			}
+			body = head[6:]
+		default:
+			return false
+		}
+	} else { // Old packet format.
+		tag = head[0] >> 2 & 0x0f
+		switch head[0] & 0x03 {
+		case 0:
+			body = head[2:]
+		case 1:
+			body = head[3:]
+		case 2:
+			if len(head) < 5 {
+				return false
+			}
+			body = head[5:]
+		default:
+			return false
+		}
+	}
+	if len(body) == 0 {
+		return false
+	}
+
+	switch tag {
+	case 1: // Public-key encrypted session key.
+		return body[0] == 3 || body[0] == 6
+	case 3: // Symmetric-key encrypted session key.
+		return body[0] == 4 || body[0] == 5 || body[0] == 6
+	}
+	return false
+}
+
+// contains reports whether the marker occurs between the offsets start and end.
+func contains(r io.ReaderAt, start, end int64, marker []byte) (bool, error) {
+	buf := make([]byte, 64<<10)
+	overlap := int64(len(marker) - 1)
+	for off := start; off < end; {
+		n := int64(len(buf))
+		if end-off < n {
+			n = end - off
+		}
+		m, err := r.ReadAt(buf[:n], off)
+		if bytes.Contains(buf[:m], marker) {
+			return true, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+		if off+int64(m) >= end {
+			break
+		}
+		off += int64(m) - overlap
+	}
+	return false, nil
+}
+
+// utf16le encodes an ASCII string as UTF-16LE.
+func utf16le(s string) []byte {
+	b := make([]byte, 0, 2*len(s))
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i], 0)
+	}
+	return b
+}
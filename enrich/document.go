@@ -0,0 +1,66 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/document"
+)
+
+// Document inventories the embedded files, macros and active content of Office and PDF documents,
+// see document.Inspect, and records them in FileInfo.Meta under the following keys:
+//
+//	<Prefix>format    the container format: "ooxml", "ole" or "pdf"
+//	<Prefix>macros    "true" if the document contains macros, "false" otherwise
+//	<Prefix>embedded  the number of embedded files and objects
+//	<Prefix>active    the kinds of active content, separated by commas, if any
+//
+// Files in other formats get no labels.
+type Document struct {
+	Prefix      string // Prefix added to the label keys, e.g. "doc.".
+	Concurrency int    // Maximum number of files read at once, defaults to the number of CPUs.
+}
+
+// Enrich inspects the provided files and merges the labels into their Meta in place.
+// Files that cannot be read are skipped and their errors are joined.
+func (d *Document) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	return enrichAll(ctx, files, d.Stream)
+}
+
+// Stream is an asynchronous enrichment stage: it inspects the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all files are done.
+// Files that cannot be read are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (d *Document) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	return eachFile(ctx, in, d.Concurrency, d.inspect)
+}
+
+// inspect inventories the document and labels it.
+func (d *Document) inspect(fi *dirreader.FileInfo) error {
+	if fi.FileInfo == nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+
+	rep, err := document.Inspect(fi.PathAbs)
+	if err != nil {
+		if errors.Is(err, document.ErrUnknownFormat) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Meta == nil {
+		fi.Meta = make(map[string]string, 4)
+	}
+	fi.Meta[d.Prefix+"format"] = rep.Format
+	fi.Meta[d.Prefix+"macros"] = strconv.FormatBool(rep.Macros)
+	fi.Meta[d.Prefix+"embedded"] = strconv.Itoa(len(rep.Embedded))
+	if len(rep.Active) > 0 {
+		fi.Meta[d.Prefix+"active"] = strings.Join(rep.Active, ",")
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Classifier sends file descriptions to an external HTTP classifier, such as a DLP service or a document-type model,
+// and merges the labels it returns into FileInfo.Meta.
+//
+// The classifier receives POST requests with a JSON body
+//
+//	{"files": [{"path": "docs/a.pdf", "pathAbs": "/srv/docs/a.pdf", "size": 1024, "modTime": "...", "hash": "..."}]}
+//
+// and must respond with
+//
+//	{"results": [{"path": "docs/a.pdf", "labels": {"class": "confidential"}}]}
+//
+// Files missing from the response get no labels.
+type Classifier struct {
+	URL         string        // URL of the classifier endpoint.
+	Header      http.Header   // Additional request headers, e.g. Authorization.
+	Prefix      string        // Prefix added to the label keys, e.g. "dlp.".
+	BatchSize   int           // Maximum number of files per request, defaults to 100.
+	Concurrency int           // Maximum number of requests in flight, defaults to 4.
+	Rate        float64       // Maximum number of requests per second, unlimited if not positive.
+	Retries     int           // Number of retries on network errors, 429 and 5xx responses.
+	HTTP        *http.Client  // HTTP client to use, defaults to http.DefaultClient.
+	FlushAfter  time.Duration // Maximum time Stream waits to fill a batch, defaults to one second.
+	Logger      *slog.Logger  // Logs the retried requests as warnings (optional).
+}
+
+// fileRequest is the description of a file sent to the classifier.
+type fileRequest struct {
+	Path    string    `json:"path"`
+	PathAbs string    `json:"pathAbs"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// fileResult is the classification of a file returned by the classifier.
+type fileResult struct {
+	Path   string            `json:"path"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Enrich classifies the provided files and merges the returned labels into their Meta in place.
+// Batches are sent concurrently; errors of failed batches are joined and the other batches are still applied.
+func (c *Classifier) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	batchSize := c.batchSize()
+
+	var batches [][]*dirreader.FileInfo
+	for i := 0; i < len(files); i += batchSize {
+		end := i + batchSize
+		if end > len(files) {
+			end = len(files)
+		}
+
+		batch := make([]*dirreader.FileInfo, 0, end-i)
+		for j := i; j < end; j++ {
+			batch = append(batch, &files[j])
+		}
+		batches = append(batches, batch)
+	}
+
+	w := c.newWorkers(ctx)
+	for _, batch := range batches {
+		w.submit(batch)
+	}
+
+	return w.wait()
+}
+
+// Stream is an asynchronous enrichment stage: it classifies the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all batches are done.
+// Files are grouped into batches of up to BatchSize, and an incomplete batch is sent after FlushAfter.
+// Files of failed batches are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (c *Classifier) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	out := make(chan dirreader.FileInfo)
+	errc := make(chan error, 1)
+
+	flushAfter := c.FlushAfter
+	if flushAfter <= 0 {
+		flushAfter = time.Second
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+
+		w := c.newWorkers(ctx)
+		w.out = out
+
+		var batch []*dirreader.FileInfo
+		timer := time.NewTimer(flushAfter)
+		defer timer.Stop()
+
+		flush := func() {
+			if len(batch) > 0 {
+				w.submit(batch)
+				batch = nil
+			}
+		}
+
+	loop:
+		for {
+			select {
+			case fi, ok := <-in:
+				if !ok {
+					break loop
+				}
+				batch = append(batch, &fi)
+				if len(batch) >= c.batchSize() {
+					flush()
+				}
+			case <-timer.C:
+				flush()
+				timer.Reset(flushAfter)
+			}
+		}
+		flush()
+
+		if err := w.wait(); err != nil {
+			errc <- err
+		}
+	}()
+
+	return out, errc
+}
+
+func (c *Classifier) batchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+	return 100
+}
+
+// workers sends batches to the classifier with bounded concurrency and rate.
+type workers struct {
+	c    *Classifier
+	ctx  context.Context
+	wg   sync.WaitGroup
+	sem  chan struct{}
+	tick <-chan time.Time
+	stop func()
+	out  chan<- dirreader.FileInfo
+	mu   sync.Mutex
+	err  error
+}
+
+func (c *Classifier) newWorkers(ctx context.Context) *workers {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	w := &workers{c: c, ctx: ctx, sem: make(chan struct{}, concurrency), stop: func() {}}
+	if c.Rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / c.Rate))
+		w.tick, w.stop = t.C, t.Stop
+	}
+
+	return w
+}
+
+// submit waits for a free slot and the rate limiter, then classifies the batch in the background.
+func (w *workers) submit(batch []*dirreader.FileInfo) {
+	w.sem <- struct{}{}
+	if w.tick != nil {
+		select {
+		case <-w.tick:
+		case <-w.ctx.Done():
+		}
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer func() { <-w.sem }()
+		defer w.wg.Done()
+
+		if err := w.c.classify(w.ctx, batch); err != nil {
+			w.mu.Lock()
+			w.err = errors.Join(w.err, err)
+			w.mu.Unlock()
+		}
+
+		if w.out != nil {
+			for _, fi := range batch {
+				w.out <- *fi
+			}
+		}
+	}()
+}
+
+// wait waits for all submitted batches and returns their joined errors.
+func (w *workers) wait() error {
+	w.wg.Wait()
+	w.stop()
+	return w.err
+}
+
+// classify sends a batch to the classifier and merges the returned labels.
+func (c *Classifier) classify(ctx context.Context, batch []*dirreader.FileInfo) error {
+	req := struct {
+		Files []fileRequest `json:"files"`
+	}{Files: make([]fileRequest, len(batch))}
+
+	byPath := make(map[string]*dirreader.FileInfo, len(batch))
+	for i, fi := range batch {
+		path := filepath.ToSlash(fi.RelPath())
+		byPath[path] = fi
+		req.Files[i] = fileRequest{Path: path, PathAbs: fi.PathAbs, Size: fi.Size(), ModTime: fi.ModTime(), Hash: fi.Hash}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Results []fileResult `json:"results"`
+	}
+	if err = c.post(ctx, body, &resp); err != nil {
+		return fmt.Errorf("classify %d files starting with %s: %w", len(batch), batch[0].PathAbs, err)
+	}
+
+	for _, r := range resp.Results {
+		fi, ok := byPath[r.Path]
+		if !ok || len(r.Labels) == 0 {
+			continue
+		}
+		if fi.Meta == nil {
+			fi.Meta = make(map[string]string, len(r.Labels))
+		}
+		for k, v := range r.Labels {
+			fi.Meta[c.Prefix+k] = v
+		}
+	}
+
+	return nil
+}
+
+// post sends the body to the classifier, retrying with exponential backoff, and decodes the response into v.
+func (c *Classifier) post(ctx context.Context, body []byte, v any) error {
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, vs := range c.Header {
+			req.Header[k] = vs
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var retry bool
+		resp, err := hc.Do(req)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				err = json.NewDecoder(resp.Body).Decode(v)
+				_ = resp.Body.Close()
+				return err
+			}
+
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			_ = resp.Body.Close()
+
+			err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+			retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		} else {
+			retry = ctx.Err() == nil
+		}
+
+		if !retry || attempt >= c.Retries {
+			return err
+		}
+		if c.Logger != nil {
+			c.Logger.Warn("classifier request failed, retrying", "url", c.URL, "attempt", attempt+1, "delay", backoff, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
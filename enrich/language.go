@@ -0,0 +1,251 @@
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Language detects the language of text files and records it in FileInfo.Meta under two keys:
+//
+//	<Prefix>kind      "code" for source files, "text" for prose
+//	<Prefix>language  the programming language, e.g. "Go", or the ISO 639-1 code of the natural language, e.g. "en"
+//
+// Programming languages are detected from the file name and the shebang line, natural languages from the
+// frequency of common words, or from the script for languages not written in the Latin or Cyrillic alphabets.
+// Binary files and text files whose language cannot be determined get no labels.
+type Language struct {
+	Prefix      string // Prefix added to the label keys, e.g. "lang.".
+	MaxBytes    int    // Number of bytes read from each file, defaults to 8 KiB.
+	Concurrency int    // Maximum number of files read at once, defaults to the number of CPUs.
+}
+
+// Enrich detects the language of the provided files and merges the labels into their Meta in place.
+// Files that cannot be read are skipped and their errors are joined.
+func (l *Language) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	return enrichAll(ctx, files, l.Stream)
+}
+
+// Stream is an asynchronous enrichment stage: it detects the language of the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all files are done.
+// Files that cannot be read are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (l *Language) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	return eachFile(ctx, in, l.Concurrency, l.detect)
+}
+
+// detect reads the beginning of the file and labels it with its language.
+func (l *Language) detect(fi *dirreader.FileInfo) error {
+	if fi.FileInfo == nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+
+	maxBytes := l.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = 8 << 10
+	}
+
+	f, err := os.Open(fi.PathAbs)
+	if err != nil {
+		return fmt.Errorf("detect language %s: %w", fi.PathAbs, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	head, err := io.ReadAll(io.LimitReader(f, int64(maxBytes)))
+	if err != nil {
+		return fmt.Errorf("detect language %s: %w", fi.PathAbs, err)
+	}
+	if !isText(head) {
+		return nil
+	}
+
+	kind, lang := "code", codeLanguage(fi.Name(), head)
+	if lang == "" {
+		kind, lang = "text", textLanguage(head)
+	}
+	if lang == "" {
+		return nil
+	}
+
+	if fi.Meta == nil {
+		fi.Meta = make(map[string]string, 2)
+	}
+	fi.Meta[l.Prefix+"kind"] = kind
+	fi.Meta[l.Prefix+"language"] = lang
+
+	return nil
+}
+
+// isText reports whether the data looks like UTF-8 text. A multi-byte character cut at the end is tolerated.
+func isText(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return len(data) < utf8.UTFMax && !utf8.FullRune(data)
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+// codeExtensions maps file extensions to programming languages.
+var codeExtensions = map[string]string{
+	".go": "Go", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".cxx": "C++", ".hpp": "C++",
+	".cs": "C#", ".java": "Java", ".kt": "Kotlin", ".kts": "Kotlin", ".scala": "Scala", ".swift": "Swift",
+	".m": "Objective-C", ".rs": "Rust", ".zig": "Zig", ".py": "Python", ".rb": "Ruby", ".pl": "Perl", ".pm": "Perl",
+	".php": "PHP", ".js": "JavaScript", ".mjs": "JavaScript", ".cjs": "JavaScript", ".jsx": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".lua": "Lua", ".r": "R", ".jl": "Julia", ".dart": "Dart",
+	".ex": "Elixir", ".exs": "Elixir", ".erl": "Erlang", ".hs": "Haskell", ".ml": "OCaml", ".fs": "F#",
+	".clj": "Clojure", ".lisp": "Lisp", ".el": "Emacs Lisp", ".sh": "Shell", ".bash": "Shell", ".zsh": "Shell",
+	".ps1": "PowerShell", ".bat": "Batch", ".sql": "SQL", ".html": "HTML", ".htm": "HTML", ".css": "CSS",
+	".scss": "SCSS", ".vue": "Vue", ".proto": "Protocol Buffers", ".tf": "HCL", ".hcl": "HCL",
+	".yaml": "YAML", ".yml": "YAML", ".toml": "TOML", ".json": "JSON", ".xml": "XML",
+}
+
+// codeNames maps well-known file names to programming languages.
+var codeNames = map[string]string{
+	"makefile": "Makefile", "gnumakefile": "Makefile", "dockerfile": "Dockerfile", "containerfile": "Dockerfile",
+	"cmakelists.txt": "CMake", "rakefile": "Ruby", "gemfile": "Ruby", "jenkinsfile": "Groovy",
+}
+
+// shebangs maps interpreters found on the shebang line to programming languages.
+var shebangs = map[string]string{
+	"sh": "Shell", "bash": "Shell", "zsh": "Shell", "dash": "Shell", "ksh": "Shell",
+	"python": "Python", "python2": "Python", "python3": "Python", "perl": "Perl", "ruby": "Ruby",
+	"node": "JavaScript", "deno": "TypeScript", "php": "PHP", "lua": "Lua", "Rscript": "R", "pwsh": "PowerShell",
+}
+
+// codeLanguage returns the programming language of the file, or "" if it is not a source file.
+func codeLanguage(name string, head []byte) string {
+	if lang, ok := codeNames[strings.ToLower(name)]; ok {
+		return lang
+	}
+	if lang, ok := codeExtensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return lang
+	}
+
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line, _, _ := bufio.NewReader(bytes.NewReader(head[2:])).ReadLine()
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interp := filepath.Base(fields[0])
+	if interp == "env" {
+		// Skip the options of env, e.g. "#!/usr/bin/env -S python3 -u".
+		interp = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interp = f
+				break
+			}
+		}
+	}
+
+	return shebangs[interp]
+}
+
+// stopwords lists frequent words of the detected natural languages.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "this", "are", "be", "on", "not", "you"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "auf", "ich", "es"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "pour", "dans", "pas", "qui", "sur"},
+	"es": {"el", "la", "los", "las", "y", "que", "es", "en", "un", "una", "por", "con", "para", "del", "se", "no"},
+	"it": {"il", "lo", "la", "gli", "e", "che", "di", "è", "un", "una", "per", "non", "con", "del", "della"},
+	"pt": {"o", "os", "as", "e", "que", "de", "do", "da", "em", "um", "uma", "para", "com", "não", "é"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "ik", "je"},
+	"ru": {"и", "в", "не", "на", "что", "с", "как", "это", "по", "он", "я", "но", "из", "к", "у"},
+}
+
+// stopwordIndex maps every stopword to the languages it belongs to.
+var stopwordIndex = func() map[string][]string {
+	idx := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}()
+
+// textLanguage returns the ISO 639-1 code of the natural language of the text, or "" if it cannot be determined.
+func textLanguage(text []byte) string {
+	var letters, han, kana, hangul, arabic, hebrew, greek int
+	for _, r := range string(text) {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Hebrew, r):
+			hebrew++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Scripts used by a single language, or dominated by one, decide on their own.
+	switch half := letters / 2; {
+	case kana > 0 && kana+han > half:
+		return "ja"
+	case han > half:
+		return "zh"
+	case hangul > half:
+		return "ko"
+	case arabic > half:
+		return "ar"
+	case hebrew > half:
+		return "he"
+	case greek > half:
+		return "el"
+	}
+
+	scores := make(map[string]int)
+	var words int
+	for _, w := range strings.FieldsFunc(strings.ToLower(string(text)), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		words++
+		for _, lang := range stopwordIndex[w] {
+			scores[lang]++
+		}
+	}
+
+	best, bestScore := "", 0
+	for lang, score := range scores {
+		if score > bestScore || (score == bestScore && lang < best) {
+			best, bestScore = lang, score
+		}
+	}
+
+	// Require enough evidence, so that lists of identifiers or numbers are not labeled.
+	if bestScore < 3 || bestScore*10 < words {
+		return ""
+	}
+
+	return best
+}
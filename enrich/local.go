@@ -0,0 +1,87 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// eachFile runs fn on the files received from in, with up to concurrency files at once (the number of CPUs
+// if not positive), and sends them to the returned channel, which is closed once in is closed and all files are done.
+// The errors returned by fn are joined and sent on the error channel once processing is done.
+// Stages that inspect files locally use it to implement Stream.
+func eachFile(ctx context.Context, in <-chan dirreader.FileInfo, concurrency int, fn func(fi *dirreader.FileInfo) error) (<-chan dirreader.FileInfo, <-chan error) {
+	out := make(chan dirreader.FileInfo)
+	errc := make(chan error, 1)
+
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		err error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fi := range in {
+				if ctx.Err() == nil {
+					if e := fn(&fi); e != nil {
+						mu.Lock()
+						err = errors.Join(err, e)
+						mu.Unlock()
+					}
+				}
+				out <- fi
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		if err != nil {
+			errc <- err
+		}
+		close(errc)
+		close(out)
+	}()
+
+	return out, errc
+}
+
+// enrichAll passes the files through the stream and merges the labels it adds into their Meta in place.
+// Stages that inspect files locally use it to implement Enrich.
+func enrichAll(ctx context.Context, files []dirreader.FileInfo, stream func(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error)) error {
+	in := make(chan dirreader.FileInfo)
+	go func() {
+		defer close(in)
+		for _, fi := range files {
+			select {
+			case in <- fi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Files are sent back in any order, so their labels are matched by path.
+	byPath := make(map[string]*dirreader.FileInfo, len(files))
+	for i := range files {
+		byPath[files[i].PathAbs] = &files[i]
+	}
+
+	out, errc := stream(ctx, in)
+	for fi := range out {
+		if fi.Meta != nil {
+			byPath[fi.PathAbs].Meta = fi.Meta
+		}
+	}
+
+	return errors.Join(<-errc, ctx.Err())
+}
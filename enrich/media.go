@@ -0,0 +1,68 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/media"
+)
+
+// Media validates the container of video and audio files, see media.Probe, and records the outcome
+// in FileInfo.Meta under the following keys:
+//
+//	<Prefix>container  the container format, e.g. "mp4"
+//	<Prefix>duration   the duration in seconds, e.g. "12.480", if declared by the container
+//	<Prefix>ok         "true", or "false" if structural problems were found
+//	<Prefix>problems   the problems found, separated by "; "
+//
+// Files in other formats get no labels.
+type Media struct {
+	Prefix      string // Prefix added to the label keys, e.g. "media.".
+	Concurrency int    // Maximum number of files read at once, defaults to the number of CPUs.
+}
+
+// Enrich probes the provided files and merges the labels into their Meta in place.
+// Files that cannot be read are skipped and their errors are joined.
+func (m *Media) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	return enrichAll(ctx, files, m.Stream)
+}
+
+// Stream is an asynchronous enrichment stage: it probes the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all files are done.
+// Files that cannot be read are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (m *Media) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	return eachFile(ctx, in, m.Concurrency, m.probe)
+}
+
+// probe validates the container of the file and labels it.
+func (m *Media) probe(fi *dirreader.FileInfo) error {
+	if fi.FileInfo == nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+
+	info, err := media.Probe(fi.PathAbs)
+	if err != nil {
+		if errors.Is(err, media.ErrUnknownFormat) {
+			return nil
+		}
+		return err
+	}
+
+	if fi.Meta == nil {
+		fi.Meta = make(map[string]string, 4)
+	}
+	fi.Meta[m.Prefix+"container"] = info.Container
+	if info.Duration > 0 {
+		fi.Meta[m.Prefix+"duration"] = strconv.FormatFloat(info.Duration.Seconds(), 'f', 3, 64)
+	}
+	fi.Meta[m.Prefix+"ok"] = strconv.FormatBool(info.OK())
+	if !info.OK() {
+		fi.Meta[m.Prefix+"problems"] = strings.Join(info.Problems, "; ")
+	}
+
+	return nil
+}
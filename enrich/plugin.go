@@ -0,0 +1,64 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/plugins"
+)
+
+// Plugin labels files with an external plugin supporting plugins.Enrich, which receives the description of a file
+//
+//	{"path": "docs/a.pdf", "pathAbs": "/srv/docs/a.pdf", "size": 1024, "modTime": "...", "hash": "..."}
+//
+// and must respond with its labels, e.g. {"labels": {"class": "confidential"}}, which are merged into FileInfo.Meta.
+type Plugin struct {
+	Client      *plugins.Client // Running plugin, see plugins.Start.
+	Prefix      string          // Prefix added to the label keys, e.g. "scanner.".
+	Concurrency int             // Maximum number of files sent to the plugin at once, defaults to the number of CPUs.
+}
+
+// Enrich labels the provided files and merges the labels into their Meta in place.
+// The errors of the files the plugin failed to label are joined.
+func (p *Plugin) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	return enrichAll(ctx, files, p.Stream)
+}
+
+// Stream is an asynchronous enrichment stage: it labels the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all files are done.
+// Files the plugin failed to label are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (p *Plugin) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	return eachFile(ctx, in, p.Concurrency, func(fi *dirreader.FileInfo) error {
+		return p.label(ctx, fi)
+	})
+}
+
+// label sends the description of the file to the plugin and merges the returned labels.
+func (p *Plugin) label(ctx context.Context, fi *dirreader.FileInfo) error {
+	if fi.FileInfo == nil {
+		return nil
+	}
+
+	req := fileRequest{Path: filepath.ToSlash(fi.RelPath()), PathAbs: fi.PathAbs, Size: fi.Size(), ModTime: fi.ModTime(), Hash: fi.Hash}
+	var resp struct {
+		Labels map[string]string `json:"labels"`
+	}
+	if err := p.Client.Call(ctx, plugins.Enrich, req, &resp); err != nil {
+		return fmt.Errorf("label %s: %w", fi.PathAbs, err)
+	}
+
+	if len(resp.Labels) == 0 {
+		return nil
+	}
+	if fi.Meta == nil {
+		fi.Meta = make(map[string]string, len(resp.Labels))
+	}
+	for k, v := range resp.Labels {
+		fi.Meta[p.Prefix+k] = v
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package enrich
+
+import (
+	"context"
+
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/script"
+)
+
+// Script labels files with the annotate function of a script, see script.Script.Labels.
+type Script struct {
+	Script      *script.Script // Compiled script, see script.Load.
+	Prefix      string         // Prefix added to the label keys, e.g. "script.".
+	Concurrency int            // Maximum number of files labeled at once, defaults to the number of CPUs.
+}
+
+// Enrich labels the provided files and merges the labels into their Meta in place.
+// The errors of the files the script failed to label are joined.
+func (s *Script) Enrich(ctx context.Context, files []dirreader.FileInfo) error {
+	return enrichAll(ctx, files, s.Stream)
+}
+
+// Stream is an asynchronous enrichment stage: it labels the files received from in and sends them,
+// with their labels merged, to the returned channel, which is closed once in is closed and all files are done.
+// Files the script failed to label are passed through without labels and the errors are reported on the error channel,
+// which receives at most one joined error once processing is done.
+func (s *Script) Stream(ctx context.Context, in <-chan dirreader.FileInfo) (<-chan dirreader.FileInfo, <-chan error) {
+	return eachFile(ctx, in, s.Concurrency, s.label)
+}
+
+// label runs the script on the file and merges the returned labels.
+func (s *Script) label(fi *dirreader.FileInfo) error {
+	labels, err := s.Script.Labels(*fi)
+	if err != nil || len(labels) == 0 {
+		return err
+	}
+	if fi.Meta == nil {
+		fi.Meta = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		fi.Meta[s.Prefix+k] = v
+	}
+	return nil
+}
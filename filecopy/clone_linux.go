@@ -0,0 +1,42 @@
+package filecopy
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request number.
+const ficlone = 0x40049409
+
+// Clone creates dst as a copy-on-write clone of src using the FICLONE ioctl.
+func Clone(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	if err = out.Close(); errno != 0 || err != nil {
+		_ = os.Remove(dst)
+		if errno == syscall.EOPNOTSUPP || errno == syscall.EXDEV || errno == syscall.EINVAL || errno == syscall.ENOTTY {
+			return ErrCloneUnsupported
+		}
+		if errno != 0 {
+			return errno
+		}
+		return err
+	}
+
+	return os.Chtimes(dst, st.ModTime(), st.ModTime())
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package filecopy
+
+// Clone is not implemented on this platform.
+func Clone(_, _ string) error {
+	return ErrCloneUnsupported
+}
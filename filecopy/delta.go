@@ -0,0 +1,214 @@
+package filecopy
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"math"
+	"os"
+)
+
+// Bounds of the size of the blocks compared by deltaCopy, multiples of the 4 KiB blocks of common filesystems
+// so that a block left in place keeps its extents shared with the previous version.
+const (
+	minDeltaBlock = 4 << 10
+	maxDeltaBlock = 1 << 20
+)
+
+// deltaBlockSize returns the size of the blocks compared for a file of the size: about its square root, as rsync does.
+func deltaBlockSize(size int64) int {
+	bs := int64(math.Sqrt(float64(size)))
+	bs = (bs + minDeltaBlock - 1) / minDeltaBlock * minDeltaBlock
+	switch {
+	case bs < minDeltaBlock:
+		return minDeltaBlock
+	case bs > maxDeltaBlock:
+		return maxDeltaBlock
+	}
+	return int(bs)
+}
+
+// signatures indexes the blocks of a file with the rsync algorithm.
+type signatures struct {
+	size   int                 // Size of the blocks.
+	weak   map[uint32][]int    // Blocks by weak rolling checksum.
+	strong [][sha256.Size]byte // Strong hash of each block.
+}
+
+// newSignatures reads the file of the size and indexes its whole blocks of bs bytes.
+// The reads are subject to the limits.
+func newSignatures(ctx context.Context, f *os.File, size int64, bs int, limit limits) (*signatures, error) {
+	s := &signatures{size: bs, weak: make(map[uint32][]int)}
+	r := limit.reader(ctx, io.NewSectionReader(f, 0, size))
+	buf := make([]byte, bs)
+	for i := 0; int64(i+1)*int64(bs) <= size; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		a, b := weakSum(buf)
+		s.weak[checksum(a, b)] = append(s.weak[checksum(a, b)], i)
+		s.strong = append(s.strong, sha256.Sum256(buf))
+	}
+	return s, nil
+}
+
+// find returns the index of a block with the content p, of weak rolling checksum a and b, preferring the block at
+// the offset off, or -1 if there is none.
+func (s *signatures) find(p []byte, a, b uint32, off int64) int {
+	blocks := s.weak[checksum(a, b)]
+	if len(blocks) == 0 {
+		return -1
+	}
+	sum := sha256.Sum256(p)
+	found := -1
+	for _, i := range blocks {
+		if s.strong[i] != sum {
+			continue
+		}
+		if int64(i)*int64(s.size) == off {
+			return i
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found
+}
+
+// weakSum returns the two halves of the weak rolling checksum of p, as defined by rsync.
+func weakSum(p []byte) (a, b uint32) {
+	for i, c := range p {
+		a += uint32(c)
+		b += uint32(len(p)-i) * uint32(c)
+	}
+	return a, b
+}
+
+// roll returns the weak rolling checksum of a window of n bytes moved forward by a byte, from out to in.
+func roll(a, b uint32, out, in byte, n int) (uint32, uint32) {
+	a = a - uint32(out) + uint32(in)
+	b = b - uint32(n)*uint32(out) + a
+	return a, b
+}
+
+// checksum combines the halves of a weak rolling checksum.
+func checksum(a, b uint32) uint32 {
+	return a&0xffff | b<<16
+}
+
+// deltaCopy copies the content of in, of the size, to out as an update of basis, the previous version of the file,
+// with the rsync algorithm: the whole blocks of basis are indexed by a weak rolling checksum and a strong hash and
+// searched at every offset of in, then out, first made a copy of basis, is only written where its content changes.
+// Unchanged blocks are thus neither written nor, on filesystems cloning the copy, duplicated, see offloadCopy.
+// The content read is hashed with h unless h is nil, and the reads are subject to the limits.
+// deltaCopy returns the number of bytes left in place.
+func deltaCopy(ctx context.Context, out, in, basis *os.File, size int64, h hash.Hash, limit limits) (int64, error) {
+	st, err := basis.Stat()
+	if err != nil {
+		return 0, err
+	}
+	sigs, err := newSignatures(ctx, basis, st.Size(), deltaBlockSize(size), limit)
+	if err != nil {
+		return 0, err
+	}
+	if err = cloneFile(ctx, out, basis, st.Size(), limit); err != nil {
+		return 0, err
+	}
+
+	var reused int64
+	write := func(p []byte, off int64, inPlace bool) error {
+		if h != nil {
+			_, _ = h.Write(p)
+		}
+		if inPlace {
+			reused += int64(len(p))
+			return nil
+		}
+		_, err := out.WriteAt(p, off)
+		return err
+	}
+
+	var (
+		bs    = sigs.size
+		r     = limit.reader(ctx, io.NewSectionReader(in, 0, size))
+		buf   = make([]byte, 0, 4*bs) // Content of in from off not yet written, the window starting at i.
+		off   int64
+		i     int
+		a, b  uint32 // Weak rolling checksum of the window, if valid.
+		valid bool
+		eof   bool
+	)
+	for {
+		// Read the window and the byte it rolls over next.
+		for len(buf)-i <= bs && !eof {
+			n, err := r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if errors.Is(err, io.EOF) {
+				eof = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		if len(buf)-i < bs {
+			break
+		}
+
+		window := buf[i : i+bs]
+		if !valid {
+			a, b = weakSum(window)
+			valid = true
+		}
+		if blk := sigs.find(window, a, b, off+int64(i)); blk >= 0 {
+			if err = write(buf[:i], off, false); err != nil {
+				return 0, err
+			}
+			if err = write(window, off+int64(i), int64(blk)*int64(bs) == off+int64(i)); err != nil {
+				return 0, err
+			}
+			off += int64(i + bs)
+			buf = buf[:copy(buf, buf[i+bs:])]
+			i, valid = 0, false
+			continue
+		}
+		if len(buf)-i == bs {
+			break // The window ends the file.
+		}
+
+		a, b = roll(a, b, buf[i], buf[i+bs], bs)
+		if i++; i >= bs {
+			// Write the literal content that can no longer be part of a block, bounding the buffer.
+			if err = write(buf[:i], off, false); err != nil {
+				return 0, err
+			}
+			off += int64(i)
+			buf = buf[:copy(buf, buf[i:])]
+			i = 0
+		}
+	}
+	if err = write(buf, off, false); err != nil {
+		return 0, err
+	}
+
+	// Cut what remains of a longer previous version.
+	return reused, out.Truncate(off + int64(len(buf)))
+}
+
+// cloneFile makes out a copy of the size bytes of in, by the filesystem where possible, see offloadCopy.
+func cloneFile(ctx context.Context, out, in *os.File, size int64, limit limits) error {
+	if ok, err := offloadCopy(out, in, size); ok || err != nil {
+		if err == nil {
+			err = limit.wait(ctx, size)
+		}
+		return err
+	}
+	_, err := io.Copy(out, limit.reader(ctx, io.NewSectionReader(in, 0, size)))
+	return err
+}
+
+// dense reports whether the file of the size has no holes, or whether they cannot be listed on the platform.
+func dense(f *os.File, size int64) bool {
+	extents, err := dataExtents(f, size)
+	return err != nil || extents == nil || size == 0 || (len(extents) == 1 && extents[0] == extent{0, size})
+}
@@ -0,0 +1,200 @@
+// Package filecopy copies files safely: the content is written to a temporary file next to the destination,
+// flushed to disk, optionally checked against the expected hash and read back, then renamed over the destination,
+// so that readers, even after a crash, see either the previous or the new version of the file, never a partial one.
+package filecopy
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/throttle"
+)
+
+// maxTempPrefix is the longest part of the name of the destination kept in the name of its temporary file,
+// in bytes, so that the latter stays within the 255 bytes most filesystems allow.
+const maxTempPrefix = 200
+
+// ErrMismatch is returned, wrapped, when the content read does not match the expected hash, or the file written
+// does not read back as the content read.
+var ErrMismatch = errors.New("content does not match the recorded hash")
+
+// ErrCloneUnsupported is returned by Clone when copy-on-write clones are not supported by the platform or the filesystem.
+var ErrCloneUnsupported = errors.New("reflink is not supported")
+
+// Options configures a copy.
+type Options struct {
+	HashFunc func() hash.Hash    // Hashes the content for Expected and Verify.
+	Expected string              // Hash the content read must match, hex-encoded, not checked if empty.
+	Verify   bool                // Read back the file written and check that it has the hash of the content read.
+	Delta    int64               // Minimum size of the files updated with a block delta, see File, 0 to never.
+	Limits   []*throttle.Limiter // Throttle the reads, in addition to the limit of the process, see throttle.SetGlobal.
+}
+
+// File copies the file src to dst, creating the directory of dst if needed, and preserves the holes of sparse files,
+// the mode and the modification time. The copy is abandoned, leaving dst untouched, if the content does not
+// match the options, see ErrMismatch.
+//
+// A file of at least Delta bytes replacing a file without holes is updated with the rsync algorithm: only
+// the blocks of the destination that changed are written, in a copy of it cloned by the filesystem where possible,
+// and File returns the number of bytes left in place.
+func File(ctx context.Context, src, dst string, opts Options) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = in.Close() }()
+
+	st, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+
+	var basis *os.File
+	if opts.Delta > 0 && st.Size() >= opts.Delta && dense(in, st.Size()) {
+		if basis, err = os.Open(dst); err == nil {
+			defer func() { _ = basis.Close() }()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+
+	out, err := createTemp(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(out.Name()) }()
+
+	h := opts.hash()
+	var reused int64
+	if basis != nil {
+		reused, err = deltaCopy(ctx, out, in, basis, st.Size(), h, opts.limits())
+	} else {
+		err = copyContent(ctx, out, in, st.Size(), h, opts.limits())
+	}
+	if err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+
+	return reused, commit(ctx, out, dst, st.Mode().Perm(), st.ModTime(), h, opts)
+}
+
+// createTemp creates the temporary file of the destination, in its directory, under a unique hidden name.
+func createTemp(dst string) (*os.File, error) {
+	name := filepath.Base(dst)
+	if len(name) > maxTempPrefix {
+		name = strings.ToValidUTF8(name[:maxTempPrefix], "")
+	}
+	return os.CreateTemp(filepath.Dir(dst), "."+name+".octopus-*")
+}
+
+// commit flushes and closes the temporary file out holding the content hashed with h, if not nil, checks it as
+// the options require, sets its mode and modification time, and renames it to dst.
+func commit(ctx context.Context, out *os.File, dst string, mode os.FileMode, modTime time.Time, h hash.Hash, opts Options) error {
+	err := out.Sync()
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	if h != nil {
+		sum := hex.EncodeToString(h.Sum(nil))
+		if opts.Expected != "" && !strings.EqualFold(sum, opts.Expected) {
+			return fmt.Errorf("%w: expected %s, read %s", ErrMismatch, opts.Expected, sum)
+		}
+		if opts.Verify {
+			if err = verify(ctx, out.Name(), sum, opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = os.Chmod(out.Name(), mode); err != nil {
+		return err
+	}
+	if err = os.Chtimes(out.Name(), modTime, modTime); err != nil {
+		return err
+	}
+	if err = os.Rename(out.Name(), dst); err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// verify reads back the file at path and checks that it has the hash sum. The file was flushed to disk,
+// but may be read from the cache of the operating system rather than from the disk itself.
+func verify(ctx context.Context, path, sum string, opts Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := opts.HashFunc()
+	if _, err = io.Copy(h, opts.limits().reader(ctx, f)); err != nil {
+		return err
+	}
+	if back := hex.EncodeToString(h.Sum(nil)); back != sum {
+		return fmt.Errorf("%w: wrote %s, read back %s", ErrMismatch, sum, back)
+	}
+	return nil
+}
+
+// syncDir flushes the directory to disk, so that the rename of a file into it survives a crash. Errors are
+// ignored: some platforms and filesystems cannot sync directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// hash returns a new hash of the content read, or nil if the options do not require one.
+func (o *Options) hash() hash.Hash {
+	if o.HashFunc == nil || (o.Expected == "" && !o.Verify) {
+		return nil
+	}
+	return o.HashFunc()
+}
+
+// limits returns the limiters of the reads.
+func (o *Options) limits() limits {
+	return append(limits{throttle.Global()}, o.Limits...)
+}
+
+// limits throttles reads by several limiters at once, those that are not nil.
+type limits []*throttle.Limiter
+
+// reader returns r throttled by all the limiters.
+func (ls limits) reader(ctx context.Context, r io.Reader) io.Reader {
+	for _, l := range ls {
+		r = l.Reader(ctx, r)
+	}
+	return r
+}
+
+// wait takes n tokens from all the limiters.
+func (ls limits) wait(ctx context.Context, n int64) error {
+	for _, l := range ls {
+		if err := l.Wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
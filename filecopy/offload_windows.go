@@ -0,0 +1,91 @@
+package filecopy
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Control codes of the SMB server-side copy.
+const (
+	fsctlSrvRequestResumeKey = 0x00140078
+	fsctlSrvCopyChunkWrite   = 0x001480f2
+)
+
+// Limits of a server-side copy request, the defaults of Windows servers.
+const (
+	copyChunkLen   = 1 << 20
+	copyChunkCount = 16
+)
+
+// srvRequestResumeKey is the output of fsctlSrvRequestResumeKey, SRV_REQUEST_RESUME_KEY.
+type srvRequestResumeKey struct {
+	ResumeKey     [24]byte
+	ContextLength uint32
+	Context       [4]byte
+}
+
+// srvCopyChunk is a range to copy, SRV_COPYCHUNK.
+type srvCopyChunk struct {
+	SourceOffset int64
+	TargetOffset int64
+	Length       uint32
+	Reserved     uint32
+}
+
+// srvCopyChunkCopy is the input of fsctlSrvCopyChunkWrite, SRV_COPYCHUNK_COPY.
+type srvCopyChunkCopy struct {
+	SourceFile [24]byte
+	ChunkCount uint32
+	Reserved   uint32
+	Chunks     [copyChunkCount]srvCopyChunk
+}
+
+// srvCopyChunkResponse is the output of fsctlSrvCopyChunkWrite, SRV_COPYCHUNK_RESPONSE.
+type srvCopyChunkResponse struct {
+	ChunksWritten     uint32
+	ChunkBytesWritten uint32
+	TotalBytesWritten uint32
+}
+
+// offloadCopy copies the size bytes of in to out with an SMB server-side copy, so that the data of files
+// on the same share is copied by the server without passing through octopus.
+// It returns false if the files are not on an SMB share supporting it, so that the content is copied by reading it.
+func offloadCopy(out, in *os.File, size int64) (bool, error) {
+	var key srvRequestResumeKey
+	var n uint32
+	err := windows.DeviceIoControl(windows.Handle(in.Fd()), fsctlSrvRequestResumeKey,
+		nil, 0, (*byte)(unsafe.Pointer(&key)), uint32(unsafe.Sizeof(key)), &n, nil)
+	if err != nil {
+		return false, nil
+	}
+
+	var off int64
+	for off < size {
+		req := srvCopyChunkCopy{SourceFile: key.ResumeKey}
+		for o := off; o < size && req.ChunkCount < copyChunkCount; o += copyChunkLen {
+			l := size - o
+			if l > copyChunkLen {
+				l = copyChunkLen
+			}
+			req.Chunks[req.ChunkCount] = srvCopyChunk{SourceOffset: o, TargetOffset: o, Length: uint32(l)}
+			req.ChunkCount++
+		}
+
+		var resp srvCopyChunkResponse
+		err = windows.DeviceIoControl(windows.Handle(out.Fd()), fsctlSrvCopyChunkWrite,
+			(*byte)(unsafe.Pointer(&req)), uint32(unsafe.Sizeof(req)), (*byte)(unsafe.Pointer(&resp)), uint32(unsafe.Sizeof(resp)), &n, nil)
+		if err != nil {
+			if off == 0 {
+				return false, nil
+			}
+			return true, err
+		}
+		if resp.TotalBytesWritten == 0 {
+			break // The file shrank since it was listed.
+		}
+		off += int64(resp.TotalBytesWritten)
+	}
+	return true, nil
+}
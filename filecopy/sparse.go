@@ -0,0 +1,86 @@
+package filecopy
+
+import (
+	"context"
+	"hash"
+	"io"
+	"os"
+)
+
+// extent represents a range of a file holding data, as opposed to a hole of a sparse file.
+type extent struct {
+	off int64
+	len int64
+}
+
+// copyContent copies the content of in, of the size, to out and hashes it with h unless h is nil.
+// The holes of a sparse file are skipped rather than written, so they remain holes in out;
+// files that are not sparse, or whose holes cannot be listed on the platform, are copied as a whole,
+// by the filesystem where possible, see offloadCopy. The reads are subject to the limits.
+func copyContent(ctx context.Context, out, in *os.File, size int64, h hash.Hash, limit limits) error {
+
+	extents, err := dataExtents(in, size)
+	if err != nil || extents == nil || size == 0 || (len(extents) == 1 && extents[0] == extent{0, size}) {
+		// Let the filesystem copy the content if it need not be hashed.
+		if h == nil {
+			if ok, err := offloadCopy(out, in, size); ok || err != nil {
+				if err == nil {
+					err = limit.wait(ctx, size)
+				}
+				return err
+			}
+		}
+		// Listing the extents may have moved the offset of in.
+		if _, err = in.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		var w io.Writer = out
+		if h != nil {
+			w = io.MultiWriter(out, h)
+		}
+		_, err = io.Copy(w, limit.reader(ctx, in))
+		return err
+	}
+
+	if err = makeSparse(out); err != nil {
+		return err
+	}
+
+	var off int64
+	for _, e := range extents {
+		if h != nil {
+			if _, err = io.CopyN(h, zeros{}, e.off-off); err != nil {
+				return err
+			}
+		}
+		if _, err = out.Seek(e.off, io.SeekStart); err != nil {
+			return err
+		}
+		var w io.Writer = out
+		if h != nil {
+			w = io.MultiWriter(out, h)
+		}
+		if _, err = io.Copy(w, limit.reader(ctx, io.NewSectionReader(in, e.off, e.len))); err != nil {
+			return err
+		}
+		off = e.off + e.len
+	}
+	if h != nil {
+		if _, err = io.CopyN(h, zeros{}, size-off); err != nil {
+			return err
+		}
+	}
+
+	// Extend the file over the trailing hole, if any.
+	return out.Truncate(size)
+}
+
+// zeros reads an endless stream of zero bytes, the content of holes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
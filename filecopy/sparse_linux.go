@@ -0,0 +1,37 @@
+package filecopy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataExtents returns the ranges of the file holding data, found with SEEK_DATA and SEEK_HOLE.
+func dataExtents(f *os.File, size int64) ([]extent, error) {
+	fd := int(f.Fd())
+	list := []extent{}
+	for off := int64(0); off < size; {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			break // Only a hole remains.
+		}
+		if err != nil {
+			return nil, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		list = append(list, extent{off: data, len: hole - data})
+		off = hole
+	}
+	return list, nil
+}
+
+// makeSparse does nothing, seeking past the end of a file before writing leaves a hole on Linux.
+func makeSparse(*os.File) error {
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package filecopy
+
+import "os"
+
+// dataExtents returns no ranges on platforms where the holes of files cannot be listed, so files are copied as a whole.
+func dataExtents(*os.File, int64) ([]extent, error) {
+	return nil, nil
+}
+
+// makeSparse does nothing on platforms where the holes of files cannot be listed.
+func makeSparse(*os.File) error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package filecopy
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocatedRange is the input and output of FSCTL_QUERY_ALLOCATED_RANGES, FILE_ALLOCATED_RANGE_BUFFER.
+type allocatedRange struct {
+	Offset int64
+	Length int64
+}
+
+// dataExtents returns the ranges of the file holding data, found with FSCTL_QUERY_ALLOCATED_RANGES.
+// Files not marked sparse are reported as a single range.
+func dataExtents(f *os.File, size int64) ([]extent, error) {
+	query := allocatedRange{Offset: 0, Length: size}
+	buf := make([]allocatedRange, 64)
+	list := []extent{}
+	for query.Length > 0 {
+		var n uint32
+		err := windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_QUERY_ALLOCATED_RANGES,
+			(*byte)(unsafe.Pointer(&query)), uint32(unsafe.Sizeof(query)),
+			(*byte)(unsafe.Pointer(&buf[0])), uint32(len(buf))*uint32(unsafe.Sizeof(buf[0])), &n, nil)
+		if err != nil && err != windows.ERROR_MORE_DATA {
+			return nil, err
+		}
+
+		k := int(n / uint32(unsafe.Sizeof(buf[0])))
+		for _, r := range buf[:k] {
+			list = append(list, extent{off: r.Offset, len: r.Length})
+		}
+		if err == nil || k == 0 {
+			break
+		}
+		last := buf[k-1]
+		query.Offset = last.Offset + last.Length
+		query.Length = size - query.Offset
+	}
+	return list, nil
+}
+
+// makeSparse marks the file sparse, so that the ranges left unwritten are holes.
+func makeSparse(f *os.File) error {
+	var n uint32
+	return windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &n, nil)
+}
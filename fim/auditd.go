@@ -0,0 +1,230 @@
+package fim
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAuditTail is the number of bytes read from the end of the audit log to look up the changes.
+const maxAuditTail = 16 << 20
+
+// auditSlack is how long before the given time the system calls are looked up, since the changes are detected,
+// and the baselines taken, after the files were written.
+const auditSlack = 5 * time.Second
+
+// unsetAUID is the login user ID of the processes not started by a logged in user, e.g. daemons.
+const unsetAUID = "4294967295"
+
+// Actor represents who changed a file, from a system call recorded in the audit log.
+type Actor struct {
+	Time time.Time `json:"time"`           // Time of the system call.
+	User string    `json:"user,omitempty"` // Name of the login user, e.g. the user who ran sudo, or of the user of the process for daemons.
+	AUID string    `json:"auid,omitempty"` // Login user ID, empty for daemons.
+	UID  string    `json:"uid"`            // User ID of the process.
+	PID  int       `json:"pid"`            // ID of the process.
+	Comm string    `json:"comm,omitempty"` // Name of the command.
+	Exe  string    `json:"exe,omitempty"`  // Path of the executable.
+}
+
+// String returns a description of the actor, e.g. `alice (uid 0) with /usr/bin/vim at 2024-05-01T10:00:00Z`.
+func (a *Actor) String() string {
+	who := a.User
+	if who == "" {
+		who = "uid " + a.UID
+	} else {
+		who += " (uid " + a.UID + ")"
+	}
+	with := a.Exe
+	if with == "" {
+		with = a.Comm
+	}
+	return fmt.Sprintf("%s with %s (pid %d) at %s", who, with, a.PID, a.Time.Format(time.RFC3339))
+}
+
+// identify sets the actors of the alerts to the last processes the audit log of the profile records changing their
+// files since the time. The alerts are left unidentified when the log cannot be read or does not record them.
+func (p *Profile) identify(alerts []Alert, since time.Time) {
+	path := p.AuditLog
+	if path == "-" || len(alerts) == 0 {
+		return
+	}
+	if path == "" {
+		path = defaultAuditLog
+	}
+
+	wanted := make(map[string]bool, len(alerts))
+	for _, a := range alerts {
+		wanted[a.Path] = true
+	}
+	actors, err := lookupActors(path, wanted, since.Add(-auditSlack))
+	if err != nil {
+		return
+	}
+	for i := range alerts {
+		alerts[i].Actor = actors[alerts[i].Path]
+	}
+}
+
+// auditEvent is a system call of the audit log, made of several records sharing a serial number.
+type auditEvent struct {
+	time    time.Time
+	syscall map[string]string // Fields of the SYSCALL record, nil if not read.
+	cwd     string
+	names   []string
+}
+
+// lookupActors returns the last processes the audit log at path records changing the files wanted since the time,
+// by path. Only the end of the log is read, see maxAuditTail.
+func lookupActors(path string, wanted map[string]bool, since time.Time) (map[string]*Actor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxAuditTail {
+		if _, err = f.Seek(fi.Size()-maxAuditTail, io.SeekStart); err != nil {
+			return nil, err
+		}
+		br := bufio.NewReader(f)
+		// Skip the partial line.
+		if _, err = br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		r = br
+	}
+
+	events := make(map[string]*auditEvent)
+	var order []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		typ, serial, t, fields, ok := parseAuditRecord(sc.Text())
+		if !ok || t.Before(since) {
+			continue
+		}
+		e := events[serial]
+		if e == nil {
+			e = &auditEvent{time: t}
+			events[serial] = e
+			order = append(order, serial)
+		}
+		switch typ {
+		case "SYSCALL":
+			e.syscall = fields
+		case "CWD":
+			e.cwd = fields["cwd"]
+		case "PATH":
+			if name := fields["name"]; name != "" {
+				e.names = append(e.names, name)
+			}
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log %s: %w", path, err)
+	}
+
+	actors := make(map[string]*Actor)
+	for _, serial := range order {
+		e := events[serial]
+		if e.syscall == nil || e.syscall["success"] == "no" {
+			continue
+		}
+		for _, name := range e.names {
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(e.cwd, name)
+			}
+			if wanted[filepath.Clean(name)] {
+				actors[filepath.Clean(name)] = newActor(e)
+			}
+		}
+	}
+	return actors, nil
+}
+
+// newActor returns the actor of the system call.
+func newActor(e *auditEvent) *Actor {
+	a := &Actor{Time: e.time, UID: e.syscall["uid"], Comm: e.syscall["comm"], Exe: e.syscall["exe"]}
+	a.PID, _ = strconv.Atoi(e.syscall["pid"])
+	if auid := e.syscall["auid"]; auid != "" && auid != unsetAUID && auid != "unset" {
+		a.AUID = auid
+	}
+
+	id := a.AUID
+	if id == "" {
+		id = a.UID
+	}
+	if u, err := user.LookupId(id); err == nil {
+		a.User = u.Username
+	}
+	return a
+}
+
+// parseAuditRecord parses a line of the audit log, e.g.
+// `type=PATH msg=audit(1714557600.123:456): item=0 name="/etc/passwd" inode=42 nametype=NORMAL`, returning the type,
+// the serial number and the time of its event, and its fields.
+func parseAuditRecord(line string) (string, string, time.Time, map[string]string, bool) {
+	// The fields of the enriched format, after a group separator, repeat the raw ones with names resolved.
+	line, _, _ = strings.Cut(line, "\x1d")
+	rest, ok := strings.CutPrefix(line, "type=")
+	if !ok {
+		return "", "", time.Time{}, nil, false
+	}
+	typ, rest, _ := strings.Cut(rest, " ")
+	rest, ok = strings.CutPrefix(rest, "msg=audit(")
+	if !ok {
+		return "", "", time.Time{}, nil, false
+	}
+	stamp, rest, ok := strings.Cut(rest, "):")
+	if !ok {
+		return "", "", time.Time{}, nil, false
+	}
+	ts, serial, ok := strings.Cut(stamp, ":")
+	if !ok {
+		return "", "", time.Time{}, nil, false
+	}
+	secs, frac, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, nil, false
+	}
+	ms, _ := strconv.ParseInt(frac, 10, 64)
+	t := time.Unix(sec, ms*int64(time.Millisecond)).UTC()
+
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(rest) {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		fields[k] = auditValue(k, v)
+	}
+	return typ, serial, t, fields, true
+}
+
+// auditValue decodes a value of the audit log: quoted, hex-encoded for the strings with spaces or special
+// characters, or "(null)" for none.
+func auditValue(key, v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return v[1 : len(v)-1]
+	}
+	if v == "(null)" {
+		return ""
+	}
+	switch key {
+	case "name", "cwd", "comm", "exe":
+		if b, err := hex.DecodeString(v); err == nil {
+			return string(b)
+		}
+	}
+	return v
+}
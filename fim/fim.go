@@ -0,0 +1,538 @@
+// Package fim monitors the integrity of files: it takes a baseline of the files of a set of paths, hashed with HMAC
+// and sealed with the same key, so that an attacker able to modify the files cannot forge the baseline to match,
+// watches the paths for changes, with inotify on Linux and by rescanning them on the other platforms, and raises an
+// Alert for every file created, deleted, or whose content, permissions or owner differ from the baseline, with the
+// user and the program that changed it when the Linux audit log records them, see Profile.AuditRules.
+//
+// Profiles are defined in JSON:
+//
+//	{
+//	  "name": "system",
+//	  "paths": ["/etc", "/usr/local/bin", "/root/.ssh/authorized_keys"],
+//	  "exclude": ["*.swp", "mtab"],
+//	  "keyFile": "/etc/octopus/fim.key",
+//	  "baseline": "/var/lib/octopus/system.baseline",
+//	  "rescan": "30m",
+//	  "notify": [{"type": "syslog"}, {"type": "slack", "url": "https://hooks.slack.com/services/T000/B000/XXXX"}]
+//	}
+package fim
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/notify"
+)
+
+// ErrTampered is returned when a baseline does not match its seal: it was modified since it was taken, or it was
+// taken with another key.
+var ErrTampered = errors.New("baseline tampered")
+
+// defaultHash, defaultRescan and defaultAuditLog configure the profiles that do not set them.
+const (
+	defaultHash     = "sha256"
+	defaultRescan   = time.Hour
+	defaultAuditLog = "/var/log/audit/audit.log"
+)
+
+// AuditKey is the key of the audit rules of Profile.AuditRules, which the audit log is searched for.
+const AuditKey = "octopus-fim"
+
+// Profile represents a set of monitored paths.
+type Profile struct {
+	Name     string          `json:"name"`               // Name of the profile, for the alerts.
+	Paths    []string        `json:"paths"`              // Files and directories monitored, with the files below the directories.
+	Exclude  []string        `json:"exclude,omitempty"`  // Patterns of the names of the files and directories not monitored, see filepath.Match.
+	Hash     string          `json:"hash,omitempty"`     // Hash function of the HMAC, see hashes.Lookup, "sha256" if empty.
+	KeyFile  string          `json:"keyFile"`            // File holding the secret key of the HMAC.
+	Baseline string          `json:"baseline"`           // File the baseline is saved to.
+	Rescan   string          `json:"rescan,omitempty"`   // Interval of the full rescans, which catch the changes the watches miss, "1h" if empty.
+	AuditLog string          `json:"auditLog,omitempty"` // Audit log the changes are looked up in, /var/log/audit/audit.log if empty, none if "-".
+	Notify   []notify.Config `json:"notify,omitempty"`   // Notifiers the alerts are sent to.
+
+	rescan time.Duration
+	hash   func() hash.Hash
+}
+
+// LoadProfile reads and validates the profile defined in the JSON file at path.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load profile %s: %w", path, err)
+	}
+
+	p := new(Profile)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("load profile %s: %w", path, err)
+	}
+	if err = p.Validate(); err != nil {
+		return nil, fmt.Errorf("load profile %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// Validate checks that the profile is named, has absolute paths, a key file, a baseline file, valid exclusion
+// patterns, a hash function and a rescan interval. It cleans the paths and records the parsed settings.
+func (p *Profile) Validate() error {
+	var errs []error
+	if p.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if len(p.Paths) == 0 {
+		errs = append(errs, errors.New("paths are required"))
+	}
+	for i, path := range p.Paths {
+		if !filepath.IsAbs(path) {
+			errs = append(errs, fmt.Errorf("path %q is not absolute", path))
+		}
+		p.Paths[i] = filepath.Clean(path)
+	}
+	for _, pattern := range p.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("exclude %q: %w", pattern, err))
+		}
+	}
+	if p.KeyFile == "" {
+		errs = append(errs, errors.New("keyFile is required"))
+	}
+	if p.Baseline == "" {
+		errs = append(errs, errors.New("baseline is required"))
+	}
+
+	name := p.Hash
+	if name == "" {
+		name = defaultHash
+	}
+	h, err := hashes.Lookup(name)
+	switch {
+	case err != nil:
+		errs = append(errs, err)
+	case h == nil:
+		errs = append(errs, errors.New("a hash function is required"))
+	}
+	p.hash = h
+
+	p.rescan = defaultRescan
+	if p.Rescan != "" {
+		d, err := time.ParseDuration(p.Rescan)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid rescan %q", p.Rescan))
+		}
+		p.rescan = d
+	}
+	for i, c := range p.Notify {
+		if _, err := c.Notifier(); err != nil {
+			errs = append(errs, fmt.Errorf("notifier %d: %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Key reads the secret key of the HMAC from the key file.
+func (p *Profile) Key() ([]byte, error) {
+	key, err := os.ReadFile(p.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read HMAC key: %w", err)
+	}
+	if len(bytes.TrimSpace(key)) == 0 {
+		return nil, fmt.Errorf("read HMAC key: %s is empty", p.KeyFile)
+	}
+	return key, nil
+}
+
+// Notifier returns the notifiers of the profile, nil if it has none.
+func (p *Profile) Notifier() (notify.Notifier, error) {
+	if len(p.Notify) == 0 {
+		return nil, nil
+	}
+	m := make(notify.Multi, len(p.Notify))
+	for i, c := range p.Notify {
+		n, err := c.Notifier()
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i, err)
+		}
+		m[i] = n
+	}
+	return m, nil
+}
+
+// AuditRules returns the rules of auditctl recording the writes to the monitored paths and the changes of their
+// attributes, with the AuditKey, so that the alerts tell who changed the files, e.g. "-w /etc -p wa -k octopus-fim".
+func (p *Profile) AuditRules() []string {
+	rules := make([]string, len(p.Paths))
+	for i, path := range p.Paths {
+		rules[i] = fmt.Sprintf("-w %s -p wa -k %s", path, AuditKey)
+	}
+	return rules
+}
+
+// monitored reports whether the file at path is monitored: it is one of the paths or below one of them, and
+// neither it nor any of its parents below the path is excluded.
+func (p *Profile) monitored(path string) bool {
+	for _, root := range p.Paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if rel == "." {
+			return !p.excluded(filepath.Base(path))
+		}
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			if p.excluded(name) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// excluded reports whether the name matches an exclusion pattern.
+func (p *Profile) excluded(name string) bool {
+	for _, pattern := range p.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry represents the state of a monitored file.
+type Entry struct {
+	Hash    string      `json:"hash"`    // HMAC of the content, or of the target of a symbolic link, hex-encoded.
+	Size    int64       `json:"size"`    // Size in bytes.
+	Mode    fs.FileMode `json:"mode"`    // Type and permission bits.
+	UID     uint32      `json:"uid"`     // Numeric user ID of the owner, 0 where the platform does not expose it.
+	GID     uint32      `json:"gid"`     // Numeric group ID of the owner.
+	ModTime time.Time   `json:"modTime"` // Modification time.
+}
+
+// scan is the outcome of a scan: the monitored files found, by absolute path, and the errors of the files and
+// directories that could not be read.
+type scan struct {
+	files  map[string]Entry
+	failed map[string]error
+}
+
+// walk adds the monitored files at path, a file or a directory, to the scan, none if it does not exist.
+func (p *Profile) walk(ctx context.Context, key []byte, path string, sc *scan) error {
+	return filepath.WalkDir(path, func(abs string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				sc.failed[abs] = err
+			}
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !p.monitored(abs) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		e, err := p.stat(key, abs)
+		switch {
+		case err == nil:
+			sc.files[abs] = e
+		case !errors.Is(err, fs.ErrNotExist):
+			sc.failed[abs] = err
+		}
+		return nil
+	})
+}
+
+// scanPaths scans the monitored files at the paths.
+func (p *Profile) scanPaths(ctx context.Context, key []byte, paths []string) (*scan, error) {
+	sc := &scan{files: make(map[string]Entry), failed: make(map[string]error)}
+	for _, path := range paths {
+		if err := p.walk(ctx, key, path, sc); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// keep adds to the files of the scan the previous states of the files it failed to read, so that they are not
+// reported as removed.
+func (sc *scan) keep(prev map[string]Entry) {
+	for failed := range sc.failed {
+		for path, e := range prev {
+			if path == failed || strings.HasPrefix(path, failed+string(filepath.Separator)) {
+				if _, ok := sc.files[path]; !ok {
+					sc.files[path] = e
+				}
+			}
+		}
+	}
+}
+
+// err returns the errors of the files and directories the scan failed to read, sorted by path.
+func (sc *scan) err() error {
+	paths := make([]string, 0, len(sc.failed))
+	for path := range sc.failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		errs[i] = sc.failed[path]
+	}
+	return errors.Join(errs...)
+}
+
+// stat returns the state of the file at path, hashing its content, or its target if it is a symbolic link.
+func (p *Profile) stat(key []byte, path string) (Entry, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Size: fi.Size(), Mode: fi.Mode(), ModTime: fi.ModTime().UTC()}
+	e.UID, e.GID = owner(fi)
+
+	mac := hmac.New(p.hash, key)
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return Entry{}, err
+		}
+		mac.Write([]byte(target))
+	case fi.Mode().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return Entry{}, err
+		}
+		_, err = io.Copy(mac, f)
+		_ = f.Close()
+		if err != nil {
+			return Entry{}, fmt.Errorf("hash %s: %w", path, err)
+		}
+	}
+	e.Hash = hex.EncodeToString(mac.Sum(nil))
+	return e, nil
+}
+
+// Baseline represents the monitored files of a profile at a point in time, sealed with the key of the profile.
+type Baseline struct {
+	Profile string           `json:"profile"` // Name of the profile.
+	Created time.Time        `json:"created"` // Time the baseline was taken.
+	Hash    string           `json:"hash"`    // Hash function of the HMAC.
+	Files   map[string]Entry `json:"files"`   // Monitored files by absolute path.
+	Seal    string           `json:"seal"`    // HMAC of the other fields, hex-encoded.
+}
+
+// Take returns a baseline of the monitored files of the profile. The files that cannot be read are left out of
+// it, and their errors returned along with it.
+func Take(ctx context.Context, p *Profile, key []byte) (*Baseline, error) {
+	sc, err := p.scanPaths(ctx, key, p.Paths)
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{Profile: p.Name, Created: time.Now().UTC(), Hash: p.Hash, Files: sc.files}
+	if b.Hash == "" {
+		b.Hash = defaultHash
+	}
+	return b, sc.err()
+}
+
+// seal returns the seal of the baseline.
+func (b *Baseline) seal(h func() hash.Hash, key []byte) (string, error) {
+	v := *b
+	v.Seal = ""
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(h, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Save seals the baseline with the key, and writes it to the baseline file of the profile, readable by its owner
+// only. It writes to a temporary file first, so that a failed save never leaves a partial baseline behind.
+func (b *Baseline) Save(p *Profile, key []byte) error {
+	var err error
+	if b.Seal, err = b.seal(p.hash, key); err != nil {
+		return fmt.Errorf("save baseline %s: %w", p.Baseline, err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save baseline %s: %w", p.Baseline, err)
+	}
+
+	tmp := p.Baseline + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("save baseline %s: %w", p.Baseline, err)
+	}
+	if err = os.Rename(tmp, p.Baseline); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("save baseline %s: %w", p.Baseline, err)
+	}
+	return nil
+}
+
+// LoadBaseline reads the baseline file of the profile, and returns ErrTampered if it does not match its seal.
+func LoadBaseline(p *Profile, key []byte) (*Baseline, error) {
+	data, err := os.ReadFile(p.Baseline)
+	if err != nil {
+		return nil, fmt.Errorf("load baseline %s: %w", p.Baseline, err)
+	}
+	b := new(Baseline)
+	if err = json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("load baseline %s: %w", p.Baseline, err)
+	}
+
+	seal, err := b.seal(p.hash, key)
+	if err != nil {
+		return nil, fmt.Errorf("load baseline %s: %w", p.Baseline, err)
+	}
+	if !hmac.Equal([]byte(seal), []byte(b.Seal)) {
+		return nil, fmt.Errorf("load baseline %s: %w", p.Baseline, ErrTampered)
+	}
+	if b.Profile != p.Name {
+		return nil, fmt.Errorf("load baseline %s: taken for profile %q, not %q", p.Baseline, b.Profile, p.Name)
+	}
+	if b.Files == nil {
+		b.Files = make(map[string]Entry)
+	}
+	return b, nil
+}
+
+// Alert represents a change of a monitored file: what changed, when it was detected, and who changed it if known.
+type Alert struct {
+	Time    time.Time `json:"time"`              // Time the change was detected.
+	Profile string    `json:"profile"`           // Name of the profile.
+	Path    string    `json:"path"`              // Absolute path of the file.
+	Op      diff.Op   `json:"op"`                // Kind of the change.
+	Changed []string  `json:"changed,omitempty"` // What changed in a modified file: "content", "type", "permissions" or "owner".
+	Old     *Entry    `json:"old,omitempty"`     // Previous state of the file, nil if it was added.
+	New     *Entry    `json:"new,omitempty"`     // Current state of the file, nil if it was removed.
+	Actor   *Actor    `json:"actor,omitempty"`   // Who changed the file, from the audit log, nil if unknown.
+}
+
+// String returns a description of the alert on a single line, e.g.
+// `modified /etc/passwd (content, permissions) by alice (uid 0) with /usr/bin/vim at 2024-05-01T10:00:00Z`.
+func (a *Alert) String() string {
+	s := fmt.Sprintf("%s %s", a.Op, a.Path)
+	if len(a.Changed) > 0 {
+		s += " (" + strings.Join(a.Changed, ", ") + ")"
+	}
+	if a.Actor != nil {
+		s += " by " + a.Actor.String()
+	}
+	return s
+}
+
+// severity returns the severity of the alert: a warning for added files, critical otherwise.
+func (a *Alert) severity() notify.Severity {
+	if a.Op == diff.Added {
+		return notify.Warning
+	}
+	return notify.Critical
+}
+
+// Message returns the message of the alerts for notifiers, nil if there are none: the alert itself if there is
+// one, a summary listing them otherwise, critical unless all the files were added.
+func Message(profile string, alerts []Alert) *notify.Message {
+	if len(alerts) == 0 {
+		return nil
+	}
+	m := &notify.Message{Time: alerts[0].Time, Severity: notify.Warning, Event: "fim"}
+	lines := make([]string, len(alerts))
+	for i := range alerts {
+		lines[i] = alerts[i].String()
+		if alerts[i].severity() == notify.Critical {
+			m.Severity = notify.Critical
+		}
+	}
+	m.Subject = fmt.Sprintf("%s: %d monitored files changed", profile, len(alerts))
+	if len(alerts) == 1 {
+		m.Root = alerts[0].Path
+		m.Subject = fmt.Sprintf("%s: %s", profile, lines[0])
+	}
+	m.Body = notify.Lines(lines)
+	return m
+}
+
+// compare returns the alerts of the differences between the old and the new states of the files, sorted by path.
+func compare(profile string, old, new map[string]Entry, now time.Time) []Alert {
+	var alerts []Alert
+	for path, n := range new {
+		n := n
+		o, ok := old[path]
+		if !ok {
+			alerts = append(alerts, Alert{Time: now, Profile: profile, Path: path, Op: diff.Added, New: &n})
+			continue
+		}
+		if changed := changes(o, n); len(changed) > 0 {
+			o := o
+			alerts = append(alerts, Alert{Time: now, Profile: profile, Path: path, Op: diff.Modified, Changed: changed, Old: &o, New: &n})
+		}
+	}
+	for path, o := range old {
+		if _, ok := new[path]; !ok {
+			o := o
+			alerts = append(alerts, Alert{Time: now, Profile: profile, Path: path, Op: diff.Removed, Old: &o})
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Path < alerts[j].Path })
+	return alerts
+}
+
+// changes returns what differs between two states of a file. The modification time alone is not a change, since
+// it can be set to anything, while the content cannot be changed without changing its HMAC.
+func changes(old, new Entry) []string {
+	var changed []string
+	if old.Hash != new.Hash || old.Size != new.Size {
+		changed = append(changed, "content")
+	}
+	if old.Mode.Type() != new.Mode.Type() {
+		changed = append(changed, "type")
+	}
+	if old.Mode.Perm()|old.Mode&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) != new.Mode.Perm()|new.Mode&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) {
+		changed = append(changed, "permissions")
+	}
+	if old.UID != new.UID || old.GID != new.GID {
+		changed = append(changed, "owner")
+	}
+	return changed
+}
+
+// Check compares the monitored files of the profile with the baseline, and returns the alerts of the changes,
+// with who made them if the audit log of the profile records it. The files that cannot be read are not compared,
+// and their errors returned along with the alerts.
+func Check(ctx context.Context, p *Profile, key []byte, b *Baseline) ([]Alert, error) {
+	sc, err := p.scanPaths(ctx, key, p.Paths)
+	if err != nil {
+		return nil, err
+	}
+	sc.keep(b.Files)
+	alerts := compare(p.Name, b.Files, sc.files, time.Now().UTC())
+	p.identify(alerts, b.Created)
+	return alerts, sc.err()
+}
@@ -0,0 +1,151 @@
+package fim
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/notify"
+)
+
+// errNoWatch is returned by watch on the platforms without file system notifications.
+var errNoWatch = errors.New("watching files is not supported on this platform")
+
+// debounce is how long the monitor waits for more changes after one, since writing a file changes it many times.
+const debounce = time.Second
+
+// Monitor watches the monitored files of a profile, and raises alerts when they differ from their last known state,
+// the baseline at first, so that a change is reported once.
+type Monitor struct {
+	Profile  *Profile
+	Key      []byte               // Key of the HMAC.
+	Baseline *Baseline            // Baseline loaded with LoadBaseline.
+	Alert    func(alerts []Alert) // Called with the alerts of each batch of changes, from a single goroutine (optional).
+	Notifier notify.Notifier      // Sent a message for each batch of changes (optional).
+	Logger   *slog.Logger         // Logs the alerts, the files that cannot be read and the failed notifications (optional).
+}
+
+// Run compares the monitored files with the baseline, then watches them until the context is done, checking the
+// files as they change, and all of them on the rescan interval of the profile. Where the files cannot be watched,
+// the changes are only found by the rescans.
+func (m *Monitor) Run(ctx context.Context) error {
+	state := make(map[string]Entry, len(m.Baseline.Files))
+	for path, e := range m.Baseline.Files {
+		state[path] = e
+	}
+
+	changed := make(chan string, 256)
+	werr := make(chan error, 1)
+	go func() { werr <- watch(ctx, m.Profile, changed) }()
+
+	// The changes made while the files were not monitored are found by a first rescan.
+	lastScan := time.Now()
+	m.check(ctx, state, m.Profile.Paths, m.Baseline.Created)
+
+	rescan := time.NewTicker(m.Profile.rescan)
+	defer rescan.Stop()
+	var pending map[string]bool
+	var since time.Time
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-werr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			if m.Logger != nil {
+				m.Logger.Warn("cannot watch the files, relying on rescans", "profile", m.Profile.Name, "rescan", m.Profile.rescan, "error", err)
+			}
+			werr = nil
+		case path := <-changed:
+			if pending == nil {
+				pending, since = make(map[string]bool), time.Now()
+				flush = time.After(debounce)
+			}
+			pending[path] = true
+		case <-flush:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			m.check(ctx, state, paths, since)
+			pending, flush = nil, nil
+		case <-rescan.C:
+			now := time.Now()
+			m.check(ctx, state, m.Profile.Paths, lastScan)
+			lastScan = now
+		}
+	}
+}
+
+// check scans the monitored files at the paths, raises the alerts of their differences with the state, looking up
+// who made them since the time, and records them in the state.
+func (m *Monitor) check(ctx context.Context, state map[string]Entry, paths []string, since time.Time) {
+	sc, err := m.Profile.scanPaths(ctx, m.Key, paths)
+	if err != nil {
+		return
+	}
+	if err = sc.err(); err != nil && m.Logger != nil {
+		m.Logger.Warn("cannot read monitored files", "profile", m.Profile.Name, "error", err)
+	}
+
+	prev := make(map[string]Entry)
+	for path, e := range state {
+		if under(path, paths) {
+			prev[path] = e
+		}
+	}
+	sc.keep(prev)
+	alerts := compare(m.Profile.Name, prev, sc.files, time.Now().UTC())
+	for path := range prev {
+		delete(state, path)
+	}
+	for path, e := range sc.files {
+		state[path] = e
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	m.Profile.identify(alerts, since)
+	m.raise(ctx, alerts)
+}
+
+// raise logs the alerts, passes them to the Alert function and sends them to the notifier.
+func (m *Monitor) raise(ctx context.Context, alerts []Alert) {
+	if m.Logger != nil {
+		for _, a := range alerts {
+			attrs := []any{"profile", a.Profile, "path", a.Path, "op", a.Op}
+			if len(a.Changed) > 0 {
+				attrs = append(attrs, "changed", strings.Join(a.Changed, ","))
+			}
+			if a.Actor != nil {
+				attrs = append(attrs, "user", a.Actor.User, "uid", a.Actor.UID, "exe", a.Actor.Exe, "pid", a.Actor.PID)
+			}
+			m.Logger.Warn("monitored file changed", attrs...)
+		}
+	}
+	if m.Alert != nil {
+		m.Alert(alerts)
+	}
+	if m.Notifier != nil {
+		if err := m.Notifier.Notify(ctx, Message(m.Profile.Name, alerts)); err != nil && m.Logger != nil {
+			m.Logger.Error("notification failed", "profile", m.Profile.Name, "error", err)
+		}
+	}
+}
+
+// under reports whether the path is one of the paths or below one of them.
+func under(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fim
+
+import "io/fs"
+
+// owner returns 0, 0: the platform does not expose numeric owners.
+func owner(fs.FileInfo) (uint32, uint32) {
+	return 0, 0
+}
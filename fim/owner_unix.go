@@ -0,0 +1,16 @@
+//go:build unix
+
+package fim
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// owner returns the numeric user and group IDs of the owner of the file.
+func owner(fi fs.FileInfo) (uint32, uint32) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid
+	}
+	return 0, 0
+}
@@ -0,0 +1,143 @@
+package fim
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the events of the watched directories: the changes of the content and the attributes of their
+// files, and the files created, deleted and moved.
+const watchMask = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// watcher watches directories with inotify.
+type watcher struct {
+	fd   int
+	p    *Profile
+	dirs map[int32]string // Watched directories by watch descriptor.
+}
+
+// watch watches the monitored directories, the parent directories of the monitored files, and the directories
+// created below them, with inotify, and sends the paths of the files and directories changed until the context is
+// done. All the paths of the profile are sent when events are lost.
+func watch(ctx context.Context, p *Profile, changed chan<- string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	// The descriptor is non-blocking, so that reading it waits in the runtime poller, which closing it interrupts.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer func() { _ = f.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = f.Close() })
+	defer stop()
+
+	w := &watcher{fd: fd, p: p, dirs: make(map[int32]string)}
+	for _, path := range p.Paths {
+		fi, err := os.Stat(path)
+		switch {
+		case err == nil && fi.IsDir():
+			err = w.addTree(path)
+		default:
+			err = w.add(filepath.Dir(path))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	send := func(path string) bool {
+		select {
+		case changed <- path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("inotify: %w", err)
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := string(bytes.TrimRight(buf[off+unix.SizeofInotifyEvent:off+unix.SizeofInotifyEvent+size], "\x00"))
+			off += unix.SizeofInotifyEvent + size
+
+			switch {
+			case mask&unix.IN_Q_OVERFLOW != 0:
+				for _, path := range p.Paths {
+					if !send(path) {
+						return nil
+					}
+				}
+			case mask&unix.IN_IGNORED != 0:
+				delete(w.dirs, wd)
+			default:
+				dir, ok := w.dirs[wd]
+				if !ok {
+					continue
+				}
+				path := dir
+				if name != "" {
+					path = filepath.Join(dir, name)
+				}
+				if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && p.monitored(path) {
+					// The files created in the directory before it is watched are found by checking it.
+					_ = w.addTree(path)
+				}
+				if !send(path) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// add watches the directory.
+func (w *watcher) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("watch %s: inotify watch limit reached, raise it with sysctl fs.inotify.max_user_watches", dir)
+		}
+		return fmt.Errorf("watch %s: %w", dir, err)
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+// addTree watches the directory and the monitored directories below it.
+func (w *watcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directories that cannot be read are checked by the rescans.
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if !w.p.monitored(path) {
+			return filepath.SkipDir
+		}
+		return w.add(path)
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fim
+
+import "context"
+
+// watch returns errNoWatch: the changes are found by the rescans of the monitor.
+func watch(context.Context, *Profile, chan<- string) error {
+	return errNoWatch
+}
@@ -0,0 +1,235 @@
+// Package fixture builds reproducible directory trees and checks scan results against them,
+// so that programs integrating octopus can test their use of it deterministically:
+//
+//	tree := fixture.Tree{
+//	    {Path: "docs/a.txt", Content: "hello\n"},
+//	    {Path: "data/blob.bin", Size: 1 << 20, Mode: 0o600},
+//	    {Path: "docs/b.txt", Hardlink: "docs/a.txt"},
+//	    {Path: "latest", Symlink: "data/blob.bin"},
+//	}
+//	root := tree.BuildTemp(t)
+//	files, err := dirreader.Exec(root, sha256.New, nil, false)
+//	...
+//	tree.Assert(t, files, sha256.New)
+//
+// The generated content, modes and modification times only depend on the description of the tree,
+// so that hashes and other scan results can be compared with fixed values.
+package fixture
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// DefaultTime is the modification time of the entries that do not set one.
+var DefaultTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Entry describes a file, a directory or a link of a tree.
+type Entry struct {
+	Path     string      // Slash-separated path relative to the root of the tree.
+	Content  string      // Content of a file.
+	Size     int64       // Size of the content generated from the path when Content is empty.
+	Mode     fs.FileMode // Permission bits, 0644 for files and 0755 for directories if zero.
+	ModTime  time.Time   // Modification time, DefaultTime if zero.
+	Dir      bool        // Whether the entry is a directory, e.g. an empty one; parents are created implicitly.
+	Symlink  string      // Target of a symbolic link, as stored in the link.
+	Hardlink string      // Path of another file of the tree the entry is a hard link to.
+}
+
+// Tree is a list of entries making up a directory tree.
+type Tree []Entry
+
+// Data returns the content of the file described by the entry: Content, or else Size bytes generated from the path.
+func (e Entry) Data() []byte {
+	if e.Content != "" || e.Size == 0 {
+		return []byte(e.Content)
+	}
+
+	data := make([]byte, 0, e.Size+sha256.Size)
+	var block [8]byte
+	for i := uint64(0); int64(len(data)) < e.Size; i++ {
+		binary.BigEndian.PutUint64(block[:], i)
+		sum := sha256.Sum256(append([]byte(e.Path), block[:]...))
+		data = append(data, sum[:]...)
+	}
+	return data[:e.Size]
+}
+
+// Build creates the tree in dir, which is created if needed. Hard links are created after the files they link to,
+// and the modes and times of directories are set last, so that filling them does not change them.
+func (t Tree) Build(dir string) error {
+	byPath := make(map[string]Entry, len(t))
+	for _, e := range t {
+		byPath[path.Clean(e.Path)] = e
+	}
+
+	var links, dirs []Entry
+	for _, e := range t {
+		p := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return fmt.Errorf("build %s: %w", e.Path, err)
+		}
+
+		var err error
+		switch {
+		case e.Dir:
+			err = os.MkdirAll(p, 0o755)
+			dirs = append(dirs, e)
+		case e.Hardlink != "":
+			links = append(links, e)
+		case e.Symlink != "":
+			err = os.Symlink(filepath.FromSlash(e.Symlink), p)
+		default:
+			err = os.WriteFile(p, e.Data(), 0o644)
+			if err == nil {
+				err = setAttrs(p, e, 0o644)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("build %s: %w", e.Path, err)
+		}
+	}
+
+	for _, e := range links {
+		target, ok := byPath[path.Clean(e.Hardlink)]
+		if !ok {
+			return fmt.Errorf("build %s: hard link target %s is not in the tree", e.Path, e.Hardlink)
+		}
+		err := os.Link(filepath.Join(dir, filepath.FromSlash(target.Path)), filepath.Join(dir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			return fmt.Errorf("build %s: %w", e.Path, err)
+		}
+	}
+
+	// Set the deepest directories first, so that setting a parent is not undone by setting a child.
+	sort.Slice(dirs, func(i, j int) bool { return strings.Count(dirs[i].Path, "/") > strings.Count(dirs[j].Path, "/") })
+	for _, e := range dirs {
+		if err := setAttrs(filepath.Join(dir, filepath.FromSlash(e.Path)), e, 0o755); err != nil {
+			return fmt.Errorf("build %s: %w", e.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// BuildTemp builds the tree in a temporary directory removed when the test ends, and returns the directory.
+// It stops the test if the tree cannot be built.
+func (t Tree) BuildTemp(tb testing.TB) string {
+	tb.Helper()
+	dir := tb.TempDir()
+
+	// Make read-only directories writable again before the temporary directory is removed.
+	tb.Cleanup(func() {
+		for _, e := range t {
+			if e.Dir {
+				_ = os.Chmod(filepath.Join(dir, filepath.FromSlash(e.Path)), 0o755)
+			}
+		}
+	})
+
+	if err := t.Build(dir); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+// Assert reports an error to tb for each difference between the files returned by a scan of the tree and the tree:
+// files missing from the scan or not in the tree, and files whose size, modification time or, if hashFunc is not nil
+// and the scan hashed them, hash differ. Directories are not expected in the scan, links are expected as files.
+func (t Tree) Assert(tb testing.TB, files []dirreader.FileInfo, hashFunc func() hash.Hash) {
+	tb.Helper()
+
+	expected := t.files()
+	seen := make(map[string]bool, len(files))
+	for _, fi := range files {
+		p := path.Clean(filepath.ToSlash(fi.RelPath()))
+		seen[p] = true
+		e, ok := expected[p]
+		if !ok {
+			tb.Errorf("%s: scanned but not in the tree", p)
+			continue
+		}
+		if e.Symlink != "" {
+			continue
+		}
+
+		data := e.Data()
+		if fi.Size() != int64(len(data)) {
+			tb.Errorf("%s: size %d, want %d", p, fi.Size(), len(data))
+		}
+		if want := modTime(e); !fi.ModTime().Equal(want) {
+			tb.Errorf("%s: modification time %s, want %s", p, fi.ModTime(), want)
+		}
+		if hashFunc != nil && fi.Hash != "" {
+			h := hashFunc()
+			_, _ = h.Write(data)
+			if want := hex.EncodeToString(h.Sum(nil)); fi.Hash != want {
+				tb.Errorf("%s: hash %s, want %s", p, fi.Hash, want)
+			}
+		}
+	}
+
+	var missing []string
+	for p := range expected {
+		if !seen[p] {
+			missing = append(missing, p)
+		}
+	}
+	sort.Strings(missing)
+	for _, p := range missing {
+		tb.Errorf("%s: in the tree but not scanned", p)
+	}
+}
+
+// files returns the entries expected in a scan by their cleaned path, hard links resolved to their targets.
+func (t Tree) files() map[string]Entry {
+	byPath := make(map[string]Entry, len(t))
+	for _, e := range t {
+		byPath[path.Clean(e.Path)] = e
+	}
+
+	files := make(map[string]Entry, len(t))
+	for p, e := range byPath {
+		if e.Dir {
+			continue
+		}
+		if e.Hardlink != "" {
+			e = byPath[path.Clean(e.Hardlink)]
+		}
+		files[p] = e
+	}
+	return files
+}
+
+// setAttrs sets the mode and the modification time of the entry at p, defaulting to mode.
+func setAttrs(p string, e Entry, mode fs.FileMode) error {
+	if e.Mode != 0 {
+		mode = e.Mode
+	}
+	if err := os.Chmod(p, mode); err != nil {
+		return err
+	}
+	t := modTime(e)
+	return os.Chtimes(p, t, t)
+}
+
+// modTime returns the modification time of the entry.
+func modTime(e Entry) time.Time {
+	if e.ModTime.IsZero() {
+		return DefaultTime
+	}
+	return e.ModTime
+}
@@ -0,0 +1,46 @@
+package fleet
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// Jitter returns a random duration in [0, max), used to spread the start of scheduled scans across hosts.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// HostJitter returns a duration in [0, max) derived from the host name.
+// Unlike Jitter it is stable across restarts, so each host keeps its own slot and hosts stay evenly spread.
+func HostJitter(host string, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(host))
+
+	return time.Duration(h.Sum64() % uint64(max))
+}
+
+// Sleep waits for the provided duration or until the context is done, whichever happens first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,334 @@
+package fleet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Grant represents the answer of the token server to an acquire or renew request.
+type Grant struct {
+	Token    string        `json:"token,omitempty"`  // Token identifying the lease, empty if no token is granted.
+	TTL      time.Duration `json:"ttl"`              // Time after which the lease expires unless renewed.
+	Capacity int           `json:"capacity"`         // Number of scans the server allows to run concurrently.
+	Active   int           `json:"active"`           // Number of leases currently held.
+	Retry    time.Duration `json:"retry,omitempty"`  // Suggested delay before retrying when no token is available.
+	Holder   string        `json:"holder,omitempty"` // Holder of the lease.
+	Expires  time.Time     `json:"expires"`          // Expiration time of the lease.
+}
+
+// TokenServer is an http.Handler advertising a fixed number of concurrency tokens to the fleet.
+// A host must hold a token to run a scan against the shared storage, so at most Capacity scans run at once.
+// Tokens are leases that expire unless renewed, so a crashed host cannot hold a token forever.
+//
+// Endpoints:
+//   - POST /acquire?holder=<name>: acquire a token, 200 with the grant or 429 with a Retry-After header.
+//   - POST /renew?token=<token>: extend a lease, 404 if it expired.
+//   - POST /release?token=<token>: release a lease.
+//   - GET /status: current capacity and active leases.
+type TokenServer struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	leases   map[string]lease
+	mux      *http.ServeMux
+}
+
+// lease represents a token held by a host.
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewTokenServer returns a token server allowing capacity concurrent leases that expire after ttl unless renewed.
+func NewTokenServer(capacity int, ttl time.Duration) *TokenServer {
+	s := &TokenServer{
+		capacity: capacity,
+		ttl:      ttl,
+		leases:   make(map[string]lease),
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/acquire", s.post(s.acquire))
+	s.mux.HandleFunc("/renew", s.post(s.renew))
+	s.mux.HandleFunc("/release", s.post(s.release))
+	s.mux.HandleFunc("/status", s.status)
+
+	return s
+}
+
+// SetCapacity changes the number of concurrent leases. Leases above the new capacity are not revoked,
+// but no new token is granted until enough of them are released.
+func (s *TokenServer) SetCapacity(capacity int) {
+	s.mu.Lock()
+	s.capacity = capacity
+	s.mu.Unlock()
+}
+
+// ServeHTTP implements http.Handler.
+func (s *TokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// post restricts the handler to the POST method.
+func (s *TokenServer) post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *TokenServer) acquire(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	if len(s.leases) >= s.capacity {
+		// Suggest retrying when the earliest lease expires at the latest.
+		retry := s.ttl
+		for _, l := range s.leases {
+			if d := time.Until(l.expires); d < retry {
+				retry = d
+			}
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)+1))
+		writeGrant(w, http.StatusTooManyRequests, Grant{Capacity: s.capacity, Active: len(s.leases), Retry: retry})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	l := lease{holder: r.URL.Query().Get("holder"), expires: time.Now().Add(s.ttl)}
+	s.leases[token] = l
+
+	writeGrant(w, http.StatusOK, s.grant(token, l))
+}
+
+func (s *TokenServer) renew(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	token := r.URL.Query().Get("token")
+	l, ok := s.leases[token]
+	if !ok {
+		writeGrant(w, http.StatusNotFound, Grant{Capacity: s.capacity, Active: len(s.leases)})
+		return
+	}
+
+	l.expires = time.Now().Add(s.ttl)
+	s.leases[token] = l
+
+	writeGrant(w, http.StatusOK, s.grant(token, l))
+}
+
+func (s *TokenServer) release(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.leases, r.URL.Query().Get("token"))
+	s.expire()
+
+	writeGrant(w, http.StatusOK, Grant{Capacity: s.capacity, Active: len(s.leases)})
+}
+
+func (s *TokenServer) status(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	writeGrant(w, http.StatusOK, Grant{Capacity: s.capacity, Active: len(s.leases), TTL: s.ttl})
+}
+
+// expire removes expired leases. The caller must hold the lock.
+func (s *TokenServer) expire() {
+	now := time.Now()
+	for token, l := range s.leases {
+		if now.After(l.expires) {
+			delete(s.leases, token)
+		}
+	}
+}
+
+// grant returns the grant of the lease. The caller must hold the lock.
+func (s *TokenServer) grant(token string, l lease) Grant {
+	return Grant{
+		Token:    token,
+		TTL:      s.ttl,
+		Capacity: s.capacity,
+		Active:   len(s.leases),
+		Holder:   l.holder,
+		Expires:  l.expires,
+	}
+}
+
+func writeGrant(w http.ResponseWriter, code int, g Grant) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(g)
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Client acquires concurrency tokens from a TokenServer.
+type Client struct {
+	URL      string        // Base URL of the token server.
+	Holder   string        // Name reported to the server, usually the host name.
+	MaxRetry time.Duration // Maximum delay between acquire attempts, defaults to one minute.
+	HTTP     *http.Client  // HTTP client to use, defaults to http.DefaultClient.
+}
+
+// Lease represents a token held by the client. It is renewed in the background until released.
+type Lease struct {
+	Grant
+	client *Client
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	err    error
+}
+
+// Acquire waits until the server grants a token or the context is done.
+// While waiting, the client retries after the delay suggested by the server plus a random jitter,
+// so rejected hosts do not retry in lockstep.
+func (c *Client) Acquire(ctx context.Context) (*Lease, error) {
+	maxRetry := c.MaxRetry
+	if maxRetry <= 0 {
+		maxRetry = time.Minute
+	}
+
+	for {
+		g, code, err := c.call(ctx, "/acquire", url.Values{"holder": {c.Holder}})
+		if err != nil {
+			return nil, err
+		}
+
+		if code == http.StatusOK {
+			return c.start(g), nil
+		}
+		if code != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("acquire token: unexpected status %d", code)
+		}
+
+		retry := g.Retry
+		if retry <= 0 || retry > maxRetry {
+			retry = maxRetry
+		}
+		if err = Sleep(ctx, retry/2+Jitter(retry)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// start starts renewing the lease in the background at a third of its TTL.
+func (c *Client) start(g Grant) *Lease {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lease{Grant: g, client: c, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(l.done)
+
+		if g.TTL <= 0 {
+			return
+		}
+
+		t := time.NewTicker(g.TTL / 3)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if _, code, err := c.call(ctx, "/renew", url.Values{"token": {g.Token}}); err != nil || code != http.StatusOK {
+					if err == nil {
+						err = errors.New("lease expired")
+					}
+					if ctx.Err() == nil {
+						l.mu.Lock()
+						l.err = err
+						l.mu.Unlock()
+					}
+					if code == http.StatusNotFound {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return l
+}
+
+// Err returns the last error encountered while renewing the lease.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release stops renewing the lease and returns the token to the server.
+func (l *Lease) Release(ctx context.Context) error {
+	l.cancel()
+	<-l.done
+
+	_, code, err := l.client.call(ctx, "/release", url.Values{"token": {l.Token}})
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("release token: unexpected status %d", code)
+	}
+
+	return nil
+}
+
+// call performs a POST request to the token server and decodes the grant.
+func (c *Client) call(ctx context.Context, path string, query url.Values) (Grant, int, error) {
+	var g Grant
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return g, 0, err
+	}
+
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return g, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err = json.NewDecoder(resp.Body).Decode(&g); err != nil {
+		return g, resp.StatusCode, fmt.Errorf("decode grant: %w", err)
+	}
+
+	return g, resp.StatusCode, nil
+}
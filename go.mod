@@ -1,3 +1,30 @@
 module github.com/gromey/octopus
 
-go 1.18
+go 1.21
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/klauspost/compress v1.16.7
+	github.com/pierrec/lz4/v4 v4.1.21
+	github.com/pkg/sftp v1.13.6
+	github.com/zeebo/blake3 v0.2.4
+	go.etcd.io/bbolt v1.3.7
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+	go.starlark.net v0.0.0-20240123142251-f86470692795
+	golang.org/x/crypto v0.24.0
+	golang.org/x/sys v0.30.0
+	google.golang.org/grpc v1.64.1
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
@@ -0,0 +1,73 @@
+package hashes
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// Default is the name of the hash algorithm to use when content only needs to be compared, not authenticated:
+// xxh64 is non-cryptographic and several times faster than the cryptographic algorithms.
+const Default = "xxh64"
+
+var (
+	mu    sync.RWMutex
+	funcs = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+		"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+		"xxh64":  func() hash.Hash { return xxhash.New() },
+		"blake3": func() hash.Hash { return blake3.New() },
+	}
+)
+
+// Register makes the hash algorithm selectable by its name, replacing any algorithm registered with the same name.
+func Register(name string, fn func() hash.Hash) {
+	mu.Lock()
+	defer mu.Unlock()
+	funcs[strings.ToLower(name)] = fn
+}
+
+// Lookup returns the constructor of the hash algorithm registered with the name, case-insensitively.
+// An empty name and "none" select no hashing, for which a nil constructor is returned.
+func Lookup(name string) (func() hash.Hash, error) {
+	if name == "" || strings.EqualFold(name, "none") {
+		return nil, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if fn, ok := funcs[strings.ToLower(name)]; ok {
+		return fn, nil
+	}
+
+	return nil, fmt.Errorf("unknown hash algorithm %q, supported: none, %s", name, strings.Join(names(), ", "))
+}
+
+// Names returns the names of the registered hash algorithms, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(funcs))
+	for n := range funcs {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Check reports whether a component is healthy by returning nil, or the problem found.
+type Check func(ctx context.Context) error
+
+// Result represents the outcome of a single check.
+type Result struct {
+	Name     string        `json:"name"`            // Name of the check.
+	OK       bool          `json:"ok"`              // Whether the check passed.
+	Error    string        `json:"error,omitempty"` // Problem reported by the check.
+	Duration time.Duration `json:"duration"`        // Time the check took.
+}
+
+// Report represents the outcome of a set of checks.
+type Report struct {
+	OK     bool     `json:"ok"`     // Whether all checks passed.
+	Checks []Result `json:"checks"` // Results of the individual checks, in registration order.
+}
+
+// Checker runs liveness and readiness checks and serves them over HTTP.
+// Liveness checks tell whether the process must be restarted,
+// readiness checks tell whether it can do its job right now.
+type Checker struct {
+	mu      sync.RWMutex
+	live    []namedCheck
+	ready   []namedCheck
+	timeout time.Duration
+}
+
+// namedCheck is a check registered under a name.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// New returns a checker running each check with the provided timeout, or without a timeout if it is not positive.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// AddLiveness registers a liveness check.
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.mu.Lock()
+	c.live = append(c.live, namedCheck{name, check})
+	c.mu.Unlock()
+}
+
+// AddReadiness registers a readiness check.
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.mu.Lock()
+	c.ready = append(c.ready, namedCheck{name, check})
+	c.mu.Unlock()
+}
+
+// Live runs the liveness checks.
+func (c *Checker) Live(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.live
+	c.mu.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// Ready runs the liveness and readiness checks, since a process that is not alive cannot be ready.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append(append([]namedCheck(nil), c.live...), c.ready...)
+	c.mu.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// run runs the checks concurrently and collects their results.
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Report {
+	rep := Report{OK: true, Checks: make([]Result, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+
+			cctx := ctx
+			if c.timeout > 0 {
+				var cancel context.CancelFunc
+				cctx, cancel = context.WithTimeout(ctx, c.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			err := nc.check(cctx)
+
+			rep.Checks[i] = Result{Name: nc.name, OK: err == nil, Duration: time.Since(start)}
+			if err != nil {
+				rep.Checks[i].Error = err.Error()
+			}
+		}(i, nc)
+	}
+	wg.Wait()
+
+	for _, r := range rep.Checks {
+		rep.OK = rep.OK && r.OK
+	}
+
+	return rep
+}
+
+// Handler returns an http.Handler serving /healthz with the liveness report and /readyz with the readiness report.
+// Both respond with 200 if all checks pass and 503 otherwise.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { writeReport(w, c.Live(r.Context())) })
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { writeReport(w, c.Ready(r.Context())) })
+	return mux
+}
+
+func writeReport(w http.ResponseWriter, rep Report) {
+	code := http.StatusOK
+	if !rep.OK {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
+// Writable returns a check verifying that a file can be created in the directory, e.g. the snapshot store.
+func Writable(dir string) Check {
+	return func(context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		if err = f.Close(); err != nil {
+			_ = os.Remove(name)
+			return err
+		}
+		return os.Remove(name)
+	}
+}
+
+// Accessible returns a check verifying that all the provided roots exist and can be read.
+func Accessible(roots ...string) Check {
+	return func(context.Context) error {
+		for _, root := range roots {
+			dir, err := os.Open(root)
+			if err != nil {
+				return err
+			}
+			_, err = dir.Readdirnames(1)
+			_ = dir.Close()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("read dir %s: %w", root, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Heartbeat tracks the liveness of a background component such as a watch backend,
+// which calls Beat regularly while it is working.
+type Heartbeat struct {
+	mu     sync.Mutex
+	last   time.Time
+	maxAge time.Duration
+}
+
+// NewHeartbeat returns a heartbeat considered dead when no beat happened for maxAge.
+// The heartbeat starts alive.
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{last: time.Now(), maxAge: maxAge}
+}
+
+// Beat records that the component is alive.
+func (h *Heartbeat) Beat() {
+	h.mu.Lock()
+	h.last = time.Now()
+	h.mu.Unlock()
+}
+
+// Check returns a check failing when the last beat is older than the maximum age.
+func (h *Heartbeat) Check() Check {
+	return func(context.Context) error {
+		h.mu.Lock()
+		age := time.Since(h.last)
+		h.mu.Unlock()
+
+		if age > h.maxAge {
+			return fmt.Errorf("no heartbeat for %s", age.Round(time.Second))
+		}
+		return nil
+	}
+}
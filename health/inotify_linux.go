@@ -0,0 +1,28 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InotifyWatches returns a check verifying that a user may watch at least min directories with inotify,
+// which watch backends need a watch per directory for.
+func InotifyWatches(min int) Check {
+	return func(context.Context) error {
+		b, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			return fmt.Errorf("parse max_user_watches: %w", err)
+		}
+		if n < min {
+			return fmt.Errorf("inotify watch limit is %d, below %d: raise it with sysctl fs.inotify.max_user_watches", n, min)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package health
+
+import "context"
+
+// FileLimit returns a check verifying that the process may open at least min files at once.
+// It always passes where the platform has no such limit.
+func FileLimit(uint64) Check {
+	return func(context.Context) error { return nil }
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileLimit returns a check verifying that the process may open at least min files at once.
+// Scans open a file per directory and per file read concurrently, and fail with "too many open files" below it.
+func FileLimit(min uint64) Check {
+	return func(context.Context) error {
+		var rl unix.Rlimit
+		if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil {
+			return err
+		}
+		if uint64(rl.Cur) < min {
+			return fmt.Errorf("open file limit is %d, below %d: raise it with ulimit -n or LimitNOFILE= in the unit", rl.Cur, min)
+		}
+		return nil
+	}
+}
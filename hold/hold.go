@@ -0,0 +1,158 @@
+package hold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileName is the name of the file keeping the holds in the snapshot store directory.
+// It has no .json extension, so the store does not mistake it for a snapshot.
+const fileName = "holds"
+
+// ErrHeld is returned when an operation would touch a held path.
+var ErrHeld = errors.New("path is held")
+
+// ErrNotHeld is returned when releasing a path that is not held.
+var ErrNotHeld = errors.New("path is not held")
+
+// Hold marks a file, or a directory and everything below it, as immutable.
+type Hold struct {
+	Path    string    `json:"path"`             // Absolute path of the held file or directory.
+	Reason  string    `json:"reason,omitempty"` // Why the path is held, e.g. a case reference.
+	Created time.Time `json:"created"`          // Time the hold was placed.
+}
+
+// Set represents the holds kept in a snapshot store directory.
+// Sync deletes, dedupe remediation and planned actions refuse to touch held paths.
+// A nil *Set holds nothing.
+type Set struct {
+	path  string
+	holds []Hold
+}
+
+// Load reads the holds kept in the snapshot store directory. A store without holds yields an empty set.
+func Load(dir string) (*Set, error) {
+	s := &Set{path: filepath.Join(dir, fileName)}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("load holds %s: %w", s.path, err)
+	}
+
+	if err = json.Unmarshal(data, &s.holds); err != nil {
+		return nil, fmt.Errorf("load holds %s: %w", s.path, err)
+	}
+
+	return s, nil
+}
+
+// List returns the holds sorted by path.
+func (s *Set) List() []Hold {
+	if s == nil {
+		return nil
+	}
+	return append([]Hold(nil), s.holds...)
+}
+
+// Add places a hold on the path and saves the set. Holding a path that is already held updates its reason.
+func (s *Set) Add(path, reason string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	for i := range s.holds {
+		if s.holds[i].Path == abs {
+			s.holds[i].Reason = reason
+			return s.save()
+		}
+	}
+
+	s.holds = append(s.holds, Hold{Path: abs, Reason: reason, Created: time.Now()})
+	sort.Slice(s.holds, func(i, j int) bool { return s.holds[i].Path < s.holds[j].Path })
+
+	return s.save()
+}
+
+// Remove releases the hold placed on the path and saves the set.
+// Holds placed on the ancestors or the descendants of the path are not affected.
+func (s *Set) Remove(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	for i := range s.holds {
+		if s.holds[i].Path == abs {
+			s.holds = append(s.holds[:i], s.holds[i+1:]...)
+			return s.save()
+		}
+	}
+
+	return fmt.Errorf("release %s: %w", abs, ErrNotHeld)
+}
+
+// Held returns the hold covering the path, placed either on the path itself or on one of its ancestors.
+func (s *Set) Held(path string) (Hold, bool) {
+	if s == nil || len(s.holds) == 0 {
+		return Hold{}, false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Hold{}, false
+	}
+
+	for _, h := range s.holds {
+		if abs == h.Path || strings.HasPrefix(abs, strings.TrimSuffix(h.Path, string(filepath.Separator))+string(filepath.Separator)) {
+			return h, true
+		}
+	}
+
+	return Hold{}, false
+}
+
+// Check returns an error wrapping ErrHeld if the path is covered by a hold.
+func (s *Set) Check(path string) error {
+	if h, ok := s.Held(path); ok {
+		if h.Reason != "" {
+			return fmt.Errorf("%w by %s (%s)", ErrHeld, h.Path, h.Reason)
+		}
+		return fmt.Errorf("%w by %s", ErrHeld, h.Path)
+	}
+	return nil
+}
+
+// save writes the set through a temporary file, so a failed save never leaves a partial file behind.
+func (s *Set) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("save holds %s: %w", s.path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(s.holds); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("save holds %s: %w", s.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("save holds %s: %w", s.path, err)
+	}
+
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("save holds %s: %w", s.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Matroska element IDs, with their length marker.
+const (
+	idEBML          = 0x1A45DFA3
+	idDocType       = 0x4282
+	idSegment       = 0x18538067
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+)
+
+// errElementHeader is returned when an element header is invalid or cut by the end of the file.
+var errElementHeader = errors.New("invalid or truncated element header")
+
+// probeMatroska walks the top-level elements of a Matroska or WebM file and reads the duration from the segment info.
+func probeMatroska(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "matroska"}
+
+	id, dataStart, dataSize, unknown, err := readElement(r, 0)
+	if err != nil || id != idEBML || unknown {
+		info.problemf("invalid EBML header")
+		return info, nil
+	}
+	headerEnd := dataStart + dataSize
+	if headerEnd > size {
+		info.problemf("truncated EBML header")
+		return info, nil
+	}
+	if doc, _ := readChild(r, dataStart, headerEnd, idDocType); string(doc) == "webm" {
+		info.Container = "webm"
+	}
+
+	id, segStart, segSize, unknown, err := readElement(r, headerEnd)
+	if err != nil || id != idSegment {
+		info.problemf("missing segment")
+		return info, nil
+	}
+	segEnd := size
+	if !unknown {
+		segEnd = segStart + segSize
+		if segEnd > size {
+			info.problemf("truncated: segment is missing %d bytes", segEnd-size)
+			segEnd = size
+		}
+	}
+
+	for offset := segStart; offset < segEnd; {
+		id, start, n, unknown, err := readElement(r, offset)
+		if err != nil {
+			if errors.Is(err, errElementHeader) {
+				if info.OK() {
+					info.problemf("invalid or truncated element header at offset %d", offset)
+				}
+				break
+			}
+			return nil, err
+		}
+		if unknown {
+			break // Elements of unknown size, e.g. live clusters, cannot be skipped.
+		}
+		if start+int64(n) > size {
+			if info.OK() {
+				info.problemf("truncated: element 0x%X at offset %d is missing %d bytes", id, offset, start+int64(n)-size)
+			}
+			break
+		}
+
+		if id == idInfo {
+			info.Duration = segmentDuration(r, start, start+int64(n))
+		}
+
+		offset = start + int64(n)
+	}
+
+	return info, nil
+}
+
+// segmentDuration reads the duration from the segment info element found between start and end.
+func segmentDuration(r io.ReaderAt, start, end int64) time.Duration {
+	scale := uint64(1000000) // Default timecode scale, in nanoseconds.
+	if b, _ := readChild(r, start, end, idTimecodeScale); len(b) > 0 && len(b) <= 8 {
+		scale = 0
+		for _, c := range b {
+			scale = scale<<8 | uint64(c)
+		}
+	}
+
+	b, _ := readChild(r, start, end, idDuration)
+	var d float64
+	switch len(b) {
+	case 4:
+		d = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		d = math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return 0
+	}
+
+	return time.Duration(d * float64(scale))
+}
+
+// readChild returns the data of the first child element with the provided ID found between start and end.
+func readChild(r io.ReaderAt, start, end int64, want uint32) ([]byte, error) {
+	for offset := start; offset < end; {
+		id, dataStart, n, unknown, err := readElement(r, offset)
+		if err != nil || unknown || dataStart+int64(n) > end {
+			return nil, err
+		}
+		if id == want {
+			if n > 1<<16 {
+				return nil, nil
+			}
+			b := make([]byte, n)
+			if _, err = r.ReadAt(b, dataStart); err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+		offset = dataStart + int64(n)
+	}
+	return nil, nil
+}
+
+// readElement reads the header of the element at offset and returns its ID, the offset and the size of its data,
+// and whether the size is unknown.
+func readElement(r io.ReaderAt, offset int64) (id uint32, dataStart, size int64, unknown bool, err error) {
+	rawID, idLen, err := readVint(r, offset, 4)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	// IDs keep their length marker.
+	id = uint32(rawID | 1<<(7*idLen))
+
+	rawSize, sizeLen, err := readVint(r, offset+int64(idLen), 8)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	unknown = rawSize == 1<<(7*sizeLen)-1
+	return id, offset + int64(idLen+sizeLen), int64(rawSize), unknown, nil
+}
+
+// readVint reads an EBML variable-length integer of at most maxLen bytes at offset,
+// and returns its value without the length marker and its length.
+func readVint(r io.ReaderAt, offset int64, maxLen int) (uint64, int, error) {
+	var b [8]byte
+	if n, err := r.ReadAt(b[:1], offset); n < 1 {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = errElementHeader
+		}
+		return 0, 0, err
+	}
+
+	length := bits.LeadingZeros8(b[0]) + 1
+	if length > maxLen {
+		return 0, 0, errElementHeader
+	}
+	if n, err := r.ReadAt(b[1:length], offset+1); n < length-1 {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = errElementHeader
+		}
+		return 0, 0, err
+	}
+
+	v := uint64(b[0]) & (1<<(8-length) - 1)
+	for _, c := range b[1:length] {
+		v = v<<8 | uint64(c)
+	}
+
+	return v, length, nil
+}
@@ -0,0 +1,81 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnknownFormat is returned when the file is not in a supported container format.
+var ErrUnknownFormat = errors.New("unknown media format")
+
+// Info represents the result of probing a media file.
+type Info struct {
+	Container string        `json:"container"`          // Container format, e.g. "mp4", "matroska" or "wav".
+	Duration  time.Duration `json:"duration,omitempty"` // Duration declared by the container, zero if unknown.
+	Problems  []string      `json:"problems,omitempty"` // Structural problems, e.g. truncation.
+}
+
+// OK reports whether no problem was found.
+func (i *Info) OK() bool {
+	return len(i.Problems) == 0
+}
+
+// problemf records a structural problem.
+func (i *Info) problemf(format string, args ...any) {
+	i.Problems = append(i.Problems, fmt.Sprintf(format, args...))
+}
+
+// Probe validates the container structure of a video or audio file and extracts its duration.
+// It detects files that were cut short, such as interrupted copies or downloads, which hash successfully
+// but cannot be played back completely. Only the container is checked, not the encoded streams.
+// Supported formats are MP4 and QuickTime (including M4A), Matroska and WebM, and WAV.
+// Files in other formats return ErrUnknownFormat.
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", path, err)
+	}
+
+	var head [12]byte
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("probe %s: %w", path, err)
+	}
+
+	var info *Info
+	switch h := head[:n]; {
+	case len(h) >= 8 && isBoxType(h[4:8]) && (string(h[4:8]) == "ftyp" || string(h[4:8]) == "moov" ||
+		string(h[4:8]) == "wide" || string(h[4:8]) == "free" || string(h[4:8]) == "mdat"):
+		info, err = probeMP4(f, st.Size())
+	case len(h) >= 4 && string(h[:4]) == "\x1a\x45\xdf\xa3":
+		info, err = probeMatroska(f, st.Size())
+	case len(h) >= 12 && string(h[:4]) == "RIFF" && string(h[8:12]) == "WAVE":
+		info, err = probeWAV(f, st.Size())
+	default:
+		return nil, fmt.Errorf("probe %s: %w", path, ErrUnknownFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", path, err)
+	}
+
+	return info, nil
+}
+
+// isBoxType reports whether b looks like an ISO base media box type, i.e. four printable characters.
+func isBoxType(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
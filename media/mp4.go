@@ -0,0 +1,118 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// probeMP4 walks the top-level boxes of an ISO base media file and reads the duration from the movie header.
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "mp4"}
+
+	var moov, mdat bool
+	for offset := int64(0); offset < size; {
+		var hdr [16]byte
+		n, err := r.ReadAt(hdr[:8], offset)
+		if n < 8 {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			info.problemf("truncated box header at offset %d", offset)
+			break
+		}
+
+		boxType := string(hdr[4:8])
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0: // The box extends to the end of the file.
+			boxSize = size - offset
+		case 1: // The size is stored as a 64-bit integer after the type.
+			if n, err = r.ReadAt(hdr[8:16], offset+8); n < 8 {
+				if err != nil && !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+				info.problemf("truncated box header at offset %d", offset)
+				return info, nil
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerSize = 16
+		}
+
+		if boxSize < headerSize || !isBoxType(hdr[4:8]) {
+			info.problemf("invalid box at offset %d", offset)
+			break
+		}
+		if offset+boxSize > size {
+			info.problemf("truncated: box %q at offset %d is missing %d bytes", boxType, offset, offset+boxSize-size)
+			if boxType == "mdat" {
+				mdat = true
+			}
+			break
+		}
+
+		switch boxType {
+		case "moov":
+			moov = true
+			d, err := movieDuration(r, offset+headerSize, offset+boxSize)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = d
+		case "mdat":
+			mdat = true
+		}
+
+		offset += boxSize
+	}
+
+	if !moov {
+		info.problemf("missing movie box (moov)")
+	}
+	if !mdat && moov {
+		// Fragmented files keep their media in moof/mdat pairs; a file without any mdat has no media at all.
+		info.problemf("missing media data box (mdat)")
+	}
+
+	return info, nil
+}
+
+// movieDuration reads the duration from the movie header box (mvhd) found between start and end.
+func movieDuration(r io.ReaderAt, start, end int64) (time.Duration, error) {
+	for offset := start; offset+8 <= end; {
+		var hdr [8]byte
+		if _, err := r.ReadAt(hdr[:], offset); err != nil {
+			return 0, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		if boxSize < 8 || offset+boxSize > end {
+			return 0, nil
+		}
+
+		if string(hdr[4:8]) == "mvhd" {
+			var body [32]byte
+			n, _ := r.ReadAt(body[:], offset+8)
+			b := body[:n]
+
+			var timescale, duration uint64
+			switch {
+			case len(b) >= 20 && b[0] == 0:
+				timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+				duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+			case len(b) >= 32 && b[0] == 1:
+				timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+				duration = binary.BigEndian.Uint64(b[24:32])
+			}
+			if timescale == 0 || duration == 1<<32-1 || duration == 1<<64-1 {
+				return 0, nil // Unknown duration.
+			}
+			return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+		}
+
+		offset += boxSize
+	}
+
+	return 0, nil
+}
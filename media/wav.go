@@ -0,0 +1,61 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// probeWAV walks the chunks of a RIFF WAVE file and computes the duration from the format and the data size.
+func probeWAV(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "wav"}
+
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	if end := 8 + int64(binary.LittleEndian.Uint32(hdr[4:8])); end > size {
+		info.problemf("truncated: RIFF chunk is missing %d bytes", end-size)
+	}
+
+	var byteRate uint32
+	var dataSize int64
+	var data bool
+	for offset := int64(12); offset+8 <= size; {
+		if _, err := r.ReadAt(hdr[:], offset); err != nil {
+			return nil, err
+		}
+		id, n := string(hdr[:4]), int64(binary.LittleEndian.Uint32(hdr[4:8]))
+
+		switch id {
+		case "fmt ":
+			var fmtChunk [12]byte
+			if n >= 12 && offset+8+12 <= size {
+				if _, err := r.ReadAt(fmtChunk[:], offset+8); err != nil {
+					return nil, err
+				}
+				byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			}
+		case "data":
+			data = true
+			dataSize = n
+			if offset+8+n > size {
+				if info.OK() {
+					info.problemf("truncated: data chunk is missing %d bytes", offset+8+n-size)
+				}
+			}
+		}
+
+		// Chunks are padded to an even size.
+		offset += 8 + n + n&1
+	}
+
+	if !data {
+		info.problemf("missing data chunk")
+	}
+	if byteRate > 0 {
+		info.Duration = time.Duration(float64(dataSize) / float64(byteRate) * float64(time.Second))
+	}
+
+	return info, nil
+}
@@ -0,0 +1,114 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Hash computes a single deterministic digest of the whole tree described by the provided files.
+// Two trees have the same digest if and only if they contain the same relative paths with the same hashes,
+// regardless of the platform, the scan order or the location of the root.
+//   - files: scanned files with hashes, e.g. the result of dirreader.Exec with a hash function.
+//   - hashFunc: function used to combine the entries of each directory.
+func Hash(files []dirreader.FileInfo, hashFunc func() hash.Hash) (string, error) {
+	digests, err := Tree(files, hashFunc)
+	if err != nil {
+		return "", err
+	}
+	return digests["."], nil
+}
+
+// Tree computes the digest of every directory of the tree described by the provided files,
+// keyed by the slash-separated relative path of the directory, with "." for the root.
+// Comparing the digests of two trees shows which subtrees differ without comparing every file.
+func Tree(files []dirreader.FileInfo, hashFunc func() hash.Hash) (map[string]string, error) {
+	t := &tree{dirs: map[string]*node{".": newNode()}}
+
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+		if fi.Hash == "" {
+			return nil, fmt.Errorf("file %s has no hash", fi.PathAbs)
+		}
+
+		dir := path.Clean(filepath.ToSlash(fi.PathRel))
+		if dir == "" {
+			dir = "."
+		}
+		t.dir(dir).files[fi.Name()] = fi.Hash
+	}
+
+	digests := make(map[string]string, len(t.dirs))
+	t.digest(".", hashFunc, digests)
+
+	return digests, nil
+}
+
+// tree holds the directories of the tree being hashed.
+type tree struct {
+	dirs map[string]*node
+}
+
+// node holds the entries of a single directory.
+type node struct {
+	files map[string]string   // File hashes by name.
+	dirs  map[string]struct{} // Names of subdirectories.
+}
+
+func newNode() *node {
+	return &node{files: make(map[string]string), dirs: make(map[string]struct{})}
+}
+
+// dir returns the node of the directory, creating it and its ancestors if needed.
+func (t *tree) dir(p string) *node {
+	n, ok := t.dirs[p]
+	if ok {
+		return n
+	}
+
+	n = newNode()
+	t.dirs[p] = n
+	t.dir(path.Dir(p)).dirs[path.Base(p)] = struct{}{}
+
+	return n
+}
+
+// digest computes the digest of the directory from the sorted names and digests of its entries
+// and records it together with the digests of all its subdirectories.
+func (t *tree) digest(p string, hashFunc func() hash.Hash, digests map[string]string) string {
+	n := t.dirs[p]
+
+	type entry struct{ kind, name, sum string }
+	entries := make([]entry, 0, len(n.files)+len(n.dirs))
+	for name, sum := range n.files {
+		entries = append(entries, entry{"f", name, sum})
+	}
+	for name := range n.dirs {
+		entries = append(entries, entry{"d", name, t.digest(path.Join(p, name), hashFunc, digests)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].kind < entries[j].kind
+	})
+
+	h := hashFunc()
+	for _, e := range entries {
+		// The NUL separator cannot appear in file names, so entries cannot be confused with each other.
+		_, _ = fmt.Fprintf(h, "%s %s\x00%s\n", e.kind, e.name, e.sum)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	digests[p] = sum
+
+	return sum
+}
@@ -0,0 +1,178 @@
+// Package metrics exposes counters and gauges in the Prometheus text format, so that operators can scrape the
+// long-running modes, such as pipelines run on an interval, and alert on failed scans or on drift.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind represents the type of a metric family.
+type Kind string
+
+const (
+	Counter Kind = "counter" // Value that only increases, e.g. the number of files scanned.
+	Gauge   Kind = "gauge"   // Value that goes up and down, e.g. the duration of the last scan.
+)
+
+// Registry holds metric families and writes them in the Prometheus text format. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*Family
+}
+
+// Family represents the series of a metric, one per combination of the values of its labels.
+type Family struct {
+	name   string
+	help   string
+	kind   Kind
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series // Series by their joined label values.
+}
+
+// series is a value of a family.
+type series struct {
+	values []string
+	value  float64
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers a counter with the name, help text and label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Family {
+	return r.register(name, help, Counter, labels)
+}
+
+// Gauge registers a gauge with the name, help text and label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Family {
+	return r.register(name, help, Gauge, labels)
+}
+
+// register adds a family to the registry.
+func (r *Registry) register(name, help string, kind Kind, labels []string) *Family {
+	f := &Family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+	r.mu.Lock()
+	r.families = append(r.families, f)
+	r.mu.Unlock()
+	return f
+}
+
+// Add adds v, which must not be negative for a counter, to the series of the label values.
+func (f *Family) Add(v float64, values ...string) {
+	if f.kind == Counter && v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s decreased by %g", f.name, v))
+	}
+	f.mu.Lock()
+	f.get(values).value += v
+	f.mu.Unlock()
+}
+
+// Inc adds 1 to the series of the label values.
+func (f *Family) Inc(values ...string) {
+	f.Add(1, values...)
+}
+
+// Set sets the series of the label values of a gauge to v.
+func (f *Family) Set(v float64, values ...string) {
+	if f.kind != Gauge {
+		panic(fmt.Sprintf("metrics: %s %s cannot be set", f.kind, f.name))
+	}
+	f.mu.Lock()
+	f.get(values).value = v
+	f.mu.Unlock()
+}
+
+// get returns the series of the label values, creating it if needed.
+func (f *Family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Write writes the families in the Prometheus text format, the series of a family sorted by their label values.
+// Families without series are written with their help and type only.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*Family(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+
+		f.mu.Lock()
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			bw.WriteString(f.name)
+			if len(f.labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range f.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l, escape(s.values[i], true))
+				}
+				bw.WriteByte('}')
+			}
+			fmt.Fprintf(bw, " %s\n", formatValue(s.value))
+		}
+		f.mu.Unlock()
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the metrics of the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = r.Write(w)
+	})
+}
+
+// escape escapes the backslashes and line feeds of a help text, and the double quotes of a label value.
+func escape(s string, quotes bool) string {
+	r := []string{`\`, `\\`, "\n", `\n`}
+	if quotes {
+		r = append(r, `"`, `\"`)
+	}
+	return strings.NewReplacer(r...).Replace(s)
+}
+
+// formatValue formats a sample value as Prometheus does.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
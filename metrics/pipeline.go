@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"github.com/gromey/octopus/pipeline"
+)
+
+// Pipelines holds the metrics of pipeline runs, labeled by pipeline name.
+type Pipelines struct {
+	runs         *Family
+	lastRun      *Family
+	files        *Family
+	hashed       *Family
+	errors       *Family
+	scanDuration *Family
+	drift        *Family
+	changes      *Family
+	alerts       *Family
+	failures     *Family
+}
+
+// NewPipelines registers the metrics of pipeline runs in the registry.
+func NewPipelines(r *Registry) *Pipelines {
+	return &Pipelines{
+		runs:         r.Counter("octopus_pipeline_runs_total", "Number of pipeline runs, by outcome.", "pipeline", "status"),
+		lastRun:      r.Gauge("octopus_pipeline_last_run_timestamp_seconds", "Time the last run of the pipeline started, in seconds since the epoch.", "pipeline"),
+		files:        r.Counter("octopus_files_scanned_total", "Number of files found by the scans.", "pipeline"),
+		hashed:       r.Counter("octopus_bytes_hashed_total", "Number of bytes hashed by the scans.", "pipeline"),
+		errors:       r.Counter("octopus_scan_errors_total", "Number of files and directories the scans failed to read.", "pipeline"),
+		scanDuration: r.Gauge("octopus_last_scan_duration_seconds", "Duration of the last scan.", "pipeline"),
+		drift:        r.Gauge("octopus_drift_detected", "Number of changes found by the diff of the last run, since the latest snapshot.", "pipeline"),
+		changes:      r.Counter("octopus_changes_total", "Number of changes found by the diffs.", "pipeline"),
+		alerts:       r.Counter("octopus_alerts_total", "Number of alerts triggered by the alert steps.", "pipeline"),
+		failures:     r.Counter("octopus_step_failures_total", "Number of failed steps, by type, e.g. verify for a replica that does not match.", "pipeline", "step"),
+	}
+}
+
+// Observe records the report of a run.
+func (m *Pipelines) Observe(rep *pipeline.Report) {
+	status := "ok"
+	if !rep.OK {
+		status = "failed"
+	}
+	m.runs.Inc(rep.Name, status)
+	m.lastRun.Set(float64(rep.Started.UnixNano())/1e9, rep.Name)
+	m.files.Add(float64(rep.Files), rep.Name)
+	m.hashed.Add(float64(rep.Hashed), rep.Name)
+	m.errors.Add(float64(rep.Errors), rep.Name)
+	m.changes.Add(float64(rep.Changes), rep.Name)
+	m.alerts.Add(float64(len(rep.Alerts)), rep.Name)
+
+	for _, s := range rep.Steps {
+		switch {
+		case s.Status == pipeline.Failed:
+			m.failures.Inc(rep.Name, string(s.Type))
+		case s.Type == pipeline.Scan && s.Status == pipeline.OK:
+			m.scanDuration.Set(s.Elapsed.Seconds(), rep.Name)
+		case s.Type == pipeline.Diff && s.Status == pipeline.OK:
+			m.drift.Set(float64(rep.Changes), rep.Name)
+		}
+	}
+}
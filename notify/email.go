@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends the messages by email through an SMTP server, upgrading the connection with STARTTLS when the server
+// supports it. Authentication requires an encrypted connection, except to localhost.
+type Email struct {
+	Addr     string   // Address of the SMTP server, host:port.
+	From     string   // Sender address.
+	To       []string // Recipient addresses.
+	Username string   // User to authenticate as with PLAIN, no authentication if empty.
+	Password string   // Password of the user.
+}
+
+// Notify implements Notifier.
+func (e *Email) Notify(ctx context.Context, m *Message) error {
+	if err := e.send(ctx, e.message(m)); err != nil {
+		return fmt.Errorf("notify email: %w", err)
+	}
+	return nil
+}
+
+// message returns the email of the message.
+func (e *Email) message(m *Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("[octopus %s] %s", m.Severity, m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", m.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	body := m.Subject + "\n"
+	if m.Body != "" {
+		body += "\n" + m.Body + "\n"
+	}
+	// Lines are terminated by CRLF, and a line starting with a dot is escaped by the SMTP client.
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// send sends the email, the connection being bound to the context.
+func (e *Email) send(ctx context.Context, msg []byte) error {
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", e.Username, e.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,266 @@
+// Package notify sends integrity alerts to humans, by email, to Slack or Microsoft Teams channels, or to syslog,
+// through the Notifier interface consumed by the verify and diff commands, pipelines run on an interval and octopusd.
+//
+// Notifiers are defined in JSON:
+//
+//	[
+//	  {"type": "email", "smtp": "mail.example.com:587", "from": "octopus@example.com", "to": ["ops@example.com"],
+//	   "username": "octopus", "passwordEnv": "OCTOPUS_SMTP_PASSWORD"},
+//	  {"type": "slack", "url": "https://hooks.slack.com/services/T000/B000/XXXX"},
+//	  {"type": "teams", "url": "https://example.webhook.office.com/webhookb2/...", "minSeverity": "critical"},
+//	  {"type": "syslog", "network": "udp", "addr": "logs.example.com:514", "tag": "octopus"}
+//	]
+//
+// A syslog notifier without address writes to the local syslog socket.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Severity represents how urgent a message is.
+type Severity string
+
+const (
+	Info     Severity = "info"     // Nothing went wrong, e.g. a summary.
+	Warning  Severity = "warning"  // Something changed that may be expected, e.g. drift.
+	Critical Severity = "critical" // Something is wrong, e.g. corrupted files or a triggered alert rule.
+)
+
+// rank returns the order of the severity, 0 for unknown ones.
+func (s Severity) rank() int {
+	switch s {
+	case Info:
+		return 1
+	case Warning:
+		return 2
+	case Critical:
+		return 3
+	}
+	return 0
+}
+
+// Message represents an alert.
+type Message struct {
+	Time     time.Time `json:"time"`
+	Severity Severity  `json:"severity"`
+	Event    string    `json:"event"`          // Kind of the alert, e.g. "drift", "corruption" or "alert".
+	Root     string    `json:"root,omitempty"` // Directory concerned, if any.
+	Subject  string    `json:"subject"`        // Summary on a single line.
+	Body     string    `json:"body,omitempty"` // Details, e.g. one changed file per line.
+}
+
+// maxLines is the number of lines of the bodies made by Lines.
+const maxLines = 50
+
+// Lines returns a body of the lines, one per line, truncated to its first 50 lines followed by the number of the
+// others, so that a mass change does not flood the channels.
+func Lines(lines []string) string {
+	if len(lines) <= maxLines {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:maxLines], "\n") + fmt.Sprintf("\n… and %d more", len(lines)-maxLines)
+}
+
+// Notifier sends messages to humans.
+type Notifier interface {
+	Notify(ctx context.Context, m *Message) error
+}
+
+// Multi sends the messages to all its notifiers.
+type Multi []Notifier
+
+// Notify sends the message to every notifier, and returns the errors of those that failed.
+func (m Multi) Notify(ctx context.Context, msg *Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Config represents a notifier in JSON, see Load.
+type Config struct {
+	Type        string   `json:"type"`                  // "email", "slack", "teams" or "syslog".
+	MinSeverity Severity `json:"minSeverity,omitempty"` // Severity below which messages are not sent, all if empty.
+
+	SMTP        string   `json:"smtp,omitempty"`        // Email: address of the SMTP server, host:port.
+	From        string   `json:"from,omitempty"`        // Email: sender address.
+	To          []string `json:"to,omitempty"`          // Email: recipient addresses.
+	Username    string   `json:"username,omitempty"`    // Email: user to authenticate as, no authentication if empty.
+	PasswordEnv string   `json:"passwordEnv,omitempty"` // Email: environment variable holding the password.
+
+	URL string `json:"url,omitempty"` // Slack and Teams: incoming webhook of the channel.
+
+	Network string `json:"network,omitempty"` // Syslog: "udp", "tcp" or "unixgram", the local socket if empty.
+	Addr    string `json:"addr,omitempty"`    // Syslog: address of the server.
+	Tag     string `json:"tag,omitempty"`     // Syslog: tag of the messages, "octopus" if empty.
+}
+
+// Load reads the notifiers defined in the JSON file at path.
+func Load(path string) (Multi, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load notifiers %s: %w", path, err)
+	}
+
+	var configs []Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("load notifiers %s: %w", path, err)
+	}
+
+	m := make(Multi, 0, len(configs))
+	for i, c := range configs {
+		n, err := c.Notifier()
+		if err != nil {
+			return nil, fmt.Errorf("load notifiers %s: notifier %d: %w", path, i, err)
+		}
+		m = append(m, n)
+	}
+	return m, nil
+}
+
+// Notifier returns the notifier of the configuration.
+func (c Config) Notifier() (Notifier, error) {
+	if c.MinSeverity != "" && c.MinSeverity.rank() == 0 {
+		return nil, fmt.Errorf("unknown severity %q", c.MinSeverity)
+	}
+
+	var n Notifier
+	switch c.Type {
+	case "email":
+		if c.SMTP == "" || c.From == "" || len(c.To) == 0 {
+			return nil, errors.New("email requires smtp, from and to")
+		}
+		e := &Email{Addr: c.SMTP, From: c.From, To: c.To, Username: c.Username}
+		if c.PasswordEnv != "" {
+			e.Password = os.Getenv(c.PasswordEnv)
+			if e.Password == "" {
+				return nil, fmt.Errorf("%s is not set", c.PasswordEnv)
+			}
+		}
+		n = e
+	case "slack", "teams":
+		if c.URL == "" {
+			return nil, fmt.Errorf("%s requires url", c.Type)
+		}
+		if c.Type == "slack" {
+			n = &Slack{URL: c.URL}
+		} else {
+			n = &Teams{URL: c.URL}
+		}
+	case "syslog":
+		if (c.Network == "") != (c.Addr == "") {
+			return nil, errors.New("syslog requires both network and addr, or neither for the local socket")
+		}
+		n = &Syslog{Network: c.Network, Addr: c.Addr, Tag: c.Tag}
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q, expected email, slack, teams or syslog", c.Type)
+	}
+
+	if c.MinSeverity != "" {
+		n = &filter{n: n, min: c.MinSeverity}
+	}
+	return n, nil
+}
+
+// filter drops the messages below a severity.
+type filter struct {
+	n   Notifier
+	min Severity
+}
+
+func (f *filter) Notify(ctx context.Context, m *Message) error {
+	if m.Severity.rank() < f.min.rank() {
+		return nil
+	}
+	return f.n.Notify(ctx, m)
+}
+
+// Slack posts the messages to an incoming webhook of a Slack channel.
+type Slack struct {
+	URL string
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, m *Message) error {
+	text := fmt.Sprintf("%s *%s*", icon(m.Severity), m.Subject)
+	if m.Body != "" {
+		text += "\n```\n" + m.Body + "\n```"
+	}
+	if err := post(ctx, s.URL, map[string]string{"text": text}); err != nil {
+		return fmt.Errorf("notify slack: %w", err)
+	}
+	return nil
+}
+
+// Teams posts the messages to an incoming webhook of a Microsoft Teams channel, as message cards.
+type Teams struct {
+	URL string
+}
+
+// Notify implements Notifier.
+func (t *Teams) Notify(ctx context.Context, m *Message) error {
+	colors := map[Severity]string{Info: "2EB886", Warning: "DAA038", Critical: "A30200"}
+	card := map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    m.Subject,
+		"title":      m.Subject,
+		"themeColor": colors[m.Severity],
+		// Teams renders the text as Markdown, in which single line feeds do not break lines.
+		"text": strings.ReplaceAll(m.Body, "\n", "  \n"),
+	}
+	if err := post(ctx, t.URL, card); err != nil {
+		return fmt.Errorf("notify teams: %w", err)
+	}
+	return nil
+}
+
+// icon returns the emoji code of the severity in Slack.
+func icon(s Severity) string {
+	switch s {
+	case Critical:
+		return ":rotating_light:"
+	case Warning:
+		return ":warning:"
+	}
+	return ":information_source:"
+}
+
+// post posts v as JSON to the URL.
+func post(ctx context.Context, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// localSockets are the syslog sockets tried by a Syslog notifier without address, on Linux and on macOS.
+var localSockets = []string{"/dev/log", "/var/run/syslog"}
+
+// Syslog sends the messages to syslog in the BSD format of RFC 3164, with the daemon facility, at the notice
+// severity for Info and Warning, and crit for Critical.
+type Syslog struct {
+	Network string // "udp", "tcp" or "unixgram", the local socket if empty.
+	Addr    string // Address of the server.
+	Tag     string // Tag of the messages, "octopus" if empty.
+}
+
+// Notify implements Notifier.
+func (s *Syslog) Notify(ctx context.Context, m *Message) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("notify syslog: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err = conn.Write(s.format(m)); err != nil {
+		return fmt.Errorf("notify syslog: %w", err)
+	}
+	return nil
+}
+
+// dial connects to the server, or to the first local socket that accepts the connection.
+func (s *Syslog) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	if s.Network != "" {
+		return d.DialContext(ctx, s.Network, s.Addr)
+	}
+
+	var errs []error
+	for _, path := range localSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := d.DialContext(ctx, network, path)
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	return nil, fmt.Errorf("no local syslog socket: %w", errors.Join(errs...))
+}
+
+// format returns the syslog line of the message, the body being joined on the line with " | ", terminated by a line
+// feed for stream connections.
+func (s *Syslog) format(m *Message) []byte {
+	const daemon = 3
+	severity := 5 // notice
+	if m.Severity == Critical {
+		severity = 2
+	}
+	tag := s.Tag
+	if tag == "" {
+		tag = "octopus"
+	}
+	host, _ := os.Hostname()
+
+	text := m.Subject
+	if m.Body != "" {
+		text += " | " + strings.ReplaceAll(strings.TrimSpace(m.Body), "\n", " | ")
+	}
+	line := fmt.Sprintf("<%d>%s %s %s[%d]: event=%s %s", daemon*8+severity, m.Time.Local().Format(time.Stamp), host, tag, os.Getpid(), m.Event, text)
+	if s.Network == "tcp" || s.Network == "unix" {
+		line += "\n"
+	}
+	return []byte(line)
+}
@@ -0,0 +1,141 @@
+package organize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// exifHead is the number of leading bytes of a file searched for its EXIF data.
+const exifHead = 256 << 10
+
+// EXIF tags of the dates.
+const (
+	tagDateTime         = 0x0132 // Date and time the file was last changed, in IFD0.
+	tagExifIFD          = 0x8769 // Offset of the EXIF IFD, in IFD0.
+	tagDateTimeOriginal = 0x9003 // Date and time the picture was taken, in the EXIF IFD.
+)
+
+// errNoExif is returned by exifDate for files without an EXIF date.
+var errNoExif = errors.New("no EXIF date")
+
+// exifDate returns the date a photo was taken, or else last changed, recorded in the EXIF data of the JPEG or
+// TIFF-based file at path, such as most raw formats. EXIF dates carry no time zone: the date is returned in UTC,
+// so that it formats as recorded.
+func exifDate(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	head := make([]byte, exifHead)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return time.Time{}, err
+	}
+	head = head[:n]
+
+	tiff := head
+	if bytes.HasPrefix(head, []byte{0xff, 0xd8}) {
+		if tiff = jpegExif(head); tiff == nil {
+			return time.Time{}, errNoExif
+		}
+	}
+	return tiffDate(tiff)
+}
+
+// jpegExif returns the TIFF structure of the APP1 EXIF segment of a JPEG file, or nil.
+func jpegExif(b []byte) []byte {
+	for i := 2; i+4 <= len(b) && b[i] == 0xff; {
+		marker := b[i+1]
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if marker == 0xda || marker == 0xd9 || size < 2 { // Start of scan, end of image.
+			return nil
+		}
+		end := i + 2 + size
+		if end > len(b) {
+			end = len(b)
+		}
+		seg := b[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + size
+	}
+	return nil
+}
+
+// tiffDate returns the date of a TIFF structure, see exifDate.
+func tiffDate(b []byte) (time.Time, error) {
+	if len(b) < 8 {
+		return time.Time{}, errNoExif
+	}
+	var order binary.ByteOrder
+	switch string(b[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, errNoExif
+	}
+
+	ifd0 := order.Uint32(b[4:])
+	changed, _ := ifdValue(b, order, ifd0, tagDateTime)
+	if off, ok := ifdValue(b, order, ifd0, tagExifIFD); ok && len(off) == 4 {
+		if taken, ok := ifdValue(b, order, order.Uint32(off), tagDateTimeOriginal); ok {
+			if t, err := parseExifTime(taken); err == nil {
+				return t, nil
+			}
+		}
+	}
+	if changed != nil {
+		if t, err := parseExifTime(changed); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errNoExif
+}
+
+// ifdValue returns the bytes of the value of the tag in the IFD at offset off: the 4 bytes of an offset,
+// or an ASCII string.
+func ifdValue(b []byte, order binary.ByteOrder, off uint32, tag uint16) ([]byte, bool) {
+	if int64(off)+2 > int64(len(b)) {
+		return nil, false
+	}
+	n := int(order.Uint16(b[off:]))
+	for i := 0; i < n; i++ {
+		e := int(off) + 2 + 12*i
+		if e+12 > len(b) {
+			return nil, false
+		}
+		if order.Uint16(b[e:]) != tag {
+			continue
+		}
+		typ, count := order.Uint16(b[e+2:]), order.Uint32(b[e+4:])
+		switch {
+		case typ == 2 && count <= 4: // ASCII stored in the entry.
+			return b[e+8 : e+8+int(count)], true
+		case typ == 2:
+			start := int64(order.Uint32(b[e+8:]))
+			if start+int64(count) > int64(len(b)) {
+				return nil, false
+			}
+			return b[start : start+int64(count)], true
+		default: // LONG or IFD offsets.
+			return b[e+8 : e+12], true
+		}
+	}
+	return nil, false
+}
+
+// parseExifTime parses an EXIF date such as "2024:05:17 14:03:22".
+func parseExifTime(b []byte) (time.Time, error) {
+	s := strings.TrimRight(string(b), "\x00 ")
+	return time.Parse("2006:01:02 15:04:05", s)
+}
@@ -0,0 +1,318 @@
+// Package organize plans the moves and renames that sort the files of a tree by templates over their metadata,
+// e.g. photos into year and month directories by the date they were taken. The plans are reviewed, then executed
+// with actions.Plan.Execute, which never overwrites a file.
+//
+// Rules are defined in JSON, the first rule matching a file giving its new path:
+//
+//	[
+//	  {"name": "photos", "names": ["*.jpg", "*.jpeg", "*.dng"], "template": "photos/{taken:2006}/{taken:01}/{name}"},
+//	  {"name": "invoices", "paths": ["inbox"], "names": ["*.pdf"], "template": "invoices/{mtime:2006}/{stem}.{ext}"}
+//	]
+//
+// A template is a slash-separated path relative to the destination, with placeholders replaced by the metadata
+// of each file:
+//
+//	{name}           name of the file, e.g. "IMG_1234.jpg"
+//	{stem}           name without its extension, e.g. "IMG_1234"
+//	{ext}            extension without the dot, in lower case, e.g. "jpg"
+//	{dir}            relative path of the directory of the file, "." at the root
+//	{size}           size in bytes
+//	{hash}           hash of the content, if the scan computed it
+//	{mtime:LAYOUT}   modification time formatted with a time layout, e.g. {mtime:2006-01}, 2006-01-02 by default
+//	{taken:LAYOUT}   date a photo was taken, from its EXIF data, or else the modification time
+//	{meta:KEY}       label of the file, see dirreader.FileInfo.Meta
+package organize
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/alert"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// defaultLayout is the time layout of the date placeholders without one.
+const defaultLayout = "2006-01-02"
+
+// Conflict represents how a file whose new path is taken is handled.
+type Conflict string
+
+const (
+	Skip   Conflict = "skip"   // Leave the file in place, the default.
+	Suffix Conflict = "suffix" // Add a number to the name, e.g. "IMG_1234 (2).jpg".
+)
+
+// Rule gives a new path to the files matching all of its patterns.
+type Rule struct {
+	Name     string   `json:"name"`            // Name of the rule, for the plans and the audit log.
+	Paths    []string `json:"paths,omitempty"` // Patterns of the slash-separated relative paths, see alert.Match, any if empty.
+	Names    []string `json:"names,omitempty"` // Patterns of the file names, e.g. "*.jpg", see path.Match, any if empty.
+	Template string   `json:"template"`        // New path of the files, relative to the destination, see the package doc.
+
+	segments []segment
+}
+
+// segment is a literal part or a placeholder of a template.
+type segment struct {
+	text  string // Literal text, if field is empty.
+	field string // Name of the placeholder, e.g. "mtime".
+	arg   string // Argument of the placeholder, e.g. a time layout.
+}
+
+// Options configures a plan.
+type Options struct {
+	Dest     string   // Root directory of the new paths, the scanned root if empty: the files are renamed in place.
+	Conflict Conflict // Handling of the files whose new path is taken, by an existing file or another planned one.
+}
+
+// Skipped represents a file that is left in place, and why.
+type Skipped struct {
+	Path   string `json:"path"`   // Absolute path of the file.
+	Reason string `json:"reason"` // Reason the file is not moved.
+}
+
+// Load reads and validates the rules defined in the JSON file at path.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load organize rules %s: %w", path, err)
+	}
+
+	var rules []Rule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("load organize rules %s: %w", path, err)
+	}
+	if err = Validate(rules); err != nil {
+		return nil, fmt.Errorf("load organize rules %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// Validate checks that there are rules, that they are named, and that their patterns and templates are valid.
+// It records the parsed templates in the rules.
+func Validate(rules []Rule) error {
+	if len(rules) == 0 {
+		return errors.New("no rules")
+	}
+	for i := range rules {
+		r := &rules[i]
+		var err error
+		switch {
+		case r.Name == "":
+			err = errors.New("name is required")
+		case r.Template == "":
+			err = errors.New("template is required")
+		default:
+			r.segments, err = parseTemplate(r.Template)
+		}
+		for _, p := range append(r.Paths[:len(r.Paths):len(r.Paths)], r.Names...) {
+			if _, e := path.Match(p, ""); e != nil && err == nil {
+				err = fmt.Errorf("pattern %q: %w", p, e)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, r.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseTemplate splits a template into literal parts and placeholders.
+func parseTemplate(t string) ([]segment, error) {
+	var segs []segment
+	for t != "" {
+		open := strings.IndexByte(t, '{')
+		if open < 0 {
+			segs = append(segs, segment{text: t})
+			break
+		}
+		if open > 0 {
+			segs = append(segs, segment{text: t[:open]})
+		}
+		end := strings.IndexByte(t[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in %q", t)
+		}
+		field, arg, _ := strings.Cut(t[open+1:open+end], ":")
+		switch field {
+		case "name", "stem", "ext", "dir", "size", "hash":
+		case "mtime", "taken":
+			if arg == "" {
+				arg = defaultLayout
+			}
+		case "meta":
+			if arg == "" {
+				return nil, errors.New("placeholder {meta} requires a key, e.g. {meta:class}")
+			}
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s}", field)
+		}
+		segs = append(segs, segment{field: field, arg: arg})
+		t = t[open+end+1:]
+	}
+	return segs, nil
+}
+
+// Plan validates the rules and returns the moves of the scanned files the rules give a new path, in the order of
+// the files, as a plan of renames if the destination is the root of the scan, and the files that are left in place.
+// Files whose new path is their current path are neither planned nor skipped.
+func Plan(root string, files []dirreader.FileInfo, rules []Rule, opts Options) (*actions.Plan, []Skipped, error) {
+	rules = append([]Rule(nil), rules...)
+	if err := Validate(rules); err != nil {
+		return nil, nil, err
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	dest, kind := root, actions.Rename
+	if opts.Dest != "" {
+		if dest, err = filepath.Abs(opts.Dest); err != nil {
+			return nil, nil, err
+		}
+		kind = actions.Move
+	}
+	switch opts.Conflict {
+	case "", Skip, Suffix:
+	default:
+		return nil, nil, fmt.Errorf("unknown conflict handling %q", opts.Conflict)
+	}
+
+	plan := new(actions.Plan)
+	var skipped []Skipped
+	taken := make(map[string]bool) // New paths of the planned files.
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+		r := match(rules, filepath.ToSlash(fi.RelPath()))
+		if r == nil {
+			continue
+		}
+
+		rel, err := r.render(fi)
+		if err == nil && (rel == "." || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../")) {
+			err = fmt.Errorf("new path %q is outside the destination", rel)
+		}
+		if err != nil {
+			skipped = append(skipped, Skipped{Path: filepath.Join(root, fi.RelPath()), Reason: err.Error()})
+			continue
+		}
+		src, dst := filepath.Join(root, fi.RelPath()), filepath.Join(dest, filepath.FromSlash(rel))
+		if dst == src {
+			continue
+		}
+
+		if taken[dst] || exists(dst) {
+			if opts.Conflict != Suffix {
+				skipped = append(skipped, Skipped{Path: src, Reason: fmt.Sprintf("%s already exists", dst)})
+				continue
+			}
+			dst = free(dst, taken)
+		}
+		taken[dst] = true
+		plan.Add(actions.Op{Kind: kind, Src: src, Dst: dst, Size: fi.Size(), Reason: "organize rule " + r.Name})
+	}
+
+	return plan, skipped, nil
+}
+
+// match returns the first rule matching the file at the slash-separated relative path p, or nil.
+func match(rules []Rule, p string) *Rule {
+	for i := range rules {
+		r := &rules[i]
+		if len(r.Paths) > 0 && !matchAny(r.Paths, p, alert.Match) {
+			continue
+		}
+		if len(r.Names) > 0 && !matchAny(r.Names, path.Base(p), func(pattern, name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+// matchAny reports whether one of the patterns matches s.
+func matchAny(patterns []string, s string, match func(pattern, s string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the new slash-separated relative path of the file.
+func (r *Rule) render(fi dirreader.FileInfo) (string, error) {
+	var b strings.Builder
+	ext := filepath.Ext(fi.Name())
+	for _, s := range r.segments {
+		switch s.field {
+		case "":
+			b.WriteString(s.text)
+		case "name":
+			b.WriteString(fi.Name())
+		case "stem":
+			b.WriteString(strings.TrimSuffix(fi.Name(), ext))
+		case "ext":
+			b.WriteString(strings.ToLower(strings.TrimPrefix(ext, ".")))
+		case "dir":
+			b.WriteString(filepath.ToSlash(filepath.Clean(fi.PathRel)))
+		case "size":
+			b.WriteString(strconv.FormatInt(fi.Size(), 10))
+		case "hash":
+			if fi.Hash == "" {
+				return "", errors.New("no hash, the scan did not compute it")
+			}
+			b.WriteString(fi.Hash)
+		case "mtime":
+			b.WriteString(fi.ModTime().Format(s.arg))
+		case "taken":
+			t, err := exifDate(fi.PathAbs)
+			if err != nil {
+				t = fi.ModTime()
+			}
+			b.WriteString(t.Format(s.arg))
+		case "meta":
+			v, ok := fi.Meta[s.arg]
+			if !ok {
+				return "", fmt.Errorf("no label %q", s.arg)
+			}
+			b.WriteString(strings.ReplaceAll(v, "/", "_"))
+		}
+	}
+	return path.Clean(b.String()), nil
+}
+
+// exists reports whether a file exists at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// free returns the first path derived from dst by numbering its name, e.g. "a (2).jpg", neither taken by a file
+// nor planned.
+func free(dst string, taken map[string]bool) string {
+	ext := filepath.Ext(dst)
+	stem := strings.TrimSuffix(dst, ext)
+	for i := 2; ; i++ {
+		p := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if !taken[p] && !exists(p) {
+			return p
+		}
+	}
+}
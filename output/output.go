@@ -0,0 +1,297 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Format represents an output format.
+type Format string
+
+const (
+	JSON   Format = "json"   // A single JSON array.
+	NDJSON Format = "ndjson" // One JSON object per line.
+	CSV    Format = "csv"    // Comma-separated values with a header row.
+)
+
+// Column represents a FileInfo field that can be selected for output.
+type Column string
+
+const (
+	Name        Column = "name"        // Base name of the file.
+	Path        Column = "path"        // Relative path of the file, including its name.
+	PathAbs     Column = "pathAbs"     // Absolute path of the file.
+	PathRel     Column = "pathRel"     // Relative path of the directory containing the file.
+	Root        Column = "root"        // Root the file was found under, empty for single-root scans.
+	Size        Column = "size"        // Size of the file in bytes.
+	Mode        Column = "mode"        // File mode, e.g. "-rw-r--r--".
+	ModTime     Column = "modTime"     // Modification time in RFC 3339 format.
+	Hash        Column = "hash"        // Hash of the file's content.
+	Perm        Column = "perm"        // Numeric permission bits in octal, e.g. "0644".
+	UID         Column = "uid"         // Numeric ID of the owning user, empty if unknown.
+	GID         Column = "gid"         // Numeric ID of the owning group, empty if unknown.
+	User        Column = "user"        // Name of the owning user, empty if unknown.
+	Group       Column = "group"       // Name of the owning group, empty if unknown.
+	ContentType Column = "contentType" // MIME type sniffed from the content, empty if not collected.
+	Binary      Column = "binary"      // Whether the file is binary, false if not collected.
+	Lines       Column = "lines"       // Number of lines of a text file, 0 if not collected.
+	Encrypted   Column = "encrypted"   // Whether the file is encrypted, false if not collected.
+	Dev         Column = "dev"         // ID of the device the file resides on, 0 if unknown.
+	Ino         Column = "ino"         // Inode number of the file, 0 if unknown.
+	QuickHash   Column = "quickHash"   // Hash of the file's size and ends, empty if not collected.
+)
+
+// DefaultColumns is the column set used for CSV output when no columns are selected.
+var DefaultColumns = []Column{Path, Size, ModTime, Hash}
+
+// Encoder writes files to an output stream one at a time.
+// Close must be called after the last file to complete the output.
+type Encoder interface {
+	Encode(fi dirreader.FileInfo) error
+	Close() error
+}
+
+// NewEncoder returns an encoder writing to w in the provided format.
+// If no columns are selected, JSON formats encode complete FileInfo objects and CSV uses DefaultColumns.
+func NewEncoder(w io.Writer, format Format, columns []Column) (Encoder, error) {
+	for _, c := range columns {
+		if _, ok := fields[c]; !ok {
+			return nil, fmt.Errorf("unknown column %q", c)
+		}
+	}
+
+	switch format {
+	case JSON:
+		return &jsonEncoder{w: bufio.NewWriter(w), columns: columns}, nil
+	case NDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonEncoder{w: bw, enc: json.NewEncoder(bw), columns: columns}, nil
+	case CSV:
+		if len(columns) == 0 {
+			columns = DefaultColumns
+		}
+		return &csvEncoder{w: csv.NewWriter(w), columns: columns}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// Write writes all the provided files to w in the provided format.
+func Write(w io.Writer, format Format, columns []Column, files []dirreader.FileInfo) error {
+	enc, err := NewEncoder(w, format, columns)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		if err = enc.Encode(fi); err != nil {
+			return err
+		}
+	}
+
+	return enc.Close()
+}
+
+// WriteChan writes the files received from the channel to w in the provided format until the channel is closed.
+func WriteChan(w io.Writer, format Format, columns []Column, files <-chan dirreader.FileInfo) error {
+	enc, err := NewEncoder(w, format, columns)
+	if err != nil {
+		return err
+	}
+
+	for fi := range files {
+		if err = enc.Encode(fi); err != nil {
+			// Drain the channel so the producer is not blocked forever.
+			for range files {
+			}
+			return err
+		}
+	}
+
+	return enc.Close()
+}
+
+// jsonEncoder writes files as elements of a JSON array.
+type jsonEncoder struct {
+	w       *bufio.Writer
+	columns []Column
+	n       int
+}
+
+func (e *jsonEncoder) Encode(fi dirreader.FileInfo) error {
+	b, err := marshal(fi, e.columns)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if e.n == 0 {
+		sep = "[\n"
+	}
+	e.n++
+
+	if _, err = e.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if e.n == 0 {
+		end = "[]\n"
+	}
+	if _, err := e.w.WriteString(end); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// ndjsonEncoder writes files as JSON objects separated by newlines.
+type ndjsonEncoder struct {
+	w       *bufio.Writer
+	enc     *json.Encoder
+	columns []Column
+}
+
+func (e *ndjsonEncoder) Encode(fi dirreader.FileInfo) error {
+	if len(e.columns) == 0 {
+		return e.enc.Encode(fi)
+	}
+
+	b, err := marshal(fi, e.columns)
+	if err != nil {
+		return err
+	}
+	if _, err = e.w.Write(b); err != nil {
+		return err
+	}
+
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return e.w.Flush()
+}
+
+// csvEncoder writes files as CSV records preceded by a header.
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []Column
+	header  bool
+}
+
+func (e *csvEncoder) Encode(fi dirreader.FileInfo) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		record[i] = fmt.Sprint(fields[c](fi))
+	}
+
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader writes the header row once, so that even an empty output has one.
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+
+	header := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		header[i] = string(c)
+	}
+
+	return e.w.Write(header)
+}
+
+// marshal encodes the selected columns of the file as a JSON object, or the whole file if no columns are selected.
+func marshal(fi dirreader.FileInfo, columns []Column) ([]byte, error) {
+	if len(columns) == 0 {
+		return json.Marshal(fi)
+	}
+
+	// Build the object by hand to keep the columns in the selected order.
+	b := []byte{'{'}
+	for i, c := range columns {
+		vb, err := json.Marshal(fields[c](fi))
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuote(b, string(c))
+		b = append(b, ':')
+		b = append(b, vb...)
+	}
+
+	return append(b, '}'), nil
+}
+
+// fields maps each column to the function extracting its value from a file.
+var fields = map[Column]func(fi dirreader.FileInfo) any{
+	Name:    func(fi dirreader.FileInfo) any { return fi.Name() },
+	Path:    func(fi dirreader.FileInfo) any { return fi.RelPath() },
+	PathAbs: func(fi dirreader.FileInfo) any { return fi.PathAbs },
+	PathRel: func(fi dirreader.FileInfo) any { return fi.PathRel },
+	Root:    func(fi dirreader.FileInfo) any { return fi.Root },
+	Size:    func(fi dirreader.FileInfo) any { return fi.Size() },
+	Mode:    func(fi dirreader.FileInfo) any { return fi.Mode().String() },
+	ModTime: func(fi dirreader.FileInfo) any { return fi.ModTime().Format(time.RFC3339Nano) },
+	Hash:    func(fi dirreader.FileInfo) any { return fi.Hash },
+	Perm:    func(fi dirreader.FileInfo) any { return fmt.Sprintf("%04o", fi.Perm()) },
+	UID: func(fi dirreader.FileInfo) any {
+		if fi.Owner == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(fi.Owner.UID), 10)
+	},
+	GID: func(fi dirreader.FileInfo) any {
+		if fi.Owner == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(fi.Owner.GID), 10)
+	},
+	User: func(fi dirreader.FileInfo) any {
+		if fi.Owner == nil {
+			return ""
+		}
+		return fi.Owner.User
+	},
+	ContentType: func(fi dirreader.FileInfo) any { return fi.ContentType },
+	Binary:      func(fi dirreader.FileInfo) any { return fi.IsBinary },
+	Lines:       func(fi dirreader.FileInfo) any { return fi.LineCount },
+	Encrypted:   func(fi dirreader.FileInfo) any { return fi.Encrypted },
+	Dev:         func(fi dirreader.FileInfo) any { return fi.Dev },
+	Ino:         func(fi dirreader.FileInfo) any { return fi.Ino },
+	QuickHash:   func(fi dirreader.FileInfo) any { return fi.QuickHash },
+	Group: func(fi dirreader.FileInfo) any {
+		if fi.Owner == nil {
+			return ""
+		}
+		return fi.Owner.Group
+	},
+}
@@ -0,0 +1,631 @@
+// Package pipeline runs jobs of several steps defined in configuration, such as scanning a tree, comparing it with
+// its last snapshot, notifying a webhook of the changes and syncing them to a replica, as a single unit sharing
+// the files scanned and with a single status.
+//
+// A pipeline is defined in JSON:
+//
+//	{
+//	  "name": "nightly",
+//	  "root": "/srv/data",
+//	  "hash": "sha256",
+//	  "store": "/var/lib/octopus/snapshots",
+//	  "steps": [
+//	    {"type": "scan"},
+//	    {"type": "enrich", "processor": "plugin", "plugin": "exif", "contentTypes": ["image/*"]},
+//	    {"type": "diff"},
+//	    {"type": "alert", "rules": [{"name": "etc", "paths": ["etc"]}], "url": "https://hooks.example.com/alerts"},
+//	    {"type": "notify", "url": "https://hooks.example.com/octopus"},
+//	    {"type": "sync", "dest": "/mnt/replica", "delete": true, "trash": "/mnt/trash"},
+//	    {"type": "verify", "dest": "/mnt/replica"},
+//	    {"type": "snapshot"}
+//	  ]
+//	}
+//
+// Enrich steps label the files with a processor, only those of their content types if any, so that expensive
+// processors do not read irrelevant files. The content types are then detected by the scans, see
+// dirreader.WithContentType, and matched with path.Match, ignoring their parameters.
+//
+// Saving the snapshot last means a failed run is compared with the same snapshot, and its changes notified and
+// synced, again the next time.
+//
+// A pipeline is the profile of its root: besides the hash algorithm and the store, it may set the file extensions its
+// scans include or exclude and a rate limit on their reads. RunAll runs the pipelines of several roots in one
+// process, each isolated from the failures of the others.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/alert"
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	"github.com/gromey/octopus/dirsync"
+	"github.com/gromey/octopus/enrich"
+	"github.com/gromey/octopus/hashes"
+	"github.com/gromey/octopus/plugins"
+	"github.com/gromey/octopus/snapshot"
+	"github.com/gromey/octopus/trash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the runs with the global tracer provider, see otel.SetTracerProvider: an
+// octopus.pipeline span per run, with an octopus.step span per step, parent of the spans of its scans, diff and sync.
+var tracer = otel.Tracer("github.com/gromey/octopus/pipeline")
+
+// StepType represents the kind of a step.
+type StepType string
+
+const (
+	Scan     StepType = "scan"     // Scan the root; the following steps use its files.
+	Diff     StepType = "diff"     // Compare the files with the latest snapshot of the root in the store.
+	Snapshot StepType = "snapshot" // Save the files as a new snapshot of the root in the store.
+	Notify   StepType = "notify"   // POST the changes found by diff to a webhook, skipped if there are none.
+	Sync     StepType = "sync"     // Make the destination a copy of the root, skipped if diff found no changes.
+	Verify   StepType = "verify"   // Check that the files of the destination have the hashes of the scanned ones.
+	Enrich   StepType = "enrich"   // Label the files with a processor, see Processor.
+	Alert    StepType = "alert"    // Evaluate alert rules on the changes found by diff, posting the alerts to a webhook if any.
+)
+
+// Processor represents the processor labeling the files of an enrich step, with the labels prefixed by its name
+// followed by a dot, or by the name of the plugin for the plugin processor.
+type Processor string
+
+const (
+	Media     Processor = "media"     // Validate the containers of video and audio files, see enrich.Media.
+	Documents Processor = "documents" // Inventory the active content of Office and PDF documents, see enrich.Document.
+	Language  Processor = "language"  // Detect the language of text files, see enrich.Language.
+	Plugin    Processor = "plugin"    // Label the files with an external plugin, see enrich.Plugin.
+)
+
+// Status represents the outcome of a step.
+type Status string
+
+const (
+	OK      Status = "ok"      // The step completed.
+	Skipped Status = "skipped" // The step did not run, because there was nothing to do or a previous step failed.
+	Failed  Status = "failed"  // The step failed, which fails the pipeline.
+)
+
+// Pipeline represents a job of several steps, see Run.
+type Pipeline struct {
+	Name  string `json:"name"`            // Name of the pipeline, for reports.
+	Root  string `json:"root"`            // Directory the steps work on.
+	Hash  string `json:"hash,omitempty"`  // Hash algorithm of the scans, see hashes.Lookup, hashes.Default if empty.
+	Store string `json:"store,omitempty"` // Snapshot store of the diff and snapshot steps.
+	Steps []Step `json:"steps"`           // Steps, run in order.
+
+	Include    []string `json:"include,omitempty"`    // Only scan and sync the files with these extensions, see dirreader.Exec.
+	Exclude    []string `json:"exclude,omitempty"`    // Do not scan or sync the files with these extensions.
+	SkipHidden bool     `json:"skipHidden,omitempty"` // Skip hidden files and directories.
+	RateLimit  int64    `json:"rateLimit,omitempty"`  // Maximum number of bytes read per second by the scans, unlimited if 0.
+
+	Logger *slog.Logger `json:"-"` // Logs the steps and the scans, see dirreader.WithLogger (optional).
+}
+
+// Step represents a step of a pipeline.
+type Step struct {
+	Type   StepType `json:"type"`             // Kind of the step.
+	URL    string   `json:"url,omitempty"`    // Webhook of a notify step, or of an alert step (optional).
+	Dest   string   `json:"dest,omitempty"`   // Destination of a sync or verify step.
+	Delete bool     `json:"delete,omitempty"` // Whether a sync step deletes the files missing from the root.
+	Always bool     `json:"always,omitempty"` // Whether a notify or sync step runs even if diff found no changes.
+	Trash  string   `json:"trash,omitempty"`  // Trash directory, or "system" for the trash of the desktop, receiving the files a sync step deletes.
+
+	Processor    Processor `json:"processor,omitempty"`    // Processor of an enrich step.
+	Plugin       string    `json:"plugin,omitempty"`       // Name of the plugin of the plugin processor, see plugins.Find.
+	ContentTypes []string  `json:"contentTypes,omitempty"` // Content types of the files an enrich step labels, e.g. "image/*", all if empty.
+
+	Rules []alert.Rule `json:"rules,omitempty"` // Rules of an alert step.
+}
+
+// StepResult represents the outcome of a step.
+type StepResult struct {
+	Type    StepType      `json:"type"`
+	Status  Status        `json:"status"`
+	Detail  string        `json:"detail,omitempty"` // Summary of what the step did, e.g. "12 changes".
+	Error   string        `json:"error,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Report represents the outcome of a run.
+type Report struct {
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed"`
+	OK      bool          `json:"ok"`               // Whether all the steps completed or were skipped for lack of work.
+	Changes int           `json:"changes"`          // Number of changes found by diff.
+	Files   int           `json:"files"`            // Number of files found by the scan.
+	Hashed  int64         `json:"hashed"`           // Number of bytes hashed by the scan, counting hard-linked files once.
+	Errors  int           `json:"errors"`           // Number of files and directories the scan failed to read.
+	Alerts  []alert.Alert `json:"alerts,omitempty"` // Alerts triggered by alert steps.
+	Steps   []StepResult  `json:"steps"`
+}
+
+// Load reads and validates the pipeline defined in the JSON file at path.
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load pipeline %s: %w", path, err)
+	}
+
+	p := new(Pipeline)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("load pipeline %s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = filepath.Base(path)
+	}
+	if err = p.Validate(); err != nil {
+		return nil, fmt.Errorf("load pipeline %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// Validate checks that the steps are known, have the settings they need, and come after a scan where required.
+func (p *Pipeline) Validate() error {
+	if p.Root == "" {
+		return errors.New("root is required")
+	}
+	if _, err := hashes.Lookup(p.hashName()); err != nil {
+		return err
+	}
+	if len(p.Include) > 0 && len(p.Exclude) > 0 {
+		return errors.New("include and exclude cannot be used together")
+	}
+	if p.RateLimit < 0 {
+		return errors.New("rateLimit must not be negative")
+	}
+
+	scanned, diffed := false, false
+	for i, s := range p.Steps {
+		var err error
+		switch s.Type {
+		case Scan:
+		case Diff, Snapshot:
+			if p.Store == "" {
+				err = errors.New("store is required")
+			}
+		case Notify:
+			if s.URL == "" {
+				err = errors.New("url is required")
+			}
+		case Sync, Verify:
+			if s.Dest == "" {
+				err = errors.New("dest is required")
+			}
+			if s.Type == Verify && p.Hash == "none" {
+				err = errors.New("a hash algorithm is required")
+			}
+			if s.Trash != "" && (s.Type != Sync || !s.Delete) {
+				err = errors.New("trash requires a sync step that deletes")
+			}
+		case Enrich:
+			err = s.validateEnrich()
+		case Alert:
+			if len(s.Rules) == 0 {
+				err = errors.New("rules are required")
+			} else if !diffed {
+				err = errors.New("must follow a diff step")
+			} else {
+				err = alert.Validate(s.Rules)
+			}
+		default:
+			err = fmt.Errorf("unknown step type %q", s.Type)
+		}
+		if err == nil && s.Type != Scan && !scanned {
+			err = errors.New("must follow a scan step")
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, s.Type, err)
+		}
+		scanned = scanned || s.Type == Scan
+		diffed = diffed || s.Type == Diff
+	}
+
+	return nil
+}
+
+// validateEnrich checks the processor and the content types of an enrich step.
+func (s *Step) validateEnrich() error {
+	switch s.Processor {
+	case Media, Documents, Language:
+	case Plugin:
+		if s.Plugin == "" {
+			return errors.New("plugin is required")
+		}
+	case "":
+		return errors.New("processor is required")
+	default:
+		return fmt.Errorf("unknown processor %q", s.Processor)
+	}
+	for _, ct := range s.ContentTypes {
+		if _, err := path.Match(ct, ""); err != nil {
+			return fmt.Errorf("content type %q: %w", ct, err)
+		}
+	}
+	return nil
+}
+
+// hashName returns the name of the hash algorithm of the pipeline.
+func (p *Pipeline) hashName() string {
+	if p.Hash == "" {
+		return hashes.Default
+	}
+	return p.Hash
+}
+
+// state holds what the steps of a run share.
+type state struct {
+	hashFunc func() hash.Hash
+	scan     []dirreader.Option
+	mask     []string // File extensions the scans include or exclude.
+	include  bool
+	files    []dirreader.FileInfo // Files of the last scan.
+	stats    dirreader.Stats      // Statistics of the last scan, for its capabilities.
+	errors   int                  // Number of failures of the last scan.
+	diffed   bool                 // Whether a diff step ran.
+	changes  []diff.Change        // Changes found by the last diff.
+	prev     int                  // Number of files of the snapshot compared by the last diff.
+	alerts   []alert.Alert        // Alerts triggered by alert steps.
+}
+
+// Run runs the steps in order, stopping at the first failure: the following steps are skipped.
+// The options are applied to the scans, e.g. dirreader.WithSkipHidden. When the context is done, the step in
+// progress fails and the others are skipped. The returned error is the error of the failed step, along with the report.
+func (p *Pipeline) Run(ctx context.Context, opts ...dirreader.Option) (*Report, error) {
+	rep := &Report{Name: p.Name, Started: time.Now(), OK: true}
+
+	h, err := hashes.Lookup(p.hashName())
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tracer.Start(ctx, "octopus.pipeline", trace.WithAttributes(attribute.String("octopus.pipeline", p.Name), attribute.String("octopus.root", p.Root)))
+	defer span.End()
+	st := &state{hashFunc: h, scan: append(opts[:len(opts):len(opts)], dirreader.WithContext(ctx))}
+	st.mask, st.include = p.Exclude, false
+	if len(p.Include) > 0 {
+		st.mask, st.include = p.Include, true
+	}
+	if p.SkipHidden {
+		st.scan = append(st.scan, dirreader.WithSkipHidden(true))
+	}
+	if p.RateLimit > 0 {
+		st.scan = append(st.scan, dirreader.WithRateLimit(p.RateLimit))
+	}
+	var log *slog.Logger
+	if p.Logger != nil {
+		log = p.Logger.With("pipeline", p.Name)
+		st.scan = append(st.scan, dirreader.WithLogger(log))
+	}
+	for _, s := range p.Steps {
+		if s.Type == Enrich && len(s.ContentTypes) > 0 {
+			st.scan = append(st.scan, dirreader.WithContentType(true))
+			break
+		}
+	}
+
+	for _, s := range p.Steps {
+		res := StepResult{Type: s.Type, Status: Skipped}
+		if rep.OK {
+			start := time.Now()
+			var detail string
+			var skip bool
+			sctx, sspan := tracer.Start(ctx, "octopus.step", trace.WithAttributes(attribute.String("octopus.step", string(s.Type))))
+			detail, skip, err = p.runStep(sctx, s, st)
+			if err != nil {
+				sspan.RecordError(err)
+				sspan.SetStatus(codes.Error, err.Error())
+			}
+			sspan.End()
+			res.Elapsed = time.Since(start)
+			switch {
+			case err != nil:
+				res.Status, res.Error = Failed, err.Error()
+				rep.OK = false
+				err = fmt.Errorf("%s: %w", s.Type, err)
+			case !skip:
+				res.Status = OK
+			}
+			res.Detail = detail
+			if log != nil && res.Status == Failed {
+				log.Error("step failed", "step", string(s.Type), "elapsed", res.Elapsed, "error", res.Error)
+			} else if log != nil {
+				log.Info("step finished", "step", string(s.Type), "status", string(res.Status), "elapsed", res.Elapsed, "detail", detail)
+			}
+		}
+		rep.Steps = append(rep.Steps, res)
+	}
+
+	rep.Changes = len(st.changes)
+	rep.Files, rep.Errors = len(st.files), st.errors
+	if st.hashFunc != nil {
+		rep.Hashed = st.stats.Bytes
+	}
+	rep.Alerts = st.alerts
+	rep.Elapsed = time.Since(rep.Started)
+	span.SetAttributes(attribute.Int("octopus.changes", rep.Changes), attribute.Bool("octopus.ok", rep.OK))
+	if !rep.OK {
+		span.SetStatus(codes.Error, err.Error())
+		return rep, fmt.Errorf("pipeline %s: %w", p.Name, err)
+	}
+
+	return rep, nil
+}
+
+// RunAll runs the pipelines concurrently, as Run, and returns their reports and errors by index. A pipeline that
+// fails, or panics, only fails its own report, and the others run to completion.
+func RunAll(ctx context.Context, pipelines []*Pipeline, opts ...dirreader.Option) ([]*Report, []error) {
+	reports := make([]*Report, len(pipelines))
+	errs := make([]error, len(pipelines))
+	var wg sync.WaitGroup
+	for i, p := range pipelines {
+		wg.Add(1)
+		go func(i int, p *Pipeline) {
+			defer wg.Done()
+			defer func() {
+				if v := recover(); v != nil {
+					reports[i] = &Report{Name: p.Name, Started: time.Now()}
+					errs[i] = fmt.Errorf("pipeline %s: panic: %v", p.Name, v)
+				}
+			}()
+			reports[i], errs[i] = p.Run(ctx, opts...)
+		}(i, p)
+	}
+	wg.Wait()
+	return reports, errs
+}
+
+// runStep runs a step and returns a summary of what it did, and whether it was skipped for lack of work.
+func (p *Pipeline) runStep(ctx context.Context, s Step, st *state) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+
+	switch s.Type {
+	case Scan:
+		files, err := dirreader.Exec(p.Root, st.hashFunc, st.mask, st.include, append(st.scan[:len(st.scan):len(st.scan)], dirreader.WithStats(&st.stats), dirreader.WithContext(ctx))...)
+		if err != nil {
+			if st.errors = len(dirreader.Errors(err)); st.errors == 0 {
+				st.errors = 1
+			}
+			return "", false, dirreader.Summarize(err)
+		}
+		st.files = files
+		return fmt.Sprintf("%d files", len(files)), false, nil
+
+	case Diff:
+		store, err := snapshot.Open(p.Store)
+		if err != nil {
+			return "", false, err
+		}
+		var prev []dirreader.FileInfo
+		last, err := store.Latest(p.Root)
+		if err == nil {
+			prev = last.Files
+		} else if !errors.Is(err, snapshot.ErrNotFound) {
+			return "", false, err
+		}
+		st.changes, st.diffed, st.prev = diff.CompareContext(ctx, prev, st.files), true, len(prev)
+		if last == nil {
+			return fmt.Sprintf("%d changes, no previous snapshot", len(st.changes)), false, nil
+		}
+		return fmt.Sprintf("%d changes since %s", len(st.changes), last.ID), false, nil
+
+	case Snapshot:
+		store, err := snapshot.Open(p.Store)
+		if err != nil {
+			return "", false, err
+		}
+		caps := st.stats.Capabilities
+		snap := &snapshot.Snapshot{Root: p.Root, Tags: []string{"pipeline:" + p.Name}, Files: st.files, Capabilities: &caps}
+		snap.Hash, snap.Filters = strings.ToLower(p.hashName()), &snapshot.Filters{Include: p.Include, Exclude: p.Exclude, SkipHidden: p.SkipHidden}
+		if err = store.Save(snap); err != nil {
+			return "", false, err
+		}
+		return snap.ID, false, nil
+
+	case Notify:
+		if st.diffed && len(st.changes) == 0 && !s.Always {
+			return "no changes", true, nil
+		}
+		return fmt.Sprintf("%d changes", len(st.changes)), false, p.notify(ctx, s.URL, st)
+
+	case Sync:
+		if st.diffed && len(st.changes) == 0 && !s.Always {
+			return "no changes", true, nil
+		}
+		var bin *trash.Trash
+		var err error
+		if s.Trash == "system" {
+			bin, err = trash.System()
+		} else if s.Trash != "" {
+			bin, err = trash.Open(s.Trash)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		defer func() { _ = bin.Close() }()
+		res, err := dirsync.Sync(p.Root, s.Dest, dirsync.Options{HashFunc: st.hashFunc, Mask: st.mask, Include: st.include, Scan: st.scan, Delete: s.Delete, Context: ctx, Verify: true, Trash: bin})
+		if res == nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("copied %d files (%d bytes), deleted %d files", res.Copied, res.Bytes, res.Deleted), false, err
+
+	case Verify:
+		return verify(ctx, s.Dest, st)
+
+	case Enrich:
+		return enrichFiles(ctx, s, st)
+
+	case Alert:
+		alerts := alert.Evaluate(s.Rules, st.changes, st.prev)
+		st.alerts = append(st.alerts, alerts...)
+		if len(alerts) == 0 {
+			return "no alerts", true, nil
+		}
+		if s.URL == "" {
+			return fmt.Sprintf("%d alerts", len(alerts)), false, nil
+		}
+		return fmt.Sprintf("%d alerts", len(alerts)), false, alert.Post(ctx, s.URL, alerts)
+	}
+
+	return "", false, fmt.Errorf("unknown step type %q", s.Type)
+}
+
+// notification is the body posted by a notify step.
+type notification struct {
+	Pipeline string        `json:"pipeline"`
+	Root     string        `json:"root"`
+	Changes  []notifyEntry `json:"changes"`
+}
+
+// notifyEntry is a change in a notification.
+type notifyEntry struct {
+	Op   diff.Op `json:"op"`
+	Path string  `json:"path"`
+}
+
+// notify posts the changes to the webhook.
+func (p *Pipeline) notify(ctx context.Context, url string, st *state) error {
+	n := notification{Pipeline: p.Name, Root: p.Root, Changes: make([]notifyEntry, len(st.changes))}
+	for i, c := range st.changes {
+		n.Changes[i] = notifyEntry{Op: c.Op, Path: filepath.ToSlash(c.Path)}
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// verify scans the destination and checks that it holds every scanned file with the same hash.
+func verify(ctx context.Context, dest string, st *state) (string, bool, error) {
+	if st.hashFunc == nil {
+		return "", false, errors.New("a hash algorithm is required")
+	}
+
+	copies, err := dirreader.ExecMap(dest, st.hashFunc, nil, false, append(st.scan[:len(st.scan):len(st.scan)], dirreader.WithContext(ctx))...)
+	if err != nil {
+		return "", false, dirreader.Summarize(err)
+	}
+
+	for _, fi := range st.files {
+		c, ok := copies[dirreader.NormPath(fi.RelPath())]
+		switch {
+		case !ok:
+			err = errors.Join(err, fmt.Errorf("%s: missing from %s", fi.RelPath(), dest))
+		case c.Hash != fi.Hash:
+			err = errors.Join(err, fmt.Errorf("%s: hash mismatch in %s", fi.RelPath(), dest))
+		}
+	}
+
+	return fmt.Sprintf("%d files", len(st.files)), false, err
+}
+
+// enrichFiles labels the scanned files of the content types of the step with its processor.
+func enrichFiles(ctx context.Context, s Step, st *state) (string, bool, error) {
+	var selected []dirreader.FileInfo
+	var indexes []int
+	for i, fi := range st.files {
+		if s.routes(fi.ContentType) {
+			selected = append(selected, fi)
+			indexes = append(indexes, i)
+		}
+	}
+	detail := fmt.Sprintf("%d of %d files", len(selected), len(st.files))
+	if len(selected) == 0 {
+		return detail, true, nil
+	}
+
+	var err error
+	switch s.Processor {
+	case Media:
+		err = (&enrich.Media{Prefix: string(Media) + "."}).Enrich(ctx, selected)
+	case Documents:
+		err = (&enrich.Document{Prefix: string(Documents) + "."}).Enrich(ctx, selected)
+	case Language:
+		err = (&enrich.Language{Prefix: string(Language) + "."}).Enrich(ctx, selected)
+	case Plugin:
+		err = enrichWithPlugin(ctx, s.Plugin, selected)
+	default:
+		err = fmt.Errorf("unknown processor %q", s.Processor)
+	}
+
+	// The labels of the files that could be read are kept even if others failed.
+	for j, i := range indexes {
+		st.files[i].Meta = selected[j].Meta
+	}
+	return detail, false, err
+}
+
+// routes reports whether the files of the content type are labeled by the enrich step.
+func (s *Step) routes(contentType string) bool {
+	if len(s.ContentTypes) == 0 {
+		return true
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mt
+	}
+	for _, pattern := range s.ContentTypes {
+		if ok, _ := path.Match(pattern, contentType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enrichWithPlugin labels the files with the named plugin, which must support plugins.Enrich.
+func enrichWithPlugin(ctx context.Context, name string, files []dirreader.FileInfo) error {
+	p, err := plugins.Find(name, plugins.SearchPath())
+	if err != nil {
+		return err
+	}
+	c, err := plugins.Start(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !c.Supports(plugins.Enrich) {
+		err = fmt.Errorf("plugin %s does not support %s", name, plugins.Enrich)
+	} else {
+		err = (&enrich.Plugin{Client: c, Prefix: name + "."}).Enrich(ctx, files)
+	}
+	return errors.Join(err, c.Close())
+}
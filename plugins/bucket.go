@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"context"
+	"time"
+
+	"github.com/gromey/octopus/publish"
+)
+
+// Bucket is a publish.Bucket storing the objects with a plugin supporting Put, which receives the params
+//
+//	{"key": "snapshots/<id>.json", "data": "<base64>", "lock": {"mode": "COMPLIANCE", "until": "...", "legalHold": false}}
+//
+// and must only respond once the object is stored with the requested retention, or fail.
+type Bucket struct {
+	Client *Client
+}
+
+// putParams are the params of a Put request.
+type putParams struct {
+	Key  string     `json:"key"`
+	Data []byte     `json:"data"`
+	Lock lockParams `json:"lock"`
+}
+
+// lockParams represent a publish.Lock in a Put request.
+type lockParams struct {
+	Mode      publish.Mode `json:"mode,omitempty"`
+	Until     *time.Time   `json:"until,omitempty"`
+	LegalHold bool         `json:"legalHold,omitempty"`
+}
+
+// Put uploads the object under the key with the provided lock.
+func (b *Bucket) Put(ctx context.Context, key string, data []byte, lock publish.Lock) error {
+	params := putParams{Key: key, Data: data, Lock: lockParams{Mode: lock.Mode, LegalHold: lock.LegalHold}}
+	if !lock.Until.IsZero() {
+		params.Lock.Until = &lock.Until
+	}
+	return b.Client.Call(ctx, Put, params, nil)
+}
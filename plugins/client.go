@@ -0,0 +1,188 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// closeTimeout is how long Close waits for a plugin to exit after closing its input before killing it.
+const closeTimeout = 5 * time.Second
+
+// request is a message sent to a plugin.
+type request struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+// response is a message received from a plugin.
+type response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// handshake is the result of the handshake.
+type handshake struct {
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Client represents a running plugin. Its methods are safe for concurrent use;
+// concurrent calls are sent without waiting for the previous ones to be answered.
+type Client struct {
+	Plugin
+	Capabilities []string // Methods the plugin supports, as reported by the handshake.
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	wmu   sync.Mutex // Serializes the requests written to stdin.
+	enc   *json.Encoder
+
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]chan response
+	done    chan struct{} // Closed once the output of the plugin is closed.
+	err     error         // Why the output was closed, set before done is closed.
+}
+
+// Start runs the plugin and performs the handshake, which is abandoned when the context is done.
+func Start(ctx context.Context, p Plugin) (*Client, error) {
+	cmd := exec.Command(p.Path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", p.Name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", p.Name, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", p.Name, err)
+	}
+
+	c := &Client{
+		Plugin:  p,
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		pending: make(map[uint64]chan response),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(stdout)
+
+	var hs handshake
+	if err = c.Call(ctx, "handshake", handshake{Protocol: Protocol}, &hs); err == nil && hs.Protocol != Protocol {
+		err = fmt.Errorf("plugin %s speaks protocol %d, expected %d", p.Name, hs.Protocol, Protocol)
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	c.Capabilities = hs.Capabilities
+
+	return c, nil
+}
+
+// Supports reports whether the plugin supports the method.
+func (c *Client) Supports(method string) bool {
+	for _, m := range c.Capabilities {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Call sends a request to the plugin and decodes the result of its response into result, unless it is nil.
+// It returns the error reported by the plugin, or an error if the plugin exited or the context is done first.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	ch := make(chan response, 1)
+
+	c.mu.Lock()
+	c.next++
+	id := c.next
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	c.wmu.Lock()
+	err := c.enc.Encode(request{ID: id, Method: method, Params: params})
+	c.wmu.Unlock()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s: %w", c.Name, method, err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return fmt.Errorf("plugin %s: %s: %s", c.Name, method, resp.Error)
+		}
+		if result != nil {
+			if err = json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("plugin %s: %s: %w", c.Name, method, err)
+			}
+		}
+		return nil
+	case <-c.done:
+		return fmt.Errorf("plugin %s: %s: %w", c.Name, method, c.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readLoop dispatches the responses of the plugin to the pending calls until its output is closed.
+func (c *Client) readLoop(stdout io.Reader) {
+	dec := json.NewDecoder(stdout)
+	for {
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("plugin exited")
+			}
+			c.err = err
+			close(c.done)
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// Close closes the input of the plugin and waits for it to exit, killing it if it does not exit in time.
+func (c *Client) Close() error {
+	_ = c.stdin.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", c.Name, err)
+		}
+		return nil
+	case <-time.After(closeTimeout):
+		_ = c.cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("plugin %s: killed after not exiting within %s", c.Name, closeTimeout)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package plugins
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// pluginName returns the name of the plugin of the executable file name, and whether it is one.
+func pluginName(file string) (string, bool) {
+	if !strings.HasPrefix(file, Prefix) {
+		return "", false
+	}
+	return file[len(Prefix):], true
+}
+
+// executable reports whether a file with the mode can be run by someone.
+func executable(mode fs.FileMode) bool {
+	return mode&0o111 != 0
+}
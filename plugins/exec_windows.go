@@ -0,0 +1,22 @@
+//go:build windows
+
+package plugins
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// pluginName returns the name of the plugin of the executable file name, and whether it is one.
+func pluginName(file string) (string, bool) {
+	lower := strings.ToLower(file)
+	if !strings.HasPrefix(lower, Prefix) || !strings.HasSuffix(lower, ".exe") {
+		return "", false
+	}
+	return file[len(Prefix) : len(file)-len(".exe")], true
+}
+
+// executable reports whether a file with the mode can be run; on Windows it depends on the extension only.
+func executable(fs.FileMode) bool {
+	return true
+}
@@ -0,0 +1,101 @@
+// Package plugins runs external executables extending octopus without recompiling it,
+// such as enrichment stages labeling files or object storage backends for publish.
+//
+// A plugin is an executable named octopus-plugin-<name>, found in the directories listed in OCTOPUS_PLUGIN_PATH
+// or in PATH. It is started once and exchanges JSON messages, one per line, over its standard input and output:
+// requests
+//
+//	{"id": 1, "method": "enrich", "params": {...}}
+//
+// are answered, in any order, with
+//
+//	{"id": 1, "result": {...}}
+//
+// or {"id": 1, "error": "message"}. The first request is a handshake with the params {"protocol": 1},
+// to which the plugin responds with the protocol version it speaks and the methods it supports, e.g.
+// {"protocol": 1, "capabilities": ["enrich"]}. The standard error of the plugin is passed through for logging.
+// The plugin must exit when its standard input is closed.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Prefix is the prefix of the names of plugin executables.
+const Prefix = "octopus-plugin-"
+
+// Protocol is the version of the protocol spoken with the plugins.
+const Protocol = 1
+
+// Capabilities of the plugins, i.e. the methods they support besides the handshake.
+const (
+	Enrich = "enrich" // Labels a file, see enrich.Plugin.
+	Put    = "put"    // Stores an object, see Bucket.
+)
+
+// ErrNotFound is returned by Find when no plugin has the name.
+var ErrNotFound = errors.New("plugin not found")
+
+// Plugin represents a plugin executable.
+type Plugin struct {
+	Name string `json:"name"` // Name of the plugin, without Prefix and extension.
+	Path string `json:"path"` // Path of the executable.
+}
+
+// SearchPath returns the directories searched for plugins: those of OCTOPUS_PLUGIN_PATH, then those of PATH.
+func SearchPath() []string {
+	dirs := filepath.SplitList(os.Getenv("OCTOPUS_PLUGIN_PATH"))
+	return append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// Discover returns the plugins found in the directories, sorted by name.
+// A plugin found in several directories is taken from the first one, like commands in PATH.
+// Directories that cannot be read are skipped.
+func Discover(dirs []string) []Plugin {
+	byName := make(map[string]Plugin)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := pluginName(e.Name())
+			if !ok || name == "" {
+				continue
+			}
+			if _, dup := byName[name]; dup {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if st, err := os.Stat(path); err != nil || !st.Mode().IsRegular() || !executable(st.Mode()) {
+				continue
+			}
+			byName[name] = Plugin{Name: name, Path: path}
+		}
+	}
+
+	list := make([]Plugin, 0, len(byName))
+	for _, p := range byName {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// Find returns the plugin with the name found in the directories.
+func Find(name string, dirs []string) (Plugin, error) {
+	for _, p := range Discover(dirs) {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Plugin{}, fmt.Errorf("find plugin %s: %w", name, ErrNotFound)
+}
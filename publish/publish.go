@@ -0,0 +1,112 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gromey/octopus/audit"
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/snapshot"
+)
+
+// Mode represents an Object Lock retention mode.
+type Mode string
+
+const (
+	Governance Mode = "GOVERNANCE" // Retention that users with a special permission can shorten or lift.
+	Compliance Mode = "COMPLIANCE" // Retention that nobody, including the root account, can shorten or lift.
+)
+
+// Lock represents the immutability settings of a published object.
+type Lock struct {
+	Mode      Mode      // Retention mode, no retention if empty.
+	Until     time.Time // End of the retention period.
+	LegalHold bool      // Whether to place a legal hold, which lasts until removed regardless of the retention.
+}
+
+// Bucket is an object storage supporting write-once-read-many retention.
+type Bucket interface {
+	// Put uploads the object under the key with the provided lock.
+	Put(ctx context.Context, key string, data []byte, lock Lock) error
+}
+
+// Publisher writes manifests and audit logs to a Bucket as immutable objects,
+// for compliance regimes that require integrity records nobody can alter or delete.
+type Publisher struct {
+	Bucket    Bucket        // Destination of the published objects.
+	Prefix    string        // Prefix of the object keys, e.g. "octopus/".
+	Mode      Mode          // Retention mode of the published objects, no retention if empty.
+	Retain    time.Duration // Retention period of the published objects, counted from the publication.
+	LegalHold bool          // Whether to place a legal hold on the published objects.
+	Codec     codec.Codec   // Codec the objects are compressed with, whose extension is appended to the keys (optional).
+}
+
+// Snapshot publishes the snapshot under <Prefix>snapshots/<id>.json, followed by the extension of the codec,
+// and returns the key of the object.
+func (p *Publisher) Snapshot(ctx context.Context, snap *snapshot.Snapshot) (string, error) {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", fmt.Errorf("publish snapshot %s: %w", snap.ID, err)
+	}
+
+	key := path.Join(p.Prefix, "snapshots", snap.ID+".json")
+	if key, err = p.put(ctx, key, data); err != nil {
+		return "", fmt.Errorf("publish snapshot %s: %w", snap.ID, err)
+	}
+
+	return key, nil
+}
+
+// AuditLog verifies the audit log at logPath and publishes it under <Prefix>audit/<name>.<n>.ndjson, followed by
+// the extension of the codec, where n is the number of entries, and returns the key of the object.
+// Publishing the log again after new entries were recorded creates a new object, so every published state
+// remains available.
+func (p *Publisher) AuditLog(ctx context.Context, logPath string) (string, error) {
+	var buf bytes.Buffer
+	if err := audit.Export(logPath, &buf); err != nil {
+		return "", fmt.Errorf("publish audit log %s: %w", logPath, err)
+	}
+
+	n := bytes.Count(buf.Bytes(), []byte{'\n'})
+	key, err := p.put(ctx, path.Join(p.Prefix, "audit", filepath.Base(logPath)+"."+strconv.Itoa(n)+".ndjson"), buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("publish audit log %s: %w", logPath, err)
+	}
+
+	return key, nil
+}
+
+// put compresses the object with the codec of the publisher and uploads it with the lock of the publisher.
+// It returns the key of the object, with the extension of the codec appended.
+func (p *Publisher) put(ctx context.Context, key string, data []byte) (string, error) {
+	lock := Lock{Mode: p.Mode, LegalHold: p.LegalHold}
+	if lock.Mode != "" {
+		if p.Retain <= 0 {
+			return "", fmt.Errorf("retention mode %s requires a retention period", lock.Mode)
+		}
+		lock.Until = time.Now().Add(p.Retain)
+	}
+
+	if p.Codec != nil {
+		var buf bytes.Buffer
+		w, err := p.Codec.NewWriter(&buf)
+		if err != nil {
+			return "", err
+		}
+		if _, err = w.Write(data); err != nil {
+			return "", err
+		}
+		if err = w.Close(); err != nil {
+			return "", err
+		}
+		key, data = key+p.Codec.Ext(), buf.Bytes()
+	}
+
+	return key, p.Bucket.Put(ctx, key, data, lock)
+}
@@ -0,0 +1,123 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/sigv4"
+)
+
+// S3 is a Bucket stored in an S3-compatible object storage, addressed path-style, i.e. <Endpoint>/<Bucket>/<key>.
+// Requests are signed with AWS Signature Version 4. The bucket must have Object Lock enabled for the retention
+// headers to be accepted.
+type S3 struct {
+	Endpoint     string       // Base URL of the service, e.g. "https://s3.eu-west-1.amazonaws.com".
+	Bucket       string       // Name of the bucket.
+	Region       string       // Region used to sign requests, defaults to "us-east-1".
+	AccessKey    string       // Access key ID.
+	SecretKey    string       // Secret access key.
+	SessionToken string       // Session token of temporary credentials (optional).
+	HTTP         *http.Client // HTTP client to use, defaults to http.DefaultClient.
+}
+
+// Put uploads the object with the Object Lock headers of the provided lock.
+func (s *S3) Put(ctx context.Context, key string, data []byte, lock Lock) error {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + key)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	u.RawPath = "/" + sigv4.EscapePath(s.Bucket+"/"+key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+
+	// Object Lock requires an integrity header on uploads.
+	sum := md5.Sum(data)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if lock.Mode != "" {
+		req.Header.Set("X-Amz-Object-Lock-Mode", string(lock.Mode))
+		req.Header.Set("X-Amz-Object-Lock-Retain-Until-Date", lock.Until.UTC().Format(time.RFC3339))
+	}
+	if lock.LegalHold {
+		req.Header.Set("X-Amz-Object-Lock-Legal-Hold", "ON")
+	}
+	payload := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(payload[:]), time.Now())
+
+	client := s.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("put %s: unexpected status %s: %s", key, resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// Check verifies that the credentials are accepted and that the bucket has Object Lock enabled,
+// by reading the Object Lock configuration of the bucket.
+func (s *S3) Check(ctx context.Context) error {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket)
+	if err != nil {
+		return fmt.Errorf("check bucket %s: %w", s.Bucket, err)
+	}
+	u.RawPath = "/" + sigv4.EscapePath(s.Bucket)
+	u.RawQuery = "object-lock="
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("check bucket %s: %w", s.Bucket, err)
+	}
+	payload := sha256.Sum256(nil)
+	s.sign(req, hex.EncodeToString(payload[:]), time.Now())
+
+	client := s.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("check bucket %s: %w", s.Bucket, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNotFound && bytes.Contains(body, []byte("ObjectLockConfigurationNotFound")):
+		return fmt.Errorf("check bucket %s: Object Lock is not enabled", s.Bucket)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("check bucket %s: unexpected status %s: %s", s.Bucket, resp.Status, bytes.TrimSpace(body))
+	case !bytes.Contains(body, []byte("<ObjectLockEnabled>Enabled</ObjectLockEnabled>")):
+		return fmt.Errorf("check bucket %s: Object Lock is not enabled", s.Bucket)
+	}
+
+	return nil
+}
+
+// sign adds the Signature Version 4 authorization to the request, see sigv4.Credentials.Sign.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	sigv4.Credentials{Region: s.Region, AccessKey: s.AccessKey, SecretKey: s.SecretKey, SessionToken: s.SessionToken}.Sign(req, payloadHash, now)
+}
@@ -0,0 +1,240 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/snapshot"
+)
+
+// ErrEmptyPolicy is returned when a policy would not keep anything, to protect against pruning everything by mistake.
+var ErrEmptyPolicy = errors.New("retention policy keeps nothing")
+
+// Policy describes which items to keep. An item is kept if any of the rules selects it.
+type Policy struct {
+	Last     int      // Keep the N most recent items.
+	Daily    int      // Keep the most recent item of each of the last N days that have items.
+	Weekly   int      // Keep the most recent item of each of the last N weeks that have items.
+	Monthly  int      // Keep the most recent item of each of the last N months that have items.
+	KeepTags []string // Keep forever the items carrying any of these tags.
+}
+
+// Empty reports whether the policy has no rules.
+func (p Policy) Empty() bool {
+	return p.Last <= 0 && p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0 && len(p.KeepTags) == 0
+}
+
+// Item represents anything subject to retention, such as a snapshot or a mirror directory.
+type Item struct {
+	ID   string    // Identifier of the item.
+	Time time.Time // Time the item was created.
+	Tags []string  // Tags of the item.
+}
+
+// Decision represents the outcome of the policy for a single item.
+type Decision struct {
+	Item
+	Keep    bool     // Whether the item is kept.
+	Reasons []string // Rules that selected the item, e.g. "last", "daily" or "tag:release".
+}
+
+// Apply evaluates the policy against the provided items and returns a decision for each of them,
+// sorted from newest to oldest.
+func (p Policy) Apply(items []Item) ([]Decision, error) {
+	if p.Empty() {
+		return nil, ErrEmptyPolicy
+	}
+
+	decisions := make([]Decision, len(items))
+	for i, item := range items {
+		decisions[i] = Decision{Item: item}
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Time.After(decisions[j].Time) })
+
+	buckets := []struct {
+		reason string
+		n      int
+		key    func(i int, t time.Time) string
+	}{
+		{"last", p.Last, func(i int, _ time.Time) string { return strconv.Itoa(i) }},
+		{"daily", p.Daily, func(_ int, t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.Weekly, func(_ int, t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-%02d", y, w) }},
+		{"monthly", p.Monthly, func(_ int, t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for _, b := range buckets {
+		seen := make(map[string]bool)
+		for i := range decisions {
+			if len(seen) >= b.n {
+				break
+			}
+
+			key := b.key(i, decisions[i].Time)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			decisions[i].Keep = true
+			decisions[i].Reasons = append(decisions[i].Reasons, b.reason)
+		}
+	}
+
+	for i := range decisions {
+		for _, tag := range p.KeepTags {
+			if hasTag(decisions[i].Tags, tag) {
+				decisions[i].Keep = true
+				decisions[i].Reasons = append(decisions[i].Reasons, "tag:"+tag)
+			}
+		}
+	}
+
+	return decisions, nil
+}
+
+// Snapshots applies the policy to the snapshot store and deletes the snapshots that are not kept.
+// The policy is applied separately to each series of comparable snapshots: those of the same root, taken with the
+// same filters and hash algorithm, so that the snapshots of one series do not push those of another out.
+// The decisions of all series are returned together, sorted from newest to oldest.
+// If dryRun is true nothing is deleted and the returned decisions show what would be pruned.
+func Snapshots(s *snapshot.Store, p Policy, dryRun bool) ([]Decision, error) {
+	if p.Empty() {
+		return nil, ErrEmptyPolicy
+	}
+
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var decisions []Decision
+	for _, series := range seriesOf(snaps) {
+		items := make([]Item, len(series))
+		for i, snap := range series {
+			items[i] = Item{ID: snap.ID, Time: snap.Created, Tags: snap.Tags}
+		}
+
+		d, err := p.Apply(items)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d...)
+	}
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Time.After(decisions[j].Time) })
+
+	if dryRun {
+		return decisions, nil
+	}
+
+	for _, d := range decisions {
+		if d.Keep {
+			continue
+		}
+		if e := s.Delete(d.ID); e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+
+	return decisions, err
+}
+
+// seriesOf groups the snapshots by root, filters and hash algorithm, keeping their order.
+func seriesOf(snaps []snapshot.Snapshot) [][]snapshot.Snapshot {
+	var series [][]snapshot.Snapshot
+next:
+	for _, snap := range snaps {
+		for i, group := range series {
+			first := group[0]
+			if first.Root == snap.Root && strings.EqualFold(first.Hash, snap.Hash) && first.Filters.Equal(snap.Filters) {
+				series[i] = append(group, snap)
+				continue next
+			}
+		}
+		series = append(series, []snapshot.Snapshot{snap})
+	}
+	return series
+}
+
+// Dirs applies the policy to the subdirectories of dir whose names are timestamps in the provided layout,
+// as produced by hard-link mirrors that keep one directory per run, and removes the directories that are not kept.
+// Subdirectories whose names do not match the layout are left untouched.
+// If dryRun is true nothing is removed and the returned decisions show what would be pruned.
+func Dirs(dir, layout string, p Policy, dryRun bool) ([]Decision, error) {
+	decisions, err := dirDecisions(dir, layout, p)
+	if err != nil || dryRun {
+		return decisions, err
+	}
+
+	for _, d := range decisions {
+		if d.Keep {
+			continue
+		}
+		if e := os.RemoveAll(filepath.Join(dir, d.ID)); e != nil {
+			err = errors.Join(err, fmt.Errorf("remove %s: %w", d.ID, e))
+		}
+	}
+
+	return decisions, err
+}
+
+// DirsPlan applies the policy like Dirs, and returns the removal of the directories that are not kept as a plan of
+// recursive deletions, to be reviewed and executed later with actions.Plan.Execute.
+func DirsPlan(dir, layout string, p Policy) (*actions.Plan, []Decision, error) {
+	decisions, err := dirDecisions(dir, layout, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, nil, err
+	}
+
+	plan := new(actions.Plan)
+	for _, d := range decisions {
+		if !d.Keep {
+			plan.Add(actions.Op{Kind: actions.Delete, Src: filepath.Join(dir, d.ID), Reason: "retention", Recursive: true})
+		}
+	}
+	return plan, decisions, nil
+}
+
+// dirDecisions applies the policy to the subdirectories of dir whose names are timestamps in the layout.
+func dirDecisions(dir, layout string, p Policy) ([]Decision, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %s: %w", dir, err)
+	}
+
+	var items []Item
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		t, e := time.ParseInLocation(layout, entry.Name(), time.Local)
+		if e != nil {
+			continue
+		}
+
+		items = append(items, Item{ID: entry.Name(), Time: t})
+	}
+
+	return p.Apply(items)
+}
+
+// hasTag reports whether tags contain the provided tag.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// Package script runs Starlark scripts selecting and labeling files, so that selection logic too complex for masks
+// can be kept in configuration instead of Go code.
+//
+// A script defines either or both of the functions filter and annotate, which receive a file:
+//
+//	def filter(file):
+//	    return file.size > 0 and not file.path.startswith("tmp/")
+//
+//	def annotate(file):
+//	    if "/finance/" in file.path_abs:
+//	        return {"owner": "finance"}
+//
+// filter returns whether to keep the file; it runs before the content is read, so the fields collected from the
+// content are still empty. annotate returns the labels of the file, or None; it runs on the files of a complete scan.
+// The fields of a file are:
+//
+//	name, path, dir, path_abs, root, ext     strings, path being relative to the root
+//	size, mod_time                           ints, mod_time in seconds since the Unix epoch
+//	mode, perm                               strings, e.g. "-rw-r--r--" and "0644"
+//	hash, quick_hash, content_type           strings, empty if not collected
+//	binary, encrypted, lines                 bool, bool, int
+//	uid, gid, user, group                    int, int, string, string; -1 and "" if unknown
+//	meta                                     dict of the labels attached so far
+//
+// Scripts are sandboxed: they cannot read files or the environment, and are stopped after a bounded number of steps.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// maxSteps bounds the number of steps of a call to a script function, so a runaway loop fails instead of hanging a scan.
+const maxSteps = 1000000
+
+// Script represents a compiled script. Its methods are safe for concurrent use.
+type Script struct {
+	name     string
+	filter   starlark.Callable // Function filter of the script, nil if undefined.
+	annotate starlark.Callable // Function annotate of the script, nil if undefined.
+}
+
+// Load compiles the script in the file at path.
+func Load(path string) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load script %s: %w", path, err)
+	}
+	return Compile(path, src)
+}
+
+// Compile compiles and runs the top level of the script, whose name is used in error messages.
+// It returns an error if the script defines neither filter nor annotate.
+func Compile(name string, src []byte) (*Script, error) {
+	thread := newThread(name)
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("compile script %s: %w", name, err)
+	}
+	globals.Freeze()
+
+	s := &Script{name: name}
+	for fn, dst := range map[string]*starlark.Callable{"filter": &s.filter, "annotate": &s.annotate} {
+		v, ok := globals[fn]
+		if !ok {
+			continue
+		}
+		c, ok := v.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("compile script %s: %s is a %s, not a function", name, fn, v.Type())
+		}
+		*dst = c
+	}
+	if s.filter == nil && s.annotate == nil {
+		return nil, fmt.Errorf("compile script %s: neither filter nor annotate is defined", name)
+	}
+
+	return s, nil
+}
+
+// HasFilter reports whether the script defines filter.
+func (s *Script) HasFilter() bool {
+	return s.filter != nil
+}
+
+// HasAnnotate reports whether the script defines annotate.
+func (s *Script) HasAnnotate() bool {
+	return s.annotate != nil
+}
+
+// Filter reports whether filter keeps the file. Files are kept if the script does not define filter.
+// Its signature matches dirreader.WithFilter.
+func (s *Script) Filter(fi dirreader.FileInfo) (bool, error) {
+	if s.filter == nil {
+		return true, nil
+	}
+	v, err := s.call(s.filter, fi)
+	if err != nil {
+		return false, err
+	}
+	return bool(v.Truth()), nil
+}
+
+// Labels returns the labels annotate returns for the file, nil if the script does not define annotate.
+// Values that are not strings are converted to their Starlark representation, e.g. 3 to "3".
+func (s *Script) Labels(fi dirreader.FileInfo) (map[string]string, error) {
+	if s.annotate == nil {
+		return nil, nil
+	}
+	v, err := s.call(s.annotate, fi)
+	if err != nil || v == starlark.None {
+		return nil, err
+	}
+
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("script %s: annotate returned a %s, not a dict", s.name, v.Type())
+	}
+	labels := make(map[string]string, d.Len())
+	for _, item := range d.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("script %s: annotate returned a label key of type %s", s.name, item[0].Type())
+		}
+		if str, ok := starlark.AsString(item[1]); ok {
+			labels[k] = str
+		} else {
+			labels[k] = item[1].String()
+		}
+	}
+
+	return labels, nil
+}
+
+// call calls the function with the file on a new thread.
+func (s *Script) call(fn starlark.Callable, fi dirreader.FileInfo) (starlark.Value, error) {
+	thread := newThread(s.name)
+	thread.SetMaxExecutionSteps(maxSteps)
+	v, err := starlark.Call(thread, fn, starlark.Tuple{fileValue(fi)}, nil)
+	if err != nil {
+		var ee *starlark.EvalError
+		if errors.As(err, &ee) && len(ee.CallStack) > 0 {
+			return nil, fmt.Errorf("script %s: %s", ee.CallStack.At(0).Pos, ee.Msg)
+		}
+		return nil, fmt.Errorf("script %s: %w", s.name, err)
+	}
+	return v, nil
+}
+
+// newThread returns a thread whose print calls write to the standard error.
+func newThread(name string) *starlark.Thread {
+	return &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(os.Stderr, msg) },
+	}
+}
+
+// fileValue returns the file as a Starlark struct, see the package documentation for its fields.
+func fileValue(fi dirreader.FileInfo) starlark.Value {
+	d := starlark.StringDict{
+		"path":         starlark.String(filepath.ToSlash(fi.PathRel)),
+		"dir":          starlark.String(filepath.ToSlash(fi.PathRel)),
+		"path_abs":     starlark.String(fi.PathAbs),
+		"root":         starlark.String(fi.Root),
+		"name":         starlark.String(""),
+		"ext":          starlark.String(""),
+		"size":         starlark.MakeInt(0),
+		"mod_time":     starlark.MakeInt(0),
+		"mode":         starlark.String(""),
+		"perm":         starlark.String(""),
+		"hash":         starlark.String(fi.Hash),
+		"quick_hash":   starlark.String(fi.QuickHash),
+		"content_type": starlark.String(fi.ContentType),
+		"binary":       starlark.Bool(fi.IsBinary),
+		"encrypted":    starlark.Bool(fi.Encrypted),
+		"lines":        starlark.MakeInt64(fi.LineCount),
+		"uid":          starlark.MakeInt(-1),
+		"gid":          starlark.MakeInt(-1),
+		"user":         starlark.String(""),
+		"group":        starlark.String(""),
+	}
+
+	if fi.FileInfo != nil {
+		d["name"] = starlark.String(fi.Name())
+		d["path"] = starlark.String(filepath.ToSlash(fi.RelPath()))
+		d["ext"] = starlark.String(strings.ToLower(filepath.Ext(fi.Name())))
+		d["size"] = starlark.MakeInt64(fi.Size())
+		d["mod_time"] = starlark.MakeInt64(fi.ModTime().Unix())
+		d["mode"] = starlark.String(fi.Mode().String())
+		d["perm"] = starlark.String(fmt.Sprintf("%04o", fi.Perm()))
+	}
+	if fi.Owner != nil {
+		d["uid"] = starlark.MakeUint(uint(fi.Owner.UID))
+		d["gid"] = starlark.MakeUint(uint(fi.Owner.GID))
+		d["user"] = starlark.String(fi.Owner.User)
+		d["group"] = starlark.String(fi.Owner.Group)
+	}
+
+	meta := starlark.NewDict(len(fi.Meta))
+	for k, v := range fi.Meta {
+		_ = meta.SetKey(starlark.String(k), starlark.String(v))
+	}
+	d["meta"] = meta
+
+	return starlarkstruct.FromStringDict(starlark.String("file"), d)
+}
@@ -0,0 +1,49 @@
+package shutdown
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ExitCode is the status the process exits with on a second signal, the conventional 128 + SIGINT.
+const ExitCode = 130
+
+// Notify returns a context canceled when the process receives SIGINT or SIGTERM, so that long operations
+// given the context, such as scans with dirreader.WithContext and dirsync.Sync, stop early and save their
+// progress, e.g. the checkpoint of a scan, before returning. If a second signal is received before stop is called,
+// the process exits immediately with ExitCode, for operations that do not stop in time.
+// stop releases the signals and cancels the context; it must be called once the operations are done.
+func Notify(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-done:
+			return
+		}
+
+		select {
+		case <-sig:
+			os.Exit(ExitCode)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			cancel()
+			close(done)
+		})
+	}
+}
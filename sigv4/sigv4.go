@@ -0,0 +1,135 @@
+// Package sigv4 signs requests to S3-compatible object storages with AWS Signature Version 4.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// amzDateLayout is the time layout of the x-amz-date header.
+const amzDateLayout = "20060102T150405Z"
+
+// UnsignedPayload is the payload hash of requests whose body is streamed without being hashed first,
+// which S3 accepts over HTTPS.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Credentials holds the settings used to sign requests.
+type Credentials struct {
+	Region       string // Region used to sign requests, defaults to "us-east-1".
+	AccessKey    string // Access key ID.
+	SecretKey    string // Secret access key.
+	SessionToken string // Session token of temporary credentials (optional).
+}
+
+// EmptyPayload returns the payload hash of requests without a body.
+func EmptyPayload() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign adds the session token, if any, and the Signature Version 4 authorization to the request,
+// signing the host and all the headers set. payloadHash is the hex-encoded SHA-256 of the body, or UnsignedPayload.
+func (c Credentials) Sign(req *http.Request, payloadHash string, now time.Time) {
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	amzDate := now.UTC().Format(amzDateLayout)
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + payloadHash)
+
+	digest := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// canonicalQuery returns the query string with sorted keys and values, encoded as required by the signature.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, Escape(k)+"="+Escape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// EscapePath encodes every segment of the path as required by the signature.
+func EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Escape encodes everything but the unreserved characters of RFC 3986.
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the provided key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
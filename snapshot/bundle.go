@@ -0,0 +1,170 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gromey/octopus/codec"
+)
+
+// bundleVersion is the version of the bundle format written by Export.
+const bundleVersion = 1
+
+// Names of the entries of a bundle.
+const (
+	bundleHeader   = "bundle.json"
+	bundleSnapshot = "snapshot.json"
+)
+
+// ErrExists is returned when importing a snapshot whose ID is already used in the store.
+var ErrExists = errors.New("snapshot already exists")
+
+// bundle is the header of a bundle, describing the snapshot it carries.
+type bundle struct {
+	Version  int       `json:"version"`  // Version of the bundle format.
+	Exported time.Time `json:"exported"` // Time the bundle was written.
+	ID       string    `json:"id"`       // ID of the snapshot.
+	SHA256   string    `json:"sha256"`   // Hash of the snapshot entry, checked on import.
+}
+
+// Export writes the snapshot with the provided ID as a portable bundle, a tar archive compressed with the codec,
+// that can be transferred to another host and imported into its store with Import. A nil codec selects gzip.
+func (s *Store) Export(w io.Writer, id string, c codec.Codec) error {
+	if err := validID(id); err != nil {
+		return err
+	}
+	if c == nil {
+		c = codec.Gzip
+	}
+
+	data, err := s.read(id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("export snapshot %s: %w", id, ErrNotFound)
+		}
+		return fmt.Errorf("export snapshot %s: %w", id, err)
+	}
+
+	sum := sha256.Sum256(data)
+	hdr, err := json.Marshal(bundle{
+		Version:  bundleVersion,
+		Exported: time.Now().UTC(),
+		ID:       id,
+		SHA256:   hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return fmt.Errorf("export snapshot %s: %w", id, err)
+	}
+
+	zw, err := c.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("export snapshot %s: %w", id, err)
+	}
+	tw := tar.NewWriter(zw)
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{{bundleHeader, hdr}, {bundleSnapshot, data}} {
+		if err = tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), ModTime: time.Now()}); err != nil {
+			return fmt.Errorf("export snapshot %s: %w", id, err)
+		}
+		if _, err = tw.Write(e.data); err != nil {
+			return fmt.Errorf("export snapshot %s: %w", id, err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("export snapshot %s: %w", id, err)
+	}
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("export snapshot %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// read returns the uncompressed content of the file of the snapshot with the provided ID.
+func (s *Store) read(id string) ([]byte, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := codec.NewDetectingReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	return io.ReadAll(r)
+}
+
+// Import reads a bundle written by Export, with any codec, and saves its snapshot in the store under its original ID.
+// The content of the bundle is verified before anything is saved, and a snapshot whose ID is already used
+// in the store is refused with ErrExists.
+func (s *Store) Import(r io.Reader) (*Snapshot, error) {
+	zr, err := codec.NewDetectingReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("import bundle: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(zr)
+	for {
+		th, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("import bundle: %w", err)
+		}
+		if th.Name != bundleHeader && th.Name != bundleSnapshot {
+			continue
+		}
+		if entries[th.Name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("import bundle: %w", err)
+		}
+	}
+
+	var hdr bundle
+	if err = json.Unmarshal(entries[bundleHeader], &hdr); err != nil {
+		return nil, fmt.Errorf("import bundle: invalid header: %w", err)
+	}
+	if hdr.Version != bundleVersion {
+		return nil, fmt.Errorf("import bundle: unsupported version %d", hdr.Version)
+	}
+
+	data := entries[bundleSnapshot]
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != hdr.SHA256 {
+		return nil, fmt.Errorf("import bundle: snapshot %s is corrupted", hdr.ID)
+	}
+
+	snap, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("import bundle: %w", err)
+	}
+	if snap.ID != hdr.ID {
+		return nil, fmt.Errorf("import bundle: snapshot id %q does not match the header %q", snap.ID, hdr.ID)
+	}
+	if err = validID(snap.ID); err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Lstat(s.path(snap.ID)); err == nil {
+		return nil, fmt.Errorf("import snapshot %s: %w", snap.ID, ErrExists)
+	}
+	if err = s.Save(snap); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
@@ -0,0 +1,71 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// Event represents a change of a single path between two consecutive snapshots of a root.
+type Event struct {
+	Op       diff.Op             `json:"op"`            // Added when the path appeared, Modified when it changed, Removed when it disappeared.
+	Snapshot string              `json:"snapshot"`      // ID of the snapshot in which the change was first seen.
+	Created  time.Time           `json:"created"`       // Creation time of that snapshot.
+	Old      *dirreader.FileInfo `json:"old,omitempty"` // Version from the previous snapshot, nil for added paths.
+	New      *dirreader.FileInfo `json:"new,omitempty"` // Version from the snapshot, nil for removed paths.
+}
+
+// History returns the history of the file at the relative path across all snapshots of the provided root,
+// oldest first: when it appeared, every change of its content, with the hashes of both versions,
+// and when it disappeared. A path may appear again after it disappeared.
+// Changes are detected as in diff.Changed. Snapshots in which the path is unchanged produce no events.
+func (s *Store) History(root, path string) ([]Event, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Clean(path)
+
+	var events []Event
+	var prev *dirreader.FileInfo
+	for _, hdr := range snaps {
+		if hdr.Root != root {
+			continue
+		}
+
+		snap, err := s.Load(hdr.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		cur := find(snap.Files, path)
+		ev := Event{Snapshot: snap.ID, Created: snap.Created, Old: prev, New: cur}
+		switch {
+		case prev == nil && cur != nil:
+			ev.Op = diff.Added
+		case prev != nil && cur == nil:
+			ev.Op = diff.Removed
+		case prev != nil && cur != nil && diff.Changed(*prev, *cur):
+			ev.Op = diff.Modified
+		}
+		if ev.Op != "" {
+			events = append(events, ev)
+		}
+
+		prev = cur
+	}
+
+	return events, nil
+}
+
+// find returns the file at the relative path, or nil if there is none.
+func find(files []dirreader.FileInfo, path string) *dirreader.FileInfo {
+	for i := range files {
+		if files[i].RelPath() == path {
+			return &files[i]
+		}
+	}
+	return nil
+}
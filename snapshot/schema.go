@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SchemaVersion is the version of the snapshot format written by Save, covering the snapshot header and the
+// encoding of its files, see dirreader.FileInfo.MarshalJSON. It is increased whenever a change of the format
+// requires a Migration, so that snapshots written by older versions of octopus remain loadable and diffable.
+// Snapshots written before the format was versioned have no version and are taken as version 0.
+const SchemaVersion = 1
+
+// ErrNewerSchema is returned when loading a snapshot written with a schema newer than SchemaVersion.
+var ErrNewerSchema = errors.New("snapshot written by a newer version of octopus")
+
+// Migration upgrades a decoded snapshot of a schema version to the next one in place.
+// The snapshot is given as its top-level JSON fields, e.g. doc["files"] holds the encoded files.
+type Migration func(doc map[string]json.RawMessage) error
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = map[int]Migration{
+		// Version 1 only records the version, the layout of unversioned snapshots is unchanged.
+		0: func(map[string]json.RawMessage) error { return nil },
+	}
+)
+
+// RegisterMigration registers the migration upgrading snapshots of the version from to version from+1,
+// replacing any migration registered for the same version.
+func RegisterMigration(from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	migrations[from] = m
+}
+
+// Migrate upgrades the encoded snapshot to SchemaVersion, applying the migrations of the versions in between,
+// and returns it encoded again with its version updated. Snapshots already at SchemaVersion are returned as is.
+func Migrate(data []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var version int
+	if v, ok := doc["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("invalid schema version: %w", err)
+		}
+	}
+	switch {
+	case version == SchemaVersion:
+		return data, nil
+	case version > SchemaVersion:
+		return nil, fmt.Errorf("%w: schema version %d, supported up to %d", ErrNewerSchema, version, SchemaVersion)
+	}
+
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	for ; version < SchemaVersion; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := m(doc); err != nil {
+			return nil, fmt.Errorf("migrate from schema version %d: %w", version, err)
+		}
+	}
+
+	doc["version"] = json.RawMessage(fmt.Sprint(SchemaVersion))
+	return json.Marshal(doc)
+}
+
+// decode reads a snapshot encoded with any schema version, migrating it to SchemaVersion.
+func decode(r io.Reader) (*Snapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = Migrate(data); err != nil {
+		return nil, err
+	}
+
+	snap := new(Snapshot)
+	if err = json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
@@ -0,0 +1,345 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/codec"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// ext is the file extension of stored snapshots.
+const ext = ".json"
+
+// headExt is the file extension of the headers of stored snapshots, see Store.List.
+const headExt = ".head"
+
+// idLayout is the time layout used to generate snapshot IDs, so that IDs sort in creation order.
+const idLayout = "20060102T150405.000000000Z"
+
+// ErrNotFound is returned when a snapshot does not exist in the store.
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot represents the result of a scan persisted in a Store.
+type Snapshot struct {
+	Version int                  `json:"version"`        // Schema version the snapshot was written with, see SchemaVersion.
+	ID      string               `json:"id"`             // Unique ID of the snapshot within the store.
+	Created time.Time            `json:"created"`        // Time the snapshot was taken.
+	Root    string               `json:"root"`           // Root directory that was scanned.
+	Tags    []string             `json:"tags,omitempty"` // Arbitrary labels attached to the snapshot.
+	Files   []dirreader.FileInfo `json:"files"`          // Scanned files.
+
+	// Hash algorithm of the scan, "none" if the files were not hashed, empty if not recorded: the hashes of snapshots
+	// taken with different algorithms cannot be compared.
+	Hash string `json:"hash,omitempty"`
+	// Files of the root the scan read, nil if not recorded.
+	Filters *Filters `json:"filters,omitempty"`
+
+	// Metadata supported by the filesystem of the root and collected by the scan, nil if not recorded.
+	Capabilities *dirreader.Capabilities `json:"capabilities,omitempty"`
+}
+
+// Filters represents the files of its root a scan read, so that a snapshot is only compared with scans of the same
+// files: the files left out by other filters would otherwise be reported as added or removed.
+type Filters struct {
+	Include    []string `json:"include,omitempty"`    // Only the files with these extensions were scanned.
+	Exclude    []string `json:"exclude,omitempty"`    // The files with these extensions were not scanned.
+	SkipHidden bool     `json:"skipHidden,omitempty"` // Hidden files and directories were skipped.
+}
+
+// Equal reports whether the filters select the same files, regardless of the order of the extensions. Filters that
+// were not recorded only equal each other.
+func (f *Filters) Equal(o *Filters) bool {
+	if f == nil || o == nil {
+		return f == o
+	}
+	return f.SkipHidden == o.SkipHidden && sameSet(f.Include, o.Include) && sameSet(f.Exclude, o.Exclude)
+}
+
+// sameSet reports whether the slices hold the same strings, regardless of their order.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTag reports whether the snapshot carries the provided tag.
+func (s *Snapshot) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is a snapshot repository keeping each snapshot as a JSON file in a directory, along with a file holding its
+// header: all its fields but the files, which List reads instead of the whole snapshot.
+type Store struct {
+	dir   string
+	codec codec.Codec
+}
+
+// Open opens the snapshot store located in the provided directory, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// SetCodec sets the codec new snapshots are compressed with, none by default.
+// The files keep the .json extension so that every ID maps to a single file, and Load detects the codec
+// of each of them, so a store may hold snapshots written with different codecs.
+func (s *Store) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save persists the snapshot with the current SchemaVersion. If the snapshot has no creation time it is set
+// to the current time, and if it has no ID one is generated from the creation time.
+// The snapshot is written to a temporary file first, so a failed save never leaves a partial snapshot behind.
+func (s *Store) Save(snap *Snapshot) error {
+	if snap.Created.IsZero() {
+		snap.Created = time.Now()
+	}
+	if snap.ID == "" {
+		snap.ID = snap.Created.UTC().Format(idLayout)
+	}
+	if err := validID(snap.ID); err != nil {
+		return err
+	}
+	snap.Version = SchemaVersion
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("save snapshot %s: %w", snap.ID, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	c := s.codec
+	if c == nil {
+		c = codec.None
+	}
+	w, err := c.NewWriter(tmp)
+	if err == nil {
+		err = json.NewEncoder(w).Encode(snap)
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("save snapshot %s: %w", snap.ID, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("save snapshot %s: %w", snap.ID, err)
+	}
+
+	// The header of a snapshot replaced is removed first, so that it never describes the new one.
+	if err = os.Remove(s.headPath(snap.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("save snapshot %s: %w", snap.ID, err)
+	}
+	if err = os.Rename(tmp.Name(), s.path(snap.ID)); err != nil {
+		return fmt.Errorf("save snapshot %s: %w", snap.ID, err)
+	}
+
+	// List reads the snapshot itself when its header is missing.
+	_ = s.saveHead(snap)
+
+	return nil
+}
+
+// saveHead writes the header of the snapshot, replacing the previous one atomically.
+func (s *Store) saveHead(snap *Snapshot) error {
+	head := *snap
+	head.Files = nil
+	data, err := json.Marshal(&head)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(data)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.headPath(snap.ID))
+}
+
+// loadHead returns the header of the snapshot stored in the file of the entry, nil if it has no valid header: if it
+// is missing, written with an older schema, or older than the snapshot, which was then replaced by other means.
+func (s *Store) loadHead(id string, entry fs.DirEntry) *Snapshot {
+	info, err := entry.Info()
+	if err != nil {
+		return nil
+	}
+	path := s.headPath(id)
+	hi, err := os.Stat(path)
+	if err != nil || hi.ModTime().Before(info.ModTime()) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	head := new(Snapshot)
+	if err = json.Unmarshal(data, head); err != nil || head.Version != SchemaVersion || head.ID != id {
+		return nil
+	}
+	return head
+}
+
+// Load reads the snapshot with the provided ID, migrating it to SchemaVersion if it was written with an older schema.
+func (s *Store) Load(id string) (*Snapshot, error) {
+	if err := validID(id); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("load snapshot %s: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("load snapshot %s: %w", id, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := codec.NewDetectingReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot %s: %w", id, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	snap, err := decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot %s: %w", id, err)
+	}
+
+	return snap, nil
+}
+
+// List returns all snapshots in the store sorted by creation time, oldest first.
+// The returned snapshots contain only their headers, use Load to read their files. The headers are read from their
+// own files; the snapshots without a valid one, e.g. those saved by earlier versions, are read in full, and their
+// header is written for the next calls.
+func (s *Store) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read store %s: %w", s.dir, err)
+	}
+
+	var snaps []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ext) || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ext)
+		if head := s.loadHead(id, entry); head != nil {
+			snaps = append(snaps, *head)
+			continue
+		}
+
+		snap, err := s.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		snap.Files = nil
+		_ = s.saveHead(snap)
+
+		snaps = append(snaps, *snap)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		if !snaps[i].Created.Equal(snaps[j].Created) {
+			return snaps[i].Created.Before(snaps[j].Created)
+		}
+		return snaps[i].ID < snaps[j].ID
+	})
+
+	return snaps, nil
+}
+
+// Latest returns the most recent snapshot of the provided root.
+func (s *Store) Latest(root string) (*Snapshot, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if snaps[i].Root == root {
+			return s.Load(snaps[i].ID)
+		}
+	}
+
+	return nil, fmt.Errorf("latest snapshot of %s: %w", root, ErrNotFound)
+}
+
+// Delete removes the snapshot with the provided ID.
+func (s *Store) Delete(id string) error {
+	if err := validID(id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.path(id)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("delete snapshot %s: %w", id, ErrNotFound)
+		}
+		return fmt.Errorf("delete snapshot %s: %w", id, err)
+	}
+	if err := os.Remove(s.headPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete snapshot %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// path returns the path of the file holding the snapshot with the provided ID.
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// headPath returns the path of the file holding the header of the snapshot with the provided ID.
+func (s *Store) headPath(id string) string {
+	return filepath.Join(s.dir, id+headExt)
+}
+
+// validID checks that the ID can be safely used as a file name.
+func validID(id string) error {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid snapshot id %q", id)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltTimeout is how long OpenBolt waits for another process to close the database.
+const boltTimeout = 5 * time.Second
+
+// Buckets of a Bolt store. The roots bucket holds a bucket per root, which holds the scans by ID,
+// the files by relative path and the versions by relative path and scan ID. Its sequence numbers the scans.
+var (
+	rootsBucket    = []byte("roots")
+	scansBucket    = []byte("scans")
+	filesBucket    = []byte("files")
+	versionsBucket = []byte("hashes")
+)
+
+// boltFile is a file recorded in a Bolt store.
+type boltFile struct {
+	Info      json.RawMessage `json:"info"`      // JSON encoding of the file, see dirreader.FileInfo.
+	FirstScan int64           `json:"firstScan"` // ID of the first scan that found the file.
+	LastScan  int64           `json:"lastScan"`  // ID of the latest scan that found the file.
+}
+
+// Bolt is a Store kept in a single bbolt file, without any service or cgo. Only one process can open
+// the file at a time.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the Bolt store at path, creating it if needed. It waits a few seconds at most
+// for another process using the store to close it.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open store %s: %w", path, err)
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rootsBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open store %s: %w", path, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Save implements Store.
+func (s *Bolt) Save(ctx context.Context, root string, files []dirreader.FileInfo, created time.Time) (Scan, error) {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	scan := Scan{Root: root, Created: created, Files: len(files)}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		roots := tx.Bucket(rootsBucket)
+		seq, err := roots.NextSequence()
+		if err != nil {
+			return err
+		}
+		scan.ID = int64(seq)
+
+		b, err := roots.CreateBucketIfNotExists([]byte(root))
+		if err != nil {
+			return err
+		}
+		scans, err := b.CreateBucketIfNotExists(scansBucket)
+		if err != nil {
+			return err
+		}
+		recorded, err := b.CreateBucketIfNotExists(filesBucket)
+		if err != nil {
+			return err
+		}
+		versions, err := b.CreateBucketIfNotExists(versionsBucket)
+		if err != nil {
+			return err
+		}
+
+		if err = putJSON(scans, scanKey(scan.ID), scan); err != nil {
+			return err
+		}
+
+		for _, fi := range files {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+
+			path := filepath.ToSlash(fi.RelPath())
+			info, err := json.Marshal(fi)
+			if err != nil {
+				return fmt.Errorf("save %s: %w", path, err)
+			}
+
+			// A file not seen before, or changed since it was last seen, gets a new version.
+			rec := boltFile{Info: info, FirstScan: scan.ID, LastScan: scan.ID}
+			changed := true
+			if data := recorded.Get([]byte(path)); data != nil {
+				var prev boltFile
+				var prevInfo dirreader.FileInfo
+				if err = json.Unmarshal(data, &prev); err == nil {
+					err = json.Unmarshal(prev.Info, &prevInfo)
+				}
+				if err != nil {
+					return fmt.Errorf("load %s: %w", path, err)
+				}
+				rec.FirstScan, changed = prev.FirstScan, diff.Changed(prevInfo, fi)
+			}
+
+			if err = putJSON(recorded, []byte(path), rec); err != nil {
+				return fmt.Errorf("save %s: %w", path, err)
+			}
+			if changed {
+				v := Version{Scan: scan.ID, Created: created, Hash: fi.Hash, Size: fi.Size(), ModTime: fi.ModTime()}
+				if err = putJSON(versions, versionKey(path, scan.ID), v); err != nil {
+					return fmt.Errorf("save %s: %w", path, err)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return scan, fmt.Errorf("save scan of %s: %w", root, err)
+	}
+
+	return scan, nil
+}
+
+// Scans implements Store.
+func (s *Bolt) Scans(ctx context.Context, root string) ([]Scan, error) {
+	var scans []Scan
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, root, scansBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, data []byte) error {
+			var sc Scan
+			if err := json.Unmarshal(data, &sc); err != nil {
+				return err
+			}
+			scans = append(scans, sc)
+			return nil
+		})
+	})
+	return scans, err
+}
+
+// Files implements Store.
+func (s *Bolt) Files(ctx context.Context, root string) ([]dirreader.FileInfo, error) {
+	var files []dirreader.FileInfo
+	err := s.db.View(func(tx *bolt.Tx) error {
+		scans, recorded := bucket(tx, root, scansBucket), bucket(tx, root, filesBucket)
+		if scans == nil || recorded == nil {
+			return nil
+		}
+		last, _ := scans.Cursor().Last()
+		latest := int64(binary.BigEndian.Uint64(last))
+
+		return recorded.ForEach(func(path, data []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var rec boltFile
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return fmt.Errorf("load %s: %w", path, err)
+			}
+			if rec.LastScan != latest {
+				return nil
+			}
+			var fi dirreader.FileInfo
+			if err := json.Unmarshal(rec.Info, &fi); err != nil {
+				return fmt.Errorf("load %s: %w", path, err)
+			}
+			files = append(files, fi)
+			return nil
+		})
+	})
+	return files, err
+}
+
+// History implements Store.
+func (s *Bolt) History(ctx context.Context, root, path string) ([]Version, error) {
+	var versions []Version
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, root, versionsBucket)
+		if b == nil {
+			return nil
+		}
+		prefix := append([]byte(relPath(path)), 0)
+		c := b.Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			var v Version
+			if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			versions = append(versions, v)
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// Close implements Store.
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+// bucket returns the named bucket of the root, or nil if the root was never scanned.
+func bucket(tx *bolt.Tx, root string, name []byte) *bolt.Bucket {
+	b := tx.Bucket(rootsBucket).Bucket([]byte(root))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket(name)
+}
+
+// putJSON stores the JSON encoding of v at the key of the bucket.
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// scanKey returns the key of a scan, which sorts by ID.
+func scanKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// versionKey returns the key of a version of the file at path: the path, a NUL byte and the scan ID,
+// so that the versions of a file are adjacent and sorted by scan.
+func versionKey(path string, scan int64) []byte {
+	return append(append([]byte(path), 0), scanKey(scan)...)
+}
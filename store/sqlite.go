@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/diff"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// schema creates the tables of the store. Times are stored as nanoseconds since the Unix epoch,
+// paths relative to the root with forward slashes, and files as their JSON encoding, see dirreader.FileInfo.
+const schema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id      INTEGER PRIMARY KEY,
+	root    TEXT    NOT NULL,
+	created INTEGER NOT NULL,
+	files   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scans_root ON scans (root, id);
+CREATE TABLE IF NOT EXISTS files (
+	id         INTEGER PRIMARY KEY,
+	root       TEXT    NOT NULL,
+	path       TEXT    NOT NULL,
+	info       TEXT    NOT NULL,
+	first_scan INTEGER NOT NULL REFERENCES scans (id),
+	last_scan  INTEGER NOT NULL REFERENCES scans (id),
+	UNIQUE (root, path)
+);
+CREATE INDEX IF NOT EXISTS files_last_scan ON files (root, last_scan);
+CREATE TABLE IF NOT EXISTS hashes (
+	file     INTEGER NOT NULL REFERENCES files (id),
+	scan     INTEGER NOT NULL REFERENCES scans (id),
+	hash     TEXT    NOT NULL,
+	size     INTEGER NOT NULL,
+	mod_time INTEGER NOT NULL,
+	PRIMARY KEY (file, scan)
+);
+`
+
+// SQLite is a Store kept in an SQLite database.
+//
+// It uses database/sql and does not register a driver: the application opens the database with the SQLite
+// driver of its choice, e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3, and passes it to OpenSQLite.
+// SQLite 3.24 or newer is required.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite returns a store kept in the SQLite database, creating its tables if needed.
+func OpenSQLite(ctx context.Context, db *sql.DB) (*SQLite, error) {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("create store tables: %w", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Save implements Store.
+func (s *SQLite) Save(ctx context.Context, root string, files []dirreader.FileInfo, created time.Time) (Scan, error) {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	scan := Scan{Root: root, Created: created, Files: len(files)}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return scan, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO scans (root, created, files) VALUES (?, ?, ?)`, root, created.UnixNano(), len(files))
+	if err != nil {
+		return scan, fmt.Errorf("save scan of %s: %w", root, err)
+	}
+	if scan.ID, err = res.LastInsertId(); err != nil {
+		return scan, fmt.Errorf("save scan of %s: %w", root, err)
+	}
+
+	get, err := tx.PrepareContext(ctx, `SELECT id, info FROM files WHERE root = ? AND path = ?`)
+	if err != nil {
+		return scan, err
+	}
+	defer func() { _ = get.Close() }()
+	upsert, err := tx.PrepareContext(ctx, `INSERT INTO files (root, path, info, first_scan, last_scan) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (root, path) DO UPDATE SET info = excluded.info, last_scan = excluded.last_scan`)
+	if err != nil {
+		return scan, err
+	}
+	defer func() { _ = upsert.Close() }()
+	version, err := tx.PrepareContext(ctx, `INSERT INTO hashes (file, scan, hash, size, mod_time)
+		SELECT id, ?, ?, ?, ? FROM files WHERE root = ? AND path = ?`)
+	if err != nil {
+		return scan, err
+	}
+	defer func() { _ = version.Close() }()
+
+	for _, fi := range files {
+		path := filepath.ToSlash(fi.RelPath())
+		info, err := json.Marshal(fi)
+		if err != nil {
+			return scan, fmt.Errorf("save %s: %w", path, err)
+		}
+
+		// A file not seen before, or changed since it was last seen, gets a new version.
+		changed := true
+		var id int64
+		var prevInfo []byte
+		switch err = get.QueryRowContext(ctx, root, path).Scan(&id, &prevInfo); {
+		case err == nil:
+			var prev dirreader.FileInfo
+			if err = json.Unmarshal(prevInfo, &prev); err != nil {
+				return scan, fmt.Errorf("load %s: %w", path, err)
+			}
+			changed = diff.Changed(prev, fi)
+		case !errors.Is(err, sql.ErrNoRows):
+			return scan, fmt.Errorf("load %s: %w", path, err)
+		}
+
+		if _, err = upsert.ExecContext(ctx, root, path, string(info), scan.ID, scan.ID); err != nil {
+			return scan, fmt.Errorf("save %s: %w", path, err)
+		}
+		if changed {
+			if _, err = version.ExecContext(ctx, scan.ID, fi.Hash, fi.Size(), fi.ModTime().UnixNano(), root, path); err != nil {
+				return scan, fmt.Errorf("save %s: %w", path, err)
+			}
+		}
+	}
+
+	return scan, tx.Commit()
+}
+
+// Scans implements Store.
+func (s *SQLite) Scans(ctx context.Context, root string) ([]Scan, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, created, files FROM scans WHERE root = ? ORDER BY id`, root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var scans []Scan
+	for rows.Next() {
+		sc := Scan{Root: root}
+		var created int64
+		if err = rows.Scan(&sc.ID, &created, &sc.Files); err != nil {
+			return nil, err
+		}
+		sc.Created = time.Unix(0, created)
+		scans = append(scans, sc)
+	}
+
+	return scans, rows.Err()
+}
+
+// Files implements Store.
+func (s *SQLite) Files(ctx context.Context, root string) ([]dirreader.FileInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT info FROM files
+		WHERE root = ? AND last_scan = (SELECT MAX(id) FROM scans WHERE root = ?) ORDER BY path`, root, root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []dirreader.FileInfo
+	for rows.Next() {
+		var info []byte
+		if err = rows.Scan(&info); err != nil {
+			return nil, err
+		}
+		var fi dirreader.FileInfo
+		if err = json.Unmarshal(info, &fi); err != nil {
+			return nil, err
+		}
+		files = append(files, fi)
+	}
+
+	return files, rows.Err()
+}
+
+// History implements Store.
+func (s *SQLite) History(ctx context.Context, root, path string) ([]Version, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT h.scan, s.created, h.hash, h.size, h.mod_time
+		FROM hashes h JOIN files f ON f.id = h.file JOIN scans s ON s.id = h.scan
+		WHERE f.root = ? AND f.path = ? ORDER BY h.scan`, root, relPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		var created, modTime int64
+		if err = rows.Scan(&v.Scan, &created, &v.Hash, &v.Size, &modTime); err != nil {
+			return nil, err
+		}
+		v.Created, v.ModTime = time.Unix(0, created), time.Unix(0, modTime)
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// Close implements Store. The database is left open, as it belongs to the caller.
+func (s *SQLite) Close() error {
+	return nil
+}
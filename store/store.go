@@ -0,0 +1,74 @@
+// Package store persists scans, keeping every file of a root once with the scans it was seen in and each
+// version of its content, so that the history of a file can be queried without loading whole scans,
+// and a root can be scanned again reading only the files changed since, see Store.Files.
+//
+// Two implementations of Store are provided: SQLite, for applications already using a database, and Bolt,
+// a single file written by the process itself for environments where SQLite is too heavy.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gromey/octopus/dirreader"
+)
+
+// ErrNotFound is returned when a file has no recorded version.
+var ErrNotFound = errors.New("file not found in store")
+
+// Scan represents a scan of a root recorded in the store.
+type Scan struct {
+	ID      int64     `json:"id"`      // ID of the scan, increasing with every scan saved.
+	Root    string    `json:"root"`    // Root directory that was scanned.
+	Created time.Time `json:"created"` // Time the scan was saved.
+	Files   int       `json:"files"`   // Number of files found by the scan.
+}
+
+// Version represents a version of the content of a file, recorded by the first scan that found it.
+type Version struct {
+	Scan    int64     `json:"scan"`           // ID of the scan that found the version.
+	Created time.Time `json:"created"`        // Time of that scan.
+	Hash    string    `json:"hash,omitempty"` // Hash of the content, empty if the scan did not hash it.
+	Size    int64     `json:"size"`           // Size of the file.
+	ModTime time.Time `json:"modTime"`        // Modification time of the file.
+}
+
+// Store is a persistent scan index.
+type Store interface {
+	// Save records the files found by a scan of root at the provided time, or the current time if it is zero,
+	// atomically. Files are upserted by relative path: a file found again is updated, and a new version
+	// is recorded when its content changed since it was last seen, as in diff.Changed.
+	Save(ctx context.Context, root string, files []dirreader.FileInfo, created time.Time) (Scan, error)
+	// Scans returns the scans of root, oldest first.
+	Scans(ctx context.Context, root string) ([]Scan, error)
+	// Files returns the files found by the latest scan of root, sorted by relative path, or none if root
+	// was never scanned. Passing them to dirreader.WithPrevious scans root again reading only the files
+	// changed since.
+	Files(ctx context.Context, root string) ([]dirreader.FileInfo, error)
+	// History returns the versions of the file at the relative path under root, oldest first.
+	// A file that disappeared and appeared again unchanged has no version for its return.
+	History(ctx context.Context, root, path string) ([]Version, error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// LastChange returns the latest version of the file at the relative path under root, which tells when
+// its content last changed, or ErrNotFound if the file was never found.
+func LastChange(ctx context.Context, s Store, root, path string) (Version, error) {
+	versions, err := s.History(ctx, root, path)
+	if err != nil {
+		return Version{}, err
+	}
+	if len(versions) == 0 {
+		return Version{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	return versions[len(versions)-1], nil
+}
+
+// relPath returns the key of a path relative to the root, with forward slashes.
+func relPath(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
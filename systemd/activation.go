@@ -0,0 +1,64 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by the service manager.
+const listenFdsStart = 3
+
+// Listeners returns the listeners passed by the service manager through socket activation, keyed by the names
+// configured with FileDescriptorName= (or "unknown" when the socket unit does not set one).
+// It returns an empty map if the process was not socket-activated.
+// The environment variables are unset, so child processes do not inherit the sockets.
+func Listeners() (map[string][]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	listeners := make(map[string][]net.Listener)
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return listeners, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return listeners, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		l, err := net.FileListener(f)
+		_ = f.Close() // FileListener duplicates the descriptor.
+		if err != nil {
+			return nil, fmt.Errorf("socket activation fd %d: %w", listenFdsStart+i, err)
+		}
+
+		listeners[name] = append(listeners[name], l)
+	}
+
+	return listeners, nil
+}
+
+// Listen returns the socket-activated listener with the provided name if there is one,
+// otherwise a new listener on the provided network address, so a service works both with and without activation.
+func Listen(activated map[string][]net.Listener, name, network, address string) (net.Listener, error) {
+	if ls := activated[name]; len(ls) > 0 {
+		return ls[0], nil
+	}
+	return net.Listen(network, address)
+}
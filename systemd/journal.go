@@ -0,0 +1,212 @@
+package systemd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// journalSocket is the socket of the native journal protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// JournalEnabled reports whether the standard error of the process is connected to the journal,
+// as it is for services started by systemd with the default output settings.
+func JournalEnabled() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(stream, "%d:%d", &dev, &ino); err != nil {
+		return false
+	}
+
+	d, i, ok := stderrID()
+
+	return ok && d == dev && i == ino
+}
+
+// JournalHandler is a slog.Handler sending records to the journal using the native protocol,
+// so every attribute becomes a separate journal field that can be filtered on with journalctl,
+// e.g. "journalctl OCTOPUS_ROOT=/srv".
+//
+// Attribute keys are converted to upper case, prefixed with the handler's prefix,
+// and characters not allowed in journal field names are replaced with underscores.
+type JournalHandler struct {
+	conn   *net.UnixConn
+	opts   slog.HandlerOptions
+	prefix string
+	attrs  []slog.Attr
+	groups []string
+	mu     *sync.Mutex
+}
+
+// NewJournalHandler connects to the journal and returns a handler using the provided options,
+// which may be nil. Attribute fields are prefixed with prefix, e.g. "OCTOPUS_".
+func NewJournalHandler(prefix string, opts *slog.HandlerOptions) (*JournalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connect to journal: %w", err)
+	}
+
+	h := &JournalHandler{conn: conn, prefix: prefix, mu: new(sync.Mutex)}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	return h, nil
+}
+
+// Close closes the connection to the journal.
+func (h *JournalHandler) Close() error {
+	return h.conn.Close()
+}
+
+// Enabled implements slog.Handler.
+func (h *JournalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if h.opts.Level != nil {
+		min = h.opts.Level.Level()
+	}
+	return level >= min
+}
+
+// Handle implements slog.Handler.
+func (h *JournalHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+
+	writeField(&buf, "MESSAGE", r.Message)
+	writeField(&buf, "PRIORITY", strconv.Itoa(priority(r.Level)))
+	writeField(&buf, "SYSLOG_IDENTIFIER", filepath.Base(os.Args[0]))
+
+	if h.opts.AddSource && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := frames.Next()
+		writeField(&buf, "CODE_FILE", f.File)
+		writeField(&buf, "CODE_LINE", strconv.Itoa(f.Line))
+		writeField(&buf, "CODE_FUNC", f.Function)
+	}
+
+	for _, a := range h.attrs {
+		h.writeAttr(&buf, nil, a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.writeAttr(&buf, h.groups, a)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.conn.Write(buf.Bytes())
+
+	return err
+}
+
+// WithAttrs implements slog.Handler.
+func (h *JournalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if len(h.groups) > 0 {
+			a = slog.Group(strings.Join(h.groups, "_"), a)
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler.
+func (h *JournalHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(append([]string(nil), h.groups...), name)
+	return &h2
+}
+
+// writeAttr writes the attribute as a journal field, flattening groups into the field name.
+func (h *JournalHandler) writeAttr(buf *bytes.Buffer, groups []string, a slog.Attr) {
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+	}
+
+	v := a.Value.Resolve()
+	if a.Key == "" && v.Kind() != slog.KindGroup {
+		return
+	}
+
+	if v.Kind() == slog.KindGroup {
+		sub := groups
+		if a.Key != "" {
+			sub = append(append([]string(nil), groups...), a.Key)
+		}
+		for _, ga := range v.Group() {
+			h.writeAttr(buf, sub, ga)
+		}
+		return
+	}
+
+	key := h.prefix + strings.Join(append(append([]string(nil), groups...), a.Key), "_")
+	writeField(buf, fieldName(key), v.String())
+}
+
+// fieldName converts the key into a valid journal field name: upper-case letters, digits and underscores,
+// not starting with an underscore or a digit.
+func fieldName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+
+	name := strings.TrimLeft(string(b), "_0123456789")
+	if name == "" {
+		name = "FIELD"
+	}
+
+	return name
+}
+
+// writeField writes a field in the native journal protocol, using the binary form for multi-line values.
+func writeField(buf *bytes.Buffer, name, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// priority maps the slog level to a syslog priority.
+func priority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
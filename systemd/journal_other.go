@@ -0,0 +1,8 @@
+//go:build !unix
+
+package systemd
+
+// stderrID is not supported on this platform.
+func stderrID() (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package systemd
+
+import (
+	"os"
+	"syscall"
+)
+
+// stderrID returns the device and inode numbers of the standard error.
+func stderrID() (dev, ino uint64, ok bool) {
+	fi, err := os.Stderr.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return uint64(st.Dev), uint64(st.Ino), true
+}
@@ -0,0 +1,102 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends the state to the service manager, as sd_notify(3) does, e.g. "READY=1" or "STATUS=scanning /srv".
+// It returns false without an error if the process is not run by a service manager expecting notifications.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		addr.Name = "\x00" + socket[1:] // Abstract socket.
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Ready notifies the service manager that the service finished starting up.
+func Ready() error {
+	_, err := Notify("READY=1")
+	return err
+}
+
+// Reloading notifies the service manager that the service is reloading its configuration.
+// Ready must be called once the reload is complete.
+func Reloading() error {
+	_, err := Notify("RELOADING=1")
+	return err
+}
+
+// Stopping notifies the service manager that the service is shutting down.
+func Stopping() error {
+	_, err := Notify("STOPPING=1")
+	return err
+}
+
+// Status sends a free-form status line shown by "systemctl status".
+func Status(status string) error {
+	_, err := Notify("STATUS=" + status)
+	return err
+}
+
+// WatchdogInterval returns the interval within which the service manager expects watchdog pings,
+// and false if the watchdog is not enabled for this process.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// RunWatchdog pings the service manager's watchdog at half the expected interval until the context is done.
+// The alive function, if not nil, is consulted before each ping, so a stuck service stops pinging and gets restarted.
+// It returns immediately if the watchdog is not enabled.
+func RunWatchdog(ctx context.Context, alive func() bool) error {
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return nil
+	}
+
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if alive != nil && !alive() {
+				continue
+			}
+			if _, err := Notify("WATCHDOG=1"); err != nil {
+				return err
+			}
+		}
+	}
+}
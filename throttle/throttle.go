@@ -0,0 +1,121 @@
+// Package throttle limits the rate of reads, so that background jobs do not saturate production disks or network
+// mounts. Limits apply either to a single operation, such as the reads of a scan, or to the whole process, see SetGlobal.
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// burstDuration is the longest burst allowed by a rate limiter, as a duration of reading at the full rate.
+const burstDuration = 100 * time.Millisecond
+
+// Limiter is a token bucket limiting the number of bytes transferred per second. It is safe for concurrent use,
+// and the limit applies to all the transfers it throttles together. A nil Limiter does not limit anything.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64   // Number of bytes per second.
+	burst  float64   // Capacity of the bucket, in bytes.
+	tokens float64   // Number of bytes that can be read without waiting, negative if reads are ahead.
+	last   time.Time // Time the bucket was last refilled.
+}
+
+// New returns a limiter allowing bytesPerSecond bytes per second, or nil if it is not positive.
+func New(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	burst := rate * burstDuration.Seconds()
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait takes n tokens from the bucket and blocks until they are available, or until the context, which may be nil,
+// is done. Transfers larger than a burst are allowed, the following ones wait for the bucket to refill.
+func (l *Limiter) Wait(ctx context.Context, n int64) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if ctx == nil {
+		time.Sleep(delay)
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader returns rd throttled by the limiter, or rd itself if the limiter is nil.
+func (l *Limiter) Reader(ctx context.Context, rd io.Reader) io.Reader {
+	if l == nil {
+		return rd
+	}
+	return &limitedReader{r: rd, l: l, ctx: ctx}
+}
+
+// limitedReader is a reader throttled by a rate limiter.
+type limitedReader struct {
+	r   io.Reader
+	l   *Limiter
+	ctx context.Context
+}
+
+// Read reads at most a burst of bytes, then waits for the limiter to allow them.
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > int(lr.l.burst) {
+		p = p[:int(lr.l.burst)]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if e := lr.l.Wait(lr.ctx, int64(n)); e != nil && err == nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+var (
+	globalMu sync.RWMutex
+	global   *Limiter
+)
+
+// SetGlobal sets the limit shared by all the reads of the process, scans, hashing, syncs and verifications alike,
+// regardless of how many run concurrently. Zero or less removes the limit.
+func SetGlobal(bytesPerSecond int64) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	global = New(bytesPerSecond)
+}
+
+// Global returns the limiter set by SetGlobal, nil if there is none.
+func Global() *Limiter {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
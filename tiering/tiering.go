@@ -0,0 +1,208 @@
+package tiering
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gromey/octopus/actions"
+	"github.com/gromey/octopus/dirreader"
+)
+
+// gib is the number of bytes in a GiB.
+const gib = 1 << 30
+
+// Rule assigns the files untouched for longer than a given age to a storage tier.
+type Rule struct {
+	Tier      string        `json:"tier"`           // Name of the tier, e.g. "archive".
+	OlderThan time.Duration `json:"olderThan"`      // Minimum time since the last modification of a file to qualify for the tier.
+	Dest      string        `json:"dest,omitempty"` // Root directory of the tier, used to build the move plan.
+	CostPerGB float64       `json:"costPerGB"`      // Monthly cost of storing one GiB in the tier.
+}
+
+// Options configures the recommendations.
+type Options struct {
+	Now       time.Time // Reference time to compute ages, defaults to the current time.
+	CostPerGB float64   // Monthly cost of storing one GiB in the current tier.
+}
+
+// Candidate represents a file or a directory recommended for a tier.
+type Candidate struct {
+	Path    string    `json:"path"`    // Relative path of the file or directory.
+	PathAbs string    `json:"pathAbs"` // Absolute path of the file or directory.
+	Dir     bool      `json:"dir"`     // Whether the candidate is a directory, all of whose files qualify.
+	Files   int       `json:"files"`   // Number of files in the candidate.
+	Bytes   int64     `json:"bytes"`   // Total size of the candidate.
+	ModTime time.Time `json:"modTime"` // Latest modification time of the files in the candidate.
+}
+
+// Tier represents the recommendations for a single tier.
+type Tier struct {
+	Rule       Rule        `json:"rule"`       // Rule of the tier.
+	Candidates []Candidate `json:"candidates"` // Candidates, sorted by size in descending order.
+	Files      int         `json:"files"`      // Total number of files in the candidates.
+	Bytes      int64       `json:"bytes"`      // Total size of the candidates.
+	Savings    float64     `json:"savings"`    // Projected monthly savings of moving the candidates to the tier.
+}
+
+// Report represents the tiering recommendations for a scan.
+type Report struct {
+	Tiers   []Tier  `json:"tiers"`   // Recommendations per tier, from the coldest to the warmest.
+	Savings float64 `json:"savings"` // Total projected monthly savings.
+}
+
+// Recommend assigns each file to the coldest tier it qualifies for according to its modification time.
+// Directories whose files all qualify for the same tier are recommended as a whole instead of file by file,
+// and only the topmost such directories are reported.
+func Recommend(files []dirreader.FileInfo, rules []Rule, opts Options) *Report {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Sort the rules from the coldest to the warmest tier.
+	rules = append([]Rule(nil), rules...)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].OlderThan > rules[j].OlderThan })
+
+	tierOf := func(t time.Time) int {
+		age := now.Sub(t)
+		for i, r := range rules {
+			if age > r.OlderThan {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// Aggregate the directories: the tier of a directory is the tier of its most recently modified file.
+	type dirStat struct {
+		abs     string
+		files   int
+		bytes   int64
+		modTime time.Time
+	}
+	dirs := make(map[string]*dirStat)
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+
+		root := rootOf(fi)
+		for dir := filepath.Clean(fi.PathRel); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			d, ok := dirs[dir]
+			if !ok {
+				d = &dirStat{abs: filepath.Join(root, dir)}
+				dirs[dir] = d
+			}
+			d.files++
+			d.bytes += fi.Size()
+			if fi.ModTime().After(d.modTime) {
+				d.modTime = fi.ModTime()
+			}
+		}
+	}
+
+	// A directory is a candidate if it qualifies for a tier and its parent does not qualify for the same tier.
+	candidates := make([][]Candidate, len(rules))
+	covered := make(map[string]int) // Tier of the topmost candidate directories.
+	for dir, d := range dirs {
+		t := tierOf(d.modTime)
+		if t < 0 {
+			continue
+		}
+		if parent := filepath.Dir(dir); parent != "." {
+			if p, ok := dirs[parent]; ok && tierOf(p.modTime) == t {
+				continue
+			}
+		}
+
+		covered[dir] = t
+		candidates[t] = append(candidates[t], Candidate{
+			Path:    dir,
+			PathAbs: d.abs,
+			Dir:     true,
+			Files:   d.files,
+			Bytes:   d.bytes,
+			ModTime: d.modTime,
+		})
+	}
+
+	// The remaining files are candidates on their own.
+	for _, fi := range files {
+		if fi.FileInfo == nil || fi.IsDir() {
+			continue
+		}
+
+		t := tierOf(fi.ModTime())
+		if t < 0 || coveredBy(covered, fi.PathRel) {
+			continue
+		}
+
+		candidates[t] = append(candidates[t], Candidate{
+			Path:    fi.RelPath(),
+			PathAbs: fi.PathAbs,
+			Files:   1,
+			Bytes:   fi.Size(),
+			ModTime: fi.ModTime(),
+		})
+	}
+
+	rep := &Report{Tiers: make([]Tier, len(rules))}
+	for i, r := range rules {
+		tier := Tier{Rule: r, Candidates: candidates[i]}
+		sort.Slice(tier.Candidates, func(a, b int) bool {
+			if tier.Candidates[a].Bytes != tier.Candidates[b].Bytes {
+				return tier.Candidates[a].Bytes > tier.Candidates[b].Bytes
+			}
+			return tier.Candidates[a].Path < tier.Candidates[b].Path
+		})
+
+		for _, c := range tier.Candidates {
+			tier.Files += c.Files
+			tier.Bytes += c.Bytes
+		}
+		tier.Savings = float64(tier.Bytes) / gib * (opts.CostPerGB - r.CostPerGB)
+
+		rep.Tiers[i] = tier
+		rep.Savings += tier.Savings
+	}
+
+	return rep
+}
+
+// Plan returns a plan moving every candidate into the destination of its tier, keeping its relative path.
+// Tiers without a destination are left out of the plan.
+func (r *Report) Plan() *actions.Plan {
+	p := new(actions.Plan)
+	for _, t := range r.Tiers {
+		if t.Rule.Dest == "" {
+			continue
+		}
+		for _, c := range t.Candidates {
+			p.Add(actions.Op{
+				Kind:   actions.Move,
+				Src:    c.PathAbs,
+				Dst:    filepath.Join(t.Rule.Dest, c.Path),
+				Size:   c.Bytes,
+				Reason: "tier " + t.Rule.Tier,
+			})
+		}
+	}
+	return p
+}
+
+// coveredBy reports whether the directory or one of its ancestors is a candidate directory.
+func coveredBy(covered map[string]int, dir string) bool {
+	for dir = filepath.Clean(dir); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if _, ok := covered[dir]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rootOf returns the root directory the file was scanned from.
+func rootOf(fi dirreader.FileInfo) string {
+	return strings.TrimSuffix(strings.TrimSuffix(fi.PathAbs, fi.RelPath()), string(filepath.Separator))
+}
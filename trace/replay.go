@@ -0,0 +1,193 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// Replay is an fs.FS serving the tree recorded in a trace, see Load. The files hold zeros, and the files
+// and directories not listed in the trace do not exist. It is safe for concurrent use.
+type Replay struct {
+	dirs  map[string]*Event // Listings by directory path.
+	files map[string]Entry  // Listed files by path.
+	opens map[string]*Event // Opens by file path.
+	reads map[string]*Event // Reads by file path.
+	delay bool
+}
+
+// Load reads a trace written by a Recorder. When delay is enabled, every operation of the Replay takes
+// the time recorded for it, and the reads of a file share the time recorded for its content, so that
+// the scan takes about as long as the recorded one.
+func Load(r io.Reader, delay bool) (*Replay, error) {
+	rp := &Replay{
+		dirs:  make(map[string]*Event),
+		files: make(map[string]Entry),
+		opens: make(map[string]*Event),
+		reads: make(map[string]*Event),
+		delay: delay,
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 64<<20)
+	for n := 1; s.Scan(); n++ {
+		e := new(Event)
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch e.Op {
+		case OpReadDir:
+			rp.dirs[e.Path] = e
+			for _, entry := range e.Entries {
+				if !entry.Mode.IsDir() {
+					rp.files[path.Join(e.Path, entry.Name)] = entry
+				}
+			}
+		case OpOpen:
+			rp.opens[e.Path] = e
+		case OpRead:
+			if prev, ok := rp.reads[e.Path]; ok {
+				// A file read several times, e.g. for its quick hash and its content.
+				prev.Bytes += e.Bytes
+				prev.Reads += e.Reads
+				prev.Duration += e.Duration
+				continue
+			}
+			rp.reads[e.Path] = e
+		default:
+			return nil, fmt.Errorf("line %d: unknown operation %q", n, e.Op)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+// sleep waits for the duration if delays are enabled.
+func (rp *Replay) sleep(d time.Duration) {
+	if rp.delay && d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (rp *Replay) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, ok := rp.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: OpReadDir, Path: name, Err: fs.ErrNotExist}
+	}
+	rp.sleep(e.Duration)
+	if err := e.err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(e.Entries))
+	for i, entry := range e.Entries {
+		entries[i] = fs.FileInfoToDirEntry(recordedInfo{entry})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Open implements fs.FS. Directories can be opened for their information only.
+func (rp *Replay) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: OpOpen, Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := rp.dirs[name]; ok {
+		return &replayedDir{info: recordedInfo{Entry{Name: path.Base(name), Mode: fs.ModeDir | 0o755}}}, nil
+	}
+
+	entry, ok := rp.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: OpOpen, Path: name, Err: fs.ErrNotExist}
+	}
+	if e, ok := rp.opens[name]; ok {
+		rp.sleep(e.Duration)
+		if err := e.err(); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &replayedFile{rp: rp, info: recordedInfo{entry}, content: io.NewSectionReader(zeros{}, 0, entry.Size)}
+	if e, ok := rp.reads[name]; ok {
+		f.read = e
+	}
+	return f, nil
+}
+
+// replayedFile is a file of a Replay, holding zeros.
+type replayedFile struct {
+	rp      *Replay
+	info    fs.FileInfo
+	content *io.SectionReader
+	read    *Event // Recorded reads of the file, if any.
+}
+
+func (f *replayedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *replayedFile) Close() error               { return nil }
+
+func (f *replayedFile) Read(p []byte) (int, error) {
+	n, err := f.content.Read(p)
+	return f.replay(n, err)
+}
+
+func (f *replayedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.content.ReadAt(p, off)
+	return f.replay(n, err)
+}
+
+// replay takes the share of the recorded read time of n bytes, or returns the recorded read error, if any.
+func (f *replayedFile) replay(n int, err error) (int, error) {
+	if f.read == nil {
+		return n, err
+	}
+	if rerr := f.read.err(); rerr != nil {
+		return 0, rerr
+	}
+	if f.read.Bytes > 0 {
+		f.rp.sleep(time.Duration(int64(f.read.Duration) * int64(n) / f.read.Bytes))
+	}
+	return n, err
+}
+
+// replayedDir is a directory of a Replay, opened for its information.
+type replayedDir struct {
+	info fs.FileInfo
+}
+
+func (d *replayedDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *replayedDir) Close() error               { return nil }
+func (d *replayedDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+// zeros is an io.ReaderAt of zeros.
+type zeros struct{}
+
+func (zeros) ReadAt(p []byte, _ int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// recordedInfo is the fs.FileInfo of a recorded entry.
+type recordedInfo struct {
+	e Entry
+}
+
+func (i recordedInfo) Name() string       { return i.e.Name }
+func (i recordedInfo) Size() int64        { return i.e.Size }
+func (i recordedInfo) Mode() fs.FileMode  { return i.e.Mode }
+func (i recordedInfo) ModTime() time.Time { return i.e.ModTime }
+func (i recordedInfo) IsDir() bool        { return i.e.Mode.IsDir() }
+func (i recordedInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,228 @@
+// Package trace records the filesystem interactions of a scan to a trace file and replays them later,
+// so that performance problems and bugs seen on a tree can be reproduced without access to it.
+//
+// A Recorder is an fs.FS reading a real tree, to scan with dirreader.WithFS, which writes every directory
+// listing, open and read to the trace as a line of JSON. A Replay is an fs.FS serving the recorded tree:
+// the same directories, names, sizes, modes, modification times and errors, with zeros as the content
+// of the files, optionally taking the recorded time of every operation.
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded in a trace.
+const (
+	OpReadDir = "readdir" // A directory was listed.
+	OpOpen    = "open"    // A file was opened.
+	OpRead    = "read"    // The content of a file was read, from its opening to its closing.
+)
+
+// Error kinds recorded in a trace, so that replayed errors match fs.ErrNotExist and fs.ErrPermission.
+const (
+	errNotExist   = "not exist"
+	errPermission = "permission"
+)
+
+// Event represents a filesystem interaction recorded in a trace.
+type Event struct {
+	Op       string        `json:"op"`                // Operation, e.g. OpReadDir.
+	Path     string        `json:"path"`              // Path of the directory or file in the fs.FS.
+	Entries  []Entry       `json:"entries,omitempty"` // Entries of a listed directory.
+	Bytes    int64         `json:"bytes,omitempty"`   // Number of bytes read.
+	Reads    int           `json:"reads,omitempty"`   // Number of reads.
+	Duration time.Duration `json:"duration"`          // Time taken by the operation, or by all the reads.
+	Err      string        `json:"err,omitempty"`     // Error of the operation, if any.
+	ErrKind  string        `json:"errKind,omitempty"` // Kind of the error, to replay it: "not exist", "permission" or empty.
+}
+
+// Entry represents an entry of a listed directory.
+type Entry struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+}
+
+// newEntry returns the entry of the file info.
+func newEntry(info fs.FileInfo) Entry {
+	return Entry{Name: info.Name(), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+}
+
+// setErr records the error and its kind in the event.
+func (e *Event) setErr(err error) {
+	if err == nil {
+		return
+	}
+	e.Err = err.Error()
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		e.ErrKind = errNotExist
+	case errors.Is(err, fs.ErrPermission):
+		e.ErrKind = errPermission
+	}
+}
+
+// err returns the recorded error of the event, matching its kind, or nil.
+func (e *Event) err() error {
+	if e.Err == "" {
+		return nil
+	}
+	err := errors.New(e.Err)
+	switch e.ErrKind {
+	case errNotExist:
+		err = fs.ErrNotExist
+	case errPermission:
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: e.Op, Path: e.Path, Err: err}
+}
+
+// Recorder is an fs.FS reading another one and recording its directory listings, opens and reads to a trace.
+// It is safe for concurrent use.
+type Recorder struct {
+	fsys      fs.FS
+	anonymize bool
+	mu        sync.Mutex
+	enc       *json.Encoder
+	err       error
+}
+
+// NewRecorder returns a Recorder reading fsys, e.g. os.DirFS of the root to scan, and writing the trace to w.
+// When anonymize is enabled, the names of the directories and files are replaced by a digest in the trace,
+// keeping their extensions, so that the trace does not reveal them.
+func NewRecorder(fsys fs.FS, w io.Writer, anonymize bool) *Recorder {
+	return &Recorder{fsys: fsys, anonymize: anonymize, enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing the trace, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes the event to the trace.
+func (r *Recorder) record(e Event) {
+	if r.anonymize {
+		e.Path = anonymize(e.Path)
+		for i := range e.Entries {
+			e.Entries[i].Name = anonymize(e.Entries[i].Name)
+		}
+		if e.Err != "" {
+			e.Err = e.ErrKind
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(e)
+	}
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (r *Recorder) ReadDir(name string) ([]fs.DirEntry, error) {
+	start := time.Now()
+	entries, err := fs.ReadDir(r.fsys, name)
+	e := Event{Op: OpReadDir, Path: name}
+	for _, de := range entries {
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		e.Entries = append(e.Entries, newEntry(info))
+	}
+	e.Duration = time.Since(start)
+	e.setErr(err)
+	r.record(e)
+	return entries, err
+}
+
+// Open implements fs.FS.
+func (r *Recorder) Open(name string) (fs.File, error) {
+	start := time.Now()
+	f, err := r.fsys.Open(name)
+	e := Event{Op: OpOpen, Path: name, Duration: time.Since(start)}
+	e.setErr(err)
+	r.record(e)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedFile{File: f, r: r, read: Event{Op: OpRead, Path: name}}, nil
+}
+
+// recordedFile is a file opened by a Recorder, counting its reads until it is closed.
+type recordedFile struct {
+	fs.File
+	r    *Recorder
+	mu   sync.Mutex
+	read Event
+}
+
+// count adds a read of n bytes started at start to the read event.
+func (f *recordedFile) count(n int, start time.Time, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read.Reads++
+	f.read.Bytes += int64(n)
+	f.read.Duration += time.Since(start)
+	if err != nil && err != io.EOF && f.read.Err == "" {
+		f.read.setErr(err)
+	}
+}
+
+func (f *recordedFile) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := f.File.Read(p)
+	f.count(n, start, err)
+	return n, err
+}
+
+// ReadAt reads at an offset if the underlying file supports it.
+func (f *recordedFile) ReadAt(p []byte, off int64) (int, error) {
+	ra, ok := f.File.(io.ReaderAt)
+	if !ok {
+		return 0, errors.New("file does not support reading at an offset")
+	}
+	start := time.Now()
+	n, err := ra.ReadAt(p, off)
+	f.count(n, start, err)
+	return n, err
+}
+
+// Close records the reads of the file and closes it.
+func (f *recordedFile) Close() error {
+	f.mu.Lock()
+	read := f.read
+	f.mu.Unlock()
+	if read.Reads > 0 {
+		f.r.record(read)
+	}
+	return f.File.Close()
+}
+
+// anonymize replaces every element of the slash-separated path by a digest of it, keeping its extension.
+func anonymize(p string) string {
+	if p == "." {
+		return p
+	}
+	elems := strings.Split(p, "/")
+	for i, el := range elems {
+		sum := sha256.Sum256([]byte(el))
+		elems[i] = hex.EncodeToString(sum[:6])
+		if ext := path.Ext(el); ext != el {
+			elems[i] += ext
+		}
+	}
+	return strings.Join(elems, "/")
+}
@@ -0,0 +1,48 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// System returns a new session of the trash of the desktop, ~/.Trash. The trashed files can be restored by Undo,
+// but not by the Finder, which keeps where files come from in a private database.
+func System() (*Trash, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	t, err := Open(filepath.Join(home, ".Trash"))
+	if err != nil {
+		return nil, err
+	}
+	t.system = true
+	return t, nil
+}
+
+// reserve picks a name in the trash for the file at path, unique among the trashed files, and returns its path.
+func (t *Trash) reserve(path string) (string, error) {
+	if err := os.MkdirAll(t.files, 0o700); err != nil {
+		return "", err
+	}
+	base := filepath.Base(path)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = base + " " + strconv.Itoa(i)
+		}
+		dst := filepath.Join(t.files, name)
+		if _, err := os.Lstat(dst); errors.Is(err, os.ErrNotExist) {
+			return dst, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// infoPath returns the path of the trash information file of the trashed file: the trash has none.
+func (t *Trash) infoPath(string) string {
+	return ""
+}
@@ -0,0 +1,82 @@
+//go:build !windows && !darwin
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// System returns a new session of the trash of the desktop, the home trash of the freedesktop.org specification,
+// in $XDG_DATA_HOME/Trash or ~/.local/share/Trash. The trashed files can be restored by Undo as well as by file
+// managers. Files on other filesystems than the home directory are copied into it.
+func System() (*Trash, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	t, err := Open(filepath.Join(data, "Trash"))
+	if err != nil {
+		return nil, err
+	}
+	t.files = filepath.Join(t.dir, "files")
+	t.system = true
+	return t, nil
+}
+
+// reserve picks a name in the trash for the file at path, unique among the trashed files, and writes its trash
+// information file, which tells file managers where to restore it. It returns the path of the file in the trash.
+func (t *Trash) reserve(path string) (string, error) {
+	for _, dir := range []string{t.files, filepath.Join(t.dir, "info")} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", err
+		}
+	}
+
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: path}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	base := filepath.Base(path)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = base + "." + strconv.Itoa(i)
+		}
+		dst := filepath.Join(t.files, name)
+		f, err := os.OpenFile(t.infoPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err = os.Lstat(dst); err == nil {
+			// A file without information, left by another program.
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			continue
+		}
+		_, err = f.WriteString(info)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return "", err
+		}
+		return dst, nil
+	}
+}
+
+// infoPath returns the path of the trash information file of the trashed file.
+func (t *Trash) infoPath(trashed string) string {
+	return filepath.Join(t.dir, "info", filepath.Base(trashed)+".trashinfo")
+}
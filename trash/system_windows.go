@@ -0,0 +1,16 @@
+package trash
+
+// System returns ErrUnsupported: the Recycle Bin is only reachable through the shell of Windows.
+func System() (*Trash, error) {
+	return nil, ErrUnsupported
+}
+
+// reserve is never called, see System.
+func (t *Trash) reserve(string) (string, error) {
+	return "", ErrUnsupported
+}
+
+// infoPath is never called, see System.
+func (t *Trash) infoPath(string) string {
+	return ""
+}
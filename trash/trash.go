@@ -0,0 +1,353 @@
+// Package trash moves files aside instead of deleting them, into a trash directory or the trash of the desktop,
+// recording every move in an undo log kept in the trash, so that the files of an operation can be restored.
+//
+// The files trashed by a Trash form a session, named after the time it was opened. In a trash directory they are
+// stored under the directory of their session, by absolute path, e.g. 20260101T000000.000000000Z/srv/data/a.txt;
+// in the trash of the desktop, under a unique name along with the information desktop file managers restore them with.
+package trash
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gromey/octopus/filecopy"
+)
+
+// logName is the name of the undo log in the trash.
+const logName = ".octopus-undo.ndjson"
+
+// ErrUnsupported is returned by System on platforms whose trash is not supported.
+var ErrUnsupported = errors.New("the trash of the desktop is not supported on this platform")
+
+// ErrNoSession is returned by Undo when the trash holds no files of the session.
+var ErrNoSession = errors.New("no trashed files")
+
+// Entry represents a file moved to the trash, a line of the undo log.
+type Entry struct {
+	Session  string    `json:"session"`            // Session of the operation that trashed the file.
+	Time     time.Time `json:"time"`               // Time the file was trashed.
+	Path     string    `json:"path"`               // Absolute path the file was moved from.
+	Trashed  string    `json:"trashed"`            // Absolute path of the file in the trash.
+	Replaced bool      `json:"replaced,omitempty"` // Whether the path was given a new file, which Undo overwrites.
+	Reason   string    `json:"reason,omitempty"`   // Reason the file was trashed, e.g. "sync from /srv/data".
+}
+
+// Trash represents a session of moves to a trash, see Open and System. It is safe for concurrent use.
+type Trash struct {
+	dir     string // Directory of the trash, holding the undo log.
+	files   string // Directory the files are moved into, under their session in a trash directory.
+	system  bool   // Whether the trash is the trash of the desktop, see System.
+	session string // Name of the session.
+
+	mu  sync.Mutex
+	log *os.File // Undo log, opened by the first Put.
+}
+
+// Open returns a new session of the trash directory dir, which is created by the first Put.
+func Open(dir string) (*Trash, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Trash{dir: dir, files: dir, session: time.Now().UTC().Format("20060102T150405.000000000Z")}, nil
+}
+
+// Dir returns the directory of the trash.
+func (t *Trash) Dir() string {
+	return t.dir
+}
+
+// Session returns the name of the session.
+func (t *Trash) Session() string {
+	return t.session
+}
+
+// Put moves the file at path to the trash and returns its path in the trash. The move is recorded in the undo log
+// first, so that the files of an interrupted session can be restored as well. replaced tells that the caller puts
+// a new file at path, e.g. a link to a duplicate, which Undo then overwrites with the trashed file.
+func (t *Trash) Put(path, reason string, replaced bool) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dst string
+	_, err = os.Lstat(path)
+	if err == nil && t.system {
+		dst, err = t.reserve(path)
+	} else if err == nil {
+		dst = filepath.Join(t.files, t.session, strings.TrimPrefix(path, filepath.VolumeName(path)))
+		err = os.MkdirAll(filepath.Dir(dst), 0o700)
+	}
+	if err == nil {
+		err = t.record(Entry{Session: t.session, Time: time.Now().UTC(), Path: path, Trashed: dst, Replaced: replaced, Reason: reason})
+	}
+	if err == nil {
+		err = move(path, dst)
+	}
+	if err != nil {
+		if t.system && dst != "" {
+			_ = os.Remove(t.infoPath(dst))
+		}
+		return "", fmt.Errorf("trash %s: %w", path, err)
+	}
+	return dst, nil
+}
+
+// record appends the entry to the undo log, opening it if needed.
+func (t *Trash) record(e Entry) error {
+	if t.log == nil {
+		if err := os.MkdirAll(t.dir, 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(t.dir, logName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		t.log = f
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err = t.log.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return t.log.Sync()
+}
+
+// Close closes the undo log.
+func (t *Trash) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.log == nil {
+		return nil
+	}
+	err := t.log.Close()
+	t.log = nil
+	return err
+}
+
+// Entries returns the files in the trash recorded in the undo log, in the order they were trashed.
+func (t *Trash) Entries() ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.entries()
+}
+
+// entries reads the undo log, which may not exist yet.
+func (t *Trash) entries() ([]Entry, error) {
+	path := filepath.Join(t.dir, logName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read undo log %s: %w", path, err)
+	}
+
+	var entries []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("read undo log %s: %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("read undo log %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Undo restores the files of the session, the last one if empty, in the reverse order they were trashed, and
+// returns the restored entries, which are removed from the undo log. A file is not restored over an existing
+// file, unless the latter replaced it, see Put; the files that cannot be restored are reported in the returned
+// error and left in the trash.
+func (t *Trash) Undo(session string) ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.entries()
+	if err != nil {
+		return nil, err
+	}
+	if session == "" && len(entries) > 0 {
+		session = entries[len(entries)-1].Session
+	}
+
+	var restored []Entry
+	done := make(map[int]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Session != session {
+			continue
+		}
+		if unmoved(e) {
+			// Put failed to move the file after recording it.
+			done[i] = true
+			continue
+		}
+		if e2 := restore(e); e2 != nil {
+			err = errors.Join(err, fmt.Errorf("restore %s: %w", e.Path, e2))
+			continue
+		}
+		if t.system {
+			_ = os.Remove(t.infoPath(e.Trashed))
+		}
+		restored = append(restored, e)
+		done[i] = true
+	}
+	if len(restored) == 0 && err == nil && session == "" {
+		return nil, ErrNoSession
+	}
+	if len(restored) == 0 && err == nil {
+		return nil, fmt.Errorf("%w in session %q", ErrNoSession, session)
+	}
+
+	var kept []Entry
+	for i, e := range entries {
+		if !done[i] {
+			kept = append(kept, e)
+		}
+	}
+	if e := t.rewrite(kept); e != nil {
+		err = errors.Join(err, e)
+	}
+	if !t.system {
+		prune(filepath.Join(t.files, session))
+	}
+
+	return restored, err
+}
+
+// unmoved reports whether the file of the entry is still at its path and not in the trash.
+func unmoved(e Entry) bool {
+	_, err := os.Lstat(e.Trashed)
+	if !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	_, err = os.Lstat(e.Path)
+	return err == nil && !e.Replaced
+}
+
+// restore moves the trashed file of the entry back to its path.
+func restore(e Entry) error {
+	if _, err := os.Lstat(e.Trashed); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(e.Path); err == nil && !e.Replaced {
+		return fmt.Errorf("%s already exists", e.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0o755); err != nil {
+		return err
+	}
+	return move(e.Trashed, e.Path)
+}
+
+// rewrite replaces the undo log with the entries, through a temporary file.
+func (t *Trash) rewrite(entries []Entry) error {
+	if t.log != nil {
+		_ = t.log.Close()
+		t.log = nil
+	}
+
+	path := filepath.Join(t.dir, logName)
+	tmp, err := os.CreateTemp(t.dir, logName+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("write undo log %s: %w", path, err)
+	}
+	return nil
+}
+
+// Sessions returns the names of the sessions in the entries, from the oldest to the latest.
+func Sessions(entries []Entry) []string {
+	seen := make(map[string]bool)
+	var sessions []string
+	for _, e := range entries {
+		if !seen[e.Session] {
+			seen[e.Session] = true
+			sessions = append(sessions, e.Session)
+		}
+	}
+	sort.Strings(sessions)
+	return sessions
+}
+
+// move renames src to dst, or copies it and removes it when they are on different devices.
+func move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: cannot move a %s across devices", src, info.Mode().Type())
+	}
+	if _, err = filecopy.File(context.Background(), src, dst, filecopy.Options{}); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// prune removes the empty directories under dir, dir included.
+func prune(dir string) {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
@@ -0,0 +1,319 @@
+// Package webhook posts the changes found by the daemon to HTTP endpoints as JSON, retrying with exponential backoff,
+// so that other systems learn of drift, corruption and new files as they are detected.
+//
+// Webhooks are defined in JSON:
+//
+//	[
+//	  {"name": "siem", "url": "https://siem.example.com/hooks/octopus", "secret": "s3cr3t"},
+//	  {"name": "ops", "url": "https://ops.example.com/hook", "events": ["corruption"], "retries": 8, "backoff": "5s"}
+//	]
+//
+// A hook with a secret signs the body of its requests with HMAC-SHA256, sent in the X-Octopus-Signature header
+// as "sha256=<hex>".
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gromey/octopus/checksum"
+	"github.com/gromey/octopus/diff"
+)
+
+// defaultRetries, defaultBackoff and maxBackoff configure the retries of the hooks that do not set them.
+const (
+	defaultRetries = 5
+	defaultBackoff = time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// SignatureHeader is the header holding the signature of the body of the requests of hooks with a secret.
+const SignatureHeader = "X-Octopus-Signature"
+
+// Event represents the kind of a payload.
+type Event string
+
+const (
+	Drift      Event = "drift"      // A scan found changes since its base.
+	NewFiles   Event = "new-files"  // A scan found files that are not in its base.
+	Corruption Event = "corruption" // Files changed content without being modified, or do not match their checksum.
+)
+
+// Hook represents an endpoint the payloads are posted to.
+type Hook struct {
+	Name    string            `json:"name"`              // Name of the hook, for the logs.
+	URL     string            `json:"url"`               // Endpoint the payloads are posted to.
+	Events  []Event           `json:"events,omitempty"`  // Events posted to the hook, all if empty.
+	Header  map[string]string `json:"header,omitempty"`  // Headers of the requests, e.g. Authorization.
+	Secret  string            `json:"secret,omitempty"`  // Key of the HMAC-SHA256 signature of the bodies (optional).
+	Retries int               `json:"retries,omitempty"` // Retries of a failed delivery, 5 if 0, none if negative.
+	Backoff string            `json:"backoff,omitempty"` // Delay before the first retry, doubled on each one, "1s" if empty.
+
+	backoff time.Duration
+}
+
+// Payload is the body posted to the hooks.
+type Payload struct {
+	Event Event     `json:"event"`
+	Time  time.Time `json:"time"`           // Time the event was detected.
+	Root  string    `json:"root"`           // Absolute path of the scanned or verified directory.
+	ID    string    `json:"id,omitempty"`   // ID of the scan or the verification.
+	Base  string    `json:"base,omitempty"` // ID of the scan or snapshot the scan was compared with.
+	Files []File    `json:"files"`          // Files concerned, by path for scans, in the order of the checksum file for verifications.
+}
+
+// File represents a file of a payload.
+type File struct {
+	Path    string `json:"path"`              // Slash-separated path of the file, relative to the root.
+	Change  string `json:"change"`            // "added", "removed", "modified", "corrupted" or "missing".
+	Hash    string `json:"hash,omitempty"`    // Current hash of the file, if known.
+	OldHash string `json:"oldHash,omitempty"` // Hash of the file in the base, or in the checksum file.
+	Size    int64  `json:"size"`              // Current size of the file, 0 if removed or missing.
+}
+
+// Load reads and validates the hooks defined in the JSON file at path.
+func Load(path string) ([]Hook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load webhooks %s: %w", path, err)
+	}
+
+	var hooks []Hook
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&hooks); err != nil {
+		return nil, fmt.Errorf("load webhooks %s: %w", path, err)
+	}
+	if err = Validate(hooks); err != nil {
+		return nil, fmt.Errorf("load webhooks %s: %w", path, err)
+	}
+
+	return hooks, nil
+}
+
+// Validate checks that the hooks are named and have a URL, known events and a valid backoff.
+// It records the parsed backoffs in the hooks.
+func Validate(hooks []Hook) error {
+	for i := range hooks {
+		h := &hooks[i]
+		var err error
+		switch {
+		case h.Name == "":
+			err = errors.New("name is required")
+		case h.URL == "":
+			err = errors.New("url is required")
+		}
+		for _, e := range h.Events {
+			if e != Drift && e != NewFiles && e != Corruption {
+				err = errors.Join(err, fmt.Errorf("unknown event %q", e))
+			}
+		}
+		h.backoff = defaultBackoff
+		if h.Backoff != "" {
+			d, e := time.ParseDuration(h.Backoff)
+			if e != nil || d <= 0 {
+				err = errors.Join(err, fmt.Errorf("invalid backoff %q", h.Backoff))
+			}
+			h.backoff = d
+		}
+		if err != nil {
+			return fmt.Errorf("webhook %d (%s): %w", i, h.Name, err)
+		}
+	}
+	return nil
+}
+
+// wants reports whether the event is posted to the hook.
+func (h *Hook) wants(e Event) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, ev := range h.Events {
+		if ev == e {
+			return true
+		}
+	}
+	return false
+}
+
+// FromDiff returns the payloads of the changes found by a scan: drift with all the changes, new files with the
+// added ones, and corruption with the files whose hash changed while their size and modification time did not,
+// which programs writing to them do not do, if there are any.
+func FromDiff(root, id, base string, changes []diff.Change) []Payload {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	drift := Payload{Event: Drift, Time: now, Root: root, ID: id, Base: base}
+	added := Payload{Event: NewFiles, Time: now, Root: root, ID: id, Base: base}
+	corrupted := Payload{Event: Corruption, Time: now, Root: root, ID: id, Base: base}
+	for _, c := range changes {
+		f := File{Path: filepath.ToSlash(c.Path), Change: string(c.Op)}
+		if c.New != nil {
+			f.Hash, f.Size = c.New.Hash, c.New.Size()
+		}
+		if c.Old != nil {
+			f.OldHash = c.Old.Hash
+		}
+		drift.Files = append(drift.Files, f)
+
+		switch {
+		case c.Op == diff.Added:
+			added.Files = append(added.Files, f)
+		case c.Op == diff.Modified && c.Old.Hash != "" && c.New.Hash != "" && c.Old.Hash != c.New.Hash &&
+			c.Old.Size() == c.New.Size() && c.Old.ModTime().Equal(c.New.ModTime()):
+			f.Change = "corrupted"
+			corrupted.Files = append(corrupted.Files, f)
+		}
+	}
+
+	payloads := []Payload{drift}
+	if len(added.Files) > 0 {
+		payloads = append(payloads, added)
+	}
+	if len(corrupted.Files) > 0 {
+		payloads = append(payloads, corrupted)
+	}
+	return payloads
+}
+
+// FromVerify returns the corruption payload of the files of a verification that do not match their checksum or
+// are missing, nil if there are none.
+func FromVerify(root, id string, results []checksum.Result) *Payload {
+	p := &Payload{Event: Corruption, Time: time.Now().UTC(), Root: root, ID: id}
+	for _, r := range results {
+		switch r.Status {
+		case checksum.Failed:
+			p.Files = append(p.Files, File{Path: r.Path, Change: "corrupted", OldHash: r.Hash})
+		case checksum.Missing:
+			p.Files = append(p.Files, File{Path: r.Path, Change: "missing", OldHash: r.Hash})
+		}
+	}
+	if len(p.Files) == 0 {
+		return nil
+	}
+	return p
+}
+
+// Dispatcher posts payloads to hooks. It is safe for concurrent use.
+type Dispatcher struct {
+	Hooks  []Hook       // Hooks, validated with Validate.
+	HTTP   *http.Client // HTTP client to use, defaults to http.DefaultClient.
+	Logger *slog.Logger // Logger of the failed deliveries and the retries (optional).
+}
+
+// Send posts the payload to the hooks expecting its event, concurrently, retrying the failed deliveries,
+// and returns the errors of the hooks it could not deliver it to.
+func (d *Dispatcher) Send(ctx context.Context, p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(d.Hooks))
+	for i := range d.Hooks {
+		h := &d.Hooks[i]
+		if !h.wants(p.Event) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := d.deliver(ctx, h, body); err != nil {
+				errs[i] = fmt.Errorf("webhook %s: %w", h.Name, err)
+				if d.Logger != nil {
+					d.Logger.Error("webhook delivery failed", "webhook", h.Name, "event", p.Event, "root", p.Root, "error", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// deliver posts the body to the hook, retrying with exponential backoff on network errors, 429 and 5xx responses,
+// and waiting for the delay of their Retry-After header if it is longer.
+func (d *Dispatcher) deliver(ctx context.Context, h *Hook, body []byte) error {
+	hc := d.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	retries := h.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	backoff := h.backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range h.Header {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if h.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(h.Secret))
+			mac.Write(body)
+			req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		var retry bool
+		delay := backoff
+		resp, err := hc.Do(req)
+		if err == nil {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			_ = resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				return nil
+			}
+
+			err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+			retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+			if s, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && time.Duration(s)*time.Second > delay {
+				delay = time.Duration(s) * time.Second
+			}
+		} else {
+			retry = ctx.Err() == nil
+		}
+
+		if !retry || attempt >= retries {
+			return err
+		}
+		if d.Logger != nil {
+			d.Logger.Warn("webhook delivery failed, retrying", "webhook", h.Name, "attempt", attempt+1, "delay", delay, "error", err)
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}